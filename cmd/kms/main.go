@@ -0,0 +1,69 @@
+// KMS stand-in: it holds the key-encryption keys of the keeper servers and wraps their data keys.
+// It listens on the local address only, requests must carry the token.
+//
+// Usage:
+//
+//	kms -keys path [-address host:port]
+//
+// The token is set in KMS_TOKEN environment variable.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/kek"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+func main() {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	keysPath := flag.String("keys", os.Getenv("KMS_KEYS_PATH"), "path to the keyring file")
+	address := flag.String("address", "localhost:4444", "address to listen")
+	flag.Parse()
+
+	token := os.Getenv("KMS_TOKEN")
+	if token == "" {
+		log.Error("KMS_TOKEN is not set")
+		os.Exit(2)
+	}
+
+	provider, err := kek.NewFile(*keysPath)
+	if err != nil {
+		log.Error("error reading keyring", sl.Err(err))
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Addr:              *address,
+		Handler:           kek.NewServer(log, provider, token).Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		log.Info("kms is running", slog.String("addr", *address))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("error running kms", sl.Err(err))
+			os.Exit(1)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	sign := <-stop
+	log.Info("stopping kms", slog.String("signal", sign.String()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Error("failed stop kms", sl.Err(err))
+	}
+	log.Info("kms stopped")
+}
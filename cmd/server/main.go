@@ -1,11 +1,26 @@
+// Keeper server.
+//
+// Usage:
+//
+//	server [-config path]                     start the server
+//	server [-config path] reencrypt [-batch n] wrap data keys with the current key, encrypt old items with data keys
+//	server [-config path] reindex [-batch n]   replace identifiers of old items with blind indexes, required to start
+//	server [-config path] keys                 show references to keys, keys without references can be retired
+//	server [-config path] shred -user id       delete the data key and the items of the user
+//	server [-config path] gc [-batch n]        delete file chunks and blobs nothing references
 package main
 
 import (
+	"context"
+	"flag"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/dkrasnykh/gophkeeper/internal/server"
 	"github.com/dkrasnykh/gophkeeper/internal/server/config"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
 )
 
 func main() {
@@ -14,7 +29,119 @@ func main() {
 	cfg := config.MustLoad()
 	log.Debug("starting application", slog.Any("config", cfg))
 
-	server.Run(log, cfg)
+	switch flag.Arg(0) {
+	case "":
+		serve(log, cfg)
+	case "reencrypt":
+		reencrypt(log, cfg, flag.Args()[1:])
+	case "reindex":
+		reindex(log, cfg, flag.Args()[1:])
+	case "keys":
+		keys(log, cfg)
+	case "shred":
+		shred(log, cfg, flag.Args()[1:])
+	case "gc":
+		gc(log, cfg, flag.Args()[1:])
+	default:
+		log.Error("unknown command", slog.String("command", flag.Arg(0)))
+		os.Exit(2)
+	}
+}
+
+func serve(log *slog.Logger, cfg *config.Config) {
+	app, err := server.New(log, cfg)
+	if err != nil {
+		log.Error(
+			"error creating application service",
+			sl.Err(err),
+		)
+		return
+	}
+	go app.MustRun()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	sign := <-stop
+	log.Info("stopping application", slog.String("signal", sign.String()))
+	app.Stop()
+	log.Info("application stopped")
+}
+
+func reencrypt(log *slog.Logger, cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "number of items re-encrypted in one batch")
+	_ = flags.Parse(args)
+
+	// items re-encrypted before the signal stay re-encrypted, the next run continues with the rest
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if err := server.Reencrypt(ctx, log, cfg, *batch); err != nil {
+		log.Error("error re-encrypting items", sl.Err(err))
+		stop()
+		os.Exit(1)
+	}
+}
+
+func reindex(log *slog.Logger, cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "number of items reindexed in one batch")
+	_ = flags.Parse(args)
+
+	// items reindexed before the signal stay reindexed, the next run continues with the rest
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if err := server.Reindex(ctx, log, cfg, *batch); err != nil {
+		log.Error("error reindexing items", sl.Err(err))
+		stop()
+		os.Exit(1)
+	}
+}
+
+func keys(log *slog.Logger, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.QueryTimeout)
+	defer cancel()
+
+	if err := server.Keys(ctx, log, cfg, os.Stdout); err != nil {
+		log.Error("error collecting key usage", sl.Err(err))
+		cancel()
+		os.Exit(1)
+	}
+}
+
+func shred(log *slog.Logger, cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("shred", flag.ExitOnError)
+	userID := flags.Int64("user", 0, "ID of the user whose data is deleted")
+	_ = flags.Parse(args)
+	if *userID <= 0 {
+		log.Error("user ID is required")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.QueryTimeout)
+	defer cancel()
+
+	if err := server.Shred(ctx, log, cfg, *userID); err != nil {
+		log.Error("error shredding user data", sl.Err(err))
+		cancel()
+		os.Exit(1)
+	}
+}
+
+func gc(log *slog.Logger, cfg *config.Config, args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "number of chunks or blobs collected in one batch")
+	_ = flags.Parse(args)
+
+	// chunks and blobs deleted before the signal stay deleted, the next run continues with the rest
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
-	// TODO gracefull shutdown
+	if err := server.CollectGarbage(ctx, log, cfg, *batch); err != nil {
+		log.Error("error collecting garbage", sl.Err(err))
+		stop()
+		os.Exit(1)
+	}
 }
@@ -5,7 +5,8 @@ cli module provides user UI commands.
 The selection commands include package models:
 
 	view_auth model prompts to select an action from the list {"Login", "Register"}.
-	view_command_list model prompts to select an action from the list {"Get all secrets", "Add credentials", "Add text data", "Add binary data", "Add card data"}
+	view_command_list model prompts to select an action from the list {"Get all secrets", "Add credentials", "Add text data", "Add binary data", "Add card data", "Save file", "Edit secret", "Search secrets", "Filter secrets", "Add folder", "Tags", "Rename tag", "Delete secret", "Show history", "Vault at date", "Resolve conflicts"}
+	view_command_list model shows the connection state and the number of changes waiting to be sent to the server above the list.
 
 # Register
 
@@ -13,26 +14,69 @@ The selection commands include package models:
 
 # Login
 
-	view_login model provides form for indicate login, password. It includes widget for data submission.
+	view_login model provides form for indicate login, password, master password. It includes widget for data submission.
+	Master password is not sent anywhere: the vault key is derived from it, items are encrypted with the key on the client.
 
 # Get all secrets
 
-	view_list model uses for show all private user data.
+	view_list model uses for show all private user data, values of hidden and otp custom fields are masked.
+	The secret put into a folder is prefixed with the folder path.
+	Changes not confirmed by the server yet are listed at the end, rejected changes are shown with the reason.
 
-# Add credentials
+# Add credentials, Add text data, Add binary data, Add card data
 
-	view_add_credentials model provides form for indicate tag, login, password, comment. It includes widget for data submission.
+	view_item_form model provides form for indicate the fields of the item type declared by the item schema (models.Schemas):
+	tags, login, password, comment for credentials; tags, key, value, comment for text data; tags, file path, comment for binary data;
+	tags, number, exp, cvv, comment for card data. Secret fields are typed without echo. It includes widget for data submission.
+	Tags are comma separated. The folder path (Work/Banks) follows the tags, missing folders are created, empty path is the top level.
+	Custom fields (name, type, value) follow the fields of the item type: text, hidden, url, date (YYYY-MM-DD) or otp (base32 secret).
+	The empty custom field is always the last one, custom field with empty name and value is removed.
 
-# Add text data
+# Edit secret
 
-	view_add_text model provides form for indicate tag, key, value, comment. It includes widget for data submission.
+	view_select model prompts to select a secret, view_item_form model provides form for edit its fields and custom fields.
 
-# Add binary data
+# Search secrets
 
-	view_add_binary model provides form for indicate tag, key, value, comment. It includes widget for data submission.
+	view_search model provides form for indicate the text, view_list model shows secrets containing it in a field value
+	or in a custom field name. Values of hidden and otp custom fields are masked and not searched.
 
-# Add card data
+# Filter secrets
 
-	view_add_card model provides form for indicate tag, number, exp, cvv, comment. It includes widget for data submission.
+	view_item_form model provides form for indicate the tag and the folder path, view_list model shows secrets labeled with the tag
+	and put into the folder or into its subfolders. Empty tag or path does not filter secrets.
+
+# Add folder
+
+	view_item_form model provides form for indicate the folder path, missing folders of the path are created.
+	Folders are synced with other clients like secrets.
+
+# Tags
+
+	view_list model shows tags of all secrets with the number of secrets labeled with each tag.
+
+# Rename tag
+
+	view_item_form model provides form for indicate the tag and the new one, the tag is replaced in all secrets.
+	The tag is removed from secrets if the new one is empty.
+
+# Delete secret
+
+	view_delete model prompts to select a secret from the list of all private user data. The selected secret is deleted on every client.
+
+# Show history
+
+	view_select model prompts to select a secret, view_history model shows versions of the secret kept by the server.
+	The selected version may be restored as the current one.
+
+# Vault at date
+
+	view_time_travel model provides form for indicate date and optional export file path.
+	view_list model shows the vault as it was at the given date (read-only); it is written to the export file as JSON if the path is set.
+
+# Resolve conflicts
+
+	view_conflicts model shows versions rejected by the server because the item was changed on another client meanwhile.
+	User keeps current or incoming version of the selected item.
 */
 package cli
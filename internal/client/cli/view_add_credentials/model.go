@@ -1,154 +0,0 @@
-package viewaddcredentials
-
-import (
-	"fmt"
-	"strings"
-
-	"github.com/charmbracelet/bubbles/cursor"
-	"github.com/charmbracelet/bubbles/textinput"
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
-)
-
-var (
-	focusedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-	blurredStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
-	cursorStyle  = focusedStyle.Copy()
-	noStyle      = lipgloss.NewStyle()
-
-	focusedButton = focusedStyle.Copy().Render("[ Submit ]")
-	blurredButton = fmt.Sprintf("[ %s ]", blurredStyle.Render("Submit"))
-)
-
-type Model struct {
-	FocusIndex int
-	Inputs     []textinput.Model
-	cursorMode cursor.Mode
-	State      string
-}
-
-func InitialModel() Model {
-	m := Model{
-		Inputs: make([]textinput.Model, 4),
-	}
-	var t textinput.Model
-	for i := range m.Inputs {
-		t = textinput.New()
-		t.Cursor.Style = cursorStyle
-		t.CharLimit = 32
-
-		switch i {
-		case 0:
-			t.Placeholder = "Tag"
-			t.Focus()
-			t.PromptStyle = focusedStyle
-			t.TextStyle = focusedStyle
-		case 1:
-			t.Placeholder = "Login"
-		case 2:
-			t.Placeholder = "Password"
-			t.EchoMode = textinput.EchoPassword
-			t.EchoCharacter = '•'
-		case 3:
-			t.Placeholder = "Comment"
-		}
-
-		m.Inputs[i] = t
-	}
-
-	return m
-}
-
-func (m Model) Init() tea.Cmd {
-	return textinput.Blink
-}
-
-func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "esc":
-			m.State = "quit"
-			return m, tea.Quit
-
-		case "ctrl+r":
-			m.cursorMode++
-			if m.cursorMode > cursor.CursorHide {
-				m.cursorMode = cursor.CursorBlink
-			}
-			cmds := make([]tea.Cmd, len(m.Inputs))
-			for i := range m.Inputs {
-				cmds[i] = m.Inputs[i].Cursor.SetMode(m.cursorMode)
-			}
-			return m, tea.Batch(cmds...)
-
-		case "tab", "shift+tab", "enter", "up", "down":
-			s := msg.String()
-
-			if s == "enter" && m.FocusIndex == len(m.Inputs) {
-				return m, tea.Quit
-			}
-
-			if s == "up" || s == "shift+tab" {
-				m.FocusIndex--
-			} else {
-				m.FocusIndex++
-			}
-
-			if m.FocusIndex > len(m.Inputs) {
-				m.FocusIndex = 0
-			} else if m.FocusIndex < 0 {
-				m.FocusIndex = len(m.Inputs)
-			}
-
-			cmds := make([]tea.Cmd, len(m.Inputs))
-			for i := 0; i <= len(m.Inputs)-1; i++ {
-				if i == m.FocusIndex {
-					cmds[i] = m.Inputs[i].Focus()
-					m.Inputs[i].PromptStyle = focusedStyle
-					m.Inputs[i].TextStyle = focusedStyle
-					continue
-				}
-				m.Inputs[i].Blur()
-				m.Inputs[i].PromptStyle = noStyle
-				m.Inputs[i].TextStyle = noStyle
-			}
-
-			return m, tea.Batch(cmds...)
-		}
-	}
-
-	cmd := m.updateInputs(msg)
-
-	return m, cmd
-}
-
-func (m *Model) updateInputs(msg tea.Msg) tea.Cmd {
-	cmds := make([]tea.Cmd, len(m.Inputs))
-
-	for i := range m.Inputs {
-		m.Inputs[i], cmds[i] = m.Inputs[i].Update(msg)
-	}
-
-	return tea.Batch(cmds...)
-}
-
-func (m Model) View() string {
-	var b strings.Builder
-	b.WriteString("login:\n\n")
-
-	for i := range m.Inputs {
-		b.WriteString(m.Inputs[i].View())
-		if i < len(m.Inputs)-1 {
-			b.WriteRune('\n')
-		}
-	}
-
-	button := &blurredButton
-	if m.FocusIndex == len(m.Inputs) {
-		button = &focusedButton
-	}
-	fmt.Fprintf(&b, "\n\n%s\n\n", *button)
-
-	return b.String()
-}
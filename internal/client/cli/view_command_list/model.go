@@ -1,23 +1,43 @@
 package view_command_list
 
 import (
-	tea "github.com/charmbracelet/bubbletea"
 	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
 )
 
-var choices = []string{"Get all secrets", "Add credentials", "Add text data", "Add binary data", "Add card data"}
+var choices = []string{"Get all secrets", "Add credentials", "Add text data", "Add binary data", "Add card data", "Save file", "Edit secret", "Search secrets", "Filter secrets", "Add folder", "Tags", "Rename tag", "Delete secret", "Show history", "Vault at date", "Resolve conflicts"}
 
 type Model struct {
 	cursor int
 	Choice string
+	// Status is shown above the list of commands, it is refreshed every second
+	Status func() string
+	// Error of the last command is shown under the status
+	Error string
+}
+
+type tickMsg struct{}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return tickMsg{}
+	})
 }
 
 func (m Model) Init() tea.Cmd {
-	return nil
+	if m.Status == nil {
+		return nil
+	}
+	return tick()
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tickMsg:
+		return m, tick()
+
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q", "esc":
@@ -47,6 +67,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m Model) View() string {
 	s := strings.Builder{}
 
+	if m.Status != nil {
+		s.WriteString(m.Status())
+		s.WriteString("\n\n")
+	}
+	if m.Error != "" {
+		s.WriteString("error: ")
+		s.WriteString(m.Error)
+		s.WriteString("\n\n")
+	}
+
 	for i := 0; i < len(choices); i++ {
 		if m.cursor == i {
 			s.WriteString("(•) ")
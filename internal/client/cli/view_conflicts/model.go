@@ -0,0 +1,85 @@
+package viewconflicts
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Conflict is a pair of item versions shown to the user.
+type Conflict struct {
+	Current  string
+	Incoming string
+}
+
+type Model struct {
+	cursor       int
+	Items        []Conflict
+	Choice       int
+	Selected     bool
+	KeepIncoming bool
+}
+
+func InitialModel(items []Conflict) Model {
+	return Model{Items: items}
+}
+
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+
+		case "c", "i":
+			if len(m.Items) > 0 {
+				m.Choice = m.cursor
+				m.Selected = true
+				m.KeepIncoming = msg.String() == "i"
+			}
+			return m, tea.Quit
+
+		case "down", "j":
+			m.cursor++
+			if m.cursor >= len(m.Items) {
+				m.cursor = 0
+			}
+
+		case "up", "k":
+			m.cursor--
+			if m.cursor < 0 {
+				m.cursor = len(m.Items) - 1
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m Model) View() string {
+	s := strings.Builder{}
+	s.WriteString("conflicting changes:\n\n")
+
+	if len(m.Items) == 0 {
+		s.WriteString("there are no conflicts\n")
+	}
+	for i := 0; i < len(m.Items); i++ {
+		if m.cursor == i {
+			s.WriteString("(•) ")
+		} else {
+			s.WriteString("( ) ")
+		}
+		s.WriteString("current:  ")
+		s.WriteString(m.Items[i].Current)
+		s.WriteString("\n    incoming: ")
+		s.WriteString(m.Items[i].Incoming)
+		s.WriteString("\n")
+	}
+	s.WriteString("\n(press c to keep current, i to keep incoming, q to go back)\n")
+
+	return s.String()
+}
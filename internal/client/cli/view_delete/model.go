@@ -0,0 +1,74 @@
+package viewdelete
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type Model struct {
+	cursor   int
+	Items    []string
+	Choice   int
+	Selected bool
+}
+
+func InitialModel(items []string) Model {
+	return Model{Items: items}
+}
+
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+
+		case "enter":
+			if len(m.Items) > 0 {
+				m.Choice = m.cursor
+				m.Selected = true
+			}
+			return m, tea.Quit
+
+		case "down", "j":
+			m.cursor++
+			if m.cursor >= len(m.Items) {
+				m.cursor = 0
+			}
+
+		case "up", "k":
+			m.cursor--
+			if m.cursor < 0 {
+				m.cursor = len(m.Items) - 1
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m Model) View() string {
+	s := strings.Builder{}
+	s.WriteString("select secret to delete:\n\n")
+
+	if len(m.Items) == 0 {
+		s.WriteString("secrets list is empty\n")
+	}
+	for i := 0; i < len(m.Items); i++ {
+		if m.cursor == i {
+			s.WriteString("(•) ")
+		} else {
+			s.WriteString("( ) ")
+		}
+		s.WriteString(m.Items[i])
+		s.WriteString("\n")
+	}
+	s.WriteString("\n(press enter to delete, q to go back)\n")
+
+	return s.String()
+}
@@ -0,0 +1,85 @@
+package viewhistory
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Version is a past version of the item shown to the user.
+type Version struct {
+	Created string
+	Value   string
+}
+
+type Model struct {
+	cursor   int
+	Versions []Version
+	Choice   int
+	Restore  bool
+}
+
+func InitialModel(versions []Version) Model {
+	return Model{Versions: versions}
+}
+
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+
+		case "r":
+			if len(m.Versions) > 0 {
+				m.Choice = m.cursor
+				m.Restore = true
+			}
+			return m, tea.Quit
+
+		case "down", "j":
+			m.cursor++
+			if m.cursor >= len(m.Versions) {
+				m.cursor = 0
+			}
+
+		case "up", "k":
+			m.cursor--
+			if m.cursor < 0 {
+				m.cursor = len(m.Versions) - 1
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m Model) View() string {
+	s := strings.Builder{}
+	s.WriteString("item versions:\n\n")
+
+	if len(m.Versions) == 0 {
+		s.WriteString("history is empty\n")
+	}
+	for i := 0; i < len(m.Versions); i++ {
+		if m.cursor == i {
+			s.WriteString("(•) ")
+		} else {
+			s.WriteString("( ) ")
+		}
+		s.WriteString(m.Versions[i].Created)
+		s.WriteString("\n")
+	}
+	if len(m.Versions) > 0 {
+		s.WriteString("\n")
+		s.WriteString(m.Versions[m.cursor].Value)
+		s.WriteString("\n")
+	}
+	s.WriteString("\n(press r to restore selected version, q to go back)\n")
+
+	return s.String()
+}
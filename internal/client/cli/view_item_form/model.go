@@ -0,0 +1,240 @@
+package viewitemform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	focusedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	blurredStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	cursorStyle  = focusedStyle.Copy()
+	noStyle      = lipgloss.NewStyle()
+
+	focusedButton = focusedStyle.Copy().Render("[ Submit ]")
+	blurredButton = fmt.Sprintf("[ %s ]", blurredStyle.Render("Submit"))
+)
+
+// customInputs is the number of inputs of the custom field: name, type and value.
+const customInputs = 3
+
+// Model is the form of the item fields, it is used to add and edit items of any type.
+// The fields of the item type are followed by custom fields, every custom field is typed in three inputs:
+// name, type and value. The empty custom field is always the last one, it is filled to add a new field.
+// Custom field with empty name and value is removed.
+type Model struct {
+	FocusIndex int
+	Title      string
+	Fields     []models.Field
+	Inputs     []textinput.Model
+	cursorMode cursor.Mode
+	State      string
+	// custom is false for the form without custom fields
+	custom bool
+}
+
+// InitialModel returns the form of the fields filled with values (by field name) and custom fields,
+// values of the new item are empty. Sensitive fields and values of secret custom fields are typed without echo.
+func InitialModel(title string, fields []models.Field, values map[string]string, custom []models.CustomField) Model {
+	m := InitialFieldsModel(title, fields, values)
+	m.custom = true
+	for _, field := range custom {
+		m.addCustomField(field)
+	}
+	m.addCustomField(models.CustomField{})
+	m.maskSecrets()
+
+	return m
+}
+
+// InitialFieldsModel returns the form of the fields filled with values (by field name) without custom fields,
+// it is used for command parameters.
+func InitialFieldsModel(title string, fields []models.Field, values map[string]string) Model {
+	m := Model{
+		Title:  title,
+		Fields: fields,
+		Inputs: make([]textinput.Model, 0, len(fields)),
+	}
+	for _, field := range fields {
+		t := newInput(field.Label, values[field.Name])
+		if field.Sensitive {
+			t.EchoMode = textinput.EchoPassword
+			t.EchoCharacter = '•'
+		}
+		m.Inputs = append(m.Inputs, t)
+	}
+
+	m.Inputs[0].Focus()
+	m.Inputs[0].PromptStyle = focusedStyle
+	m.Inputs[0].TextStyle = focusedStyle
+
+	return m
+}
+
+func newInput(placeholder string, value string) textinput.Model {
+	t := textinput.New()
+	t.Cursor.Style = cursorStyle
+	t.CharLimit = 256
+	t.Placeholder = placeholder
+	t.SetValue(value)
+	return t
+}
+
+// addCustomField adds inputs of the custom field.
+func (m *Model) addCustomField(field models.CustomField) {
+	m.Inputs = append(m.Inputs,
+		newInput("Field name", field.Name),
+		newInput("Field type (text, hidden, url, date, otp)", string(field.Type)),
+		newInput("Field value", field.Value),
+	)
+}
+
+// maskSecrets hides values of hidden and OTP secret custom fields as their type is typed in.
+func (m *Model) maskSecrets() {
+	for i := len(m.Fields); i+customInputs <= len(m.Inputs); i += customInputs {
+		field := models.CustomField{Type: models.CustomFieldType(m.Inputs[i+1].Value())}
+		if field.Secret() {
+			m.Inputs[i+2].EchoMode = textinput.EchoPassword
+			m.Inputs[i+2].EchoCharacter = '•'
+		} else {
+			m.Inputs[i+2].EchoMode = textinput.EchoNormal
+		}
+	}
+}
+
+// Values returns the typed values by field name.
+func (m Model) Values() map[string]string {
+	values := make(map[string]string, len(m.Fields))
+	for i, field := range m.Fields {
+		values[field.Name] = m.Inputs[i].Value()
+	}
+	return values
+}
+
+// CustomFields returns the typed custom fields, the field without type is a text field.
+func (m Model) CustomFields() []models.CustomField {
+	var fields []models.CustomField
+	for i := len(m.Fields); i+customInputs <= len(m.Inputs); i += customInputs {
+		field := models.CustomField{
+			Name:  strings.TrimSpace(m.Inputs[i].Value()),
+			Type:  models.CustomFieldType(strings.TrimSpace(m.Inputs[i+1].Value())),
+			Value: m.Inputs[i+2].Value(),
+		}
+		if field.Name == "" && field.Value == "" {
+			continue
+		}
+		if field.Type == "" {
+			field.Type = models.TextCustomField
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func (m Model) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			m.State = "quit"
+			return m, tea.Quit
+
+		case "ctrl+r":
+			m.cursorMode++
+			if m.cursorMode > cursor.CursorHide {
+				m.cursorMode = cursor.CursorBlink
+			}
+			cmds := make([]tea.Cmd, len(m.Inputs))
+			for i := range m.Inputs {
+				cmds[i] = m.Inputs[i].Cursor.SetMode(m.cursorMode)
+			}
+			return m, tea.Batch(cmds...)
+
+		case "tab", "shift+tab", "enter", "up", "down":
+			s := msg.String()
+
+			if s == "enter" && m.FocusIndex == len(m.Inputs) {
+				return m, tea.Quit
+			}
+
+			if s == "up" || s == "shift+tab" {
+				m.FocusIndex--
+			} else {
+				m.FocusIndex++
+			}
+
+			if m.FocusIndex > len(m.Inputs) {
+				m.FocusIndex = 0
+			} else if m.FocusIndex < 0 {
+				m.FocusIndex = len(m.Inputs)
+			}
+
+			cmds := make([]tea.Cmd, len(m.Inputs))
+			for i := 0; i <= len(m.Inputs)-1; i++ {
+				if i == m.FocusIndex {
+					cmds[i] = m.Inputs[i].Focus()
+					m.Inputs[i].PromptStyle = focusedStyle
+					m.Inputs[i].TextStyle = focusedStyle
+					continue
+				}
+				m.Inputs[i].Blur()
+				m.Inputs[i].PromptStyle = noStyle
+				m.Inputs[i].TextStyle = noStyle
+			}
+
+			return m, tea.Batch(cmds...)
+		}
+	}
+
+	cmd := m.updateInputs(msg)
+	m.maskSecrets()
+	if m.custom && m.Inputs[len(m.Inputs)-customInputs].Value() != "" {
+		m.addCustomField(models.CustomField{})
+	}
+
+	return m, cmd
+}
+
+func (m *Model) updateInputs(msg tea.Msg) tea.Cmd {
+	cmds := make([]tea.Cmd, len(m.Inputs))
+
+	for i := range m.Inputs {
+		m.Inputs[i], cmds[i] = m.Inputs[i].Update(msg)
+	}
+
+	return tea.Batch(cmds...)
+}
+
+func (m Model) View() string {
+	var b strings.Builder
+	b.WriteString(m.Title + ":\n\n")
+
+	for i := range m.Inputs {
+		if i == len(m.Fields) {
+			b.WriteString("\ncustom fields:\n")
+		}
+		b.WriteString(m.Inputs[i].View())
+		if i < len(m.Inputs)-1 {
+			b.WriteRune('\n')
+		}
+	}
+
+	button := &blurredButton
+	if m.FocusIndex == len(m.Inputs) {
+		button = &focusedButton
+	}
+	fmt.Fprintf(&b, "\n\n%s\n\n", *button)
+
+	return b.String()
+}
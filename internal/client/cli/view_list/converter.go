@@ -1,35 +1,31 @@
 package viewlist
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
 )
 
-func Convert(creds []models.Credentials, texts []models.Text, bins []models.Binary, cards []models.Card) []string {
-	viewList := make([]string, 0, len(creds)+len(texts)+len(bins)+len(cards)+4)
-	if len(creds) > 0 {
-		viewList = append(viewList, "Credentials:")
-		for _, c := range creds {
-			viewList = append(viewList, fmt.Sprintf(`tag=%s; login=%s; password=%s; comment=%s.`, c.Tag, c.Login, c.Password, c.Comment))
-		}
-	}
-	if len(texts) > 0 {
-		viewList = append(viewList, "Text data:")
-		for _, t := range texts {
-			viewList = append(viewList, fmt.Sprintf(`tag=%s; key=%s; value=%s; comment=%s.`, t.Tag, t.Key, t.Value, t.Comment))
-		}
+// Convert formats items encoded into JSON grouped by type in the order of the schema registry, folders are not items.
+// The item put into a folder is prefixed with the folder path (paths by folder ID).
+func Convert(values [][]byte, paths map[string]string) []string {
+	byType := make(map[models.ItemType][][]byte)
+	for _, value := range values {
+		kind := itemType(value)
+		byType[kind] = append(byType[kind], value)
 	}
-	if len(bins) > 0 {
-		viewList = append(viewList, "Binary data:")
-		for _, b := range bins {
-			viewList = append(viewList, fmt.Sprintf(`tag=%s; key=%s; comment=%s.`, b.Tag, b.Key, b.Comment))
+
+	viewList := make([]string, 0, len(values)+len(byType))
+	for _, schema := range models.Schemas() {
+		items := byType[schema.Type]
+		if schema.Type == models.FolderItem || len(items) == 0 {
+			continue
 		}
-	}
-	if len(cards) > 0 {
-		viewList = append(viewList, "Card data:")
-		for _, c := range cards {
-			viewList = append(viewList, fmt.Sprintf(`tag=%s; number=%s; exp=%s; cvv=%d; comment=%s`, c.Tag, c.Number, c.Exp, c.CVV, c.Comment))
+		viewList = append(viewList, strings.ToUpper(schema.Title[:1])+schema.Title[1:]+":")
+		for _, value := range items {
+			viewList = append(viewList, folderPrefix(value, paths)+schema.Format(value))
 		}
 	}
 	if len(viewList) == 0 {
@@ -37,3 +33,59 @@ func Convert(creds []models.Credentials, texts []models.Text, bins []models.Bina
 	}
 	return viewList
 }
+
+// ConvertPending formats local changes not confirmed by the server, rejected changes are shown with the reason.
+func ConvertPending(changes []models.PendingChange) []string {
+	if len(changes) == 0 {
+		return nil
+	}
+	viewList := make([]string, 0, len(changes)+1)
+	viewList = append(viewList, "Not confirmed by server:")
+	for _, c := range changes {
+		action := "saving"
+		if c.Deleted {
+			action = "deleting"
+		}
+		if c.Code != "" {
+			viewList = append(viewList, fmt.Sprintf("%s failed (%s): %s", action, c.Error, ConvertValue(c.Value)))
+			continue
+		}
+		viewList = append(viewList, fmt.Sprintf("%s pending: %s", action, ConvertValue(c.Value)))
+	}
+	return viewList
+}
+
+// ConvertValue formats single item encoded into JSON (message value).
+func ConvertValue(value []byte) string {
+	schema, ok := models.Lookup(itemType(value))
+	if !ok {
+		return "unknown item"
+	}
+	return schema.Title + ": " + schema.Format(value)
+}
+
+// ConvertFound formats items encoded into JSON like ConvertValue, the item put into a folder is prefixed with the folder path.
+func ConvertFound(value []byte, paths map[string]string) string {
+	return folderPrefix(value, paths) + ConvertValue(value)
+}
+
+// itemType returns the type of the item encoded into JSON.
+func itemType(value []byte) models.ItemType {
+	var header struct{ Type models.ItemType }
+	_ = json.Unmarshal(value, &header)
+	return header.Type
+}
+
+// folderPrefix returns the path of the item folder in brackets, the item at the top level has no prefix.
+func folderPrefix(value []byte, paths map[string]string) string {
+	folder := models.ItemFolder(value)
+	if folder == "" {
+		return ""
+	}
+	path, ok := paths[folder]
+	if !ok {
+		// the folder is not synced yet
+		path = "?"
+	}
+	return "[" + path + "] "
+}
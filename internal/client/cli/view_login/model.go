@@ -21,20 +21,24 @@ var (
 	blurredButton = fmt.Sprintf("[ %s ]", blurredStyle.Render("Submit"))
 )
 
+// Model is the login form: email, password and master password.
+// Master password never leaves the client, the vault key is derived from it by unlock after successful login.
 type Model struct {
 	State      string
 	result     string
 	Token      string
 	grpcClient *grpcclient.GRPCClient
+	unlock     func(email string, masterPassword string) error
 	focusIndex int
 	Inputs     []textinput.Model
 	cursorMode cursor.Mode
 }
 
-func InitialModel(grpcClient *grpcclient.GRPCClient) Model {
+func InitialModel(grpcClient *grpcclient.GRPCClient, unlock func(email string, masterPassword string) error) Model {
 	m := Model{
-		Inputs:     make([]textinput.Model, 2),
+		Inputs:     make([]textinput.Model, 3),
 		grpcClient: grpcClient,
+		unlock:     unlock,
 	}
 
 	var t textinput.Model
@@ -54,6 +58,11 @@ func InitialModel(grpcClient *grpcclient.GRPCClient) Model {
 			t.Placeholder = "Password"
 			t.EchoMode = textinput.EchoPassword
 			t.EchoCharacter = '•'
+		case 2:
+			t.Placeholder = "Master password"
+			t.EchoMode = textinput.EchoPassword
+			t.EchoCharacter = '•'
+			t.CharLimit = 64
 		}
 
 		m.Inputs[i] = t
@@ -88,6 +97,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			s := msg.String()
 
 			if s == "enter" && m.focusIndex == len(m.Inputs) {
+				if m.Inputs[2].Value() == "" {
+					m.State = "again"
+					m.result = "master password is required, try again"
+					m.focusIndex = -1
+					return m, nil
+				}
 				token, err := m.grpcClient.Login(context.Background(), m.Inputs[0].Value(), m.Inputs[1].Value())
 				if err != nil {
 					if err.Error() == "invalid login or password" {
@@ -101,6 +116,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.focusIndex = -1
 					return m, nil
 				}
+				if err = m.unlock(m.Inputs[0].Value(), m.Inputs[2].Value()); err != nil {
+					m.State = "again"
+					m.result = fmt.Sprintf("%s, try again", err.Error())
+					m.focusIndex = -1
+					return m, nil
+				}
 				m.State = "completed"
 				m.result = "success"
 				m.Token = token
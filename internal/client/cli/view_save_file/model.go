@@ -1,4 +1,4 @@
-package viewaddtext
+package viewsavefile
 
 import (
 	"fmt"
@@ -20,6 +20,7 @@ var (
 	blurredButton = fmt.Sprintf("[ %s ]", blurredStyle.Render("Submit"))
 )
 
+// Model prompts for the path the selected file is saved to.
 type Model struct {
 	focusIndex int
 	Inputs     []textinput.Model
@@ -29,26 +30,20 @@ type Model struct {
 
 func InitialModel() Model {
 	m := Model{
-		Inputs: make([]textinput.Model, 4),
+		Inputs: make([]textinput.Model, 1),
 	}
 	var t textinput.Model
 	for i := range m.Inputs {
 		t = textinput.New()
 		t.Cursor.Style = cursorStyle
-		t.CharLimit = 32
+		t.CharLimit = 256
 
 		switch i {
 		case 0:
-			t.Placeholder = "Tag"
+			t.Placeholder = "Save to path"
 			t.Focus()
 			t.PromptStyle = focusedStyle
 			t.TextStyle = focusedStyle
-		case 1:
-			t.Placeholder = "Key"
-		case 2:
-			t.Placeholder = "Value"
-		case 3:
-			t.Placeholder = "Comment"
 		}
 
 		m.Inputs[i] = t
@@ -107,6 +102,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.Inputs[i].TextStyle = focusedStyle
 					continue
 				}
+
 				m.Inputs[i].Blur()
 				m.Inputs[i].PromptStyle = noStyle
 				m.Inputs[i].TextStyle = noStyle
@@ -133,7 +129,7 @@ func (m *Model) updateInputs(msg tea.Msg) tea.Cmd {
 
 func (m Model) View() string {
 	var b strings.Builder
-	b.WriteString("login:\n\n")
+	b.WriteString("\nsave file:\n\n")
 
 	for i := range m.Inputs {
 		b.WriteString(m.Inputs[i].View())
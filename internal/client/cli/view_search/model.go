@@ -1,4 +1,4 @@
-package viewaddcard
+package viewsearch
 
 import (
 	"fmt"
@@ -29,32 +29,16 @@ type Model struct {
 
 func InitialModel() Model {
 	m := Model{
-		Inputs: make([]textinput.Model, 5),
-	}
-	var t textinput.Model
-	for i := range m.Inputs {
-		t = textinput.New()
-		t.Cursor.Style = cursorStyle
-		t.CharLimit = 32
-
-		switch i {
-		case 0:
-			t.Placeholder = "Tag"
-			t.Focus()
-			t.PromptStyle = focusedStyle
-			t.TextStyle = focusedStyle
-		case 1:
-			t.Placeholder = "Number"
-		case 2:
-			t.Placeholder = "Exp"
-		case 3:
-			t.Placeholder = "CVV"
-		case 4:
-			t.Placeholder = "Comment"
-		}
-
-		m.Inputs[i] = t
+		Inputs: make([]textinput.Model, 1),
 	}
+	t := textinput.New()
+	t.Cursor.Style = cursorStyle
+	t.CharLimit = 64
+	t.Placeholder = "Text in a field value or a custom field name"
+	t.Focus()
+	t.PromptStyle = focusedStyle
+	t.TextStyle = focusedStyle
+	m.Inputs[0] = t
 
 	return m
 }
@@ -135,7 +119,7 @@ func (m *Model) updateInputs(msg tea.Msg) tea.Cmd {
 
 func (m Model) View() string {
 	var b strings.Builder
-	b.WriteString("login:\n\n")
+	b.WriteString("search secrets:\n\n")
 
 	for i := range m.Inputs {
 		b.WriteString(m.Inputs[i].View())
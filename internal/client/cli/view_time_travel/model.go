@@ -1,4 +1,4 @@
-package viewaddbinary
+package viewtimetravel
 
 import (
 	"fmt"
@@ -29,24 +29,22 @@ type Model struct {
 
 func InitialModel() Model {
 	m := Model{
-		Inputs: make([]textinput.Model, 3),
+		Inputs: make([]textinput.Model, 2),
 	}
 	var t textinput.Model
 	for i := range m.Inputs {
 		t = textinput.New()
 		t.Cursor.Style = cursorStyle
-		t.CharLimit = 32
+		t.CharLimit = 64
 
 		switch i {
 		case 0:
-			t.Placeholder = "Tag"
+			t.Placeholder = "Date (YYYY-MM-DD HH:MM:SS)"
 			t.Focus()
 			t.PromptStyle = focusedStyle
 			t.TextStyle = focusedStyle
 		case 1:
-			t.Placeholder = "File path"
-		case 2:
-			t.Placeholder = "Comment"
+			t.Placeholder = "Export file path (optional)"
 		}
 
 		m.Inputs[i] = t
@@ -105,7 +103,6 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.Inputs[i].TextStyle = focusedStyle
 					continue
 				}
-
 				m.Inputs[i].Blur()
 				m.Inputs[i].PromptStyle = noStyle
 				m.Inputs[i].TextStyle = noStyle
@@ -132,7 +129,7 @@ func (m *Model) updateInputs(msg tea.Msg) tea.Cmd {
 
 func (m Model) View() string {
 	var b strings.Builder
-	b.WriteString("\nlogin:\n\n")
+	b.WriteString("vault at date:\n\n")
 
 	for i := range m.Inputs {
 		b.WriteString(m.Inputs[i].View())
@@ -2,34 +2,46 @@
 // CLI view models provides into module cli.
 // Commands for registration, login, selecting all elements, saving credentials data, text data, binary data, card data are defined for the user.
 // Application includes websocket client to communicate with server.
-// If the connection to the server is interrupted, then websocket client sends message to application using "interrupt" channel.
+// Binary files are uploaded in encrypted chunks in background, their content is downloaded only when the user saves the file.
+// The vault key is derived from the master password at login, items are encrypted before they are sent to the server.
+// If the connection to the server is interrupted, websocket client restores it, the connection state is shown above the commands.
+// If the server rejects the token, then websocket client sends message to application using "interrupt" channel.
 package client
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"strconv"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	viewaddbinary "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_add_binary"
-	viewaddcard "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_add_card"
-	viewaddcredentials "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_add_credentials"
-	viewaddtext "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_add_text"
 	viewauth "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_auth"
 	"github.com/dkrasnykh/gophkeeper/internal/client/cli/view_command_list"
+	viewconflicts "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_conflicts"
+	viewdelete "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_delete"
+	viewhistory "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_history"
+	viewitemform "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_item_form"
 	viewlist "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_list"
 	viewlogin "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_login"
 	viewregister "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_register"
+	viewsavefile "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_save_file"
+	viewsearch "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_search"
+	viewselect "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_select"
+	viewtimetravel "github.com/dkrasnykh/gophkeeper/internal/client/cli/view_time_travel"
 	"github.com/dkrasnykh/gophkeeper/internal/client/config"
+	"github.com/dkrasnykh/gophkeeper/internal/client/files"
 	"github.com/dkrasnykh/gophkeeper/internal/client/grpcclient"
 	"github.com/dkrasnykh/gophkeeper/internal/client/service"
 	"github.com/dkrasnykh/gophkeeper/internal/client/storage"
+	clienttls "github.com/dkrasnykh/gophkeeper/internal/client/tls"
 	"github.com/dkrasnykh/gophkeeper/internal/client/ws"
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
 	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
 )
@@ -47,9 +59,17 @@ type AppClient struct {
 	storagePath  string
 	grpcAddress  string
 	WSURL        string
+	filesURL     string
 	queryTimeout time.Duration
 	caCertFile   string
 	keeper       *service.Keeper
+	wsClient     *ws.WSClient
+	files        *files.Client
+	transfer     time.Duration
+	minDelay     time.Duration
+	maxDelay     time.Duration
+	pingWait     time.Duration
+	maxSize      int64
 }
 
 func NewAppClient(log *slog.Logger, cfg *config.ClientConfig) *AppClient {
@@ -58,8 +78,14 @@ func NewAppClient(log *slog.Logger, cfg *config.ClientConfig) *AppClient {
 		storagePath:  cfg.StoragePath,
 		grpcAddress:  cfg.GRPCAddress,
 		WSURL:        cfg.WSURL,
+		filesURL:     cfg.FilesURL,
+		transfer:     cfg.TransferTimeout,
 		queryTimeout: cfg.QueryTimeout,
 		caCertFile:   cfg.CaCertFile,
+		minDelay:     cfg.ReconnectMinDelay,
+		maxDelay:     cfg.ReconnectMaxDelay,
+		pingWait:     cfg.PingWait,
+		maxSize:      cfg.MaxMessageSize,
 	}
 }
 
@@ -88,32 +114,53 @@ func (app *AppClient) Run(ctx context.Context, stop chan os.Signal) {
 		return
 	}
 
-	dbCred, err := storage.NewCredentialsSqlite(app.storagePath, app.queryTimeout)
+	dbItem, err := storage.NewItemSqlite(app.storagePath, app.queryTimeout)
 	if err != nil {
-		log.Error("failed to establish connection to database for credentials storage")
+		log.Error("failed to establish connection to database for item storage")
 		stop <- syscall.SIGTERM
 		return
 	}
-	dbText, err := storage.NewTextSqlite(app.storagePath, app.queryTimeout)
+
+	dbSync, err := storage.NewSyncSqlite(app.storagePath, app.queryTimeout)
+	if err != nil {
+		log.Error("failed to establish connection to database for sync storage")
+		stop <- syscall.SIGTERM
+		return
+	}
+
+	dbConflict, err := storage.NewConflictSqlite(app.storagePath, app.queryTimeout)
 	if err != nil {
-		log.Error("failed to establish connection to database for text storage")
+		log.Error("failed to establish connection to database for conflict storage")
 		stop <- syscall.SIGTERM
 		return
 	}
-	dbBin, err := storage.NewBinarySqlite(app.storagePath, app.queryTimeout)
+
+	dbOutbox, err := storage.NewOutboxSqlite(app.storagePath, app.queryTimeout)
 	if err != nil {
-		log.Error("failed to establish connection to database for binary storage")
+		log.Error("failed to establish connection to database for outbox storage")
 		stop <- syscall.SIGTERM
 		return
 	}
-	dbCard, err := storage.NewCardSqlite(app.storagePath, app.queryTimeout)
+
+	dbUpload, err := storage.NewUploadSqlite(app.storagePath, app.queryTimeout)
 	if err != nil {
-		log.Error("failed to establish connection to database for card storage")
+		log.Error("failed to establish connection to database for upload storage")
 		stop <- syscall.SIGTERM
 		return
 	}
 
-	app.keeper = service.NewKeeper(log, app.ch, dbCred, dbText, dbBin, dbCard)
+	tlsConfig, err := clienttls.LoadTLSConfig(app.caCertFile)
+	if err != nil {
+		log.Error(
+			"failed load CA certificate",
+			slog.String("CA certificate", app.caCertFile),
+			sl.Err(err),
+		)
+		stop <- syscall.SIGTERM
+		return
+	}
+	app.files = files.NewClient(app.filesURL, tlsConfig, app.transfer)
+	app.keeper = service.NewKeeper(log, app.ch, dbItem, dbSync, dbConflict, dbOutbox, dbUpload, app.files)
 
 	app.grpcClient, err = grpcclient.NewGRPCClient(app.grpcAddress, app.caCertFile)
 	if err != nil {
@@ -154,24 +201,29 @@ func (app *AppClient) Run(ctx context.Context, stop chan os.Signal) {
 		return
 	}
 
-	wsClient := ws.NewWSClient(log, app.ch, app.keeper, app.WSURL)
+	app.wsClient = ws.NewWSClient(log, app.ch, app.keeper, app.WSURL, tlsConfig, app.minDelay, app.maxDelay, app.pingWait, app.maxSize)
 
-	// interrupt - chan for receiving signal from the websocket connection (receive error message from server)
+	// interrupt - chan for receiving signal from the websocket connection (server rejected the token)
 	interrupt := make(chan struct{})
 	go func(interrupt chan struct{}) {
 		<-interrupt
 		stop <- syscall.SIGTERM
 	}(interrupt)
 
-	wsClient.Run(ctx, interrupt, token)
+	app.wsClient.Run(ctx, interrupt, token)
+	// uploads interrupted by the lost connection or the client stop are resumed
+	app.files.SetToken(token)
+	go app.keeper.RunUploads(ctx, app.maxDelay)
 
+	// result is the error of the last command shown to the user
+	var result string
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
 			//show list of commands : {"Get all secrets", "Add credentials", "Add text data", "Add binary data", "Add card data"}
-			p := tea.NewProgram(view_command_list.Model{})
+			p := tea.NewProgram(view_command_list.Model{Status: app.status(ctx), Error: result})
 			m, err := p.Run()
 			if err != nil {
 				log.Error("viewing command list error", sl.Err(err))
@@ -193,6 +245,7 @@ func (app *AppClient) Run(ctx context.Context, stop chan os.Signal) {
 				return
 			}
 
+			result = ""
 			switch modelComandList.Choice {
 			case "Get all secrets":
 				if err := app.commandGetAllSecrets(ctx); err != nil {
@@ -202,29 +255,117 @@ func (app *AppClient) Run(ctx context.Context, stop chan os.Signal) {
 				}
 
 			case "Add credentials":
-				ok := app.commandAdd(ctx, app.commandAddCard, "credentials")
-				if !ok {
+				var ok bool
+				if result, ok = app.commandAdd(ctx, app.commandAddItem(models.CredItem), "credentials"); !ok {
 					stop <- syscall.SIGTERM
 					return
 				}
 
 			case "Add text data":
-				ok := app.commandAdd(ctx, app.commandAddText, "text data")
-				if !ok {
+				var ok bool
+				if result, ok = app.commandAdd(ctx, app.commandAddItem(models.TextItem), "text data"); !ok {
 					stop <- syscall.SIGTERM
 					return
 				}
 
 			case "Add binary data":
-				ok := app.commandAdd(ctx, app.commandAddBinary, "binary data")
-				if !ok {
+				var ok bool
+				if result, ok = app.commandAdd(ctx, app.commandAddItem(models.BinItem), "binary data"); !ok {
 					stop <- syscall.SIGTERM
 					return
 				}
 
 			case "Add card data":
-				ok := app.commandAdd(ctx, app.commandAddCard, "card")
-				if !ok {
+				var ok bool
+				if result, ok = app.commandAdd(ctx, app.commandAddItem(models.CardItem), "card"); !ok {
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Save file":
+				err := app.commandSaveFile(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute save file command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Edit secret":
+				err := app.commandEdit(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute edit secret command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Search secrets":
+				err := app.commandSearch(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute search secrets command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Filter secrets":
+				err := app.commandFilter(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute filter secrets command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Add folder":
+				err := app.commandAddFolder(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute add folder command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Tags":
+				err := app.commandTags(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute tags command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Rename tag":
+				err := app.commandRenameTag(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute rename tag command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Delete secret":
+				err := app.commandDelete(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute delete secret command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Show history":
+				err := app.commandHistory(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute show history command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Vault at date":
+				err := app.commandVaultAt(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute vault at date command", sl.Err(err))
+					stop <- syscall.SIGTERM
+					return
+				}
+
+			case "Resolve conflicts":
+				err := app.commandResolveConflicts(ctx)
+				if result, err = commandResult(err); err != nil {
+					log.Error("failed execute resolve conflicts command", sl.Err(err))
 					stop <- syscall.SIGTERM
 					return
 				}
@@ -276,7 +417,7 @@ func (app *AppClient) login(ctx context.Context) (string, error) {
 		case <-ctx.Done():
 			return "", nil
 		default:
-			p := tea.NewProgram(viewlogin.InitialModel(app.grpcClient))
+			p := tea.NewProgram(viewlogin.InitialModel(app.grpcClient, app.unlock(ctx)))
 			m, err := p.Run()
 			if err != nil {
 				return "", ErrViewModel
@@ -305,31 +446,40 @@ func (app *AppClient) login(ctx context.Context) (string, error) {
 	}
 }
 
+// unlock derives the vault key from the master password, items are encrypted and decrypted on the client with it.
+func (app *AppClient) unlock(ctx context.Context) func(email string, masterPassword string) error {
+	return func(email string, masterPassword string) error {
+		err := app.keeper.Unlock(ctx, encrypt.DeriveVaultKey(masterPassword, email))
+		if errors.Is(err, service.ErrWrongMasterPassword) {
+			return service.ErrWrongMasterPassword
+		}
+		if err != nil {
+			return errors.New("failed unlock the vault")
+		}
+		return nil
+	}
+}
+
 func (app *AppClient) commandGetAllSecrets(ctx context.Context) error {
 	const op = "client.Run.GetAllSecrets"
 	log := app.log.With(
 		slog.String("op", op),
 	)
 
-	var err error
-	creds, err := app.keeper.AllCredentials(ctx)
+	values, err := app.keeper.AllItems(ctx)
 	if err != nil {
-		log.Error("query all credentials error", sl.Err(err))
+		log.Error("query all items error", sl.Err(err))
 	}
-	texts, err := app.keeper.AllText(ctx)
+	paths, err := app.keeper.FolderPaths(ctx)
 	if err != nil {
-		log.Error("query all text data error", sl.Err(err))
+		log.Error("query folders error", sl.Err(err))
 	}
-	bins, err := app.keeper.AllBinary(ctx)
+	pending, err := app.keeper.PendingChanges(ctx)
 	if err != nil {
-		log.Error("query all binary data error", sl.Err(err))
-	}
-	cards, err := app.keeper.AllCard(ctx)
-	if err != nil {
-		log.Error("query all cards error", sl.Err(err))
+		log.Error("query pending changes error", sl.Err(err))
 	}
 	// view result
-	p := tea.NewProgram(viewlist.Model{Msg: viewlist.Convert(creds, texts, bins, cards)})
+	p := tea.NewProgram(viewlist.Model{Msg: append(viewlist.Convert(values, paths), viewlist.ConvertPending(pending)...)})
 	_, err = p.Run()
 	if err != nil {
 		return ErrViewModel
@@ -338,7 +488,8 @@ func (app *AppClient) commandGetAllSecrets(ctx context.Context) error {
 	return nil
 }
 
-func (app *AppClient) commandAdd(ctx context.Context, command func(ctx context.Context) error, msg string) bool {
+// commandAdd runs the command adding the item, it returns the error shown to the user and false if the client stops.
+func (app *AppClient) commandAdd(ctx context.Context, command func(ctx context.Context) error, msg string) (string, bool) {
 	const op = "client.Run"
 	log := app.log.With(
 		slog.String("op", op),
@@ -346,162 +497,703 @@ func (app *AppClient) commandAdd(ctx context.Context, command func(ctx context.C
 	)
 
 	if err := command(ctx); err != nil {
+		var failed commandError
 		switch {
 		case errors.Is(err, ErrUserStoppedApp):
 			log.Info("user stopped execution (q, ctrl+C, esc)")
-			return false
+			return "", false
 		case errors.Is(err, ErrViewModel) || errors.Is(err, ErrRetrieveModel):
 			log.Error(fmt.Sprintf("add %s error", msg), sl.Err(err))
-			return false
+			return "", false
+		case errors.As(err, &failed):
+			return failed.Error(), true
 		default:
 			log.Error(fmt.Sprintf("saving %s error", msg), sl.Err(err))
-			return true
+			return fmt.Sprintf("saving %s failed", msg), true
+		}
+	}
+	return "", true
+}
+
+// commandError is the error of the command shown to the user in the command list, the client keeps running.
+type commandError string
+
+func (e commandError) Error() string {
+	return string(e)
+}
+
+// userErrors are the errors whose text tells the user what to fix or to wait for, other errors are only logged.
+var userErrors = []error{
+	service.ErrLocked, service.ErrRequestTimeout, service.ErrInvalidRequest, service.ErrServer,
+	service.ErrFileNotFound, service.ErrExtractFile, service.ErrFileNotUploaded, service.ErrFileHash,
+}
+
+// commandFailed logs the error of the action and returns the error shown to the user:
+// the reasons the typed item is invalid or the known cause of the error.
+func commandFailed(log *slog.Logger, action string, err error) error {
+	log.Error(action+" error", sl.Err(err))
+
+	var invalid service.InvalidItemError
+	if errors.As(err, &invalid) {
+		return commandError(fmt.Sprintf("%s failed: %s", action, strings.Join(invalid.Reasons, ", ")))
+	}
+	for _, userErr := range userErrors {
+		if errors.Is(err, userErr) {
+			return commandError(fmt.Sprintf("%s failed: %s", action, userErr))
+		}
+	}
+	return commandError(action + " failed")
+}
+
+// commandResult returns the error of the command shown to the user, the other error stops the client.
+func commandResult(err error) (string, error) {
+	var failed commandError
+	if errors.As(err, &failed) {
+		return failed.Error(), nil
+	}
+	return "", err
+}
+
+var (
+	// filePathField is asked in the form of the binary item instead of the file name: the item is added from the file.
+	filePathField = models.Field{Name: "path", Label: "File path", Kind: models.TextField, Required: true}
+	// folderField is asked in the item form after tags: the item is put into the folder with the path, missing folders are created.
+	folderField = models.Field{Name: "folder path", Label: "Folder (path like Work/Banks)", Kind: models.TextField}
+	// tagField and renamedTagField are asked to rename the tag.
+	tagField        = models.Field{Name: "tag", Label: "Tag", Kind: models.TextField}
+	renamedTagField = models.Field{Name: "renamed", Label: "New tag (empty to remove the tag)", Kind: models.TextField}
+)
+
+// commandAddItem returns the command adding the item of the type, the form is made of the fields of the item schema.
+func (app *AppClient) commandAddItem(kind models.ItemType) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		const op = "client.Run.AddItem"
+		log := app.log.With(
+			slog.String("op", op),
+		)
+
+		schema, _ := models.Lookup(kind)
+		fields := schema.Inputs()
+		if kind == models.BinItem {
+			fields = slices.Insert(fields, 1, filePathField)
+		}
+		fields = slices.Insert(fields, 1, folderField)
+
+		p := tea.NewProgram(viewitemform.InitialModel(schema.Title, fields, nil, nil))
+		m, err := p.Run()
+		if err != nil {
+			return ErrViewModel
+		}
+
+		modelItemForm, ok := m.(viewitemform.Model)
+		if !ok {
+			return ErrRetrieveModel
+		}
+
+		if modelItemForm.State == "quit" {
+			// user stopped execution in UI (q, ctrl+C, esc)
+			return ErrUserStoppedApp
+		}
+
+		values := modelItemForm.Values()
+		value, err := schema.Edit(nil, values, modelItemForm.CustomFields())
+		if err != nil {
+			return commandFailed(log, "saving "+schema.Title, service.InvalidItemError{Reasons: []string{err.Error()}})
+		}
+		if value, err = app.putIntoFolder(ctx, value, values[folderField.Name]); err != nil {
+			return commandFailed(log, "saving "+schema.Title, err)
 		}
+
+		if kind == models.BinItem {
+			var bin models.Binary
+			_ = json.Unmarshal(value, &bin)
+			bin.Created = time.Now().Unix()
+			err = app.keeper.AddFile(ctx, bin, values[filePathField.Name])
+		} else {
+			err = app.keeper.SendSave(ctx, value)
+		}
+		if err != nil {
+			return commandFailed(log, "saving "+schema.Title, err)
+		}
+
+		return nil
+	}
+}
+
+// commandEdit edits fields and custom fields of the selected secret, the form is made of the fields of the item schema.
+func (app *AppClient) commandEdit(ctx context.Context) error {
+	const op = "client.Run.Edit"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	labels, values := app.secrets(ctx)
+
+	p := tea.NewProgram(viewselect.InitialModel("select secret to edit", labels))
+	m, err := p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	modelSelect, ok := m.(viewselect.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if !modelSelect.Selected {
+		return nil
+	}
+
+	var header struct {
+		ID   string
+		Type models.ItemType
+	}
+	_ = json.Unmarshal(values[modelSelect.Choice], &header)
+	schema, _ := models.Lookup(header.Type)
+	value, err := app.keeper.Item(ctx, header.Type, header.ID)
+	if err != nil {
+		return commandFailed(log, "querying secret", err)
+	}
+
+	paths, err := app.keeper.FolderPaths(ctx)
+	if err != nil {
+		log.Error("query folders error", sl.Err(err))
+	}
+	fieldValues := schema.Values(value)
+	fieldValues[folderField.Name] = paths[models.ItemFolder(value)]
+
+	fields := slices.Insert(schema.Inputs(), 1, folderField)
+	p = tea.NewProgram(viewitemform.InitialModel("edit "+schema.Title, fields, fieldValues, models.ItemFields(value)))
+	m, err = p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	modelItemForm, ok := m.(viewitemform.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if modelItemForm.State == "quit" {
+		return nil
+	}
+
+	fieldValues = modelItemForm.Values()
+	value, err = schema.Edit(value, fieldValues, modelItemForm.CustomFields())
+	if err != nil {
+		return commandFailed(log, "editing secret", service.InvalidItemError{Reasons: []string{err.Error()}})
+	}
+	if value, err = app.putIntoFolder(ctx, value, fieldValues[folderField.Name]); err != nil {
+		return commandFailed(log, "editing secret", err)
+	}
+	if err = app.keeper.SendSave(ctx, value); err != nil {
+		return commandFailed(log, "editing secret", err)
+	}
+
+	return nil
+}
+
+// commandSearch shows secrets containing the typed text, secret values are masked.
+func (app *AppClient) commandSearch(ctx context.Context) error {
+	const op = "client.Run.Search"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	p := tea.NewProgram(viewsearch.InitialModel())
+	m, err := p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	modelSearch, ok := m.(viewsearch.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if modelSearch.State == "quit" {
+		return nil
+	}
+
+	query := modelSearch.Inputs[0].Value()
+	found, err := app.keeper.Search(ctx, query)
+	if err != nil {
+		return commandFailed(log, "searching secrets", err)
+	}
+	paths, err := app.keeper.FolderPaths(ctx)
+	if err != nil {
+		log.Error("query folders error", sl.Err(err))
+	}
+
+	lines := []string{fmt.Sprintf("Secrets containing %q:", query)}
+	for _, value := range found {
+		lines = append(lines, viewlist.ConvertFound(value, paths))
+	}
+	if len(found) == 0 {
+		lines = append(lines, "nothing found")
+	}
+
+	p = tea.NewProgram(viewlist.Model{Msg: lines})
+	_, err = p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	return nil
+}
+
+// putIntoFolder puts the item encoded into JSON into the folder with the path, missing folders are created.
+// Empty path is the top level.
+func (app *AppClient) putIntoFolder(ctx context.Context, value []byte, path string) ([]byte, error) {
+	folder, err := app.keeper.EnsureFolder(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return models.SetFolder(value, folder)
+}
+
+// commandAddFolder creates the folder with the path (Work/Banks), missing parent folders are created too.
+func (app *AppClient) commandAddFolder(ctx context.Context) error {
+	const op = "client.Run.AddFolder"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	p := tea.NewProgram(viewitemform.InitialFieldsModel("folder", []models.Field{folderField}, nil))
+	m, err := p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	modelItemForm, ok := m.(viewitemform.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if modelItemForm.State == "quit" {
+		return nil
+	}
+
+	if _, err = app.keeper.EnsureFolder(ctx, modelItemForm.Values()[folderField.Name]); err != nil {
+		return commandFailed(log, "adding folder", err)
+	}
+
+	return nil
+}
+
+// commandFilter shows secrets labeled with the tag and put into the folder or into its subfolders.
+func (app *AppClient) commandFilter(ctx context.Context) error {
+	const op = "client.Run.Filter"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	p := tea.NewProgram(viewitemform.InitialFieldsModel("filter secrets (empty to show all)", []models.Field{tagField, folderField}, nil))
+	m, err := p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	modelItemForm, ok := m.(viewitemform.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if modelItemForm.State == "quit" {
+		return nil
+	}
+
+	values := modelItemForm.Values()
+	tag, path := strings.TrimSpace(values[tagField.Name]), values[folderField.Name]
+	found, err := app.keeper.Filter(ctx, tag, path)
+	if err != nil {
+		return commandFailed(log, "filtering secrets", err)
+	}
+	paths, err := app.keeper.FolderPaths(ctx)
+	if err != nil {
+		log.Error("query folders error", sl.Err(err))
+	}
+
+	lines := []string{fmt.Sprintf("Secrets with tag %q in folder %q:", tag, path)}
+	for _, value := range found {
+		lines = append(lines, viewlist.ConvertFound(value, paths))
+	}
+	if len(found) == 0 {
+		lines = append(lines, "nothing found")
+	}
+
+	p = tea.NewProgram(viewlist.Model{Msg: lines})
+	_, err = p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	return nil
+}
+
+// commandTags shows tags of all secrets with the number of secrets labeled with each tag.
+func (app *AppClient) commandTags(ctx context.Context) error {
+	const op = "client.Run.Tags"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	counts, err := app.keeper.TagCounts(ctx)
+	if err != nil {
+		return commandFailed(log, "querying tags", err)
+	}
+
+	lines := []string{"Tags:"}
+	for _, count := range counts {
+		lines = append(lines, fmt.Sprintf("%s: %d", count.Tag, count.Items))
+	}
+	if len(counts) == 0 {
+		lines = append(lines, "secrets have no tags")
+	}
+
+	p := tea.NewProgram(viewlist.Model{Msg: lines})
+	_, err = p.Run()
+	if err != nil {
+		return ErrViewModel
 	}
-	return true
+
+	return nil
 }
 
-func (app *AppClient) commandAddCredentials(ctx context.Context) error {
-	p := tea.NewProgram(viewaddcredentials.InitialModel())
+// commandRenameTag replaces the tag by the new one in all secrets.
+func (app *AppClient) commandRenameTag(ctx context.Context) error {
+	const op = "client.Run.RenameTag"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	p := tea.NewProgram(viewitemform.InitialFieldsModel("rename tag", []models.Field{tagField, renamedTagField}, nil))
 	m, err := p.Run()
 	if err != nil {
 		return ErrViewModel
 	}
 
-	modelAddCredentials, ok := m.(viewaddcredentials.Model)
+	modelItemForm, ok := m.(viewitemform.Model)
 	if !ok {
 		return ErrRetrieveModel
 	}
 
-	if modelAddCredentials.State == "quit" {
-		return ErrUserStoppedApp
+	if modelItemForm.State == "quit" {
+		return nil
 	}
 
-	cred := models.Credentials{
-		Type:     models.CredItem,
-		Tag:      modelAddCredentials.Inputs[0].Value(),
-		Login:    modelAddCredentials.Inputs[1].Value(),
-		Password: modelAddCredentials.Inputs[2].Value(),
-		Comment:  modelAddCredentials.Inputs[3].Value(),
-		Created:  time.Now().Unix(),
+	values := modelItemForm.Values()
+	tag, renamed := strings.TrimSpace(values[tagField.Name]), values[renamedTagField.Name]
+	if tag == "" {
+		return commandError("tag should not be empty")
 	}
-	// TODO validate item
-	err = app.keeper.SendSaveCredentials(ctx, cred)
+	changed, err := app.keeper.RenameTag(ctx, tag, renamed)
+	if err != nil {
+		return commandFailed(log, fmt.Sprintf("renaming tag (changed in %d secrets)", changed), err)
+	}
+
+	p = tea.NewProgram(viewlist.Model{Msg: []string{fmt.Sprintf("tag %q is changed in %d secrets", tag, changed)}})
+	_, err = p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	return nil
+}
+
+// commandSaveFile writes the selected binary item into the file, its content is downloaded only now.
+func (app *AppClient) commandSaveFile(ctx context.Context) error {
+	const op = "client.Run.SaveFile"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	values, err := app.keeper.Items(ctx, models.BinItem)
+	if err != nil {
+		log.Error("query all binary data error", sl.Err(err))
+	}
+	labels := make([]string, 0, len(values))
+	for _, value := range values {
+		labels = append(labels, itemLabel(value))
+	}
+
+	p := tea.NewProgram(viewselect.InitialModel("select file to save", labels))
+	m, err := p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+	modelSelect, ok := m.(viewselect.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+	if !modelSelect.Selected {
+		return nil
+	}
+
+	p = tea.NewProgram(viewsavefile.InitialModel())
+	m, err = p.Run()
 	if err != nil {
-		// TODO view result
-		return fmt.Errorf("saving credentials error %w", err)
+		return ErrViewModel
+	}
+	modelSave, ok := m.(viewsavefile.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+	if modelSave.State == "quit" {
+		return nil
+	}
+
+	var bin models.Binary
+	_ = json.Unmarshal(values[modelSelect.Choice], &bin)
+	if err = app.keeper.SaveFile(ctx, bin, modelSave.Inputs[0].Value()); err != nil {
+		return commandFailed(log, "saving file", err)
 	}
 
 	return nil
 }
 
-func (app *AppClient) commandAddText(ctx context.Context) error {
-	p := tea.NewProgram(viewaddtext.InitialModel())
+func (app *AppClient) commandDelete(ctx context.Context) error {
+	const op = "client.Run.Delete"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	labels, values := app.secrets(ctx)
+
+	p := tea.NewProgram(viewdelete.InitialModel(labels))
 	m, err := p.Run()
 	if err != nil {
 		return ErrViewModel
 	}
 
-	modelAddText, ok := m.(viewaddtext.Model)
+	modelDelete, ok := m.(viewdelete.Model)
 	if !ok {
 		return ErrRetrieveModel
 	}
 
-	if modelAddText.State == "quit" {
-		return ErrUserStoppedApp
+	if !modelDelete.Selected {
+		return nil
 	}
 
-	text := models.Text{
-		Type:    models.TextItem,
-		Tag:     modelAddText.Inputs[0].Value(),
-		Key:     modelAddText.Inputs[1].Value(),
-		Value:   modelAddText.Inputs[2].Value(),
-		Comment: modelAddText.Inputs[3].Value(),
-		Created: time.Now().Unix(),
+	if err = app.keeper.SendDelete(ctx, values[modelDelete.Choice]); err != nil {
+		return commandFailed(log, "deleting secret", err)
 	}
-	// TODO validate item
-	err = app.keeper.SendSaveText(ctx, text)
+
+	return nil
+}
+
+func (app *AppClient) commandResolveConflicts(ctx context.Context) error {
+	const op = "client.Run.ResolveConflicts"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	conflicts, err := app.keeper.AllConflicts(ctx)
 	if err != nil {
-		// TODO view result
-		return fmt.Errorf("saving text error %w", err)
+		log.Error("query all conflicts error", sl.Err(err))
+	}
+
+	items := make([]viewconflicts.Conflict, 0, len(conflicts))
+	for _, c := range conflicts {
+		item := viewconflicts.Conflict{Current: "deleted", Incoming: "deleted"}
+		if current, ok := app.keeper.Current(ctx, c); ok {
+			item.Current = viewlist.ConvertValue(current)
+		}
+		if !c.Deleted {
+			item.Incoming = viewlist.ConvertValue(c.Value)
+		}
+		items = append(items, item)
+	}
+
+	p := tea.NewProgram(viewconflicts.InitialModel(items))
+	m, err := p.Run()
+	if err != nil {
+		return ErrViewModel
+	}
+
+	modelConflicts, ok := m.(viewconflicts.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if !modelConflicts.Selected {
+		return nil
+	}
+
+	if err = app.keeper.ResolveConflict(ctx, conflicts[modelConflicts.Choice], modelConflicts.KeepIncoming); err != nil {
+		return commandFailed(log, "resolving conflict", err)
 	}
 
 	return nil
 }
 
-func (app *AppClient) commandAddBinary(ctx context.Context) error {
-	p := tea.NewProgram(viewaddbinary.InitialModel())
+func (app *AppClient) commandHistory(ctx context.Context) error {
+	const op = "client.Run.History"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	labels, values := app.secrets(ctx)
+
+	p := tea.NewProgram(viewselect.InitialModel("select secret to show history", labels))
 	m, err := p.Run()
 	if err != nil {
 		return ErrViewModel
 	}
 
-	modelAddBinary, ok := m.(viewaddbinary.Model)
+	modelSelect, ok := m.(viewselect.Model)
 	if !ok {
 		return ErrRetrieveModel
 	}
 
-	if modelAddBinary.State == "quit" {
-		return ErrUserStoppedApp
+	if !modelSelect.Selected {
+		return nil
 	}
 
-	path := modelAddBinary.Inputs[1].Value()
-	fileName, data, err := app.keeper.ExtractDataFromFile(path)
+	versions, err := app.keeper.History(ctx, values[modelSelect.Choice])
 	if err != nil {
-		return fmt.Errorf("failed extract data from file %w", err)
+		return commandFailed(log, "requesting history", err)
 	}
 
-	bin := models.Binary{
-		Type:    models.BinItem,
-		Tag:     modelAddBinary.Inputs[0].Value(),
-		Key:     fileName,
-		Value:   data,
-		Comment: modelAddBinary.Inputs[2].Value(),
-		Created: time.Now().Unix(),
+	items := make([]viewhistory.Version, 0, len(versions))
+	for _, v := range versions {
+		item := viewhistory.Version{
+			Created: time.Unix(v.Created, 0).Format(time.DateTime),
+			Value:   viewlist.ConvertValue(v.Value),
+		}
+		switch {
+		case v.Deleted:
+			item.Created += " (deleted)"
+		case v.Conflict:
+			item.Created += " (conflict)"
+		}
+		items = append(items, item)
 	}
-	// TODO validate binary item
-	err = app.keeper.SendSaveBinary(ctx, bin)
+
+	p = tea.NewProgram(viewhistory.InitialModel(items))
+	m, err = p.Run()
 	if err != nil {
-		// TODO view result
-		return fmt.Errorf("saving binary data error %w", err)
+		return ErrViewModel
+	}
+
+	modelHistory, ok := m.(viewhistory.Model)
+	if !ok {
+		return ErrRetrieveModel
+	}
+
+	if !modelHistory.Restore {
+		return nil
+	}
+
+	if err = app.keeper.Restore(ctx, versions[modelHistory.Choice]); err != nil {
+		return commandFailed(log, "restoring version", err)
 	}
 
 	return nil
 }
 
-func (app *AppClient) commandAddCard(ctx context.Context) error {
-	p := tea.NewProgram(viewaddcard.InitialModel())
+func (app *AppClient) commandVaultAt(ctx context.Context) error {
+	const op = "client.Run.VaultAt"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	p := tea.NewProgram(viewtimetravel.InitialModel())
 	m, err := p.Run()
 	if err != nil {
 		return ErrViewModel
 	}
 
-	modelAddCard, ok := m.(viewaddcard.Model)
+	modelTimeTravel, ok := m.(viewtimetravel.Model)
 	if !ok {
 		return ErrRetrieveModel
 	}
 
-	if modelAddCard.State == "quit" {
-		// user stopped execution in UI (q, ctrl+C, esc)
-		return ErrUserStoppedApp
+	if modelTimeTravel.State == "quit" {
+		return nil
 	}
 
-	cvv, _ := strconv.Atoi(modelAddCard.Inputs[3].Value())
-	card := models.Card{
-		Type:    models.CardItem,
-		Tag:     modelAddCard.Inputs[0].Value(),
-		Number:  modelAddCard.Inputs[1].Value(),
-		Exp:     modelAddCard.Inputs[2].Value(),
-		CVV:     int32(cvv),
-		Comment: modelAddCard.Inputs[4].Value(),
-		Created: time.Now().Unix(),
+	at, err := time.ParseInLocation(time.DateTime, modelTimeTravel.Inputs[0].Value(), time.Local)
+	if err != nil {
+		log.Error("parsing date error", sl.Err(err))
+		return commandError(fmt.Sprintf("date should be like %s", time.DateTime))
 	}
-	// TODO validate card item
-	err = app.keeper.SendSaveCard(ctx, card)
+
+	vault, err := app.keeper.VaultAt(ctx, at)
 	if err != nil {
-		// TODO view result
-		return fmt.Errorf("saving card data error %w", err)
+		return commandFailed(log, "requesting vault at date", err)
+	}
+
+	lines := []string{fmt.Sprintf("Vault as of %s (read-only):", vault.At.Format(time.DateTime))}
+	values := make([][]byte, 0, len(vault.Items))
+	for _, value := range vault.Items {
+		values = append(values, value)
+	}
+	lines = append(lines, viewlist.Convert(values, vault.Paths())...)
+
+	if path := modelTimeTravel.Inputs[1].Value(); path != "" {
+		if err = app.keeper.ExportVault(vault, path); err != nil {
+			log.Error("exporting vault error", sl.Err(err))
+			lines = append(lines, fmt.Sprintf("export to %s failed", path))
+		} else {
+			lines = append(lines, fmt.Sprintf("exported to %s", path))
+			if files := vault.Files(); files > 0 {
+				lines = append(lines, fmt.Sprintf("content of %d large files is not exported", files))
+			}
+		}
+	}
+
+	p = tea.NewProgram(viewlist.Model{Msg: lines})
+	_, err = p.Run()
+	if err != nil {
+		return ErrViewModel
 	}
 
 	return nil
 }
+
+// status returns function which formats connection state, vault key state and the number of changes waiting to be sent.
+func (app *AppClient) status(ctx context.Context) func() string {
+	const op = "client.Run.Status"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	return func() string {
+		waiting, err := app.keeper.Waiting(ctx)
+		if err != nil {
+			log.Error("query waiting changes error", sl.Err(err))
+		}
+		return fmt.Sprintf("connection: %s, vault: %s, changes waiting to be sent: %d", app.wsClient.State(), app.keeper.VaultState(), waiting)
+	}
+}
+
+// secrets returns labels and JSON values of all private user data.
+func (app *AppClient) secrets(ctx context.Context) ([]string, [][]byte) {
+	const op = "client.Run.Secrets"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	values, err := app.keeper.AllItems(ctx)
+	if err != nil {
+		log.Error("query all items error", sl.Err(err))
+	}
+
+	labels := make([]string, 0, len(values))
+	for _, value := range values {
+		labels = append(labels, itemLabel(value))
+	}
+	return labels, values
+}
+
+// itemLabel formats the item encoded into JSON by the identity field declared by its schema: "card: number=...; tags=...".
+func itemLabel(value []byte) string {
+	var header struct{ Type models.ItemType }
+	_ = json.Unmarshal(value, &header)
+	schema, ok := models.Lookup(header.Type)
+	if !ok {
+		return "unknown item"
+	}
+	return fmt.Sprintf("%s: %s=%s; tags=%s", schema.Title, schema.Identity, schema.NaturalKey(value), strings.Join(models.ItemTags(value), ", "))
+}
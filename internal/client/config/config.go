@@ -14,11 +14,21 @@ import (
 )
 
 type ClientConfig struct {
-	StoragePath  string        `yaml:"storage_path" env-required:"true"`
-	GRPCAddress  string        `yaml:"grpc_address" env-required:"true"`
-	WSURL        string        `yaml:"ws_url" env-required:"true"`
-	QueryTimeout time.Duration `yaml:"query_timeout" env-default:"2s"`
-	CaCertFile   string        `yaml:"ca_cert_file" env-required:"true"`
+	StoragePath string `yaml:"storage_path" env-required:"true"`
+	GRPCAddress string `yaml:"grpc_address" env-required:"true"`
+	WSURL       string `yaml:"ws_url" env-required:"true"`
+	// file chunks are transferred over FilesURL, every chunk request is limited by TransferTimeout
+	FilesURL        string        `yaml:"files_url" env-required:"true"`
+	TransferTimeout time.Duration `yaml:"transfer_timeout" env-default:"1m"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" env-default:"2s"`
+	CaCertFile      string        `yaml:"ca_cert_file" env-required:"true"`
+	// delay before reconnecting to the server grows from ReconnectMinDelay up to ReconnectMaxDelay
+	ReconnectMinDelay time.Duration `yaml:"reconnect_min_delay" env-default:"1s"`
+	ReconnectMaxDelay time.Duration `yaml:"reconnect_max_delay" env-default:"30s"`
+	// connection is considered lost if the server sends nothing (ping included) during PingWait
+	PingWait time.Duration `yaml:"ping_wait" env-default:"90s"`
+	// messages from the server larger than MaxMessageSize close the connection
+	MaxMessageSize int64 `yaml:"max_message_size" env-default:"33554432"`
 }
 
 // MustLoad parses the file into the configuration structure Config.
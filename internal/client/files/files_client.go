@@ -0,0 +1,175 @@
+// files module transfers chunks of large files to and from the server over HTTPS.
+// Files are too large to travel inside websocket messages, their chunks are encrypted by the client
+// and sent one by one, so the transfer is resumed from the missing chunk after the connection is lost.
+// Every chunk travels with its SHA-256 hash ("hash" header), damaged chunks are rejected by both sides.
+package files
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken  = errors.New("server rejected the token")
+	ErrChunkNotFound = errors.New("file chunk not found on the server")
+	ErrChunkHash     = errors.New("file chunk does not match its hash")
+	ErrServer        = errors.New("server error")
+)
+
+type Client struct {
+	url  string
+	http *http.Client
+
+	mu    *sync.Mutex
+	token string
+}
+
+// NewClient creates the client of the files endpoint at url, every request is limited by timeout.
+// Server certificate is verified by tlsConfig.
+func NewClient(url string, tlsConfig *tls.Config, timeout time.Duration) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		url:  url,
+		http: &http.Client{Transport: transport, Timeout: timeout},
+		mu:   &sync.Mutex{},
+	}
+}
+
+// SetToken replaces the token sent with the next requests.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+func (c *Client) currentToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+// Put uploads the chunk n of the file.
+func (c *Client) Put(ctx context.Context, fileID string, n int, data []byte) error {
+	const op = "files.Put"
+
+	req, err := c.newRequest(ctx, http.MethodPut, chunkPath(fileID, n), data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("hash", hash(data))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if err = statusError(resp); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Get downloads the chunk n of the file, ErrChunkHash is returned if the chunk was damaged on the way.
+func (c *Client) Get(ctx context.Context, fileID string, n int) ([]byte, error) {
+	const op = "files.Get"
+
+	req, err := c.newRequest(ctx, http.MethodGet, chunkPath(fileID, n), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if err = statusError(resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if hash(data) != resp.Header.Get("hash") {
+		return nil, fmt.Errorf("%s: %w", op, ErrChunkHash)
+	}
+	return data, nil
+}
+
+// Uploaded returns numbers of the file chunks saved by the server.
+func (c *Client) Uploaded(ctx context.Context, fileID string) ([]int, error) {
+	const op = "files.Uploaded"
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/"+url.PathEscape(fileID)+"/chunks", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if err = statusError(resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var chunks struct {
+		Chunks []int `json:"chunks"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&chunks); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return chunks.Chunks, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("token", c.currentToken())
+	return req, nil
+}
+
+func chunkPath(fileID string, n int) string {
+	return "/" + url.PathEscape(fileID) + "/chunks/" + strconv.Itoa(n)
+}
+
+func statusError(resp *http.Response) error {
+	switch {
+	case resp.StatusCode < http.StatusBadRequest:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrInvalidToken
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrChunkNotFound
+	case resp.StatusCode == http.StatusUnprocessableEntity:
+		return ErrChunkHash
+	default:
+		return fmt.Errorf("%w: %s", ErrServer, resp.Status)
+	}
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,102 @@
+package files
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer keeps uploaded chunks of file "file1" by path, damaged is sent instead of chunk 1.
+func newTestServer(t *testing.T, damaged []byte) *httptest.Server {
+	chunks := map[string][]byte{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("token") != "token" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			if hash(data) != r.Header.Get("hash") {
+				http.Error(w, "damaged chunk", http.StatusUnprocessableEntity)
+				return
+			}
+			chunks[r.URL.Path] = data
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/chunks"):
+			_, _ = w.Write([]byte(`{"chunks":[0]}`))
+		default:
+			data, ok := chunks[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("hash", hash(data))
+			if strings.HasSuffix(r.URL.Path, "/1") {
+				data = damaged
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTransfer(t *testing.T) {
+	srv := newTestServer(t, []byte("damaged"))
+	c := NewClient(srv.URL+"/files", trusted(srv), time.Second)
+	c.SetToken("token")
+
+	require.NoError(t, c.Put(context.Background(), "file1", 0, []byte("chunk 0")))
+	require.NoError(t, c.Put(context.Background(), "file1", 1, []byte("chunk 1")))
+
+	data, err := c.Get(context.Background(), "file1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk 0"), data)
+
+	_, err = c.Get(context.Background(), "file1", 1)
+	assert.ErrorIs(t, err, ErrChunkHash)
+	_, err = c.Get(context.Background(), "file1", 2)
+	assert.ErrorIs(t, err, ErrChunkNotFound)
+
+	chunks, err := c.Uploaded(context.Background(), "file1")
+	require.NoError(t, err)
+	assert.Equal(t, []int{0}, chunks)
+}
+
+func TestInvalidToken(t *testing.T) {
+	srv := newTestServer(t, nil)
+	c := NewClient(srv.URL+"/files", trusted(srv), time.Second)
+	c.SetToken("another token")
+
+	err := c.Put(context.Background(), "file1", 0, []byte("chunk 0"))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = c.Uploaded(context.Background(), "file1")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+// trusted returns TLS config trusting the certificate of the test server only.
+func trusted(srv *httptest.Server) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{RootCAs: pool}
+}
+
+func TestUntrustedCertificate(t *testing.T) {
+	srv := newTestServer(t, nil)
+	c := NewClient(srv.URL+"/files", &tls.Config{RootCAs: x509.NewCertPool()}, time.Second)
+	c.SetToken("token")
+
+	// certificate not signed by the configured CA is rejected
+	err := c.Put(context.Background(), "file1", 0, []byte("chunk 0"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+func (s *Keeper) AllConflicts(ctx context.Context) ([]models.ConflictVersion, error) {
+	const op = "service.Conflict.All"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	conflicts, err := s.conflictStore.All(ctx)
+	if err != nil {
+		log.Error("query all conflicts error", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	return conflicts, nil
+}
+
+// Current returns local version of the conflicting item, false if the item is deleted locally.
+func (s *Keeper) Current(ctx context.Context, conflict models.ConflictVersion) ([]byte, bool) {
+	value, err := s.Item(ctx, conflict.Type, conflict.Key)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// ResolveConflict writes the chosen version on top of the current server version of the item.
+// keepIncoming chooses the version rejected by the server, otherwise local (current) version is kept.
+func (s *Keeper) ResolveConflict(ctx context.Context, conflict models.ConflictVersion, keepIncoming bool) error {
+	const op = "service.Conflict.Resolve"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("revision", conflict.Revision),
+	)
+
+	msg := models.Message{Type: models.New, Value: conflict.Value}
+	if keepIncoming && conflict.Deleted {
+		msg.Type = models.Delete
+	}
+	if !keepIncoming {
+		current, ok := s.Current(ctx, conflict)
+		if ok {
+			msg.Value = current
+		} else {
+			msg.Type = models.Delete
+		}
+	}
+	msg.Value = touch(msg.Value)
+
+	if keepIncoming {
+		if msg.Type == models.Delete {
+			s.remove(ctx, msg.Value)
+		} else {
+			s.apply(ctx, msg.Value)
+		}
+	}
+	if err := s.send(ctx, msg); err != nil {
+		return err
+	}
+
+	if err := s.conflictStore.Delete(ctx, conflict.Revision); err != nil {
+		log.Error("delete resolved conflict error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	return nil
+}
+
+// touch sets the item creation time to now.
+func touch(value []byte) []byte {
+	var item map[string]any
+	if err := json.Unmarshal(value, &item); err != nil {
+		return value
+	}
+	item["created"] = time.Now().Unix()
+	res, _ := json.Marshal(item)
+	return res
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	ErrLocked              = errors.New("vault is locked")
+	ErrWrongMasterPassword = errors.New("master password does not match the vault on this device")
+	ErrUnverified          = errors.New("master password is not verified by the vault on the server yet")
+	ErrRejectedPassword    = errors.New("master password does not decrypt items of the vault on the server")
+)
+
+// Unlock sets the vault key derived from the master password, items are encrypted before sending and decrypted
+// after receiving with it. The key is remembered on the device (keyed hash of it), unlocking with another
+// master password is rejected with ErrWrongMasterPassword.
+// The key unlocked on the device which remembers no key yet is unverified: changes are not sent and files are not uploaded
+// until the full snapshot ends. The key is remembered then if any snapshot item is decrypted with it (or the vault is empty),
+// otherwise the vault is locked again, see verify.
+// The first unlock on the device requests full snapshot. If the device synced items before the vault key existed
+// (legacy migration flag set by the database migration), items saved in clear are accepted and re-encrypted
+// until the snapshot ends, then the flag is cleared. Otherwise items in clear are rejected.
+func (s *Keeper) Unlock(ctx context.Context, key *encrypt.VaultKey) error {
+	const op = "service.Keeper.Unlock"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	check := key.BlindID("key check")
+	saved, err := s.syncStore.KeyCheck(ctx)
+	if err != nil {
+		log.Error("query vault key check error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	if saved != "" && saved != check {
+		return fmt.Errorf("%s: %w", op, ErrWrongMasterPassword)
+	}
+
+	migration, err := s.syncStore.LegacyMigration(ctx)
+	if err != nil {
+		log.Error("query legacy migration flag error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	if saved == "" || migration {
+		if err = s.syncStore.SetRevision(ctx, 0); err != nil {
+			log.Error("reset applied revision error", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+	}
+
+	s.mu.Lock()
+	s.vault = key
+	s.verified = saved != ""
+	s.rejected = false
+	s.migrating = migration
+	s.mu.Unlock()
+	return nil
+}
+
+// verify is called when the full snapshot ends, it reports whether the snapshot is applied with the vault key.
+// Unverified key is rejected if snapshot items could not be decrypted with it and none could: the vault is locked
+// and the snapshot is dropped. Otherwise the key check is saved, waiting changes and uploads are sent.
+func (s *Keeper) verify(ctx context.Context) bool {
+	const op = "service.Keeper.verify"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	s.mu.Lock()
+	key, verified, opened, failed := s.vault, s.verified, s.opened, s.failed
+	s.mu.Unlock()
+
+	if key == nil {
+		return false
+	}
+	if verified {
+		return true
+	}
+	if opened == 0 && failed > 0 {
+		log.Error("master password is rejected, vault is locked", slog.Int("items", failed), sl.Err(ErrRejectedPassword))
+		s.mu.Lock()
+		s.vault, s.rejected = nil, true
+		s.snapshot, s.delivered = false, nil
+		s.mu.Unlock()
+		return false
+	}
+
+	if err := s.syncStore.SetKeyCheck(ctx, key.BlindID("key check")); err != nil {
+		log.Error("save vault key check error", sl.Err(err))
+	}
+	s.mu.Lock()
+	s.verified = true
+	s.mu.Unlock()
+
+	s.notify()
+	select {
+	case s.uploaded <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// VaultState returns the state of the vault key: locked, unverified, rejected or unlocked.
+func (s *Keeper) VaultState() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.rejected:
+		return "master password rejected, log in again"
+	case s.vault == nil:
+		return "locked"
+	case !s.verified:
+		return "unverified"
+	default:
+		return "unlocked"
+	}
+}
+
+// legacyMigration reports whether items saved in clear are accepted.
+func (s *Keeper) legacyMigration() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.migrating
+}
+
+// finishMigration clears the legacy migration flag, it is called when the full snapshot is applied:
+// all items saved in clear are re-encrypted (their changes are in outbox).
+func (s *Keeper) finishMigration(ctx context.Context) {
+	const op = "service.Keeper.finishMigration"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	if !s.legacyMigration() {
+		return
+	}
+	if err := s.syncStore.SetLegacyMigration(ctx, false); err != nil {
+		log.Error("clear legacy migration flag error", sl.Err(err))
+		return
+	}
+
+	s.mu.Lock()
+	s.migrating = false
+	s.mu.Unlock()
+}
+
+func (s *Keeper) vaultKey() *encrypt.VaultKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.vault
+}
+
+// verifiedKey returns the vault key which may encrypt data sent to the server.
+func (s *Keeper) verifiedKey() (*encrypt.VaultKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.vault == nil {
+		return nil, ErrLocked
+	}
+	if !s.verified {
+		return nil, ErrUnverified
+	}
+	return s.vault, nil
+}
+
+// seal converts the item into envelope: identifiers are keyed hashes of the item type and ID,
+// data is the item encrypted and bound to the identifiers. History request has no data. Files referenced by the item are listed in clear,
+// the server keeps their chunks while any item version references them.
+func (s *Keeper) seal(value []byte, withData bool) ([]byte, error) {
+	key := s.vaultKey()
+	if key == nil {
+		return nil, ErrLocked
+	}
+
+	kind, itemKey := itemIdentity(value)
+	env := models.Envelope{
+		Type: key.BlindID("type", kind.String()),
+		Key:  key.BlindID("item", kind.String(), itemKey),
+	}
+	if withData {
+		data, err := key.Seal(value, env.Type, env.Key)
+		if err != nil {
+			return nil, err
+		}
+		env.Data = data
+		env.Files = itemFiles(value)
+	}
+	return json.Marshal(env)
+}
+
+// sealChange converts the outbox change into envelope, ErrUnverified is returned until the vault key is verified.
+// Legacy change keeps type and key of the legacy version in clear, so the server finds it.
+func (s *Keeper) sealChange(change models.PendingChange) ([]byte, error) {
+	key, err := s.verifiedKey()
+	if err != nil {
+		return nil, err
+	}
+	if !change.Legacy {
+		return s.seal(change.Value, true)
+	}
+
+	data, err := key.Seal(change.Value, change.Type.String(), change.Key)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(models.Envelope{Type: change.Type.String(), Key: change.Key, Data: data, Files: itemFiles(change.Value)})
+}
+
+// open decrypts the item from envelope, the item must be bound to the identifiers of the envelope,
+// so the server cannot move an item into another envelope.
+// legacy is true for the item version saved before end-to-end encryption: its data is not encrypted
+// and identifiers are the item type and key in clear. It is accepted only during legacy migration.
+func (s *Keeper) open(value []byte) (item []byte, legacy bool, err error) {
+	key := s.vaultKey()
+	if key == nil {
+		return nil, false, ErrLocked
+	}
+
+	var env models.Envelope
+	if err = json.Unmarshal(value, &env); err != nil {
+		return nil, false, err
+	}
+
+	item, err = key.Open(env.Data, env.Type, env.Key)
+	if err == nil {
+		return item, false, nil
+	}
+
+	if !s.legacyMigration() {
+		return nil, false, err
+	}
+	kind, itemKey := itemIdentity(env.Data)
+	if _, ok := models.Lookup(kind); ok && kind.String() == env.Type && itemKey == env.Key {
+		return env.Data, true, nil
+	}
+	return nil, false, err
+}
+
+// reencrypt replaces the item version saved before end-to-end encryption by the encrypted one.
+// Legacy version has another identity on the server (type and key in clear), so it is deleted
+// and the item is saved again as a new encrypted item. Other clients receive the deletion and then the item.
+// The server purges the history of the legacy version when it saves the deletion.
+func (s *Keeper) reencrypt(ctx context.Context, msg models.Message) {
+	const op = "service.Keeper.reencrypt"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	kind, key := itemIdentity(msg.Value)
+	legacy := models.PendingChange{ID: newRequestID(), Type: kind, Key: key, Value: msg.Value, Deleted: true, BaseRevision: msg.Revision, Legacy: true}
+	encrypted := models.PendingChange{ID: newRequestID(), Type: kind, Key: key, Value: msg.Value}
+	if err := s.outboxStore.Save(ctx, legacy, encrypted); err != nil {
+		log.Error("save re-encrypted item into outbox error", sl.Err(err))
+		return
+	}
+	s.notify()
+}
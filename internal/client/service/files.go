@@ -0,0 +1,398 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// fileChunkSize is the size of file chunks before encryption, an encrypted chunk is a bit larger.
+const fileChunkSize = 1 << 20
+
+var (
+	ErrFileNotFound    = errors.New("file does not exist")
+	ErrExtractFile     = errors.New("extract file error")
+	ErrFileChanged     = errors.New("file was changed during upload")
+	ErrFileHash        = errors.New("downloaded file does not match its hash")
+	ErrFileNotUploaded = errors.New("file is not uploaded yet")
+)
+
+// AddFile saves the file as the binary item: Key of the item is the file name. The file is not read into memory,
+// it is hashed and uploaded in encrypted chunks in background (RunUploads). The item is saved locally at once
+// and sent to the server when all chunks are uploaded, so other clients never see the file without content.
+// The file is addressed by its content: the same content added again is not uploaded again.
+func (s *Keeper) AddFile(ctx context.Context, bin models.Binary, path string) error {
+	const op = "service.Binary.AddFile"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("file path", path),
+	)
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		log.Error("file does not exist")
+		return fmt.Errorf("%s: %w", op, ErrFileNotFound)
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		log.Error("file is not a regular file", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrExtractFile)
+	}
+
+	key := s.vaultKey()
+	if key == nil {
+		return fmt.Errorf("%s: %w", op, ErrLocked)
+	}
+	sum, err := fileHash(path)
+	if err != nil {
+		log.Error("hash file error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrExtractFile)
+	}
+
+	bin.ID = newItemID()
+	bin.Key = info.Name()
+	bin.Value = nil
+	bin.File = newFileRef(key, sum, info.Size())
+	if msg := validateItem(bin); len(msg) > 0 {
+		return fmt.Errorf("%s: %w", op, InvalidItemError{Reasons: msg})
+	}
+
+	upload := models.Upload{Binary: bin, Path: path, ModTime: info.ModTime().UnixNano()}
+	if err = s.addUpload(ctx, upload); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// addUpload saves the upload and the binary item locally, then wakes up RunUploads.
+func (s *Keeper) addUpload(ctx context.Context, upload models.Upload) error {
+	if err := s.uploadStore.Save(ctx, upload); err != nil {
+		s.log.Error("save upload error", slog.String("op", "service.Keeper.addUpload"), sl.Err(err))
+		return ErrInternal
+	}
+	value, _ := json.Marshal(upload.Binary)
+	if err := s.saveItem(ctx, value); err != nil {
+		return err
+	}
+
+	select {
+	case s.uploaded <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// moveInline moves content of the binary items saved before files into files, the items are sent again
+// referencing the files. The content is kept in the upload until the file is uploaded.
+func (s *Keeper) moveInline(ctx context.Context) error {
+	key, err := s.verifiedKey()
+	if err != nil {
+		return err
+	}
+	values, err := s.Items(ctx, models.BinItem)
+	if err != nil {
+		return err
+	}
+	for _, bin := range decodeItems[models.Binary](values) {
+		if bin.File != nil || len(bin.Value) == 0 {
+			continue
+		}
+		sum := sha256.Sum256(bin.Value)
+		content := bin.Value
+		bin.Value = nil
+		bin.File = newFileRef(key, hex.EncodeToString(sum[:]), int64(len(content)))
+		if err = s.addUpload(ctx, models.Upload{Binary: bin, Content: content}); err != nil {
+			return err
+		}
+		s.log.Info("binary content is moved into file", slog.String("op", "service.Keeper.moveInline"),
+			slog.String("file", bin.Key))
+	}
+	return nil
+}
+
+// RunUploads uploads the waiting files until the context is done. Upload interrupted by an error
+// (connection lost, client stopped) is resumed after retry delay from the chunks missing on the server.
+// Content of binary items saved before files is moved into files first.
+func (s *Keeper) RunUploads(ctx context.Context, retry time.Duration) {
+	const op = "service.Keeper.RunUploads"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	moved := false
+	for {
+		var again <-chan time.Time
+		if !moved {
+			// vault may be locked or unverified yet, items are moved after it is verified
+			err := s.moveInline(ctx)
+			if err != nil && !errors.Is(err, ErrLocked) && !errors.Is(err, ErrUnverified) {
+				log.Error("move binary content into files error", sl.Err(err))
+			}
+			moved = err == nil
+			if !moved {
+				again = time.After(retry)
+			}
+		}
+		// files are uploaded when the vault key is verified, verify wakes up the uploader
+		var uploads []models.Upload
+		if _, err := s.verifiedKey(); err == nil {
+			uploads, err = s.uploadStore.All(ctx)
+			if err != nil {
+				log.Error("query uploads error", sl.Err(err))
+				again = time.After(retry)
+			}
+		}
+		for _, upload := range uploads {
+			if upload.Error != "" {
+				continue
+			}
+			if err := s.upload(ctx, upload); err != nil {
+				log.Warn("upload interrupted, it is resumed later",
+					slog.String("file", upload.Binary.Key),
+					slog.Duration("delay", retry),
+					sl.Err(err),
+				)
+				again = time.After(retry)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.uploaded:
+		case <-again:
+		}
+	}
+}
+
+// upload sends chunks of the file missing on the server, then sends the binary item referencing the file.
+// Upload of the changed file is failed: its hash is known only for the content it had when it was added.
+func (s *Keeper) upload(ctx context.Context, upload models.Upload) error {
+	const op = "service.Keeper.upload"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("file path", upload.Path),
+	)
+
+	bin, file := upload.Binary, upload.Binary.File
+	var f io.ReaderAt
+	if upload.Content != nil {
+		f = bytes.NewReader(upload.Content)
+	} else {
+		info, err := os.Stat(upload.Path)
+		if err != nil || info.Size() != file.Size || info.ModTime().UnixNano() != upload.ModTime {
+			log.Error("file was changed or removed, upload failed", sl.Err(err))
+			if err = s.uploadStore.Fail(ctx, bin.ID, ErrFileChanged.Error()); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			return nil
+		}
+		opened, err := os.Open(upload.Path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer opened.Close()
+		f = opened
+	}
+
+	uploaded, err := s.files.Uploaded(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	done := make(map[int]bool, len(uploaded))
+	for _, n := range uploaded {
+		done[n] = true
+	}
+
+	buf := make([]byte, file.ChunkSize)
+	for n := 0; n < file.Chunks; n++ {
+		if done[n] {
+			continue
+		}
+		size, err := f.ReadAt(buf, int64(n)*file.ChunkSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		chunk, err := encrypt.Encrypt(buf[:size], string(file.Key), fileChunkAD(file.ID, n))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err = s.files.Put(ctx, file.ID, n, chunk); err != nil {
+			return fmt.Errorf("%s: chunk %d: %w", op, n, err)
+		}
+	}
+
+	// file deleted or replaced locally during upload is not sent, the item edited during upload is sent as it is saved
+	if saved, err := s.itemStore.ByID(ctx, models.BinItem, bin.ID); err == nil && slices.Equal(itemFiles(saved), []string{file.ID}) {
+		if err = s.send(ctx, itemToMsg(saved)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err = s.uploadStore.Delete(ctx, bin.ID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("file uploaded", slog.Int64("size", file.Size), slog.Int("chunks", file.Chunks))
+	return nil
+}
+
+// SaveFile writes content of the binary item into the file at path. Chunks of the file are downloaded only now,
+// they are written into path + ".part" first: download interrupted by an error is resumed from the last complete
+// chunk by the next call. ErrFileNotUploaded is returned while the file is uploaded from this client. The file appears at path only if its content matches the hash of the item,
+// otherwise the partial file is removed and ErrFileHash is returned.
+func (s *Keeper) SaveFile(ctx context.Context, bin models.Binary, path string) error {
+	const op = "service.Binary.SaveFile"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("file path", path),
+	)
+
+	file := bin.File
+	if file == nil {
+		if err := os.WriteFile(path, bin.Value, 0o600); err != nil {
+			log.Error("write file error", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	if s.uploading(ctx, file.ID) {
+		return fmt.Errorf("%s: %w", op, ErrFileNotUploaded)
+	}
+
+	part := path + ".part"
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Error("open file error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	start, err := resumeDownload(f, h, file.ChunkSize)
+	if err != nil {
+		log.Error("resume download error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for n := start; n < file.Chunks; n++ {
+		chunk, err := s.files.Get(ctx, file.ID, n)
+		if err != nil {
+			log.Error("download chunk error", slog.Int("chunk", n), sl.Err(err))
+			return fmt.Errorf("%s: chunk %d: %w", op, n, err)
+		}
+		data, err := encrypt.Decrypt(chunk, string(file.Key), fileChunkAD(file.ID, n))
+		if err != nil {
+			log.Error("decrypt chunk error", slog.Int("chunk", n), sl.Err(err))
+			_ = os.Remove(part)
+			return fmt.Errorf("%s: chunk %d: %w", op, n, ErrFileHash)
+		}
+		if _, err = f.Write(data); err != nil {
+			log.Error("write file error", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		h.Write(data)
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != file.Hash {
+		log.Error("downloaded file does not match its hash")
+		_ = os.Remove(part)
+		return fmt.Errorf("%s: %w", op, ErrFileHash)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = os.Rename(part, path); err != nil {
+		log.Error("rename downloaded file error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// uploading reports whether the file is still being uploaded from this client.
+func (s *Keeper) uploading(ctx context.Context, id string) bool {
+	return s.findUpload(ctx, func(upload models.Upload) bool { return upload.Binary.File.ID == id })
+}
+
+// uploadingItem reports whether the file of the binary item is being uploaded.
+func (s *Keeper) uploadingItem(ctx context.Context, id string) bool {
+	return s.findUpload(ctx, func(upload models.Upload) bool { return upload.Binary.ID == id })
+}
+
+func (s *Keeper) findUpload(ctx context.Context, match func(upload models.Upload) bool) bool {
+	uploads, err := s.uploadStore.All(ctx)
+	if err != nil {
+		return false
+	}
+	for _, upload := range uploads {
+		if match(upload) {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeDownload keeps complete chunks of the partial file and hashes them, the file is positioned after them.
+// Number of the first missing chunk is returned.
+func resumeDownload(f *os.File, h hash.Hash, chunkSize int64) (int, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	complete := info.Size() / chunkSize
+	if err = f.Truncate(complete * chunkSize); err != nil {
+		return 0, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err = io.CopyN(h, f, complete*chunkSize); err != nil {
+		return 0, err
+	}
+	return int(complete), nil
+}
+
+// newFileRef references the content with the hash: ID and Key are derived from the hash with the vault key,
+// so equal content gets the same file on every client of the user and other users can not guess it.
+func newFileRef(key *encrypt.VaultKey, hash string, size int64) *models.FileRef {
+	return &models.FileRef{
+		ID:        key.BlindID("file", hash),
+		Size:      size,
+		ChunkSize: fileChunkSize,
+		Chunks:    int((size + fileChunkSize - 1) / fileChunkSize),
+		Hash:      hash,
+		Key:       key.FileKey(hash),
+	}
+}
+
+// fileHash returns SHA-256 (hex) of the file content.
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileChunkAD binds the encrypted chunk to its file and position, chunks can not be swapped by the server.
+func fileChunkAD(fileID string, n int) []byte {
+	return []byte(fmt.Sprintf("file:%d:%s|chunk:%d", len(fileID), fileID, n))
+}
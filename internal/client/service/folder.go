@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+func (s *Keeper) AllFolders(ctx context.Context) ([]models.Folder, error) {
+	values, err := s.Items(ctx, models.FolderItem)
+	if err != nil {
+		return nil, err
+	}
+	return decodeItems[models.Folder](values), nil
+}
+
+// FolderPaths returns paths of all folders (Work/Banks) by the folder ID.
+// The folder whose parent is deleted is shown at the top level.
+func (s *Keeper) FolderPaths(ctx context.Context) (map[string]string, error) {
+	folders, err := s.AllFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return models.FolderPaths(folders), nil
+}
+
+// EnsureFolder returns ID of the folder with the path, missing folders of the path are created.
+// Empty path is the top level, its ID is empty.
+func (s *Keeper) EnsureFolder(ctx context.Context, path string) (string, error) {
+	const op = "service.Folder.Ensure"
+
+	folders, err := s.AllFolders(ctx)
+	if err != nil {
+		return "", err
+	}
+	paths := models.FolderPaths(folders)
+	ids := make(map[string]string, len(paths))
+	for id, path := range paths {
+		ids[path] = id
+	}
+
+	parent, current := "", ""
+	for _, name := range splitFolderPath(path) {
+		current = strings.TrimPrefix(current+models.FolderSeparator+name, models.FolderSeparator)
+		if id, ok := ids[current]; ok {
+			parent = id
+			continue
+		}
+		folder := models.Folder{ID: newItemID(), Type: models.FolderItem, Name: name, Folder: parent, Created: time.Now().Unix()}
+		value, _ := json.Marshal(folder)
+		if err = s.SendSave(ctx, value); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		ids[current], parent = folder.ID, folder.ID
+	}
+
+	return parent, nil
+}
+
+// TagCount is the number of items labeled with the tag.
+type TagCount struct {
+	Tag   string
+	Items int
+}
+
+// TagCounts returns tags of all items with the number of items labeled with each tag, ordered by tag.
+func (s *Keeper) TagCounts(ctx context.Context) ([]TagCount, error) {
+	values, err := s.AllItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, value := range values {
+		for _, tag := range models.ItemTags(value) {
+			counts[tag]++
+		}
+	}
+	res := make([]TagCount, 0, len(counts))
+	for tag, items := range counts {
+		res = append(res, TagCount{Tag: tag, Items: items})
+	}
+	slices.SortFunc(res, func(a, b TagCount) int {
+		return strings.Compare(a.Tag, b.Tag)
+	})
+	return res, nil
+}
+
+// RenameTag replaces the tag by the new one in all items and returns the number of changed items,
+// the tag is removed from items if the new one is empty.
+func (s *Keeper) RenameTag(ctx context.Context, tag string, renamed string) (int, error) {
+	const op = "service.Keeper.RenameTag"
+
+	values, err := s.AllItems(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, value := range values {
+		value, ok := models.RenameTag(value, tag, strings.TrimSpace(renamed))
+		if !ok {
+			continue
+		}
+		if err = s.sendItem(ctx, value); err != nil {
+			return changed, fmt.Errorf("%s: %w", op, err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// Filter returns items labeled with the tag and put into the folder with the path or into its subfolders,
+// items are encoded into JSON and ordered by type. Empty tag or path does not filter items.
+func (s *Keeper) Filter(ctx context.Context, tag string, path string) ([][]byte, error) {
+	values, err := s.AllItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := s.FolderPaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path = strings.Join(splitFolderPath(path), models.FolderSeparator)
+	var found [][]byte
+	for _, value := range values {
+		if tag != "" && !slices.Contains(models.ItemTags(value), tag) {
+			continue
+		}
+		if path != "" && !inFolder(paths[models.ItemFolder(value)], path) {
+			continue
+		}
+		found = append(found, value)
+	}
+	return found, nil
+}
+
+// splitFolderPath returns names of the folders of the path, empty names are dropped.
+func splitFolderPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, models.FolderSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// inFolder reports whether the folder with the path is the folder with the parent path or its subfolder.
+func inFolder(path string, parent string) bool {
+	return path == parent || strings.HasPrefix(path, parent+models.FolderSeparator)
+}
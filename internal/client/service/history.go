@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// History requests from the server all versions of the item, value is the item encoded into JSON.
+// Only the item identifiers are sent, versions are decrypted.
+func (s *Keeper) History(ctx context.Context, value []byte) ([]models.Version, error) {
+	const op = "service.History"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	request, err := s.seal(value, false)
+	if err != nil {
+		log.Error("encrypt item identifiers error", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	values, err := s.request(ctx, models.Message{Type: models.History, Value: request})
+	if err != nil {
+		log.Error("request item history error", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res := make([]models.Version, 0, len(values))
+	for _, value := range values {
+		var version models.Version
+		if err = json.Unmarshal(value, &version); err != nil {
+			log.Error("unexpected history response", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+		item, _, err := s.open(version.Value)
+		if err != nil {
+			log.Error("failed decrypt item version, it is skipped", slog.Int64("revision", version.Revision), sl.Err(err))
+			continue
+		}
+		version.Value = item
+		res = append(res, version)
+	}
+	return res, nil
+}
+
+// Restore saves the past version of the item as the current one.
+func (s *Keeper) Restore(ctx context.Context, version models.Version) error {
+	value := touch(version.Value)
+	msg := models.Message{Type: models.New, Value: value}
+	if version.Deleted {
+		msg.Type = models.Delete
+		s.remove(ctx, value)
+	} else {
+		s.apply(ctx, value)
+	}
+	return s.send(ctx, msg)
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var ErrInvalidItem = errors.New("invalid item")
+
+// InvalidItemError lists the reasons the item typed by the user is invalid, it is ErrInvalidItem.
+type InvalidItemError struct {
+	Reasons []string
+}
+
+func (e InvalidItemError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidItem, strings.Join(e.Reasons, ", "))
+}
+
+func (e InvalidItemError) Is(target error) bool {
+	return target == ErrInvalidItem
+}
+
+// SendSave validates the item encoded into JSON against the schema of its type, saves it and sends it.
+// The new item gets ID and the creation time.
+func (s *Keeper) SendSave(ctx context.Context, value []byte) error {
+	const op = "service.Keeper.SendSave"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	kind, _ := itemIdentity(value)
+	schema, ok := models.Lookup(kind)
+	if !ok {
+		log.Error("unknown item type", slog.String("type", kind.String()))
+		return fmt.Errorf("%s: %w", op, ErrInvalidItem)
+	}
+	if msg := schema.Validate(value); len(msg) > 0 {
+		return fmt.Errorf("%s: %w", op, InvalidItemError{Reasons: msg})
+	}
+
+	var item map[string]any
+	_ = json.Unmarshal(value, &item)
+	if id, _ := item["id"].(string); id == "" {
+		item["id"] = newItemID()
+	}
+	if created, _ := item["created"].(float64); created == 0 {
+		item["created"] = time.Now().Unix()
+	}
+	value, _ = json.Marshal(item)
+
+	return s.sendItem(ctx, value)
+}
+
+// sendItem sends the item and saves it locally. Item edited while its file is uploaded is only saved locally,
+// the upload sends it when the file is complete.
+func (s *Keeper) sendItem(ctx context.Context, value []byte) error {
+	_, id := itemIdentity(value)
+	if len(itemFiles(value)) > 0 && s.uploadingItem(ctx, id) {
+		return s.saveItem(ctx, value)
+	}
+	if err := s.send(ctx, itemToMsg(value)); err != nil {
+		return err
+	}
+
+	return s.saveItem(ctx, value)
+}
+
+// saveItem saves the item encoded into JSON locally, it replaces the saved item with the same ID.
+// Items of older clients are normalized, the item saved before IDs gets its natural key as ID.
+func (s *Keeper) saveItem(ctx context.Context, value []byte) error {
+	const op = "service.Keeper.saveItem"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	value = models.Normalize(value)
+	kind, id := itemIdentity(value)
+	if _, ok := models.Lookup(kind); !ok || id == "" {
+		log.Error("unknown item type or item without ID", slog.String("type", kind.String()))
+		return fmt.Errorf("%s: %w", op, ErrInvalidItem)
+	}
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(value, &item); err != nil {
+		return fmt.Errorf("%s: %w: %w", op, ErrInvalidItem, err)
+	}
+	if _, ok := item["id"]; !ok {
+		item["id"], _ = json.Marshal(id)
+		value, _ = json.Marshal(item)
+	}
+
+	if err := s.itemStore.Save(ctx, kind, id, value); err != nil {
+		log.Error("save item error", slog.String("type", kind.String()), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	return nil
+}
+
+// SendDelete deletes the item encoded into JSON and sends the deletion, upload of its file is abandoned.
+// Only the identity of the item is sent, its content is not needed to delete it.
+func (s *Keeper) SendDelete(ctx context.Context, value []byte) error {
+	const op = "service.Keeper.SendDelete"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	kind, id := itemIdentity(value)
+	schema, ok := models.Lookup(kind)
+	if !ok {
+		log.Error("unknown item type", slog.String("type", kind.String()))
+		return fmt.Errorf("%s: %w", op, ErrInvalidItem)
+	}
+	if len(itemFiles(value)) > 0 {
+		if err := s.uploadStore.Delete(ctx, id); err != nil {
+			log.Error("delete upload error", sl.Err(err))
+		}
+	}
+
+	deleted := map[string]any{"id": id, "type": kind, "created": time.Now().Unix()}
+	if key := schema.NaturalKey(value); key != "" {
+		deleted[schema.Identity] = key
+	}
+	msg := models.Message{Type: models.Delete}
+	msg.Value, _ = json.Marshal(deleted)
+	if err := s.send(ctx, msg); err != nil {
+		return err
+	}
+
+	return s.deleteItem(ctx, msg.Value)
+}
+
+func (s *Keeper) deleteItem(ctx context.Context, value []byte) error {
+	const op = "service.Keeper.deleteItem"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	kind, id := itemIdentity(value)
+	if err := s.itemStore.Delete(ctx, kind, id); err != nil {
+		log.Error("delete item error", slog.String("type", kind.String()), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	return nil
+}
+
+// Item returns the item of the type with the ID encoded into JSON.
+func (s *Keeper) Item(ctx context.Context, kind models.ItemType, id string) ([]byte, error) {
+	const op = "service.Keeper.Item"
+
+	value, err := s.itemStore.ByID(ctx, kind, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return value, nil
+}
+
+// Items returns items of the type encoded into JSON.
+func (s *Keeper) Items(ctx context.Context, kind models.ItemType) ([][]byte, error) {
+	const op = "service.Keeper.Items"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	values, err := s.itemStore.All(ctx, kind)
+	if err != nil {
+		log.Error("query items error", slog.String("type", kind.String()), sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	return values, nil
+}
+
+// AllItems returns items of every type encoded into JSON ordered by type, folders are not items.
+func (s *Keeper) AllItems(ctx context.Context) ([][]byte, error) {
+	var res [][]byte
+	for _, schema := range models.Schemas() {
+		if schema.Type == models.FolderItem {
+			continue
+		}
+		values, err := s.Items(ctx, schema.Type)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, values...)
+	}
+	return res, nil
+}
+
+// Search returns items containing the query in a field value or in a custom field name (case-insensitive),
+// items are encoded into JSON and ordered by type. Secret values are not searched.
+func (s *Keeper) Search(ctx context.Context, query string) ([][]byte, error) {
+	values, err := s.AllItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found [][]byte
+	for _, value := range values {
+		kind, _ := itemIdentity(value)
+		if schema, ok := models.Lookup(kind); ok && schema.Match(value, query) {
+			found = append(found, value)
+		}
+	}
+	return found, nil
+}
+
+// decodeItems decodes items of one type encoded into JSON, the item which cannot be decoded is skipped.
+func decodeItems[T any](values [][]byte) []T {
+	items := make([]T, 0, len(values))
+	for _, value := range values {
+		var item T
+		if err := json.Unmarshal(value, &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validateItem returns the reasons the item is invalid by the schema of its type.
+func validateItem(item any) []string {
+	value, _ := json.Marshal(item)
+	kind, _ := itemIdentity(value)
+	schema, ok := models.Lookup(kind)
+	if !ok {
+		return []string{"unknown item type"}
+	}
+	return schema.Validate(value)
+}
+
+func itemToMsg(value []byte) models.Message {
+	return models.Message{
+		Type:  "new",
+		Value: value,
+	}
+}
@@ -2,101 +2,529 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
 	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
 )
 
+const requestTimeout = 10 * time.Second
+
+var (
+	ErrInternal       = errors.New("internal error")
+	ErrRequestTimeout = errors.New("server did not respond in time")
+	ErrServer         = errors.New("server error")
+	ErrInvalidToken   = errors.New("server rejected the token")
+	ErrInvalidRequest = errors.New("server rejected the request")
+)
+
 type closeable interface {
 	Close() error
 }
 
-type CredentialsStorager interface {
+// ItemStorager keeps items of every type of the schema registry encoded into JSON,
+// items are keyed by the item type and the item ID.
+type ItemStorager interface {
 	closeable
-	All(ctx context.Context) ([]models.Credentials, error)
-	ByLogin(ctx context.Context, login string) (models.Credentials, error)
-	Save(ctx context.Context, cred models.Credentials) error
-	Update(ctx context.Context, cred models.Credentials) error
+	All(ctx context.Context, kind models.ItemType) ([][]byte, error)
+	ByID(ctx context.Context, kind models.ItemType, id string) ([]byte, error)
+	Save(ctx context.Context, kind models.ItemType, id string, value []byte) error
+	Delete(ctx context.Context, kind models.ItemType, id string) error
 }
 
-type TextStorager interface {
+// SyncStorager keeps the last server revision applied to local storage.
+type SyncStorager interface {
 	closeable
-	All(ctx context.Context) ([]models.Text, error)
-	ByKey(ctx context.Context, key string) (models.Text, error)
-	Save(ctx context.Context, text models.Text) error
-	Update(ctx context.Context, text models.Text) error
+	Revision(ctx context.Context) (int64, error)
+	SetRevision(ctx context.Context, revision int64) error
+	ItemRevision(ctx context.Context, kind models.ItemType, key string) (int64, error)
+	SetItemRevision(ctx context.Context, kind models.ItemType, key string, revision int64) error
+	Sweep(ctx context.Context, delivered func(kind models.ItemType, key string) bool, revision int64) error
+	KeyCheck(ctx context.Context) (string, error)
+	SetKeyCheck(ctx context.Context, check string) error
+	LegacyMigration(ctx context.Context) (bool, error)
+	SetLegacyMigration(ctx context.Context, migration bool) error
 }
 
-type BinaryStorager interface {
+// ConflictStorager keeps item versions rejected by the server until the user resolves them.
+type ConflictStorager interface {
 	closeable
-	All(ctx context.Context) ([]models.Binary, error)
-	ByKey(ctx context.Context, key string) (models.Binary, error)
-	Save(ctx context.Context, bin models.Binary) error
-	Update(ctx context.Context, bin models.Binary) error
+	All(ctx context.Context) ([]models.ConflictVersion, error)
+	Save(ctx context.Context, conflict models.ConflictVersion) error
+	Delete(ctx context.Context, revision int64) error
+	Resolve(ctx context.Context, kind models.ItemType, key string, revision int64) error
 }
 
-type CardStorager interface {
+// OutboxStorager keeps local changes until the server acknowledges or rejects them.
+type OutboxStorager interface {
 	closeable
-	All(ctx context.Context) ([]models.Card, error)
-	ByNumber(ctx context.Context, number string) (models.Card, error)
-	Save(ctx context.Context, card models.Card) error
-	Update(ctx context.Context, card models.Card) error
+	All(ctx context.Context) ([]models.PendingChange, error)
+	Ready(ctx context.Context) ([]models.PendingChange, error)
+	Save(ctx context.Context, changes ...models.PendingChange) error
+	Ack(ctx context.Context, id string, revision int64) error
+	Fail(ctx context.Context, id string, code models.ErrorCode, reason string) error
+}
+
+// UploadStorager keeps files being uploaded in chunks until the upload is complete, uploads are keyed by the item ID.
+type UploadStorager interface {
+	closeable
+	All(ctx context.Context) ([]models.Upload, error)
+	Save(ctx context.Context, upload models.Upload) error
+	Fail(ctx context.Context, id string, reason string) error
+	Delete(ctx context.Context, id string) error
+}
+
+// FileTransfer sends and receives encrypted file chunks.
+type FileTransfer interface {
+	Put(ctx context.Context, fileID string, n int, data []byte) error
+	Get(ctx context.Context, fileID string, n int) ([]byte, error)
+	Uploaded(ctx context.Context, fileID string) ([]int, error)
 }
 
 type Keeper struct {
-	log       *slog.Logger
-	ch        chan models.Message
-	credStore CredentialsStorager
-	textStore TextStorager
-	binStore  BinaryStorager
-	cardStore CardStorager
+	log           *slog.Logger
+	ch            chan models.Message
+	itemStore     ItemStorager
+	syncStore     SyncStorager
+	conflictStore ConflictStorager
+	outboxStore   OutboxStorager
+	uploadStore   UploadStorager
+	files         FileTransfer
+
+	// changed signals the websocket writer that outbox has changes ready to be sent
+	changed chan struct{}
+	// uploaded signals the uploader that a new file is waiting for upload
+	uploaded chan struct{}
+
+	// pending requests waiting for the server response, by request ID
+	mu      *sync.Mutex
+	pending map[string]pendingRequest
+
+	// vault key derived from the master password, nil until Unlock. Key unlocked on the device without key check
+	// is verified by the full snapshot: opened and failed count snapshot items decrypted and not decrypted with it
+	vault    *encrypt.VaultKey
+	verified bool
+	rejected bool
+	opened   int
+	failed   int
+	// snapshot is true from the beginning of the full snapshot to its end, the revision cursor is not moved meanwhile.
+	// delivered items of the snapshot (and items updated meanwhile) are kept when the snapshot ends, others are removed
+	snapshot  bool
+	delivered map[models.ItemType]map[string]struct{}
+	// migrating is true while items saved in clear before end-to-end encryption are accepted and re-encrypted
+	migrating bool
 }
 
-func NewKeeper(log *slog.Logger, ch chan models.Message, credStore CredentialsStorager,
-	textStore TextStorager, binStore BinaryStorager, cardStore CardStorager) *Keeper {
+func NewKeeper(log *slog.Logger, ch chan models.Message, itemStore ItemStorager, syncStore SyncStorager, conflictStore ConflictStorager, outboxStore OutboxStorager,
+	uploadStore UploadStorager, files FileTransfer) *Keeper {
 
 	return &Keeper{
-		log:       log,
-		ch:        ch,
-		credStore: credStore,
-		textStore: textStore,
-		binStore:  binStore,
-		cardStore: cardStore,
+		log:           log,
+		ch:            ch,
+		itemStore:     itemStore,
+		syncStore:     syncStore,
+		conflictStore: conflictStore,
+		outboxStore:   outboxStore,
+		uploadStore:   uploadStore,
+		files:         files,
+		changed:       make(chan struct{}, 1),
+		uploaded:      make(chan struct{}, 1),
+		mu:            &sync.Mutex{},
+		pending:       make(map[string]pendingRequest),
 	}
 }
 
+// Revision returns the last server revision applied to local storage.
+// Client sends it to the server on connect to receive only changes after it.
+func (s *Keeper) Revision(ctx context.Context) (int64, error) {
+	return s.syncStore.Revision(ctx)
+}
+
+// ApplyMessage applies the server message to local storage.
+// Items are decrypted with the vault key, the item which cannot be decrypted is skipped.
+// Items saved before end-to-end encryption are applied and re-encrypted.
 func (s *Keeper) ApplyMessage(ctx context.Context, msg models.Message) {
+	const op = "service.Keeper.ApplyMessage"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	if msg.ID != "" && s.deliver(msg) {
+		return
+	}
+	if msg.ID != "" && isResponse(msg.Type) {
+		// response to the request which is already finished, it must not change local storage
+		log.Info("late response is dropped", slog.String("request id", msg.ID), slog.String("type", msg.Type.String()))
+		return
+	}
+
+	legacy := false
+	if msg.Type == models.Update || msg.Type == models.Delete || msg.Type == models.Conflict {
+		value, isLegacy, err := s.open(msg.Value)
+		if err != nil {
+			log.Error("failed decrypt item, it is skipped", slog.Int64("revision", msg.Revision), sl.Err(err))
+			return
+		}
+		msg.Value, legacy = value, isLegacy
+	}
+
 	switch msg.Type {
-	case models.Update:
-		s.apply(ctx, msg.Value)
+	case models.Ack:
+		s.answered(log, msg, s.outboxStore.Ack(ctx, msg.ID, msg.Revision))
+		return
+	case models.Error:
+		if msg.ID == "" {
+			log.Error("server error", slog.String("code", string(msg.Code)), slog.String("reason", string(msg.Value)))
+			return
+		}
+		s.answered(log, msg, s.outboxStore.Fail(ctx, msg.ID, msg.Code, string(msg.Value)))
+		return
+	case models.Update, models.Delete:
+		s.applyItem(ctx, msg, legacy)
+		s.markDelivered(msg.Value)
+	case models.Conflict:
+		kind, key := itemIdentity(msg.Value)
+		conflict := models.ConflictVersion{Revision: msg.Revision, Type: kind, Key: key, Value: msg.Value, Deleted: msg.Deleted}
+		if err := s.conflictStore.Save(ctx, conflict); err != nil {
+			log.Error("save conflict error", sl.Err(err))
+		}
+	case models.SnapshotBegin:
+		// full snapshot replaces local state, items deleted on the server should disappear when it ends.
+		// Local items are kept until then and the revision is not moved (live updates between chunks are applied,
+		// but not remembered): if the snapshot is interrupted, the local vault stays usable offline
+		s.startSnapshot()
+	case models.SnapshotChunk:
+		s.applySnapshot(ctx, msg.Value)
+	case models.SnapshotEnd:
+		if s.inSnapshot() {
+			if s.verify(ctx) {
+				s.sweep(ctx, msg.Revision)
+				s.finishMigration(ctx)
+			}
+			return
+		}
 	case models.Snapshot:
-		var values [][]byte
-		_ = json.Unmarshal(msg.Value, &values)
+		// whole snapshot in one message is sent by older servers
+		s.startSnapshot()
+		s.applySnapshot(ctx, msg.Value)
+		if s.verify(ctx) {
+			s.sweep(ctx, msg.Revision)
+			s.finishMigration(ctx)
+		}
+		return
+	default:
+		return
+	}
+
+	if msg.Revision == 0 || s.inSnapshot() {
+		return
+	}
+	if err := s.syncStore.SetRevision(ctx, msg.Revision); err != nil {
+		log.Error("save applied revision error", sl.Err(err), slog.Int64("revision", msg.Revision))
+	}
+}
+
+// answered records the server answer (ack or error) to the pending change and wakes up the websocket writer:
+// changes waiting for this one may be ready now.
+func (s *Keeper) answered(log *slog.Logger, msg models.Message, err error) {
+	if err != nil {
+		log.Error("save answer to pending change error", slog.String("type", msg.Type.String()), slog.String("request id", msg.ID), sl.Err(err))
+	}
+	s.notify()
+}
+
+// applyItem applies the decrypted item change (update, deletion or snapshot item) and remembers its revision.
+// Legacy item (saved before end-to-end encryption) is re-encrypted.
+func (s *Keeper) applyItem(ctx context.Context, msg models.Message, legacy bool) {
+	if msg.Type == models.Delete {
+		s.remove(ctx, msg.Value)
+		s.applied(ctx, msg)
+		return
+	}
+	s.apply(ctx, msg.Value)
+	s.applied(ctx, msg)
+	if legacy {
+		s.reencrypt(ctx, msg)
+	}
+}
+
+// sweep ends the full snapshot: local items which were not delivered are removed and the snapshot revision is saved.
+func (s *Keeper) sweep(ctx context.Context, revision int64) {
+	const op = "service.Keeper.ApplyMessage"
+
+	s.mu.Lock()
+	delivered := s.delivered
+	s.snapshot, s.delivered = false, nil
+	s.mu.Unlock()
+
+	err := s.syncStore.Sweep(ctx, func(kind models.ItemType, key string) bool {
+		_, ok := delivered[kind][key]
+		return ok
+	}, revision)
+	if err != nil {
+		s.log.Error("remove items missing in snapshot error", slog.String("op", op), sl.Err(err), slog.Int64("revision", revision))
+	}
+}
+
+// markDelivered remembers the item is on the server while the full snapshot is applied.
+func (s *Keeper) markDelivered(value []byte) {
+	kind, key := itemIdentity(value)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.snapshot {
+		return
+	}
+	if s.delivered[kind] == nil {
+		s.delivered[kind] = make(map[string]struct{})
+	}
+	s.delivered[kind][key] = struct{}{}
+}
+
+// startSnapshot starts applying the full snapshot, delivered items are remembered and snapshot items decrypted
+// with the vault key are counted until it ends.
+func (s *Keeper) startSnapshot() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshot = true
+	s.delivered = make(map[models.ItemType]map[string]struct{})
+	s.opened, s.failed = 0, 0
+}
+
+// decrypted counts the snapshot item decrypted (or not) with the vault key, items in clear are not counted.
+func (s *Keeper) decrypted(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ok {
+		s.opened++
+	} else {
+		s.failed++
+	}
+}
+
+// inSnapshot reports whether the full snapshot is being applied.
+func (s *Keeper) inSnapshot() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot
+}
+
+// applySnapshot applies the list of snapshot items (update messages).
+// The item updated after the snapshot was read on the server (the update arrived before the chunk) is not replaced.
+func (s *Keeper) applySnapshot(ctx context.Context, value []byte) {
+	const op = "service.Keeper.ApplyMessage"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	var values []models.Message
+	if err := json.Unmarshal(value, &values); err != nil {
+		log.Error("failed decode snapshot chunk, it is skipped", sl.Err(err))
+		return
+	}
+
+	for _, value := range values {
+		item, isLegacy, err := s.open(value.Value)
+		if err != nil {
+			log.Error("failed decrypt item, it is skipped", slog.Int64("revision", value.Revision), sl.Err(err))
+			s.decrypted(false)
+			continue
+		}
+		if !isLegacy {
+			s.decrypted(true)
+		}
+		value.Value = item
+		s.markDelivered(value.Value)
+		kind, key := itemIdentity(value.Value)
+		if local, err := s.syncStore.ItemRevision(ctx, kind, key); err == nil && local > value.Revision {
+			continue
+		}
+		s.applyItem(ctx, value, isLegacy)
+	}
+}
+
+// applied remembers the revision of the local item version and drops conflicts resolved by it.
+func (s *Keeper) applied(ctx context.Context, msg models.Message) {
+	const op = "service.Keeper.ApplyMessage"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	if msg.Revision == 0 {
+		return
+	}
+	kind, key := itemIdentity(msg.Value)
+	if err := s.syncStore.SetItemRevision(ctx, kind, key, msg.Revision); err != nil {
+		log.Error("save item revision error", sl.Err(err))
+	}
+	if err := s.conflictStore.Resolve(ctx, kind, key, msg.Revision); err != nil {
+		log.Error("resolve conflicts error", sl.Err(err))
+	}
+}
+
+// send puts the change into outbox with the revision of the edited local version as base revision.
+// Websocket writer sends the change to the server when connection is established,
+// the change is kept in outbox until the server acknowledges it. The change is encrypted when it is sent.
+func (s *Keeper) send(ctx context.Context, msg models.Message) error {
+	const op = "service.Keeper.send"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	kind, key := itemIdentity(msg.Value)
+	base, err := s.syncStore.ItemRevision(ctx, kind, key)
+	if err != nil {
+		log.Error("query item revision error", sl.Err(err))
+	}
+
+	change := models.PendingChange{
+		ID:           newRequestID(),
+		Type:         kind,
+		Key:          key,
+		Value:        msg.Value,
+		Deleted:      msg.Type == models.Delete,
+		BaseRevision: base,
+	}
+	if err = s.outboxStore.Save(ctx, change); err != nil {
+		log.Error("save change into outbox error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	s.notify()
+	return nil
+}
+
+// notify wakes up websocket writer, it does not block if the writer is busy or disconnected.
+func (s *Keeper) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// pendingRequest receives messages of the response until the request is done.
+type pendingRequest struct {
+	wait chan models.Message
+	done chan struct{}
+}
+
+// request sends message to the server and collects the response with the same ID: values of snapshot_chunk
+// messages (JSON lists) between snapshot_begin and snapshot_end are joined. The server before streamed responses
+// answers with a single message with the whole list. The request fails if the next message of the response
+// is not received in time.
+func (s *Keeper) request(ctx context.Context, msg models.Message) ([]json.RawMessage, error) {
+	msg.ID = newRequestID()
+	pending := pendingRequest{wait: make(chan models.Message, 1), done: make(chan struct{})}
+
+	s.mu.Lock()
+	s.pending[msg.ID] = pending
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, msg.ID)
+		s.mu.Unlock()
+		close(pending.done)
+	}()
+
+	select {
+	case s.ch <- msg:
+	case <-time.After(requestTimeout):
+		return nil, ErrRequestTimeout
+	case <-ctx.Done():
+		return nil, ErrRequestTimeout
+	}
 
-		for _, value := range values {
-			s.apply(ctx, value)
+	var values []json.RawMessage
+	for {
+		select {
+		case resp := <-pending.wait:
+			switch resp.Type {
+			case models.Error:
+				return nil, serverError(resp)
+			case models.SnapshotBegin:
+			case models.SnapshotChunk:
+				var chunk []json.RawMessage
+				if err := json.Unmarshal(resp.Value, &chunk); err != nil {
+					return nil, err
+				}
+				values = append(values, chunk...)
+			case models.SnapshotEnd:
+				return values, nil
+			default:
+				if err := json.Unmarshal(resp.Value, &values); err != nil {
+					return nil, err
+				}
+				return values, nil
+			}
+		case <-time.After(requestTimeout):
+			return nil, ErrRequestTimeout
+		case <-ctx.Done():
+			return nil, ErrRequestTimeout
 		}
 	}
 }
 
+// serverError converts error message into the error by its code.
+func serverError(msg models.Message) error {
+	switch msg.Code {
+	case models.CodeInvalidToken:
+		return fmt.Errorf("%w: %s", ErrInvalidToken, string(msg.Value))
+	case models.CodeInvalidMessage:
+		return fmt.Errorf("%w: %s", ErrInvalidRequest, string(msg.Value))
+	default:
+		return fmt.Errorf("%w: %s", ErrServer, string(msg.Value))
+	}
+}
+
+// deliver passes the response message to the waiting request, false if nobody waits for it.
+// It waits until the request takes the message or finishes, so the response is read as fast as the request handles it.
+func (s *Keeper) deliver(msg models.Message) bool {
+	s.mu.Lock()
+	pending, ok := s.pending[msg.ID]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	select {
+	case pending.wait <- msg:
+	case <-pending.done:
+	}
+	return true
+}
+
 func (s *Keeper) Stop() {
 	const op = "service.Keeper.Stop"
 	log := s.log.With(
 		slog.String("op", op),
 	)
-	if err := s.binStore.Close(); err != nil {
-		log.Error("failed to close database connection for binary storage")
+	if err := s.itemStore.Close(); err != nil {
+		log.Error("failed to close database connection for item storage")
 	}
-	if err := s.cardStore.Close(); err != nil {
-		log.Error("failed to close database connection for card storage")
+	if err := s.syncStore.Close(); err != nil {
+		log.Error("failed to close database connection for sync storage")
 	}
-	if err := s.textStore.Close(); err != nil {
-		log.Error("failed to close database connection for text storage")
+	if err := s.conflictStore.Close(); err != nil {
+		log.Error("failed to close database connection for conflict storage")
 	}
-	if err := s.credStore.Close(); err != nil {
-		log.Error("failed to close database connection for credentials storage")
+	if err := s.outboxStore.Close(); err != nil {
+		log.Error("failed to close database connection for outbox storage")
+	}
+	if err := s.uploadStore.Close(); err != nil {
+		log.Error("failed to close database connection for upload storage")
 	}
 }
 
@@ -106,36 +534,76 @@ func (s *Keeper) apply(ctx context.Context, value []byte) {
 		slog.String("op", op),
 	)
 
-	var header struct{ Type string }
+	kind, _ := itemIdentity(value)
+	if err := s.saveItem(ctx, value); err != nil {
+		log.Error("apply item message error", slog.String("type", kind.String()), sl.Err(err))
+	}
+}
+
+func (s *Keeper) remove(ctx context.Context, value []byte) {
+	const op = "service.Keeper.ApplyMessage"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	kind, _ := itemIdentity(value)
+	if err := s.deleteItem(ctx, value); err != nil {
+		log.Error("apply item delete message error", slog.String("type", kind.String()), sl.Err(err))
+	}
+}
+
+// itemIdentity returns item type and the ID of the item, items saved before IDs are identified
+// by the natural key declared by the item schema: login, key or card number.
+func itemIdentity(value []byte) (models.ItemType, string) {
+	var header struct {
+		ID   string
+		Type models.ItemType
+	}
 	_ = json.Unmarshal(value, &header)
 
-	switch header.Type {
-	case models.CredItem.String():
-		var cred models.Credentials
-		_ = json.Unmarshal(value, &cred)
-		if err := s.saveCredentials(ctx, cred); err != nil {
-			log.Error("apply credentials message error", sl.Err(err))
-		}
+	if header.ID != "" {
+		return header.Type, header.ID
+	}
+	schema, ok := models.Lookup(header.Type)
+	if !ok {
+		return header.Type, ""
+	}
+	return header.Type, schema.NaturalKey(value)
+}
 
-	case models.TextItem.String():
-		var text models.Text
-		_ = json.Unmarshal(value, &text)
-		if err := s.saveText(ctx, text); err != nil {
-			log.Error("apply text message error", sl.Err(err))
-		}
+// newItemID returns the random ID of the new item (UUID version 4).
+func newItemID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
 
-	case models.BinItem.String():
-		var bin models.Binary
-		_ = json.Unmarshal(value, &bin)
-		if err := s.saveBinary(ctx, bin); err != nil {
-			log.Error("apply binary message error", sl.Err(err))
-		}
+// isResponse reports whether the message is a part of the response to the request (history, snapshot_at).
+func isResponse(t models.MessageType) bool {
+	switch t {
+	case models.SnapshotBegin, models.SnapshotChunk, models.SnapshotEnd, models.History, models.SnapshotAt:
+		return true
+	default:
+		return false
+	}
+}
 
-	case models.CardItem.String():
-		var card models.Card
-		_ = json.Unmarshal(value, &card)
-		if err := s.saveCard(ctx, card); err != nil {
-			log.Error("apply card message error", sl.Err(err))
-		}
+// itemFiles returns IDs of the files referenced by the item, only binary items reference a file.
+func itemFiles(value []byte) []string {
+	var bin struct {
+		Type models.ItemType
+		File *models.FileRef
+	}
+	if err := json.Unmarshal(value, &bin); err != nil || bin.Type != models.BinItem || bin.File == nil {
+		return nil
 	}
+	return []string{bin.File.ID}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
 }
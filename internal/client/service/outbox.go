@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// PendingChanges returns local changes not acknowledged by the server, rejected ones have Error set.
+func (s *Keeper) PendingChanges(ctx context.Context) ([]models.PendingChange, error) {
+	const op = "service.Outbox.All"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	changes, err := s.outboxStore.All(ctx)
+	if err != nil {
+		log.Error("query pending changes error", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	return changes, nil
+}
+
+// Waiting returns the number of local changes waiting to be saved by the server.
+func (s *Keeper) Waiting(ctx context.Context) (int, error) {
+	changes, err := s.PendingChanges(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, c := range changes {
+		if c.Code == "" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Outbox returns messages ready to be sent to the server in the order the changes were made, items are encrypted.
+// No messages are returned until the vault key is verified: nothing is encrypted with the key the vault may reject.
+func (s *Keeper) Outbox(ctx context.Context) ([]models.Message, error) {
+	const op = "service.Outbox.Ready"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	changes, err := s.outboxStore.Ready(ctx)
+	if err != nil {
+		log.Error("query outbox error", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	msgs := make([]models.Message, 0, len(changes))
+	for _, c := range changes {
+		value, err := s.sealChange(c)
+		if errors.Is(err, ErrUnverified) {
+			return nil, nil
+		}
+		if err != nil {
+			log.Error("encrypt change error", sl.Err(err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		msg := models.Message{ID: c.ID, Type: models.New, Value: value, BaseRevision: c.BaseRevision}
+		if c.Deleted {
+			msg.Type = models.Delete
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// Changed signals that outbox has new changes ready to be sent.
+func (s *Keeper) Changed() <-chan struct{} {
+	return s.changed
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	ErrExport = errors.New("export vault error")
+)
+
+// Vault is a read-only view of all private user data at the moment.
+// Items of every type (folders too) are encoded into JSON and ordered by type.
+type Vault struct {
+	At    time.Time         `json:"at"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// VaultAt requests from the server the vault as it was at the moment.
+// Local storage is not changed.
+func (s *Keeper) VaultAt(ctx context.Context, at time.Time) (Vault, error) {
+	const op = "service.Vault.At"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Time("at", at),
+	)
+
+	value, _ := json.Marshal(models.PointInTime{At: at.Unix()})
+	values, err := s.request(ctx, models.Message{Type: models.SnapshotAt, Value: value})
+	if err != nil {
+		log.Error("request vault at point in time error", sl.Err(err))
+		return Vault{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	vault := Vault{At: at}
+	for _, value := range values {
+		var item models.Message
+		if err = json.Unmarshal(value, &item); err != nil {
+			log.Error("unexpected snapshot at point in time response", sl.Err(err))
+			return Vault{}, fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+		value, _, err := s.open(item.Value)
+		if err != nil {
+			log.Error("failed decrypt item, it is skipped", slog.Int64("revision", item.Revision), sl.Err(err))
+			continue
+		}
+		kind, _ := itemIdentity(value)
+		if _, ok := models.Lookup(kind); !ok {
+			log.Error("unknown item type, it is skipped", slog.Int64("revision", item.Revision))
+			continue
+		}
+		vault.Items = append(vault.Items, models.Normalize(value))
+	}
+
+	return vault, nil
+}
+
+// Files returns the number of items whose content is kept on the server as a file.
+func (v Vault) Files() int {
+	files := 0
+	for _, value := range v.Items {
+		if len(itemFiles(value)) > 0 {
+			files++
+		}
+	}
+	return files
+}
+
+// Paths returns paths of the vault folders (Work/Banks) by the folder ID.
+func (v Vault) Paths() map[string]string {
+	var folders []models.Folder
+	for _, value := range v.Items {
+		if kind, _ := itemIdentity(value); kind == models.FolderItem {
+			var folder models.Folder
+			_ = json.Unmarshal(value, &folder)
+			folders = append(folders, folder)
+		}
+	}
+	return models.FolderPaths(folders)
+}
+
+// ExportVault writes the vault into JSON file readable only by the owner.
+// Content of large items kept on the server as files (file reference) is not exported,
+// their file keys are removed from the export too: the file is useless without its content.
+func (s *Keeper) ExportVault(vault Vault, path string) error {
+	const op = "service.Vault.Export"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("file path", path),
+	)
+
+	items := make([]json.RawMessage, 0, len(vault.Items))
+	for _, value := range vault.Items {
+		items = append(items, withoutFileKey(value))
+	}
+	vault.Items = items
+
+	data, err := json.MarshalIndent(vault, "", "  ")
+	if err != nil {
+		log.Error("encode vault error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrExport)
+	}
+
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		log.Error("write vault into file error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrExport)
+	}
+
+	return nil
+}
+
+// withoutFileKey returns the item encoded into JSON without the key of its file, the item without file is returned as it is.
+func withoutFileKey(value []byte) []byte {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(value, &item); err != nil || item["file"] == nil {
+		return value
+	}
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal(item["file"], &file); err != nil {
+		return value
+	}
+	delete(file, "key")
+	item["file"], _ = json.Marshal(file)
+	stripped, err := json.Marshal(item)
+	if err != nil {
+		return value
+	}
+	return stripped
+}
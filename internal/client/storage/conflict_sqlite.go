@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// ConflictSqlite keeps item versions rejected by the server until the user resolves them.
+type ConflictSqlite struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewConflictSqlite(storagePath string, timeout time.Duration) (*ConflictSqlite, error) {
+	db, err := newSQLDB(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ConflictSqlite{
+		db:      db,
+		timeout: timeout,
+	}, nil
+}
+
+func (s *ConflictSqlite) All(ctx context.Context) ([]models.ConflictVersion, error) {
+	const op = "storage.sqlite.Conflict.All"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("SELECT revision, type, key, value, deleted FROM conflict ORDER BY revision")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(newCtx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	res := []models.ConflictVersion{}
+	for rows.Next() {
+		var conflict models.ConflictVersion
+		err = rows.Scan(&conflict.Revision, &conflict.Type, &conflict.Key, &conflict.Value, &conflict.Deleted)
+		if err != nil {
+			continue
+		}
+		res = append(res, conflict)
+	}
+	return res, nil
+}
+
+func (s *ConflictSqlite) Save(ctx context.Context, conflict models.ConflictVersion) error {
+	const op = "storage.sqlite.Conflict.Save"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("INSERT OR REPLACE INTO conflict(revision, type, key, value, deleted) VALUES(?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, conflict.Revision, conflict.Type, conflict.Key, conflict.Value, conflict.Deleted)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *ConflictSqlite) Delete(ctx context.Context, revision int64) error {
+	const op = "storage.sqlite.Conflict.Delete"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("DELETE FROM conflict WHERE revision=?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Resolve removes conflicts of the item older than the revision: a later write resolved them.
+func (s *ConflictSqlite) Resolve(ctx context.Context, kind models.ItemType, key string, revision int64) error {
+	const op = "storage.sqlite.Conflict.Resolve"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("DELETE FROM conflict WHERE type=? AND key=? AND revision<?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, kind, key, revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *ConflictSqlite) Close() error {
+	if err := s.db.Close(); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
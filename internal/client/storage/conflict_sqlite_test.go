@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	conflict1 = models.ConflictVersion{Revision: 5, Type: models.TextItem, Key: "key1", Value: []byte(`{"type":"text","key":"key1","value":"value 1"}`)}
+	conflict2 = models.ConflictVersion{Revision: 7, Type: models.TextItem, Key: "key1", Value: []byte(`{"type":"text","key":"key1"}`), Deleted: true}
+)
+
+type ConflictStorager interface {
+	All(ctx context.Context) ([]models.ConflictVersion, error)
+	Save(ctx context.Context, conflict models.ConflictVersion) error
+	Delete(ctx context.Context, revision int64) error
+	Resolve(ctx context.Context, kind models.ItemType, key string, revision int64) error
+}
+
+type testConflictStorager interface {
+	ConflictStorager
+	clean(ctx context.Context) error
+}
+
+func (s *ConflictSqlite) clean(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := s.db.ExecContext(newCtx, "DELETE FROM conflict")
+	return err
+}
+
+type ConflictSqliteTestSuite struct {
+	suite.Suite
+	testConflictStorager
+}
+
+func (ts *ConflictSqliteTestSuite) SetupSuite() {
+	_ = Migrate("client_test.db")
+	ts.testConflictStorager, _ = NewConflictSqlite("client_test.db", time.Second*5)
+}
+
+func TestConflictSqlite(t *testing.T) {
+	suite.Run(t, new(ConflictSqliteTestSuite))
+}
+
+func (ts *ConflictSqliteTestSuite) SetupTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *ConflictSqliteTestSuite) TearDownTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *ConflictSqliteTestSuite) TestSaveAll() {
+	ts.NoError(ts.Save(context.Background(), conflict2))
+	ts.NoError(ts.Save(context.Background(), conflict1))
+
+	list, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.ConflictVersion{conflict1, conflict2}, list)
+}
+
+func (ts *ConflictSqliteTestSuite) TestDelete() {
+	ts.NoError(ts.Save(context.Background(), conflict1))
+	ts.NoError(ts.Save(context.Background(), conflict2))
+
+	ts.NoError(ts.Delete(context.Background(), conflict1.Revision))
+
+	list, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.ConflictVersion{conflict2}, list)
+}
+
+func (ts *ConflictSqliteTestSuite) TestResolve() {
+	ts.NoError(ts.Save(context.Background(), conflict1))
+	ts.NoError(ts.Save(context.Background(), conflict2))
+
+	ts.NoError(ts.Resolve(context.Background(), models.TextItem, "key1", 6))
+
+	list, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.ConflictVersion{conflict2}, list)
+}
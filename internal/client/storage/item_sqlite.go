@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// ItemSqlite keeps items of every type of the schema registry in one table.
+// Items are encoded into JSON and keyed by the item type and the item ID, so a new item type needs no new table.
+type ItemSqlite struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewItemSqlite(storagePath string, timeout time.Duration) (*ItemSqlite, error) {
+	db, err := newSQLDB(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ItemSqlite{
+		db:      db,
+		timeout: timeout,
+	}, nil
+}
+
+// All returns items of the type in the order they were saved first.
+func (s *ItemSqlite) All(ctx context.Context, kind models.ItemType) ([][]byte, error) {
+	const op = "storage.sqlite.Item.All"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(newCtx, "SELECT value FROM item WHERE type = ? ORDER BY id", kind)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	res := [][]byte{}
+	for rows.Next() {
+		var value []byte
+		if err = rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res = append(res, value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+func (s *ItemSqlite) ByID(ctx context.Context, kind models.ItemType, id string) ([]byte, error) {
+	const op = "storage.sqlite.Item.ByID"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var value []byte
+	err := s.db.QueryRowContext(newCtx, "SELECT value FROM item WHERE type = ? AND item_id = ?", kind, id).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, ErrItemNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return value, nil
+}
+
+// Save adds the item or replaces the item of the type with the same ID.
+func (s *ItemSqlite) Save(ctx context.Context, kind models.ItemType, id string, value []byte) error {
+	const op = "storage.sqlite.Item.Save"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(newCtx,
+		"INSERT INTO item(type, item_id, value) VALUES(?, ?, ?) ON CONFLICT(type, item_id) DO UPDATE SET value=excluded.value",
+		kind, id, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *ItemSqlite) Delete(ctx context.Context, kind models.ItemType, id string) error {
+	const op = "storage.sqlite.Item.Delete"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(newCtx, "DELETE FROM item WHERE type = ? AND item_id = ?", kind, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *ItemSqlite) Close() error {
+	if err := s.db.Close(); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	cred1 = models.Credentials{ID: "credentials-1", Type: models.CredItem, Tags: []string{"tag1"}, Login: "login1", Password: "password1", Comment: "comment",
+		Fields: []models.CustomField{{Name: "site", Type: models.URLCustomField, Value: "https://example.com"}}, Created: time.Now().Unix()}
+	cred2   = models.Credentials{ID: "credentials-2", Type: models.CredItem, Tags: []string{"tag1"}, Login: "login2", Password: "password2", Comment: "comment", Created: time.Now().Unix()}
+	binary1 = models.Binary{ID: "binary-1", Type: models.BinItem, Tags: []string{"tag1"}, Key: "file1.txt", Value: []byte("file1 content"), Comment: "file with secrets", Created: time.Now().Unix()}
+)
+
+type ItemStorager interface {
+	All(ctx context.Context, kind models.ItemType) ([][]byte, error)
+	ByID(ctx context.Context, kind models.ItemType, id string) ([]byte, error)
+	Save(ctx context.Context, kind models.ItemType, id string, value []byte) error
+	Delete(ctx context.Context, kind models.ItemType, id string) error
+}
+
+type testItemStorager interface {
+	ItemStorager
+	clean(ctx context.Context) error
+}
+
+func (s *ItemSqlite) clean(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := s.db.ExecContext(newCtx, "DELETE FROM item")
+	return err
+}
+
+type ItemSqliteTestSuite struct {
+	suite.Suite
+	testItemStorager
+}
+
+func (ts *ItemSqliteTestSuite) SetupSuite() {
+	_ = Migrate("client_test.db")
+	ts.testItemStorager, _ = NewItemSqlite("client_test.db", time.Second*5)
+}
+
+func TestItemSqlite(t *testing.T) {
+	suite.Run(t, new(ItemSqliteTestSuite))
+}
+
+func (ts *ItemSqliteTestSuite) SetupTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *ItemSqliteTestSuite) TearDownTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *ItemSqliteTestSuite) save(item any, kind models.ItemType, id string) []byte {
+	value, err := json.Marshal(item)
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.Save(context.Background(), kind, id, value))
+	return value
+}
+
+func (ts *ItemSqliteTestSuite) TestSave() {
+	value := ts.save(cred1, cred1.Type, cred1.ID)
+
+	saved, err := ts.ByID(context.Background(), cred1.Type, cred1.ID)
+	ts.NoError(err)
+	ts.JSONEq(string(value), string(saved))
+}
+
+func (ts *ItemSqliteTestSuite) TestSaveReplaces() {
+	ts.save(cred1, cred1.Type, cred1.ID)
+	updated := cred1
+	updated.Password, updated.Comment = "NEW PASSWORD", "NEW COMMENT"
+	value := ts.save(updated, updated.Type, updated.ID)
+
+	list, err := ts.All(context.Background(), models.CredItem)
+	ts.NoError(err)
+	ts.Equal(1, len(list))
+	ts.JSONEq(string(value), string(list[0]))
+}
+
+func (ts *ItemSqliteTestSuite) TestSameIDOtherType() {
+	// items are keyed by the type and the ID
+	ts.save(cred1, models.CredItem, "item-1")
+	value := ts.save(binary1, models.BinItem, "item-1")
+
+	saved, err := ts.ByID(context.Background(), models.BinItem, "item-1")
+	ts.NoError(err)
+	ts.JSONEq(string(value), string(saved))
+	ts.NoError(ts.Delete(context.Background(), models.BinItem, "item-1"))
+	_, err = ts.ByID(context.Background(), models.CredItem, "item-1")
+	ts.NoError(err)
+}
+
+func (ts *ItemSqliteTestSuite) TestByIDNoRows() {
+	value, err := ts.ByID(context.Background(), models.CredItem, "credentials-10")
+	ts.ErrorIs(err, ErrItemNotFound)
+	ts.Nil(value)
+}
+
+func (ts *ItemSqliteTestSuite) TestAll() {
+	value1 := ts.save(cred1, cred1.Type, cred1.ID)
+	value2 := ts.save(cred2, cred2.Type, cred2.ID)
+	ts.save(binary1, binary1.Type, binary1.ID)
+
+	list, err := ts.All(context.Background(), models.CredItem)
+	ts.NoError(err)
+	ts.Equal(2, len(list))
+	ts.JSONEq(string(value1), string(list[0]))
+	ts.JSONEq(string(value2), string(list[1]))
+
+	list, err = ts.All(context.Background(), models.CardItem)
+	ts.NoError(err)
+	ts.Empty(list)
+}
+
+func (ts *ItemSqliteTestSuite) TestDelete() {
+	ts.save(cred1, cred1.Type, cred1.ID)
+
+	err := ts.Delete(context.Background(), cred1.Type, cred1.ID)
+	ts.NoError(err)
+
+	_, err = ts.ByID(context.Background(), cred1.Type, cred1.ID)
+	ts.ErrorIs(err, ErrItemNotFound)
+}
@@ -14,6 +14,10 @@ var migrations embed.FS
 
 func migrate(db *sql.DB, version int64) error {
 	goose.SetBaseFS(migrations)
+	goose.ResetGlobalMigrations()
+	if err := goose.SetGlobalMigrations(itemMigration()); err != nil {
+		return fmt.Errorf("sqlite3 migrate register go migrations: %w", err)
+	}
 
 	if err := goose.SetDialect("sqlite3"); err != nil {
 		return fmt.Errorf("sqlite3 migrate set dialect sqlite3: %w", err)
@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// itemMigration moves items of the tables of each type into one table of items encoded into JSON,
+// so the item type registered in the schema registry needs no table of its own.
+// Binary content can not be converted into JSON by SQL, so the migration is written in Go.
+func itemMigration() *goose.Migration {
+	m := goose.NewGoMigration(11, &goose.GoFunc{RunTx: upItems}, &goose.GoFunc{RunTx: downItems})
+	m.Source = "00011_item.go"
+	return m
+}
+
+// itemTables are tables of items of the schema version 10 by item type.
+var itemTables = []struct {
+	kind   models.ItemType
+	table  string
+	create string
+}{
+	{kind: models.CredItem, table: "credentials", create: `CREATE TABLE credentials
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    login              TEXT NOT NULL,
+    password           TEXT,
+    comment            TEXT,
+    created_at         INTEGER
+)`},
+	{kind: models.TextItem, table: "text", create: `CREATE TABLE text
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    key                TEXT NOT NULL,
+    value              TEXT,
+    comment            TEXT,
+    created_at         INTEGER
+)`},
+	{kind: models.BinItem, table: "binary", create: `CREATE TABLE binary
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    key                TEXT NOT NULL,
+    value              BLOB,
+    file               BLOB,
+    comment            TEXT,
+    created_at         INTEGER
+)`},
+	{kind: models.CardItem, table: "card", create: `CREATE TABLE card
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    number             TEXT NOT NULL,
+    exp                TEXT,
+    cvv                INTEGER,
+    comment            TEXT,
+    created_at         INTEGER
+)`},
+}
+
+// jsonColumns keep JSON of the item attribute (file reference).
+var jsonColumns = map[string]bool{"file": true}
+
+// itemAttributes are item attributes named differently from the columns, by column name.
+var itemAttributes = map[string]string{"item_id": "id", "created_at": "created"}
+
+func upItems(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `CREATE TABLE item
+(
+    id                 INTEGER PRIMARY KEY,
+    type               TEXT NOT NULL,
+    item_id            TEXT NOT NULL,
+    value              BLOB NOT NULL,
+    UNIQUE (type, item_id)
+)`)
+	if err != nil {
+		return fmt.Errorf("create item table: %w", err)
+	}
+
+	for _, t := range itemTables {
+		items, err := tableItems(ctx, tx, t.table)
+		if err != nil {
+			return fmt.Errorf("query %s: %w", t.table, err)
+		}
+		for _, item := range items {
+			item["type"] = t.kind
+			value, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("encode %s item: %w", t.table, err)
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO item(type, item_id, value) VALUES(?, ?, ?)", t.kind, item["id"], value)
+			if err != nil {
+				return fmt.Errorf("insert %s item: %w", t.table, err)
+			}
+		}
+		if _, err = tx.ExecContext(ctx, "DROP TABLE "+t.table); err != nil {
+			return fmt.Errorf("drop %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+// tableItems returns items of the table by attribute name in the order they were saved, NULL columns are omitted.
+func tableItems(ctx context.Context, tx *sql.Tx, table string) ([]map[string]any, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+table+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		item := map[string]any{}
+		for i, column := range columns {
+			name := column.Name()
+			if name == "id" || values[i] == nil {
+				continue
+			}
+			if attr, ok := itemAttributes[name]; ok {
+				name = attr
+			}
+			item[name] = columnValue(name, column.DatabaseTypeName(), values[i])
+			if item[name] == nil {
+				delete(item, name)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// columnValue converts the column value into the item attribute: JSON columns are kept as JSON,
+// BLOB content is encoded into JSON as base64 like the item content is.
+func columnValue(name string, declType string, value any) any {
+	data, isBytes := value.([]byte)
+	switch {
+	case jsonColumns[name]:
+		if s, ok := value.(string); ok {
+			data = []byte(s)
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		return json.RawMessage(data)
+	case isBytes && !strings.EqualFold(declType, "BLOB"):
+		return string(data)
+	}
+	return value
+}
+
+func downItems(ctx context.Context, tx *sql.Tx) error {
+	for _, t := range itemTables {
+		if _, err := tx.ExecContext(ctx, t.create); err != nil {
+			return fmt.Errorf("create %s: %w", t.table, err)
+		}
+		columns, err := tableColumns(ctx, tx, t.table)
+		if err != nil {
+			return fmt.Errorf("query %s columns: %w", t.table, err)
+		}
+
+		rows, err := tx.QueryContext(ctx, "SELECT value FROM item WHERE type = ? ORDER BY id", t.kind)
+		if err != nil {
+			return fmt.Errorf("query %s items: %w", t.table, err)
+		}
+		var values [][]byte
+		for rows.Next() {
+			var value []byte
+			if err = rows.Scan(&value); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan %s item: %w", t.table, err)
+			}
+			values = append(values, value)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("query %s items: %w", t.table, err)
+		}
+
+		for _, value := range values {
+			names, args, err := itemColumns(value, columns)
+			if err != nil {
+				return fmt.Errorf("decode %s item: %w", t.table, err)
+			}
+			query := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", t.table,
+				strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", "))
+			if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+				return fmt.Errorf("insert %s item: %w", t.table, err)
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DROP TABLE item"); err != nil {
+		return fmt.Errorf("drop item table: %w", err)
+	}
+	return nil
+}
+
+// tableColumns returns declared types of the table columns by column name.
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]string{}
+	for rows.Next() {
+		var name, declType string
+		if err = rows.Scan(&name, &declType); err != nil {
+			return nil, err
+		}
+		columns[name] = declType
+	}
+	return columns, rows.Err()
+}
+
+// itemColumns returns names and values of the columns of the item encoded into JSON,
+// columns of missing attributes are omitted so they get default values.
+func itemColumns(value []byte, columns map[string]string) ([]string, []any, error) {
+	item := map[string]json.RawMessage{}
+	if err := json.Unmarshal(value, &item); err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	var args []any
+	for name, declType := range columns {
+		attr := name
+		if a, ok := itemAttributes[name]; ok {
+			attr = a
+		}
+		raw, ok := item[attr]
+		if name == "id" || !ok || string(raw) == "null" {
+			continue
+		}
+
+		var arg any
+		switch {
+		case jsonColumns[name]:
+			arg = []byte(raw)
+		case strings.EqualFold(declType, "BLOB"):
+			var data []byte
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			arg = data
+		case strings.EqualFold(declType, "INTEGER"):
+			var n int64
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			arg = n
+		default:
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				s = string(raw)
+			}
+			arg = s
+		}
+		names = append(names, name)
+		args = append(args, arg)
+	}
+	return names, args, nil
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+func TestMigrateItemID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.db")
+	db, err := newSQLDB(path)
+	require.NoError(t, err)
+	require.NoError(t, migrate(db, 9))
+
+	db, err = newSQLDB(path)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO credentials(tag, login, password, comment, created_at) VALUES('tag1', 'login1', 'password1', '', 1)")
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO upload(key, item, path, mod_time) VALUES('file1.bin', '{"type":"bin","key":"file1.bin","file":{"id":"id1"}}', '/tmp/file1.bin', 1)`)
+	require.NoError(t, err)
+	require.NoError(t, migrate(db, schemaVersion))
+
+	// items saved before IDs keep the natural key as ID
+	items, err := NewItemSqlite(path, time.Second)
+	require.NoError(t, err)
+	defer items.Close()
+	value, err := items.ByID(context.Background(), models.CredItem, "login1")
+	require.NoError(t, err)
+	var cred models.Credentials
+	require.NoError(t, json.Unmarshal(value, &cred))
+	assert.Equal(t, models.Credentials{ID: "login1", Type: models.CredItem, Tags: []string{"tag1"}, Login: "login1", Password: "password1", Created: 1}, cred)
+
+	uploads, err := NewUploadSqlite(path, time.Second)
+	require.NoError(t, err)
+	defer uploads.Close()
+	all, err := uploads.All(context.Background())
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "file1.bin", all[0].Binary.ID)
+	require.NoError(t, uploads.Delete(context.Background(), "file1.bin"))
+}
+
+func TestMigrateLegacyMigration(t *testing.T) {
+	// the database synced before the vault key existed migrates legacy items, the new one does not
+	for _, tt := range []struct {
+		name      string
+		revision  int64
+		keyCheck  string
+		migration bool
+	}{
+		{name: "synced before vault key", revision: 5, migration: true},
+		{name: "synced with vault key", revision: 5, keyCheck: "check"},
+		{name: "new database"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "client.db")
+			db, err := newSQLDB(path)
+			require.NoError(t, err)
+			require.NoError(t, migrate(db, 6))
+
+			db, err = newSQLDB(path)
+			require.NoError(t, err)
+			_, err = db.Exec("UPDATE sync_state SET revision = ?, key_check = ? WHERE id = 1", tt.revision, tt.keyCheck)
+			require.NoError(t, err)
+			require.NoError(t, migrate(db, schemaVersion))
+
+			syncStore, err := NewSyncSqlite(path, time.Second)
+			require.NoError(t, err)
+			defer syncStore.Close()
+			migration, err := syncStore.LegacyMigration(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.migration, migration)
+		})
+	}
+}
+
+func TestMigrateItems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.db")
+	db, err := newSQLDB(path)
+	require.NoError(t, err)
+	require.NoError(t, migrate(db, 10))
+
+	db, err = newSQLDB(path)
+	require.NoError(t, err)
+	for _, query := range []string{
+		`INSERT INTO credentials(item_id, tag, login, password, comment, created_at) VALUES('cred-1', 'tag1', 'login1', 'password1', 'comment', 1)`,
+		`INSERT INTO text(item_id, key, value, comment, created_at) VALUES('text-1', 'key1', 'value1', NULL, 2)`,
+		`INSERT INTO binary(item_id, key, value, comment, created_at) VALUES('bin-1', 'file1.txt', x'00ff', '', 3)`,
+		`INSERT INTO binary(item_id, key, file, comment, created_at) VALUES('bin-2', 'file2.bin', '{"id":"id2","size":4,"chunk_size":4,"chunks":1,"hash":"hash2","key":"a2V5"}', '', 4)`,
+		`INSERT INTO card(item_id, number, exp, cvv, comment, created_at) VALUES('card-1', '4561261212345467', '12/30', 123, '', 5)`,
+	} {
+		_, err = db.Exec(query)
+		require.NoError(t, err)
+	}
+	require.NoError(t, migrate(db, schemaVersion))
+
+	items, err := NewItemSqlite(path, time.Second)
+	require.NoError(t, err)
+	defer items.Close()
+	decode := func(kind models.ItemType, id string, item any) {
+		value, err := items.ByID(context.Background(), kind, id)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(value, item))
+	}
+
+	// items of each type table are kept in the item table as they are encoded by the client
+	var cred models.Credentials
+	decode(models.CredItem, "cred-1", &cred)
+	assert.Equal(t, models.Credentials{ID: "cred-1", Type: models.CredItem, Tags: []string{"tag1"}, Login: "login1", Password: "password1", Comment: "comment", Created: 1}, cred)
+	var text models.Text
+	decode(models.TextItem, "text-1", &text)
+	assert.Equal(t, models.Text{ID: "text-1", Type: models.TextItem, Key: "key1", Value: "value1", Created: 2}, text)
+	var bin models.Binary
+	decode(models.BinItem, "bin-1", &bin)
+	assert.Equal(t, models.Binary{ID: "bin-1", Type: models.BinItem, Key: "file1.txt", Value: []byte{0x00, 0xff}, Created: 3}, bin)
+	var file models.Binary
+	decode(models.BinItem, "bin-2", &file)
+	assert.Equal(t, models.Binary{ID: "bin-2", Type: models.BinItem, Key: "file2.bin", Created: 4,
+		File: &models.FileRef{ID: "id2", Size: 4, ChunkSize: 4, Chunks: 1, Hash: "hash2", Key: []byte("key")}}, file)
+	var card models.Card
+	decode(models.CardItem, "card-1", &card)
+	assert.Equal(t, models.Card{ID: "card-1", Type: models.CardItem, Number: "4561261212345467", Exp: "12/30", CVV: 123, Created: 5}, card)
+
+	// the item table is moved back into the type tables
+	db, err = newSQLDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, goose.DownTo(db, "migrations", 10))
+	var value []byte
+	require.NoError(t, db.QueryRow("SELECT value FROM binary WHERE item_id = 'bin-1'").Scan(&value))
+	assert.Equal(t, []byte{0x00, 0xff}, value)
+	var tag string
+	var created int64
+	require.NoError(t, db.QueryRow("SELECT tag, created_at FROM credentials WHERE item_id = 'cred-1'").Scan(&tag, &created))
+	assert.Equal(t, "tag1", tag)
+	assert.Equal(t, int64(1), created)
+	var cvv int32
+	require.NoError(t, db.QueryRow("SELECT cvv FROM card WHERE item_id = 'card-1'").Scan(&cvv))
+	assert.Equal(t, int32(123), cvv)
+}
+
+func TestMigrateTagsFolders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.db")
+	db, err := newSQLDB(path)
+	require.NoError(t, err)
+	require.NoError(t, migrate(db, 11))
+
+	db, err = newSQLDB(path)
+	require.NoError(t, err)
+	for _, query := range []string{
+		`INSERT INTO item(type, item_id, value) VALUES('cred', 'cred-1', '{"id":"cred-1","type":"cred","tag":"tag1","login":"login1","created":1}')`,
+		`INSERT INTO item(type, item_id, value) VALUES('text', 'text-1', '{"id":"text-1","type":"text","tag":"","key":"key1","created":2}')`,
+		`INSERT INTO upload(item_id, item, path, mod_time) VALUES('bin-1', '{"id":"bin-1","type":"bin","tag":"tag2","key":"file1.bin","file":{"id":"id1"}}', '/tmp/file1.bin', 1)`,
+	} {
+		_, err = db.Exec(query)
+		require.NoError(t, err)
+	}
+	require.NoError(t, migrate(db, schemaVersion))
+
+	// the single tag becomes the only tag, the item without tag has no tags
+	items, err := NewItemSqlite(path, time.Second)
+	require.NoError(t, err)
+	defer items.Close()
+	value, err := items.ByID(context.Background(), models.CredItem, "cred-1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"cred-1","type":"cred","tags":["tag1"],"login":"login1","created":1}`, string(value))
+	value, err = items.ByID(context.Background(), models.TextItem, "text-1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"text-1","type":"text","key":"key1","created":2}`, string(value))
+
+	uploads, err := NewUploadSqlite(path, time.Second)
+	require.NoError(t, err)
+	defer uploads.Close()
+	all, err := uploads.All(context.Background())
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, []string{"tag2"}, all[0].Binary.Tags)
+
+	// folders are removed and the first tag is kept when the migration is rolled back
+	folder := models.Folder{ID: "folder-1", Type: models.FolderItem, Name: "Work", Created: 3}
+	folderValue, _ := json.Marshal(folder)
+	require.NoError(t, items.Save(context.Background(), models.FolderItem, folder.ID, folderValue))
+	db, err = newSQLDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, goose.DownTo(db, "migrations", 11))
+	var tag string
+	require.NoError(t, db.QueryRow("SELECT json_extract(value, '$.tag') FROM item WHERE item_id = 'cred-1'").Scan(&tag))
+	assert.Equal(t, "tag1", tag)
+	var folders int
+	require.NoError(t, db.QueryRow("SELECT count(*) FROM item WHERE type = 'folder'").Scan(&folders))
+	assert.Equal(t, 0, folders)
+}
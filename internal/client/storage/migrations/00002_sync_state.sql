@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS sync_state
+(
+    id                 INTEGER PRIMARY KEY CHECK (id = 1),
+    revision           INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO sync_state (id, revision) VALUES (1, 0);
+
+-- +goose Down
+DROP TABLE sync_state;
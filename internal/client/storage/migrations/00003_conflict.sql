@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS item_revision
+(
+    type               TEXT NOT NULL,
+    key                TEXT NOT NULL,
+    revision           INTEGER NOT NULL,
+    PRIMARY KEY (type, key)
+);
+
+CREATE TABLE IF NOT EXISTS conflict
+(
+    revision           INTEGER PRIMARY KEY,
+    type               TEXT NOT NULL,
+    key                TEXT NOT NULL,
+    value              BLOB,
+    deleted            INTEGER NOT NULL DEFAULT 0
+);
+
+-- +goose Down
+DROP TABLE item_revision;
+DROP TABLE conflict;
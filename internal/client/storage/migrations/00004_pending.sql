@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS pending
+(
+    id                 TEXT PRIMARY KEY,
+    seq                INTEGER NOT NULL,
+    type               TEXT NOT NULL,
+    key                TEXT NOT NULL,
+    value              BLOB,
+    deleted            INTEGER NOT NULL DEFAULT 0,
+    code               TEXT NOT NULL DEFAULT '',
+    error              TEXT NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+DROP TABLE pending;
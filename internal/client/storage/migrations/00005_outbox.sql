@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE pending RENAME TO outbox;
+ALTER TABLE outbox ADD COLUMN base_revision INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE outbox ADD COLUMN after_id TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE outbox DROP COLUMN after_id;
+ALTER TABLE outbox DROP COLUMN base_revision;
+ALTER TABLE outbox RENAME TO pending;
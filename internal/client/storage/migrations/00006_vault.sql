@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE sync_state ADD COLUMN key_check TEXT NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN legacy INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE outbox DROP COLUMN legacy;
+ALTER TABLE sync_state DROP COLUMN key_check;
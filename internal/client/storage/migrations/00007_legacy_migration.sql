@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE sync_state ADD COLUMN legacy_migration INTEGER NOT NULL DEFAULT 0;
+-- items synced before the vault key existed are on the server in clear, the device re-encrypts them once
+UPDATE sync_state SET legacy_migration = 1 WHERE key_check = '' AND revision > 0;
+
+-- +goose Down
+ALTER TABLE sync_state DROP COLUMN legacy_migration;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- binary content uploaded in chunks is referenced by file (JSON), value is empty then
+ALTER TABLE binary ADD COLUMN file BLOB;
+
+CREATE TABLE IF NOT EXISTS upload
+(
+    id                 TEXT PRIMARY KEY,
+    item               BLOB NOT NULL,
+    path               TEXT NOT NULL,
+    mod_time           INTEGER NOT NULL,
+    error              TEXT NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS upload;
+ALTER TABLE binary DROP COLUMN file;
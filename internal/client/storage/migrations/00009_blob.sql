@@ -0,0 +1,30 @@
+-- +goose Up
+-- file IDs are derived from the content, the same file may be uploaded for several items:
+-- uploads are keyed by the item key. Content keeps the binary saved before files, it is uploaded as a file.
+CREATE TABLE IF NOT EXISTS upload_item
+(
+    key                TEXT PRIMARY KEY,
+    item               BLOB NOT NULL,
+    path               TEXT NOT NULL,
+    mod_time           INTEGER NOT NULL,
+    content            BLOB,
+    error              TEXT NOT NULL DEFAULT ''
+);
+INSERT OR REPLACE INTO upload_item (key, item, path, mod_time, error)
+SELECT json_extract(item, '$.key'), item, path, mod_time, error FROM upload;
+DROP TABLE upload;
+ALTER TABLE upload_item RENAME TO upload;
+
+-- +goose Down
+CREATE TABLE IF NOT EXISTS upload_file
+(
+    id                 TEXT PRIMARY KEY,
+    item               BLOB NOT NULL,
+    path               TEXT NOT NULL,
+    mod_time           INTEGER NOT NULL,
+    error              TEXT NOT NULL DEFAULT ''
+);
+INSERT OR REPLACE INTO upload_file (id, item, path, mod_time, error)
+SELECT json_extract(item, '$.file.id'), item, path, mod_time, error FROM upload WHERE content IS NULL;
+DROP TABLE upload;
+ALTER TABLE upload_file RENAME TO upload;
@@ -0,0 +1,130 @@
+-- +goose Up
+-- items are identified by item_id generated by the client, login, key and number are not unique any more.
+-- Items saved before keep the natural key as item_id, so their identity known to the server does not change.
+CREATE TABLE credentials_new
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    login              TEXT NOT NULL,
+    password           TEXT,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT INTO credentials_new (id, item_id, tag, login, password, comment, created_at)
+SELECT id, login, tag, login, password, comment, created_at FROM credentials;
+DROP TABLE credentials;
+ALTER TABLE credentials_new RENAME TO credentials;
+
+CREATE TABLE text_new
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    key                TEXT NOT NULL,
+    value              TEXT,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT INTO text_new (id, item_id, tag, key, value, comment, created_at)
+SELECT id, key, tag, key, value, comment, created_at FROM text;
+DROP TABLE text;
+ALTER TABLE text_new RENAME TO text;
+
+CREATE TABLE binary_new
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    key                TEXT NOT NULL,
+    value              BLOB,
+    file               BLOB,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT INTO binary_new (id, item_id, tag, key, value, file, comment, created_at)
+SELECT id, key, tag, key, value, file, comment, created_at FROM binary;
+DROP TABLE binary;
+ALTER TABLE binary_new RENAME TO binary;
+
+CREATE TABLE card_new
+(
+    id                 INTEGER PRIMARY KEY,
+    item_id            TEXT NOT NULL UNIQUE,
+    tag                TEXT,
+    number             TEXT NOT NULL,
+    exp                TEXT,
+    cvv                INTEGER,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT INTO card_new (id, item_id, tag, number, exp, cvv, comment, created_at)
+SELECT id, number, tag, number, exp, cvv, comment, created_at FROM card;
+DROP TABLE card;
+ALTER TABLE card_new RENAME TO card;
+
+-- uploads are keyed by the item ID, items of uploads saved before have the item key as ID
+ALTER TABLE upload RENAME COLUMN key TO item_id;
+UPDATE upload SET item = json_set(item, '$.id', item_id) WHERE json_extract(item, '$.id') IS NULL;
+
+-- +goose Down
+ALTER TABLE upload RENAME COLUMN item_id TO key;
+
+-- items with the same natural key are dropped except the first one
+CREATE TABLE credentials_old
+(
+    id                 INTEGER PRIMARY KEY,
+    tag                TEXT,
+    login              TEXT NOT NULL UNIQUE,
+    password           TEXT,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT OR IGNORE INTO credentials_old (id, tag, login, password, comment, created_at)
+SELECT id, tag, login, password, comment, created_at FROM credentials ORDER BY id;
+DROP TABLE credentials;
+ALTER TABLE credentials_old RENAME TO credentials;
+
+CREATE TABLE text_old
+(
+    id                 INTEGER PRIMARY KEY,
+    tag                TEXT,
+    key                TEXT NOT NULL UNIQUE,
+    value              TEXT,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT OR IGNORE INTO text_old (id, tag, key, value, comment, created_at)
+SELECT id, tag, key, value, comment, created_at FROM text ORDER BY id;
+DROP TABLE text;
+ALTER TABLE text_old RENAME TO text;
+
+CREATE TABLE binary_old
+(
+    id                 INTEGER PRIMARY KEY,
+    tag                TEXT,
+    key                TEXT NOT NULL UNIQUE,
+    value              BLOB,
+    file               BLOB,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT OR IGNORE INTO binary_old (id, tag, key, value, file, comment, created_at)
+SELECT id, tag, key, value, file, comment, created_at FROM binary ORDER BY id;
+DROP TABLE binary;
+ALTER TABLE binary_old RENAME TO binary;
+
+CREATE TABLE card_old
+(
+    id                 INTEGER PRIMARY KEY,
+    tag                TEXT,
+    number             TEXT NOT NULL UNIQUE,
+    exp                TEXT,
+    cvv                INTEGER,
+    comment            TEXT,
+    created_at         INTEGER
+);
+INSERT OR IGNORE INTO card_old (id, tag, number, exp, cvv, comment, created_at)
+SELECT id, tag, number, exp, cvv, comment, created_at FROM card ORDER BY id;
+DROP TABLE card;
+ALTER TABLE card_old RENAME TO card;
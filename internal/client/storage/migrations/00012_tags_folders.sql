@@ -0,0 +1,19 @@
+-- +goose Up
+-- items are labeled with several tags (JSON list) and put into the folder (folder ID, empty for the top level).
+-- The single tag of items saved before becomes the only tag. Folders are items of the folder type, they need no table.
+UPDATE item SET value = json_set(value, '$.tags', json_array(json_extract(value, '$.tag')))
+WHERE json_extract(value, '$.tag') <> '';
+UPDATE item SET value = json_remove(value, '$.tag');
+
+UPDATE upload SET item = json_set(item, '$.tags', json_array(json_extract(item, '$.tag')))
+WHERE json_extract(item, '$.tag') <> '';
+UPDATE upload SET item = json_remove(item, '$.tag');
+
+-- +goose Down
+DELETE FROM item_revision WHERE type = 'folder';
+DELETE FROM conflict WHERE type = 'folder';
+DELETE FROM item WHERE type = 'folder';
+
+-- only the first tag is kept, items are moved to the top level
+UPDATE item SET value = json_set(json_remove(value, '$.tags', '$.folder'), '$.tag', coalesce(json_extract(value, '$.tags[0]'), ''));
+UPDATE upload SET item = json_set(json_remove(item, '$.tags', '$.folder'), '$.tag', coalesce(json_extract(item, '$.tags[0]'), ''));
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// OutboxSqlite keeps local changes until the server acknowledges or rejects them.
+// Changes are sent to the server in the order they were made, they survive client restart.
+// A change of the item which has an earlier unacknowledged change waits for it (after_id):
+// its base revision is known only when the server saves the earlier change.
+// Legacy change removes the item version saved before end-to-end encryption, it does not wait for other changes
+// and other changes do not wait for it: it has another identity on the server.
+type OutboxSqlite struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewOutboxSqlite(storagePath string, timeout time.Duration) (*OutboxSqlite, error) {
+	db, err := newSQLDB(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxSqlite{
+		db:      db,
+		timeout: timeout,
+	}, nil
+}
+
+// All returns changes waiting for the server and rejected ones in the order they were made.
+func (s *OutboxSqlite) All(ctx context.Context) ([]models.PendingChange, error) {
+	const op = "storage.sqlite.Outbox.All"
+
+	return s.query(ctx, op, "SELECT id, type, key, value, deleted, base_revision, legacy, code, error FROM outbox ORDER BY seq")
+}
+
+// Ready returns changes which may be sent to the server: not rejected and not waiting for an earlier change.
+func (s *OutboxSqlite) Ready(ctx context.Context) ([]models.PendingChange, error) {
+	const op = "storage.sqlite.Outbox.Ready"
+
+	return s.query(ctx, op,
+		"SELECT id, type, key, value, deleted, base_revision, legacy, code, error FROM outbox WHERE code='' AND after_id='' ORDER BY seq")
+}
+
+func (s *OutboxSqlite) query(ctx context.Context, op string, query string) ([]models.PendingChange, error) {
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(newCtx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	res := []models.PendingChange{}
+	for rows.Next() {
+		var change models.PendingChange
+		err = rows.Scan(&change.ID, &change.Type, &change.Key, &change.Value, &change.Deleted, &change.BaseRevision, &change.Legacy, &change.Code, &change.Error)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res = append(res, change)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// Save adds the changes in one transaction, rejected changes of the same item are replaced by the change.
+func (s *OutboxSqlite) Save(ctx context.Context, changes ...models.PendingChange) error {
+	const op = "storage.sqlite.Outbox.Save"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(newCtx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, change := range changes {
+		if err = s.save(newCtx, tx, change); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *OutboxSqlite) save(ctx context.Context, tx *sql.Tx, change models.PendingChange) error {
+	var afterID string
+	if !change.Legacy {
+		_, err := tx.ExecContext(ctx, "DELETE FROM outbox WHERE type=? AND key=? AND code<>'' AND legacy=0", change.Type, change.Key)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, "SELECT id FROM outbox WHERE type=? AND key=? AND legacy=0 ORDER BY seq DESC LIMIT 1",
+			change.Type, change.Key).Scan(&afterID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO outbox(id, seq, type, key, value, deleted, base_revision, legacy, after_id)
+		VALUES(?, (SELECT COALESCE(MAX(seq), 0)+1 FROM outbox), ?, ?, ?, ?, ?, ?, ?)`,
+		change.ID, change.Type, change.Key, change.Value, change.Deleted, change.BaseRevision, change.Legacy, afterID)
+	return err
+}
+
+// Ack removes the change confirmed by the server.
+// The next change of the same item is based on the revision of the confirmed one.
+func (s *OutboxSqlite) Ack(ctx context.Context, id string, revision int64) error {
+	const op = "storage.sqlite.Outbox.Ack"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(newCtx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(newCtx, "DELETE FROM outbox WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(newCtx, "UPDATE outbox SET base_revision=?, after_id='' WHERE after_id=?", revision, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Fail marks the change rejected by the server, it is kept to be shown to the user.
+// The next change of the same item is sent with the base revision it was made with.
+func (s *OutboxSqlite) Fail(ctx context.Context, id string, code models.ErrorCode, reason string) error {
+	const op = "storage.sqlite.Outbox.Fail"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(newCtx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(newCtx, "UPDATE outbox SET code=?, error=? WHERE id=?", code, reason, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(newCtx, "UPDATE outbox SET after_id='' WHERE after_id=?", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *OutboxSqlite) Close() error {
+	if err := s.db.Close(); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
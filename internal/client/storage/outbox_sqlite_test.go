@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	pending1 = models.PendingChange{ID: "id1", Type: models.TextItem, Key: "key1", Value: []byte(`{"type":"text","key":"key1","value":"value 1"}`), BaseRevision: 2}
+	pending2 = models.PendingChange{ID: "id2", Type: models.TextItem, Key: "key2", Value: []byte(`{"type":"text","key":"key2"}`), Deleted: true}
+	pending3 = models.PendingChange{ID: "id3", Type: models.TextItem, Key: "key1", Value: []byte(`{"type":"text","key":"key1","value":"value 3"}`), BaseRevision: 2}
+)
+
+type OutboxStorager interface {
+	All(ctx context.Context) ([]models.PendingChange, error)
+	Ready(ctx context.Context) ([]models.PendingChange, error)
+	Save(ctx context.Context, changes ...models.PendingChange) error
+	Ack(ctx context.Context, id string, revision int64) error
+	Fail(ctx context.Context, id string, code models.ErrorCode, reason string) error
+}
+
+type testOutboxStorager interface {
+	OutboxStorager
+	clean(ctx context.Context) error
+}
+
+func (s *OutboxSqlite) clean(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := s.db.ExecContext(newCtx, "DELETE FROM outbox")
+	return err
+}
+
+type OutboxSqliteTestSuite struct {
+	suite.Suite
+	testOutboxStorager
+}
+
+func (ts *OutboxSqliteTestSuite) SetupSuite() {
+	_ = Migrate("client_test.db")
+	ts.testOutboxStorager, _ = NewOutboxSqlite("client_test.db", time.Second*5)
+}
+
+func TestOutboxSqlite(t *testing.T) {
+	suite.Run(t, new(OutboxSqliteTestSuite))
+}
+
+func (ts *OutboxSqliteTestSuite) SetupTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *OutboxSqliteTestSuite) TearDownTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *OutboxSqliteTestSuite) TestSaveAck() {
+	ts.NoError(ts.Save(context.Background(), pending1))
+	ts.NoError(ts.Save(context.Background(), pending2))
+
+	list, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{pending1, pending2}, list)
+
+	ts.NoError(ts.Ack(context.Background(), pending1.ID, 3))
+
+	list, err = ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{pending2}, list)
+}
+
+func (ts *OutboxSqliteTestSuite) TestReadyAfterAck() {
+	ts.NoError(ts.Save(context.Background(), pending1))
+	ts.NoError(ts.Save(context.Background(), pending2))
+	ts.NoError(ts.Save(context.Background(), pending3))
+
+	// the second change of key1 waits for the first one
+	list, err := ts.Ready(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{pending1, pending2}, list)
+
+	ts.NoError(ts.Ack(context.Background(), pending1.ID, 3))
+
+	next := pending3
+	next.BaseRevision = 3
+	list, err = ts.Ready(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{pending2, next}, list)
+}
+
+func (ts *OutboxSqliteTestSuite) TestFail() {
+	ts.NoError(ts.Save(context.Background(), pending1))
+	ts.NoError(ts.Fail(context.Background(), pending1.ID, models.CodeInvalidMessage, "invalid message"))
+
+	failed := pending1
+	failed.Code = models.CodeInvalidMessage
+	failed.Error = "invalid message"
+
+	list, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{failed}, list)
+
+	list, err = ts.Ready(context.Background())
+	ts.NoError(err)
+	ts.Empty(list)
+
+	// next change of the item replaces the rejected one
+	ts.NoError(ts.Save(context.Background(), pending3))
+
+	list, err = ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{pending3}, list)
+}
+
+func (ts *OutboxSqliteTestSuite) TestLegacyNotChained() {
+	legacy := models.PendingChange{ID: "id4", Type: models.TextItem, Key: "key1", Value: pending1.Value, Deleted: true, BaseRevision: 1, Legacy: true}
+	ts.NoError(ts.Save(context.Background(), legacy, pending1))
+
+	list, err := ts.Ready(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.PendingChange{legacy, pending1}, list)
+}
+
+func (ts *OutboxSqliteTestSuite) TestCorruptChange() {
+	ts.NoError(ts.Save(context.Background(), pending1))
+	_, err := ts.testOutboxStorager.(*OutboxSqlite).db.Exec(
+		"INSERT INTO outbox(id, seq, type, key, value, deleted, base_revision, after_id) VALUES('id5', 10, 'text', 'key5', '', 0, 'broken', '')")
+	ts.Require().NoError(err)
+
+	// corrupt change is not dropped silently
+	_, err = ts.All(context.Background())
+	ts.Error(err)
+	_, err = ts.Ready(context.Background())
+	ts.Error(err)
+}
@@ -8,6 +8,9 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// schemaVersion is the version of the database schema the storages work with.
+const schemaVersion = 12
+
 var (
 	ErrInternal     = errors.New("internal error")
 	ErrItemNotFound = errors.New("item not found")
@@ -19,7 +22,7 @@ func Migrate(storagePath string) error {
 		return err
 	}
 
-	err = migrate(db, 1)
+	err = migrate(db, schemaVersion)
 	if err != nil {
 		return fmt.Errorf("failed migrate database schema %w", ErrInternal)
 	}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// SyncSqlite keeps the last server revision applied to the local database.
+type SyncSqlite struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSyncSqlite(storagePath string, timeout time.Duration) (*SyncSqlite, error) {
+	db, err := newSQLDB(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncSqlite{
+		db:      db,
+		timeout: timeout,
+	}, nil
+}
+
+func (s *SyncSqlite) Revision(ctx context.Context) (int64, error) {
+	const op = "storage.sqlite.Sync.Revision"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var revision int64
+	err := s.db.QueryRowContext(newCtx, "SELECT revision FROM sync_state WHERE id = 1").Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return revision, nil
+}
+
+func (s *SyncSqlite) SetRevision(ctx context.Context, revision int64) error {
+	const op = "storage.sqlite.Sync.SetRevision"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("UPDATE sync_state SET revision=? WHERE id = 1")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// KeyCheck returns the identifier of the vault key the local items were synced with, empty if the vault was never unlocked.
+func (s *SyncSqlite) KeyCheck(ctx context.Context) (string, error) {
+	const op = "storage.sqlite.Sync.KeyCheck"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var check string
+	err := s.db.QueryRowContext(newCtx, "SELECT key_check FROM sync_state WHERE id = 1").Scan(&check)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return check, nil
+}
+
+func (s *SyncSqlite) SetKeyCheck(ctx context.Context, check string) error {
+	const op = "storage.sqlite.Sync.SetKeyCheck"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("UPDATE sync_state SET key_check=? WHERE id = 1")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, check)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// LegacyMigration reports whether items synced before the vault key existed are not re-encrypted yet,
+// only then the items saved in clear are accepted from the server.
+func (s *SyncSqlite) LegacyMigration(ctx context.Context) (bool, error) {
+	const op = "storage.sqlite.Sync.LegacyMigration"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var migration bool
+	err := s.db.QueryRowContext(newCtx, "SELECT legacy_migration FROM sync_state WHERE id = 1").Scan(&migration)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return migration, nil
+}
+
+func (s *SyncSqlite) SetLegacyMigration(ctx context.Context, migration bool) error {
+	const op = "storage.sqlite.Sync.SetLegacyMigration"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("UPDATE sync_state SET legacy_migration=? WHERE id = 1")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, migration)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ItemRevision returns the server revision of the local item version, 0 if the item was never synced.
+func (s *SyncSqlite) ItemRevision(ctx context.Context, kind models.ItemType, key string) (int64, error) {
+	const op = "storage.sqlite.Sync.ItemRevision"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var revision int64
+	err := s.db.QueryRowContext(newCtx, "SELECT revision FROM item_revision WHERE type = ? AND key = ?", kind, key).Scan(&revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return revision, nil
+}
+
+func (s *SyncSqlite) SetItemRevision(ctx context.Context, kind models.ItemType, key string, revision int64) error {
+	const op = "storage.sqlite.Sync.SetItemRevision"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare(`INSERT INTO item_revision(type, key, revision) VALUES(?, ?, ?)
+		ON CONFLICT(type, key) DO UPDATE SET revision=excluded.revision`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, kind, key, revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Sweep finishes the full snapshot in one transaction: local items which were not delivered in the snapshot
+// (deleted on the server) are removed with their revisions and conflicts, and the snapshot revision is saved.
+// Items changed locally and not acknowledged yet (kept in the outbox) are not removed, the server has not seen them.
+// Items are kept until the snapshot ends, so the interrupted snapshot leaves the local vault as it was.
+func (s *SyncSqlite) Sweep(ctx context.Context, delivered func(kind models.ItemType, key string) bool, revision int64) error {
+	const op = "storage.sqlite.Sync.Sweep"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(newCtx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(newCtx,
+		"SELECT type, item_id FROM item WHERE NOT EXISTS (SELECT 1 FROM outbox WHERE outbox.type = item.type AND outbox.key = item.item_id)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	type itemKey struct {
+		kind models.ItemType
+		key  string
+	}
+	var swept []itemKey
+	for rows.Next() {
+		var item itemKey
+		if err = rows.Scan(&item.kind, &item.key); err != nil {
+			rows.Close()
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !delivered(item.kind, item.key) {
+			swept = append(swept, item)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, item := range swept {
+		for _, query := range []string{
+			"DELETE FROM item WHERE type = ? AND item_id = ?",
+			"DELETE FROM item_revision WHERE type = ? AND key = ?",
+			"DELETE FROM conflict WHERE type = ? AND key = ?",
+		} {
+			if _, err = tx.ExecContext(newCtx, query, item.kind, item.key); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	if _, err = tx.ExecContext(newCtx, "UPDATE sync_state SET revision=? WHERE id = 1", revision); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *SyncSqlite) Close() error {
+	if err := s.db.Close(); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+type SyncStorager interface {
+	Revision(ctx context.Context) (int64, error)
+	SetRevision(ctx context.Context, revision int64) error
+	ItemRevision(ctx context.Context, kind models.ItemType, key string) (int64, error)
+	SetItemRevision(ctx context.Context, kind models.ItemType, key string, revision int64) error
+	Sweep(ctx context.Context, delivered func(kind models.ItemType, key string) bool, revision int64) error
+	KeyCheck(ctx context.Context) (string, error)
+	SetKeyCheck(ctx context.Context, check string) error
+	LegacyMigration(ctx context.Context) (bool, error)
+	SetLegacyMigration(ctx context.Context, migration bool) error
+}
+
+type SyncSqliteTestSuite struct {
+	suite.Suite
+	SyncStorager
+	items *ItemSqlite
+}
+
+func (ts *SyncSqliteTestSuite) SetupSuite() {
+	_ = Migrate("client_test.db")
+	ts.SyncStorager, _ = NewSyncSqlite("client_test.db", time.Second*5)
+	ts.items, _ = NewItemSqlite("client_test.db", time.Second*5)
+}
+
+func TestSyncSqlite(t *testing.T) {
+	suite.Run(t, new(SyncSqliteTestSuite))
+}
+
+func (ts *SyncSqliteTestSuite) SetupTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *SyncSqliteTestSuite) TearDownTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *SyncSqliteTestSuite) clean(ctx context.Context) error {
+	db := ts.SyncStorager.(*SyncSqlite).db
+	for _, query := range []string{
+		"DELETE FROM item",
+		"DELETE FROM item_revision",
+		"DELETE FROM conflict",
+		"DELETE FROM outbox",
+		"UPDATE sync_state SET revision=0 WHERE id = 1",
+	} {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ts *SyncSqliteTestSuite) TestSetRevision() {
+	revision, err := ts.Revision(context.Background())
+	ts.NoError(err)
+	ts.Equal(int64(0), revision)
+
+	ts.NoError(ts.SetRevision(context.Background(), 42))
+
+	revision, err = ts.Revision(context.Background())
+	ts.NoError(err)
+	ts.Equal(int64(42), revision)
+}
+
+func (ts *SyncSqliteTestSuite) TestSweep() {
+	ctx := context.Background()
+	ts.NoError(ts.items.Save(ctx, cred1.Type, cred1.ID, []byte(`{"type":"cred","login":"login1"}`)))
+	ts.NoError(ts.items.Save(ctx, cred2.Type, cred2.ID, []byte(`{"type":"cred","login":"login2"}`)))
+	ts.NoError(ts.items.Save(ctx, binary1.Type, binary1.ID, []byte(`{"type":"binary","key":"file1.txt"}`)))
+	ts.NoError(ts.SetItemRevision(ctx, cred2.Type, cred2.ID, 3))
+	// the binary is changed locally and not acknowledged yet
+	outbox, _ := NewOutboxSqlite("client_test.db", time.Second*5)
+	ts.NoError(outbox.Save(ctx, models.PendingChange{ID: "request1", Type: binary1.Type, Key: binary1.ID, Value: []byte(`{}`)}))
+
+	// only the first credentials are in the snapshot
+	ts.NoError(ts.Sweep(ctx, func(kind models.ItemType, key string) bool {
+		return kind == cred1.Type && key == cred1.ID
+	}, 7))
+
+	revision, err := ts.Revision(ctx)
+	ts.NoError(err)
+	ts.Equal(int64(7), revision)
+	list, err := ts.items.All(ctx, models.CredItem)
+	ts.NoError(err)
+	ts.Equal(1, len(list))
+	_, err = ts.items.ByID(ctx, binary1.Type, binary1.ID)
+	ts.NoError(err)
+	revision, err = ts.ItemRevision(ctx, cred2.Type, cred2.ID)
+	ts.NoError(err)
+	ts.Equal(int64(0), revision)
+}
+
+func (ts *SyncSqliteTestSuite) TestSetItemRevision() {
+	revision, err := ts.ItemRevision(context.Background(), models.CredItem, cred1.Login)
+	ts.NoError(err)
+	ts.Equal(int64(0), revision)
+
+	ts.NoError(ts.SetItemRevision(context.Background(), models.CredItem, cred1.Login, 3))
+	ts.NoError(ts.SetItemRevision(context.Background(), models.CredItem, cred1.Login, 8))
+
+	revision, err = ts.ItemRevision(context.Background(), models.CredItem, cred1.Login)
+	ts.NoError(err)
+	ts.Equal(int64(8), revision)
+}
+
+func (ts *SyncSqliteTestSuite) TestKeyCheckKeptOnSweep() {
+	ts.NoError(ts.SetKeyCheck(context.Background(), "check"))
+	ts.NoError(ts.Sweep(context.Background(), func(models.ItemType, string) bool { return false }, 1))
+
+	check, err := ts.KeyCheck(context.Background())
+	ts.NoError(err)
+	ts.Equal("check", check)
+
+	ts.NoError(ts.SetKeyCheck(context.Background(), ""))
+}
+
+func (ts *SyncSqliteTestSuite) TestLegacyMigration() {
+	migration, err := ts.LegacyMigration(context.Background())
+	ts.NoError(err)
+	ts.False(migration)
+
+	ts.NoError(ts.SetLegacyMigration(context.Background(), true))
+	migration, err = ts.LegacyMigration(context.Background())
+	ts.NoError(err)
+	ts.True(migration)
+
+	ts.NoError(ts.SetLegacyMigration(context.Background(), false))
+}
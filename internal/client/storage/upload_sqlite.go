@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// UploadSqlite keeps files being uploaded in chunks, uploads survive client restart.
+// The binary item is kept as JSON, it is sent to the server when the upload is complete.
+// Uploads are keyed by the item ID: a file added again for the item replaces its upload.
+type UploadSqlite struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewUploadSqlite(storagePath string, timeout time.Duration) (*UploadSqlite, error) {
+	db, err := newSQLDB(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadSqlite{
+		db:      db,
+		timeout: timeout,
+	}, nil
+}
+
+// All returns uploads in progress and failed ones.
+func (s *UploadSqlite) All(ctx context.Context) ([]models.Upload, error) {
+	const op = "storage.sqlite.Upload.All"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("SELECT item, path, mod_time, content, error FROM upload ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(newCtx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	res := []models.Upload{}
+	for rows.Next() {
+		var upload models.Upload
+		var item []byte
+		err = rows.Scan(&item, &upload.Path, &upload.ModTime, &upload.Content, &upload.Error)
+		if err != nil {
+			continue
+		}
+		if err = json.Unmarshal(item, &upload.Binary); err != nil || upload.Binary.File == nil {
+			continue
+		}
+		res = append(res, upload)
+	}
+	return res, nil
+}
+
+// Save adds the upload of the file referenced by the binary item, the upload of the item saved before is replaced.
+func (s *UploadSqlite) Save(ctx context.Context, upload models.Upload) error {
+	const op = "storage.sqlite.Upload.Save"
+
+	if upload.Binary.File == nil {
+		return fmt.Errorf("%s: binary item has no file", op)
+	}
+	item, err := json.Marshal(upload.Binary)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("INSERT OR REPLACE INTO upload(item_id, item, path, mod_time, content, error) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, upload.Binary.ID, item, upload.Path, upload.ModTime, upload.Content, upload.Error)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Fail marks the upload failed, it is not resumed.
+func (s *UploadSqlite) Fail(ctx context.Context, id string, reason string) error {
+	const op = "storage.sqlite.Upload.Fail"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("UPDATE upload SET error=? WHERE item_id=?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, reason, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Delete removes the complete (or abandoned) upload.
+func (s *UploadSqlite) Delete(ctx context.Context, id string) error {
+	const op = "storage.sqlite.Upload.Delete"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt, err := s.db.Prepare("DELETE FROM upload WHERE item_id=?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(newCtx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *UploadSqlite) Close() error {
+	if err := s.db.Close(); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+var (
+	upload1 = models.Upload{
+		Binary:  models.Binary{ID: "binary-1", Type: models.BinItem, Tags: []string{"tag1"}, Key: "file1.bin", File: &models.FileRef{ID: "id1", Size: 10, ChunkSize: 4, Chunks: 3, Hash: "hash1", Key: []byte("key1")}},
+		Path:    "/tmp/file1.bin",
+		ModTime: 1,
+	}
+	upload2 = models.Upload{
+		Binary:  models.Binary{ID: "binary-2", Type: models.BinItem, Tags: []string{"tag1"}, Key: "file2.bin", File: &models.FileRef{ID: "id2", Size: 4, ChunkSize: 4, Chunks: 1, Hash: "hash2", Key: []byte("key2")}},
+		Path:    "/tmp/file2.bin",
+		ModTime: 2,
+	}
+)
+
+type UploadStorager interface {
+	All(ctx context.Context) ([]models.Upload, error)
+	Save(ctx context.Context, upload models.Upload) error
+	Fail(ctx context.Context, key string, reason string) error
+	Delete(ctx context.Context, key string) error
+}
+
+type testUploadStorager interface {
+	UploadStorager
+	clean(ctx context.Context) error
+}
+
+func (s *UploadSqlite) clean(ctx context.Context) error {
+	newCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	_, err := s.db.ExecContext(newCtx, "DELETE FROM upload")
+	return err
+}
+
+type UploadSqliteTestSuite struct {
+	suite.Suite
+	testUploadStorager
+}
+
+func (ts *UploadSqliteTestSuite) SetupSuite() {
+	_ = Migrate("client_test.db")
+	ts.testUploadStorager, _ = NewUploadSqlite("client_test.db", time.Second*5)
+}
+
+func TestUploadSqlite(t *testing.T) {
+	suite.Run(t, new(UploadSqliteTestSuite))
+}
+
+func (ts *UploadSqliteTestSuite) SetupTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *UploadSqliteTestSuite) TearDownTest() {
+	ts.Require().NoError(ts.clean(context.Background()))
+}
+
+func (ts *UploadSqliteTestSuite) TestSave() {
+	ts.NoError(ts.Save(context.Background(), upload1))
+	ts.NoError(ts.Save(context.Background(), upload2))
+
+	uploads, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.Upload{upload1, upload2}, uploads)
+
+	// binary item without file is not uploaded
+	ts.Error(ts.Save(context.Background(), models.Upload{Binary: binary1, Path: "/tmp/file1.txt"}))
+}
+
+func (ts *UploadSqliteTestSuite) TestSaveAgain() {
+	ts.NoError(ts.Save(context.Background(), upload1))
+
+	// the same file is uploaded for another item, the file added again replaces the upload of the item
+	other := upload1
+	other.Binary.ID, other.Binary.Key = "binary-3", "copy.bin"
+	ts.NoError(ts.Save(context.Background(), other))
+	again := upload1
+	again.Path, again.ModTime = "", 0
+	again.Content = []byte("content saved before files")
+	ts.NoError(ts.Save(context.Background(), again))
+
+	uploads, err := ts.All(context.Background())
+	ts.NoError(err)
+	ts.Equal([]models.Upload{other, again}, uploads)
+}
+
+func (ts *UploadSqliteTestSuite) TestFailDelete() {
+	ts.NoError(ts.Save(context.Background(), upload1))
+	ts.NoError(ts.Save(context.Background(), upload2))
+
+	ts.NoError(ts.Fail(context.Background(), "binary-1", "file was changed"))
+	ts.NoError(ts.Delete(context.Background(), "binary-2"))
+
+	uploads, err := ts.All(context.Background())
+	ts.NoError(err)
+	failed := upload1
+	failed.Error = "file was changed"
+	ts.Equal([]models.Upload{failed}, uploads)
+}
@@ -12,6 +12,17 @@ import (
 // LoadTLSCredentials connection secured by server-side TLS.
 // https://dev.to/techschoolguru/how-to-secure-grpc-connection-with-ssl-tls-in-go-4ph
 func LoadTLSCredentials(caCertFile string) (credentials.TransportCredentials, error) {
+	config, err := LoadTLSConfig(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the credentials and return it
+	return credentials.NewTLS(config), nil
+}
+
+// LoadTLSConfig returns TLS config trusting only the server certificates signed by the CA.
+func LoadTLSConfig(caCertFile string) (*tls.Config, error) {
 	// Load certificate of the CA who signed server's certificate
 	pemServerCA, err := ioutil.ReadFile(caCertFile)
 	if err != nil {
@@ -23,10 +34,7 @@ func LoadTLSCredentials(caCertFile string) (credentials.TransportCredentials, er
 		return nil, fmt.Errorf("failed to add server CA's certificate")
 	}
 
-	// Create the credentials and return it
-	config := &tls.Config{
+	return &tls.Config{
 		RootCAs: certPool,
-	}
-
-	return credentials.NewTLS(config), nil
+	}, nil
 }
@@ -1,8 +1,19 @@
 // ws module establish websocket connection with server
 // It starts two gorutine for reading and writing messages.
-// When the client just establishes a connection, client received from server actual data snapshot.
+// When the client just establishes a connection, it sends the last applied revision and receives from server
+// changes after it (or actual data snapshot if the revision is too old).
+// Full snapshot is received in chunks, every message read from the server is limited by the max message size.
 // If user saved new private data, ws sends to the server update.
+// If user deleted private data, ws sends to the server delete message (tombstone).
 // If same user used other client and makes changes, then current client receives update message.
+// Every client message has request ID, server confirms saved changes with ack or answers with typed error.
+// User changes are kept in the outbox (local database) until the server acknowledges them,
+// changes made offline or not acknowledged before the connection was lost are sent again in order after connect.
+// Server saves the change only once, replayed changes are acknowledged without saving.
+// If the connection is lost (or cannot be established), ws connects again after a delay growing exponentially
+// with random jitter, the same token is sent again and changes made meanwhile are received.
+// Only if the server rejects the token ws stops and closes "interrupt" channel.
+// Server certificate is verified with the CA certificate configured for the client, like the files endpoint does.
 package ws
 
 import (
@@ -11,6 +22,10 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -20,88 +35,241 @@ import (
 
 var (
 	ErrConnectToServer = errors.New("failed establish websocket connection")
+	ErrInvalidToken    = errors.New("server rejected the token")
+)
+
+// State is the state of connection to the server.
+type State string
+
+const (
+	Connecting   State = "connecting"
+	Connected    State = "connected"
+	Reconnecting State = "reconnecting"
+	Disconnected State = "disconnected"
 )
 
 type MessageService interface {
 	ApplyMessage(ctx context.Context, msg models.Message)
+	Revision(ctx context.Context) (int64, error)
+	Outbox(ctx context.Context) ([]models.Message, error)
+	Changed() <-chan struct{}
 }
 
 type WSClient struct {
-	log  *slog.Logger
-	conn *websocket.Conn
-	ch   chan models.Message
-	s    MessageService
-	url  string
+	log      *slog.Logger
+	ch       chan models.Message
+	s        MessageService
+	url      string
+	tls      *tls.Config
+	minDelay time.Duration
+	maxDelay time.Duration
+	pingWait time.Duration
+	maxSize  int64
+
+	mu    *sync.Mutex
+	state State
+	token string
 }
 
-func NewWSClient(log *slog.Logger, ch chan models.Message, s MessageService, url string) *WSClient {
+// NewWSClient creates the client of the websocket endpoint at url, server certificate is verified by tlsConfig.
+func NewWSClient(log *slog.Logger, ch chan models.Message, s MessageService, url string, tlsConfig *tls.Config,
+	minDelay, maxDelay, pingWait time.Duration, maxSize int64) *WSClient {
 	return &WSClient{
-		log: log,
-		ch:  ch,
-		s:   s,
-		url: url,
+		log:      log,
+		ch:       ch,
+		s:        s,
+		url:      url,
+		tls:      tlsConfig,
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+		pingWait: pingWait,
+		maxSize:  maxSize,
+		mu:       &sync.Mutex{},
+		state:    Disconnected,
 	}
 }
 
+// State returns the current state of connection to the server.
+func (ws *WSClient) State() State {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.state
+}
+
+func (ws *WSClient) setState(state State) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.state = state
+}
+
+// SetToken replaces the token used for the next connection and the next messages.
+func (ws *WSClient) SetToken(token string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.token = token
+}
+
+func (ws *WSClient) currentToken() string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.token
+}
+
+// Run starts connection to the server in background, connection is restored until the context is done.
 func (ws *WSClient) Run(ctx context.Context, interrupt chan struct{}, token string) {
-	const op = "ws.Run"
+	ws.SetToken(token)
+	ws.setState(Connecting)
+
+	go ws.loop(ctx, interrupt)
+}
+
+func (ws *WSClient) loop(ctx context.Context, interrupt chan struct{}) {
+	const op = "ws.Run.loop"
 	log := ws.log.With(
 		slog.String("op", op),
 	)
 
-	dialer := *websocket.DefaultDialer
-	dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	attempt := 0
+	for {
+		conn, err := ws.connect(ctx)
+		if err == nil {
+			attempt = 0
+			ws.setState(Connected)
+			err = ws.serve(ctx, conn)
+		}
 
-	headers := make(map[string][]string)
-	headers["token"] = append(headers["token"], token)
+		if ctx.Err() != nil {
+			ws.setState(Disconnected)
+			return
+		}
+		if errors.Is(err, ErrInvalidToken) {
+			log.Error("server rejected the token, connection is not restored")
+			ws.setState(Disconnected)
+			close(interrupt)
+			return
+		}
 
-	var err error
-	ws.conn, _, err = dialer.DialContext(ctx, ws.url, headers)
+		delay := backoff(attempt, ws.minDelay, ws.maxDelay)
+		attempt++
+		ws.setState(Reconnecting)
+		log.Warn(
+			"connection to server lost, reconnecting",
+			slog.Duration("delay", delay),
+			slog.Int("attempt", attempt),
+			sl.Err(err),
+		)
 
+		select {
+		case <-ctx.Done():
+			ws.setState(Disconnected)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect establishes connection sending the token and the last applied revision,
+// server sends only changes after it.
+func (ws *WSClient) connect(ctx context.Context) (*websocket.Conn, error) {
+	const op = "ws.Run.connect"
+	log := ws.log.With(
+		slog.String("op", op),
+	)
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = ws.tls
+
+	revision, err := ws.s.Revision(ctx)
 	if err != nil {
-		log.Error(
-			"failed establish websocket connection",
+		log.Warn(
+			"failed read last applied revision, full snapshot is requested",
 			sl.Err(err),
 		)
-		close(interrupt)
-		return
 	}
 
-	go ws.read(ctx, interrupt)
-	go ws.write(ctx, token, interrupt)
+	headers := make(map[string][]string)
+	headers["token"] = append(headers["token"], ws.currentToken())
+	headers["revision"] = append(headers["revision"], strconv.FormatInt(revision, 10))
+
+	conn, _, err := dialer.DialContext(ctx, ws.url, headers)
+	if err != nil {
+		return nil, errors.Join(ErrConnectToServer, err)
+	}
+	return conn, nil
 }
 
-func (ws *WSClient) read(ctx context.Context, interrupt chan struct{}) {
+// serve reads and writes messages until the connection is lost, the error of reading or writing is returned.
+func (ws *WSClient) serve(ctx context.Context, conn *websocket.Conn) error {
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs <- ws.read(connCtx, conn)
+	}()
+	go func() {
+		defer wg.Done()
+		errs <- ws.write(connCtx, conn)
+	}()
+
+	err := <-errs
+	cancel()
+	// unblocks reading
+	_ = conn.Close()
+	wg.Wait()
+
+	return err
+}
+
+func (ws *WSClient) read(ctx context.Context, conn *websocket.Conn) error {
 	op := "ws.Run.read"
 	log := ws.log.With(
 		slog.String("op", op),
 	)
 
+	// larger message closes the connection, the server sends the snapshot in chunks to stay under the limit
+	if ws.maxSize > 0 {
+		conn.SetReadLimit(ws.maxSize)
+	}
+	// server pings the client periodically, connection is considered lost if nothing is received during ping wait
+	_ = conn.SetReadDeadline(time.Now().Add(ws.pingWait))
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(ws.pingWait))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info(
 				"receive context done message",
 			)
-			return
+			return ctx.Err()
 
 		default:
 			var header struct{ Type string }
-			mt, data, err := ws.conn.ReadMessage()
+			mt, data, err := conn.ReadMessage()
 			if err != nil {
-				// TODO implement restoring connection to the server
 				log.Error(
 					"error receiving message from server",
-					slog.String("address", ws.conn.RemoteAddr().String()),
+					slog.String("address", conn.RemoteAddr().String()),
 					sl.Err(err),
 				)
-				return
+				return err
 			}
+			_ = conn.SetReadDeadline(time.Now().Add(ws.pingWait))
 			if mt != websocket.TextMessage {
 				continue
 			}
 			err = json.Unmarshal(data, &header)
-			if err != nil || (header.Type != "update" && header.Type != "snapshot" && header.Type != "error") {
+			if err != nil || !known(models.MessageType(header.Type)) {
 				continue
 			}
 			var msg models.Message
@@ -109,14 +277,13 @@ func (ws *WSClient) read(ctx context.Context, interrupt chan struct{}) {
 			if err != nil {
 				log.Warn(
 					"receiving unexpected message from server",
-					slog.String("message value", string(msg.Value)),
+					slog.String("message type", header.Type),
 					sl.Err(err),
 				)
 				continue
 			}
-			if msg.Type == "error" && string(msg.Value) == "invalid token" {
-				close(interrupt)
-				return
+			if msg.Type == "error" && msg.Code == models.CodeInvalidToken {
+				return ErrInvalidToken
 			}
 
 			ws.s.ApplyMessage(ctx, msg)
@@ -124,27 +291,105 @@ func (ws *WSClient) read(ctx context.Context, interrupt chan struct{}) {
 	}
 }
 
-func (ws *WSClient) write(ctx context.Context, token string, interrupt chan struct{}) {
+func (ws *WSClient) write(ctx context.Context, conn *websocket.Conn) error {
 	op := "ws.Run.write"
 	log := ws.log.With(
 		slog.String("op", op),
 	)
 
+	// changes written to the current connection, they are written again only after reconnect
+	written := make(map[string]struct{})
+	if err := ws.flush(ctx, conn, written); err != nil {
+		return err
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info("recieve context done message")
 
-			return
+			return ctx.Err()
+		case <-ws.s.Changed():
+			if err := ws.flush(ctx, conn, written); err != nil {
+				log.Error(
+					"error sending changes to server",
+					sl.Err(err),
+				)
+				return err
+			}
 		case msg := <-ws.ch:
-			msg.Token = token
+			msg.Token = ws.currentToken()
 			data, _ := json.Marshal(msg)
-			err := ws.conn.WriteMessage(websocket.TextMessage, data)
+			err := conn.WriteMessage(websocket.TextMessage, data)
 			if err != nil {
-				// TODO implement restoring connection to the server
-				close(interrupt)
-				return
+				return err
 			}
 		}
 	}
 }
+
+// flush writes outbox changes which were not written to the current connection yet.
+func (ws *WSClient) flush(ctx context.Context, conn *websocket.Conn, written map[string]struct{}) error {
+	const op = "ws.Run.flush"
+	log := ws.log.With(
+		slog.String("op", op),
+	)
+
+	msgs, err := ws.s.Outbox(ctx)
+	if err != nil {
+		log.Error("failed read outbox", sl.Err(err))
+		return nil
+	}
+
+	token := ws.currentToken()
+	ready := make(map[string]struct{}, len(msgs))
+	for _, msg := range msgs {
+		ready[msg.ID] = struct{}{}
+		if _, ok := written[msg.ID]; ok {
+			continue
+		}
+		msg.Token = token
+		data, _ := json.Marshal(msg)
+		if err = conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return err
+		}
+		written[msg.ID] = struct{}{}
+	}
+
+	// acknowledged changes left outbox
+	for id := range written {
+		if _, ok := ready[id]; !ok {
+			delete(written, id)
+		}
+	}
+	return nil
+}
+
+// known reports whether the message from the server is handled by the client, other messages are skipped.
+func known(t models.MessageType) bool {
+	switch t {
+	case models.Update, models.Snapshot, models.SnapshotBegin, models.SnapshotChunk, models.SnapshotEnd, models.Delete,
+		models.Conflict, models.History, models.SnapshotAt, models.Ack, models.Error:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay before the next connection attempt: min delay doubled on every failed attempt,
+// limited by max delay. Random jitter (up to half of the delay) spreads reconnections of many clients.
+func backoff(attempt int, minDelay, maxDelay time.Duration) time.Duration {
+	delay := minDelay
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
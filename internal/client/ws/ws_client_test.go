@@ -0,0 +1,31 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	minDelay, maxDelay := time.Second, 30*time.Second
+
+	tests := []struct {
+		attempt int
+		from    time.Duration
+		to      time.Duration
+	}{
+		{attempt: 0, from: 500 * time.Millisecond, to: time.Second},
+		{attempt: 1, from: time.Second, to: 2 * time.Second},
+		{attempt: 3, from: 4 * time.Second, to: 8 * time.Second},
+		{attempt: 10, from: 15 * time.Second, to: 30 * time.Second},
+		{attempt: 100, from: 15 * time.Second, to: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay := backoff(tt.attempt, minDelay, maxDelay)
+			require.GreaterOrEqual(t, delay, tt.from)
+			require.LessOrEqual(t, delay, tt.to)
+		}
+	}
+}
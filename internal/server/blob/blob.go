@@ -0,0 +1,55 @@
+// Package blob keeps blobs addressed by their content: the key of a blob is derived from the blob hash,
+// so the same bytes are stored once however many records reference them. Blobs are immutable,
+// saving the key again keeps the stored blob. Records referencing blobs are kept elsewhere,
+// unreferenced blobs are collected with Walk and Delete.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store is the backend keeping blobs. Keys are made of segments separated by "/",
+// a segment has letters, digits, '-' and '_' only.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn for every stored blob with the time it was saved, error of fn stops the walk.
+	Walk(ctx context.Context, fn func(key string, saved time.Time) error) error
+}
+
+// New returns the store of the backend: "fs" keeps blobs in files under path.
+func New(backend string, path string) (Store, error) {
+	switch backend {
+	case "fs":
+		return NewFS(path)
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", backend)
+	}
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" {
+			return false
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
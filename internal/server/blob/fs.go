@@ -0,0 +1,157 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tmpPrefix marks files being written, they are not blobs yet.
+const tmpPrefix = ".tmp-"
+
+// FS keeps every blob in a file under the root directory. The last key segment is sharded by its first two
+// characters, so directories stay small: key "1/abcdef" is kept in "1/ab/abcdef".
+// Blob is written into a temporary file and renamed, a blob is never seen partially written.
+type FS struct {
+	dir string
+}
+
+func NewFS(dir string) (*FS, error) {
+	const op = "blob.NewFS"
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &FS{dir: dir}, nil
+}
+
+func (s *FS) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	segments := strings.Split(key, "/")
+	last := segments[len(segments)-1]
+	shard := last
+	if len(shard) > 2 {
+		shard = shard[:2]
+	}
+	segments = append(segments[:len(segments)-1], shard, last)
+	return filepath.Join(append([]string{s.dir}, segments...)...), nil
+}
+
+// Put saves the blob unless the key is already stored. Stored blob is touched instead,
+// so a blob referenced again is not collected as saved long ago.
+func (s *FS) Put(ctx context.Context, key string, data []byte) error {
+	const op = "blob.FS.Put"
+
+	path, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err = os.Stat(path); err == nil {
+		now := time.Now()
+		if err = os.Chtimes(path, now, now); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tmpPrefix)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Get returns the blob, ErrNotFound is returned if the key is not stored.
+func (s *FS) Get(ctx context.Context, key string) ([]byte, error) {
+	const op = "blob.FS.Get"
+
+	path, err := s.path(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// Delete removes the blob, missing blob is not an error.
+func (s *FS) Delete(ctx context.Context, key string) error {
+	const op = "blob.FS.Delete"
+
+	path, err := s.path(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Walk calls fn for every blob, the saving time is the file modification time.
+// Temporary files of blobs being written are skipped.
+func (s *FS) Walk(ctx context.Context, fn func(key string, saved time.Time) error) error {
+	const op = "blob.FS.Walk"
+
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tmpPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		if len(segments) < 2 {
+			return nil
+		}
+		// drop the shard directory
+		key := strings.Join(append(segments[:len(segments)-2], segments[len(segments)-1]), "/")
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(key, info.ModTime())
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
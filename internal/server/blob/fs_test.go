@@ -0,0 +1,63 @@
+package blob
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFS(dir)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "1/abcdef", []byte("blob 1")))
+	require.NoError(t, s.Put(ctx, "2/a", []byte("blob 2")))
+	assert.FileExists(t, filepath.Join(dir, "1", "ab", "abcdef"))
+
+	data, err := s.Get(ctx, "1/abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("blob 1"), data)
+
+	// stored blob is kept and touched
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "1", "ab", "abcdef"), old, old))
+	require.NoError(t, s.Put(ctx, "1/abcdef", []byte("another blob")))
+	data, err = s.Get(ctx, "1/abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("blob 1"), data)
+
+	// files being written are not blobs
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1", "ab", tmpPrefix+"1"), []byte("partial"), 0o600))
+	var keys []string
+	require.NoError(t, s.Walk(ctx, func(key string, saved time.Time) error {
+		keys = append(keys, key)
+		assert.WithinDuration(t, time.Now(), saved, time.Minute)
+		return nil
+	}))
+	sort.Strings(keys)
+	assert.Equal(t, []string{"1/abcdef", "2/a"}, keys)
+
+	require.NoError(t, s.Delete(ctx, "1/abcdef"))
+	require.NoError(t, s.Delete(ctx, "1/abcdef"))
+	_, err = s.Get(ctx, "1/abcdef")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFSInvalidKey(t *testing.T) {
+	s, err := NewFS(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../blob", "1//blob", "1/blob/", "/blob", "1/bl.ob"} {
+		assert.ErrorIs(t, s.Put(context.Background(), key, []byte("blob")), ErrInvalidKey, key)
+		_, err = s.Get(context.Background(), key)
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
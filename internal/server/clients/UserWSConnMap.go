@@ -2,34 +2,91 @@ package clients
 
 import (
 	"sync"
-
-	"github.com/gorilla/websocket"
 )
 
-// UserWSConnMap concurrency save structure, contains hashmap which contains user id (int64) key and slice of user websocket connections.
+// UserWSConnMap concurrency save structure, contains hashmap which contains user id (int64) key and slice of user sessions (websocket connections).
 // Same user may connect with different clients.
+// Session is removed from the map when it is closed.
 type UserWSConnMap struct {
 	mu    *sync.RWMutex
-	value map[int64][]*websocket.Conn
+	value map[int64][]*Session
 }
 
 func NewUserWSConnMap() *UserWSConnMap {
 	return &UserWSConnMap{
 		mu:    &sync.RWMutex{},
-		value: make(map[int64][]*websocket.Conn),
+		value: make(map[int64][]*Session),
 	}
 }
 
-func (m *UserWSConnMap) Put(userID int64, conn *websocket.Conn) {
+func (m *UserWSConnMap) Put(userID int64, session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.value[userID] = append(m.value[userID], session)
+}
+
+// Remove deletes the session of the user, it returns false if the session was already removed.
+func (m *UserWSConnMap) Remove(userID int64, session *Session) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.value[userID] = append(m.value[userID], conn)
+	sessions := m.value[userID]
+	for i, s := range sessions {
+		if s != session {
+			continue
+		}
+		rest := make([]*Session, 0, len(sessions)-1)
+		rest = append(rest, sessions[:i]...)
+		rest = append(rest, sessions[i+1:]...)
+		if len(rest) == 0 {
+			delete(m.value, userID)
+		} else {
+			m.value[userID] = rest
+		}
+		return true
+	}
+	return false
+}
+
+// UserSessions returns a copy of the user sessions list, it is safe to use while sessions are added or removed.
+func (m *UserWSConnMap) UserSessions(userID int64) []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]*Session, len(m.value[userID]))
+	copy(sessions, m.value[userID])
+	return sessions
 }
 
-func (m *UserWSConnMap) UserConns(userID int64) []*websocket.Conn {
+// All returns sessions of all users.
+func (m *UserWSConnMap) All() []*Session {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return m.value[userID]
+	sessions := make([]*Session, 0, len(m.value))
+	for _, userSessions := range m.value {
+		sessions = append(sessions, userSessions...)
+	}
+	return sessions
+}
+
+// Count returns the number of live user sessions.
+func (m *UserWSConnMap) Count(userID int64) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.value[userID])
+}
+
+// Sessions returns info of live user sessions in the order they were established.
+func (m *UserWSConnMap) Sessions(userID int64) []SessionInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]SessionInfo, 0, len(m.value[userID]))
+	for _, s := range m.value[userID] {
+		sessions = append(sessions, s.Info())
+	}
+	return sessions
 }
@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newConns opens n websocket connections to the test server and returns the client sides of them.
+// Test server reads messages until the connection is closed.
+func newConns(t *testing.T, n int) []*websocket.Conn {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conns := make([]*websocket.Conn, 0, n)
+	for i := 0; i < n; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func TestPutRemove(t *testing.T) {
+	conns := newConns(t, 3)
+	sessions := make([]*Session, 0, len(conns))
+	for _, conn := range conns {
+		sessions = append(sessions, NewSession(conn, 1, time.Second, time.Minute))
+	}
+	m := NewUserWSConnMap()
+	userID := int64(1)
+
+	m.Put(userID, sessions[0])
+	m.Put(userID, sessions[1])
+	m.Put(2, sessions[2])
+
+	require.Equal(t, 2, m.Count(userID))
+	require.Equal(t, []*Session{sessions[0], sessions[1]}, m.UserSessions(userID))
+
+	info := m.Sessions(userID)
+	require.Len(t, info, 2)
+	require.Equal(t, conns[0].RemoteAddr().String(), info[0].Address)
+	require.False(t, info[0].ConnectedAt.IsZero())
+
+	require.True(t, m.Remove(userID, sessions[0]))
+	require.False(t, m.Remove(userID, sessions[0]))
+	require.Equal(t, []*Session{sessions[1]}, m.UserSessions(userID))
+
+	require.True(t, m.Remove(userID, sessions[1]))
+	require.Equal(t, 0, m.Count(userID))
+	require.Empty(t, m.Sessions(userID))
+	require.Equal(t, 1, m.Count(2))
+}
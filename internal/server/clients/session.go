@@ -0,0 +1,211 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrSessionClosed = errors.New("session is closed")
+
+// SessionInfo describes live user connection.
+type SessionInfo struct {
+	Address     string    `json:"address"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// Session is a live user connection.
+// websocket.Conn does not support concurrent writers: all messages are written by the single writer goroutine (Run)
+// from the bounded queue. Session pings the client every ping period.
+// Session is closed when writing fails, when the queue is full (the client is too slow) or by Close.
+// Writer stops after writing close frame (SendClose), nothing can be written after it.
+// Updates sent while the client is syncing (Hold) are kept aside and queued after the sync (Release),
+// so the snapshot filling the queue does not close the session.
+type Session struct {
+	conn       *websocket.Conn
+	info       SessionInfo
+	queue      chan outbound
+	done       chan struct{}
+	stopped    chan struct{}
+	once       *sync.Once
+	writeWait  time.Duration
+	pingPeriod time.Duration
+
+	mu      *sync.Mutex
+	holding bool
+	held    [][]byte
+}
+
+type outbound struct {
+	messageType int
+	data        []byte
+}
+
+func NewSession(conn *websocket.Conn, queueSize int, writeWait time.Duration, pingPeriod time.Duration) *Session {
+	return &Session{
+		conn:       conn,
+		info:       SessionInfo{Address: conn.RemoteAddr().String(), ConnectedAt: time.Now()},
+		queue:      make(chan outbound, queueSize),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		once:       &sync.Once{},
+		writeWait:  writeWait,
+		pingPeriod: pingPeriod,
+		mu:         &sync.Mutex{},
+	}
+}
+
+// Info returns the address and the time of connection.
+func (s *Session) Info() SessionInfo {
+	return s.info
+}
+
+// Done is closed when the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Stopped is closed when the writer is stopped: the session is closed or close frame is written.
+func (s *Session) Stopped() <-chan struct{} {
+	return s.stopped
+}
+
+// Run writes queued messages and pings until the session is closed or close frame is written.
+func (s *Session) Run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.queue:
+			if err := s.conn.SetWriteDeadline(time.Now().Add(s.writeWait)); err != nil {
+				s.Close()
+				return
+			}
+			if err := s.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+				s.Close()
+				return
+			}
+			if msg.messageType == websocket.CloseMessage {
+				return
+			}
+		case <-ticker.C:
+			// reading fails when pong is not received in time
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.writeWait)); err != nil {
+				s.Close()
+				return
+			}
+		}
+	}
+}
+
+// Send queues the message without blocking.
+// If the queue is full the client does not keep up with the updates, the session is closed and false is returned.
+// Messages sent while the session holds updates are kept until Release, up to the queue size.
+func (s *Session) Send(data []byte) bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	s.mu.Lock()
+	if s.holding {
+		if len(s.held) >= cap(s.queue) {
+			s.mu.Unlock()
+			s.Close()
+			return false
+		}
+		s.held = append(s.held, data)
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- outbound{messageType: websocket.TextMessage, data: data}:
+		return true
+	default:
+		s.Close()
+		return false
+	}
+}
+
+// Hold keeps messages sent by Send aside until Release. The session holds updates while the client syncing
+// reads the snapshot: messages of the snapshot are queued by SendWait and may fill the queue.
+func (s *Session) Hold() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holding = true
+}
+
+// Release queues the held messages in the order they were sent waiting for the free place in the queue,
+// then Send queues messages again.
+func (s *Session) Release(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		held := s.held
+		s.held = nil
+		if len(held) == 0 {
+			s.holding = false
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+
+		for _, data := range held {
+			if err := s.SendWait(ctx, data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// SendWait queues the message waiting for the free place in the queue.
+// It is used for answers to the client requests: the client which sends requests faster than reads answers slows down itself.
+func (s *Session) SendWait(ctx context.Context, data []byte) error {
+	return s.sendWait(ctx, outbound{messageType: websocket.TextMessage, data: data})
+}
+
+// SendClose queues close frame after the messages already queued, the writer stops after writing it.
+func (s *Session) SendClose(ctx context.Context, code int, reason string) error {
+	return s.sendWait(ctx, outbound{messageType: websocket.CloseMessage, data: websocket.FormatCloseMessage(code, reason)})
+}
+
+func (s *Session) sendWait(ctx context.Context, msg outbound) error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+
+	select {
+	case s.queue <- msg:
+		return nil
+	case <-s.done:
+		return ErrSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StopReading makes the blocked reading of the connection fail immediately.
+func (s *Session) StopReading() {
+	_ = s.conn.SetReadDeadline(time.Now())
+}
+
+// Close stops writing and closes the connection, reading fails after it. It is safe to call Close several times.
+func (s *Session) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
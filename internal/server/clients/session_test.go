@@ -0,0 +1,109 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newSessionPair returns the server session and the client side of its connection.
+func newSessionPair(t *testing.T, queueSize int) (*Session, *websocket.Conn) {
+	upgrader := websocket.Upgrader{}
+	sessions := make(chan *Session, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sessions <- NewSession(conn, queueSize, time.Second, time.Minute)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	session := <-sessions
+	t.Cleanup(session.Close)
+	return session, client
+}
+
+func TestSessionWritesInOrder(t *testing.T) {
+	session, client := newSessionPair(t, 10)
+	go session.Run()
+
+	for i := 0; i < 10; i++ {
+		require.True(t, session.Send([]byte(fmt.Sprintf("message %d", i))))
+	}
+
+	for i := 0; i < 10; i++ {
+		_, data, err := client.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("message %d", i), string(data))
+	}
+}
+
+func TestSendSlowClient(t *testing.T) {
+	// writer is not started, the queue is not drained
+	session, _ := newSessionPair(t, 2)
+
+	require.True(t, session.Send([]byte("1")))
+	require.True(t, session.Send([]byte("2")))
+	require.False(t, session.Send([]byte("3")))
+
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("slow session is not closed")
+	}
+
+	require.False(t, session.Send([]byte("4")))
+	require.ErrorIs(t, session.SendWait(context.Background(), []byte("5")), ErrSessionClosed)
+}
+
+func TestSendWaitBlocksUntilWritten(t *testing.T) {
+	session, client := newSessionPair(t, 1)
+
+	require.NoError(t, session.SendWait(context.Background(), []byte("1")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, session.SendWait(ctx, []byte("2")), context.DeadlineExceeded)
+
+	go session.Run()
+	require.NoError(t, session.SendWait(context.Background(), []byte("2")))
+
+	for _, want := range []string{"1", "2"} {
+		_, data, err := client.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, want, string(data))
+	}
+}
+
+func TestHoldUpdatesWhileSyncing(t *testing.T) {
+	// writer is not started, the snapshot fills the queue
+	session, client := newSessionPair(t, 2)
+	session.Hold()
+
+	require.NoError(t, session.SendWait(context.Background(), []byte("snapshot 1")))
+	require.NoError(t, session.SendWait(context.Background(), []byte("snapshot 2")))
+	require.True(t, session.Send([]byte("update 1")))
+	require.True(t, session.Send([]byte("update 2")))
+
+	go session.Run()
+	require.NoError(t, session.Release(context.Background()))
+	require.True(t, session.Send([]byte("update 3")))
+
+	for _, want := range []string{"snapshot 1", "snapshot 2", "update 1", "update 2", "update 3"} {
+		_, data, err := client.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, want, string(data))
+	}
+}
@@ -17,12 +17,53 @@ type Config struct {
 	QueryTimeout time.Duration `yaml:"query_timeout" env-default:"2s"`
 	CertFile     string        `yaml:"cert_file" env-required:"true"`
 	KeyFile      string        `yaml:"key_file" env-required:"true"`
-	Key          string        `yaml:"key" env-required:"true"`
-	WS           WSConfig      `yaml:"ws"`
+	// keys are secret, they are never logged
+	Keys       KeysConfig `yaml:"keys" json:"-"`
+	MaxChanges int64      `yaml:"max_changes" env-default:"1000"`
+	// full snapshot is sent in chunks up to SnapshotChunkSize bytes (an item larger than it is sent alone)
+	SnapshotChunkSize int `yaml:"snapshot_chunk_size" env-default:"262144"`
+	// file chunks larger than MaxChunkSize bytes are rejected
+	MaxChunkSize int64       `yaml:"max_chunk_size" env-default:"4194304"`
+	Blobs        BlobsConfig `yaml:"blobs"`
+	// RequireBound is set after all rows saved before binding data to its row are re-encrypted:
+	// unbound data is not served then
+	RequireBound bool `yaml:"require_bound" env-default:"false"`
+	// connections not closed during ShutdownTimeout after stop signal are closed immediately
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	WS              WSConfig      `yaml:"ws"`
+}
+
+// KeysConfig configures the server keys. Data keys of users are wrapped by the key-encryption keys of the Provider:
+// "file" reads the keyring from File, "kms" asks the KMS process at KMSAddress. Unwrapped data keys are cached for CacheTTL.
+// Index key computes blind indexes of item type and key columns, it is not rotated. Legacy key (the former "key" setting)
+// decrypts type and key columns of rows saved before blind indexes, it is not needed once they are reindexed.
+// Keys are secret: they are set in environment variables, the committed config keeps no keys.
+type KeysConfig struct {
+	Index      string        `yaml:"index" env:"SERVER_INDEX_KEY" env-required:"true"`
+	Legacy     string        `yaml:"legacy" env:"SERVER_LEGACY_KEY"`
+	Provider   string        `yaml:"provider" env:"SERVER_KEK_PROVIDER" env-default:"file"`
+	File       string        `yaml:"file" env:"SERVER_KEK_FILE"`
+	KMSAddress string        `yaml:"kms_address" env:"SERVER_KMS_ADDRESS"`
+	KMSToken   string        `yaml:"kms_token" env:"SERVER_KMS_TOKEN"`
+	CacheTTL   time.Duration `yaml:"cache_ttl" env-default:"1m"`
+}
+
+// BlobsConfig configures the store of file chunks: "fs" Backend keeps them in files under Path.
+// Garbage collection keeps chunks and blobs saved during Grace, their files may be still uploaded.
+type BlobsConfig struct {
+	Backend string        `yaml:"backend" env-default:"fs"`
+	Path    string        `yaml:"path" env-default:"blobs"`
+	Grace   time.Duration `yaml:"grace" env-default:"24h"`
 }
 
 type WSConfig struct {
-	Address string `yaml:"address"`
+	Address    string        `yaml:"address"`
+	PingPeriod time.Duration `yaml:"ping_period" env-default:"30s"`
+	PongWait   time.Duration `yaml:"pong_wait" env-default:"60s"`
+	WriteWait  time.Duration `yaml:"write_wait" env-default:"10s"`
+	QueueSize  int           `yaml:"queue_size" env-default:"256"`
+	// messages from clients larger than MaxMessageSize close the connection
+	MaxMessageSize int64 `yaml:"max_message_size" env-default:"16777216"`
 }
 
 // MustLoad parses the file into the configuration structure Config.
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/lib"
+	"github.com/dkrasnykh/gophkeeper/internal/server/service"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+type FileService interface {
+	SaveChunk(ctx context.Context, userID int64, fileID string, n int, data []byte, hash string) error
+	Chunk(ctx context.Context, userID int64, fileID string, n int) ([]byte, string, error)
+	Chunks(ctx context.Context, userID int64, fileID string) ([]int, error)
+}
+
+// ChunksResponse is the list of uploaded chunks of the file.
+type ChunksResponse struct {
+	Chunks []int `json:"chunks"`
+}
+
+// Files handles transfer of file chunks, files are too large to travel inside websocket messages:
+//
+//	PUT /files/{id}/chunks/{n} saves the chunk n (body), "hash" header is SHA-256 (hex) of the body
+//	GET /files/{id}/chunks/{n} returns the chunk n with its hash in "hash" header
+//	GET /files/{id}/chunks     returns numbers of the uploaded chunks (ChunksResponse)
+//
+// The user is identified by the token header. Chunks larger than maxChunk bytes are rejected.
+type Files struct {
+	log      *slog.Logger
+	service  FileService
+	maxChunk int64
+}
+
+func NewFiles(log *slog.Logger, s FileService, maxChunk int64) *Files {
+	return &Files{
+		log:      log,
+		service:  s,
+		maxChunk: maxChunk,
+	}
+}
+
+func (h *Files) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op := "files.ServeHTTP"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+
+	userID, err := lib.ParseToken(r.Header.Get("token"))
+	if err != nil {
+		log.Error("invalid token", sl.Err(err))
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	// path is /files/{id}/chunks[/{n}]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] != "chunks" {
+		http.NotFound(w, r)
+		return
+	}
+	fileID := parts[0]
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.chunks(w, r, userID, fileID)
+		return
+	}
+
+	n, err := strconv.Atoi(parts[2])
+	if err != nil {
+		http.Error(w, "invalid chunk number", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		h.saveChunk(w, r, userID, fileID, n)
+	case http.MethodGet:
+		h.chunk(w, r, userID, fileID, n)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut}, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Files) saveChunk(w http.ResponseWriter, r *http.Request, userID int64, fileID string, n int) {
+	op := "files.saveChunk"
+	log := h.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxChunk))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "chunk too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Error("failed read file chunk", sl.Err(err))
+		http.Error(w, "failed read chunk", http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.SaveChunk(r.Context(), userID, fileID, n, data, r.Header.Get("hash"))
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Files) chunk(w http.ResponseWriter, r *http.Request, userID int64, fileID string, n int) {
+	op := "files.chunk"
+	log := h.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	data, hash, err := h.service.Chunk(r.Context(), userID, fileID, n)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("hash", hash)
+	if _, err = w.Write(data); err != nil {
+		log.Error("failed write file chunk", sl.Err(err))
+	}
+}
+
+func (h *Files) chunks(w http.ResponseWriter, r *http.Request, userID int64, fileID string) {
+	op := "files.chunks"
+	log := h.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	chunks, err := h.service.Chunks(r.Context(), userID, fileID)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	if chunks == nil {
+		chunks = []int{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(ChunksResponse{Chunks: chunks}); err != nil {
+		log.Error("failed write chunks response", sl.Err(err))
+	}
+}
+
+func writeFileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidChunk):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrChunkHash):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrChunkNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
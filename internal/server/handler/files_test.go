@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/service"
+)
+
+// fakeFileService keeps chunks in memory, it checks hashes like the service. Files have up to 10 chunks.
+type fakeFileService struct {
+	mu     sync.Mutex
+	chunks map[string][]byte
+}
+
+func chunkKey(userID int64, fileID string, n int) string {
+	return fmt.Sprintf("%d/%s/%d", userID, fileID, n)
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *fakeFileService) SaveChunk(ctx context.Context, userID int64, fileID string, n int, data []byte, hash string) error {
+	if hashOf(data) != hash {
+		return service.ErrChunkHash
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks[chunkKey(userID, fileID, n)] = data
+	return nil
+}
+
+func (s *fakeFileService) Chunk(ctx context.Context, userID int64, fileID string, n int) ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.chunks[chunkKey(userID, fileID, n)]
+	if !ok {
+		return nil, "", service.ErrChunkNotFound
+	}
+	return data, hashOf(data), nil
+}
+
+func (s *fakeFileService) Chunks(ctx context.Context, userID int64, fileID string) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []int
+	for n := 0; n < 10; n++ {
+		if _, ok := s.chunks[chunkKey(userID, fileID, n)]; ok {
+			res = append(res, n)
+		}
+	}
+	return res, nil
+}
+
+func newFilesServer(t *testing.T, maxChunk int64) *httptest.Server {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mux := http.NewServeMux()
+	mux.Handle("/files/", NewFiles(log, &fakeFileService{chunks: make(map[string][]byte)}, maxChunk))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doFiles(t *testing.T, method string, url string, token string, body []byte, hash string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("token", token)
+	if hash != "" {
+		req.Header.Set("hash", hash)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestFilesUploadDownload(t *testing.T) {
+	srv := newFilesServer(t, 1<<10)
+	token := newToken(t, 1)
+
+	chunk0, chunk2 := []byte("chunk 0"), []byte("chunk 2")
+	resp, _ := doFiles(t, http.MethodPut, srv.URL+"/files/file1/chunks/0", token, chunk0, hashOf(chunk0))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = doFiles(t, http.MethodPut, srv.URL+"/files/file1/chunks/2", token, chunk2, hashOf(chunk2))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body := doFiles(t, http.MethodGet, srv.URL+"/files/file1/chunks", token, nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var chunks ChunksResponse
+	require.NoError(t, json.Unmarshal(body, &chunks))
+	assert.Equal(t, []int{0, 2}, chunks.Chunks)
+
+	resp, body = doFiles(t, http.MethodGet, srv.URL+"/files/file1/chunks/2", token, nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, chunk2, body)
+	assert.Equal(t, hashOf(chunk2), resp.Header.Get("hash"))
+
+	// chunks of another user are not found
+	resp, _ = doFiles(t, http.MethodGet, srv.URL+"/files/file1/chunks/2", newToken(t, 2), nil, "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, body = doFiles(t, http.MethodGet, srv.URL+"/files/file1/chunks", newToken(t, 2), nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"chunks":[]}`, string(body))
+}
+
+func TestFilesFailCases(t *testing.T) {
+	srv := newFilesServer(t, 16)
+	token := newToken(t, 1)
+
+	chunk := []byte("chunk")
+	large := bytes.Repeat([]byte("a"), 17)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   []byte
+		hash   string
+		status int
+	}{
+		{name: "invalid token", method: http.MethodPut, path: "/files/file1/chunks/0", token: "invalid", body: chunk, hash: hashOf(chunk), status: http.StatusUnauthorized},
+		{name: "damaged chunk", method: http.MethodPut, path: "/files/file1/chunks/0", token: token, body: chunk, hash: hashOf(large), status: http.StatusUnprocessableEntity},
+		{name: "chunk too large", method: http.MethodPut, path: "/files/file1/chunks/0", token: token, body: large, hash: hashOf(large), status: http.StatusRequestEntityTooLarge},
+		{name: "invalid chunk number", method: http.MethodGet, path: "/files/file1/chunks/first", token: token, status: http.StatusBadRequest},
+		{name: "missing chunk", method: http.MethodGet, path: "/files/file1/chunks/0", token: token, status: http.StatusNotFound},
+		{name: "unknown path", method: http.MethodGet, path: "/files/file1", token: token, status: http.StatusNotFound},
+		{name: "chunk list is read only", method: http.MethodPut, path: "/files/file1/chunks", token: token, status: http.StatusMethodNotAllowed},
+		{name: "chunk is not deleted", method: http.MethodDelete, path: "/files/file1/chunks/0", token: token, status: http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := doFiles(t, test.method, srv.URL+test.path, test.token, test.body, test.hash)
+			assert.Equal(t, test.status, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/clients"
+	"github.com/dkrasnykh/gophkeeper/internal/server/lib"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+// SessionsResponse is the list of live user connections.
+type SessionsResponse struct {
+	Count    int                   `json:"count"`
+	Sessions []clients.SessionInfo `json:"sessions"`
+}
+
+// Sessions answers the number and the list of live connections of the user identified by the token header.
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	op := "ws.Sessions"
+	log := h.log.With(
+		slog.String("op", op),
+	)
+
+	userID, err := lib.ParseToken(r.Header.Get("token"))
+	if err != nil {
+		log.Error("invalid token", sl.Err(err))
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	sessions := h.conns.Sessions(userID)
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(SessionsResponse{Count: len(sessions), Sessions: sessions}); err != nil {
+		log.Error("failed write sessions response", slog.Int64("user_id", userID), sl.Err(err))
+	}
+}
@@ -3,21 +3,42 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
 	"github.com/dkrasnykh/gophkeeper/internal/server/clients"
 	"github.com/dkrasnykh/gophkeeper/internal/server/lib"
+	"github.com/dkrasnykh/gophkeeper/internal/server/service"
 	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
 )
 
 type IService interface {
-	Snapshot(ctx context.Context, userID int64) (models.Message, error)
-	Save(ctx context.Context, userID int64, msg models.Message) error
+	Sync(ctx context.Context, userID int64, revision int64, send func(models.Message) error) error
+	Save(ctx context.Context, userID int64, msg models.Message) (int64, error)
 	Validate(msg models.Message) (models.Message, error)
+	History(ctx context.Context, userID int64, msg models.Message, send func(models.Message) error) error
+	SnapshotAt(ctx context.Context, userID int64, msg models.Message, send func(models.Message) error) error
+}
+
+// Heartbeat configures keepalive of websocket connections.
+// Server pings the client every PingPeriod, connection is closed if nothing (pong included)
+// is received during PongWait or a message is not written during WriteWait.
+// QueueSize limits the number of messages waiting to be written to the connection,
+// the client which does not keep up with the updates is disconnected.
+// MaxMessageSize limits the size of a message read from the client, the connection is closed on a larger message.
+type Heartbeat struct {
+	PingPeriod     time.Duration
+	PongWait       time.Duration
+	WriteWait      time.Duration
+	QueueSize      int
+	MaxMessageSize int64
 }
 
 // Handler handle request for establish connection from user.
@@ -27,14 +48,25 @@ type Handler struct {
 	service    IService
 	wsUpgrader *websocket.Upgrader
 	conns      *clients.UserWSConnMap
+	heartbeat  Heartbeat
+
+	// active connections are tracked for graceful shutdown, new connections are refused after shutdown started
+	mu       *sync.Mutex
+	closing  bool
+	shutdown chan struct{}
+	active   *sync.WaitGroup
 }
 
-func NewHandler(log *slog.Logger, s IService, conns *clients.UserWSConnMap) *Handler {
+func NewHandler(log *slog.Logger, s IService, conns *clients.UserWSConnMap, heartbeat Heartbeat) *Handler {
 	return &Handler{
 		log:        log,
 		service:    s,
 		wsUpgrader: &websocket.Upgrader{},
 		conns:      conns,
+		heartbeat:  heartbeat,
+		mu:         &sync.Mutex{},
+		shutdown:   make(chan struct{}),
+		active:     &sync.WaitGroup{},
 	}
 }
 
@@ -46,6 +78,12 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
+	if !h.acquire() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.active.Done()
+
 	conn, err := h.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Error(
@@ -63,25 +101,64 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 			slog.String("token", token),
 			sl.Err(err),
 		)
-		errMsg, _ := json.Marshal(models.Message{Type: "error", Value: []byte("invalid token")})
-		err = conn.WriteMessage(websocket.TextMessage, errMsg)
+		errMsg, _ := json.Marshal(models.Message{Type: "error", Code: models.CodeInvalidToken, Value: []byte("invalid token")})
+		_ = h.write(conn, errMsg)
 		_ = conn.Close()
 		return
 	}
 
-	h.conns.Put(userID, conn)
-	snapshot, err := h.service.Snapshot(ctx, userID)
+	// client sends the last revision it applied, changes after it are sent (or full snapshot)
+	revision, _ := strconv.ParseInt(r.Header.Get("revision"), 10, 64)
+
+	// all messages to the connection are written by the session, updates of other devices wait until the sync is sent
+	session := clients.NewSession(conn, h.heartbeat.QueueSize, h.heartbeat.WriteWait, h.heartbeat.PingPeriod)
+	session.Hold()
+	go session.Run()
+	h.conns.Put(userID, session)
+	defer h.disconnect(userID, session)
+
+	if h.heartbeat.MaxMessageSize > 0 {
+		conn.SetReadLimit(h.heartbeat.MaxMessageSize)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(h.heartbeat.PongWait))
+	conn.SetPongHandler(func(string) error {
+		if h.shuttingDown() {
+			// reading is stopped by shutdown
+			return nil
+		}
+		return conn.SetReadDeadline(time.Now().Add(h.heartbeat.PongWait))
+	})
+	if h.shuttingDown() {
+		// shutdown started before the session was registered
+		session.StopReading()
+	}
+
+	// changes (or snapshot chunks) are written as they are read, the session queue bounds the memory
+	var sendErr error
+	err = h.service.Sync(ctx, userID, revision, func(change models.Message) error {
+		msg, _ := json.Marshal(change)
+		sendErr = session.SendWait(ctx, msg)
+		return sendErr
+	})
+	if sendErr != nil {
+		log.Error(
+			"error sending message to user",
+			slog.Int64("user_id", userID),
+			slog.String("address", conn.RemoteAddr().String()),
+			sl.Err(sendErr),
+		)
+		return
+	}
 	if err != nil {
 		log.Error(
 			"failed collect init snapshot data for user",
 			slog.Int64("user_id", userID),
 			sl.Err(err),
 		)
-		errMsg, _ := json.Marshal(models.Message{Type: "error", Value: []byte("failed collect init snapshot data")})
-		err = conn.WriteMessage(websocket.TextMessage, errMsg)
+		errMsg, _ := json.Marshal(models.Message{Type: "error", Code: models.CodeInternal, Value: []byte("failed collect init snapshot data")})
+		err = session.SendWait(ctx, errMsg)
 
 		if err != nil {
-			// TODO handle interrupted connection with client
 			log.Error(
 				"error sending message to user",
 				slog.Int64("user_id", userID),
@@ -90,35 +167,37 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 			)
 		}
 	}
-	msg, _ := json.Marshal(snapshot)
-	err = conn.WriteMessage(websocket.TextMessage, msg)
-	if err != nil {
-		// TODO handle interrupted connection with client
+	if err = session.Release(ctx); err != nil {
 		log.Error(
-			"error sending message to user",
+			"error sending updates to user",
 			slog.Int64("user_id", userID),
 			slog.String("address", conn.RemoteAddr().String()),
 			sl.Err(err),
 		)
+		return
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Info("client logged out")
-			// TODO clear user_id - conn map
 			return
 		default:
 			mt, data, err := conn.ReadMessage()
+			if err != nil && h.shuttingDown() {
+				// the message being handled is finished, client is asked to reconnect later
+				h.closeSession(session)
+				return
+			}
 			if err != nil {
-				// TODO handle interrupted connection with client
-				log.Error(
-					"error listening client connection",
+				// connection is closed by the client or the client did not answer ping in time
+				log.Info(
+					"client connection closed",
 					slog.Int64("user_id", userID),
 					slog.String("address", conn.RemoteAddr().String()),
 					sl.Err(err),
 				)
-				continue
+				return
 			}
 			if mt != websocket.TextMessage {
 				log.Info(
@@ -147,52 +226,222 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) {
 					slog.String("token", mesg.Token),
 					sl.Err(err),
 				)
-				errMsg, _ := json.Marshal(models.Message{Type: "error", Value: []byte("invalid token")})
-				_ = conn.WriteMessage(websocket.TextMessage, errMsg)
-				// TODO clear user_id - conn map
+				errMsg, _ := json.Marshal(models.Message{ID: mesg.ID, Type: "error", Code: models.CodeInvalidToken, Value: []byte("invalid token")})
+				_ = session.SendWait(ctx, errMsg)
 				return
 			}
 
+			if mesg.Type == models.History || mesg.Type == models.SnapshotAt {
+				h.sendResponse(ctx, session, userID, mesg)
+				continue
+			}
+
 			updateMsg, err := h.service.Validate(mesg)
 			if err != nil {
 				log.Error(
 					"invalid message",
 					slog.Int64("user_id", userID),
-					slog.String("message", string(mesg.Value)),
+					slog.String("request id", mesg.ID),
 					sl.Err(err),
 				)
+				h.reply(ctx, session, userID, models.Message{ID: mesg.ID, Type: models.Error, Code: models.CodeInvalidMessage, Value: []byte(err.Error())})
+				continue
+			}
+			updateMsg.Revision, err = h.service.Save(ctx, userID, mesg)
+			if errors.Is(err, service.ErrDuplicate) {
+				// client replayed the change it sent before, other devices have already received it
+				h.reply(ctx, session, userID, models.Message{ID: mesg.ID, Type: models.Ack, Revision: updateMsg.Revision})
 				continue
 			}
-			err = h.service.Save(ctx, userID, mesg)
+			if errors.Is(err, service.ErrConflict) {
+				// both versions are kept, user devices are asked to resolve the conflict
+				updateMsg = models.Message{
+					Type:         models.Conflict,
+					Value:        mesg.Value,
+					Revision:     updateMsg.Revision,
+					BaseRevision: mesg.BaseRevision,
+					Deleted:      mesg.Type == models.Delete,
+				}
+				err = nil
+			}
 			if err != nil {
 				log.Error(
 					"error saving message into database",
 					slog.Int64("user_id", userID),
-					slog.String("message", string(mesg.Value)),
+					slog.String("request id", mesg.ID),
 					sl.Err(err),
 				)
+				h.reply(ctx, session, userID, models.Message{ID: mesg.ID, Type: models.Error, Code: models.CodeInternal, Value: []byte("failed save message")})
 				continue
 			}
 
-			go h.sendUpdates(userID, updateMsg)
+			// conflicting change is saved too, the sender learns about the conflict from the broadcast
+			h.reply(ctx, session, userID, models.Message{ID: mesg.ID, Type: models.Ack, Revision: updateMsg.Revision})
+			h.sendUpdates(userID, updateMsg)
 		}
 	}
 
 }
 
+// sendUpdates queues the message to every user session without waiting (the session still syncing keeps it
+// until the sync is sent), the session which does not keep up with the updates is closed and the client reconnects later.
 func (h *Handler) sendUpdates(userID int64, msg models.Message) {
 	update, _ := json.Marshal(msg)
-	for _, c := range h.conns.UserConns(userID) {
-		err := c.WriteMessage(websocket.TextMessage, update)
-		if err != nil {
-			// TODO ? clear user_id - conn map
+	for _, s := range h.conns.UserSessions(userID) {
+		if !s.Send(update) {
 			h.log.Error(
-				"error listening client connection",
+				"session is closed or too slow, client is disconnected",
 				slog.Int64("user_id", userID),
-				slog.String("address", c.RemoteAddr().String()),
-				sl.Err(err),
+				slog.String("address", s.Info().Address),
 			)
-			continue
+			h.disconnect(userID, s)
 		}
 	}
 }
+
+// sendResponse answers the request (history, snapshot_at) only to the connection which sent it.
+// The response is streamed in chunks as the service makes them, the session queue bounds the memory.
+// Error message is sent if the response cannot be made, the client drops the chunks received before.
+func (h *Handler) sendResponse(ctx context.Context, session *clients.Session, userID int64, msg models.Message) {
+	if msg.ID == "" {
+		return
+	}
+
+	var sendErr error
+	send := func(resp models.Message) error {
+		data, _ := json.Marshal(resp)
+		sendErr = session.SendWait(ctx, data)
+		return sendErr
+	}
+	var err error
+	switch msg.Type {
+	case models.History:
+		err = h.service.History(ctx, userID, msg, send)
+	case models.SnapshotAt:
+		err = h.service.SnapshotAt(ctx, userID, msg, send)
+	}
+	if sendErr != nil {
+		h.log.Error(
+			"error sending message to user",
+			slog.Int64("user_id", userID),
+			slog.String("address", session.Info().Address),
+			sl.Err(sendErr),
+		)
+		return
+	}
+	if err != nil {
+		h.log.Error(
+			"failed answer the request",
+			slog.Int64("user_id", userID),
+			slog.String("request type", msg.Type.String()),
+			sl.Err(err),
+		)
+		h.reply(ctx, session, userID, models.Message{ID: msg.ID, Type: models.Error, Code: models.CodeInternal, Value: []byte("failed answer the request " + msg.Type.String())})
+	}
+}
+
+// reply sends message only to the connection which sent the request.
+// Messages without request ID (sent by old clients) are not answered.
+func (h *Handler) reply(ctx context.Context, session *clients.Session, userID int64, msg models.Message) {
+	if msg.ID == "" {
+		return
+	}
+
+	data, _ := json.Marshal(msg)
+	if err := session.SendWait(ctx, data); err != nil {
+		h.log.Error(
+			"error sending message to user",
+			slog.Int64("user_id", userID),
+			slog.String("address", session.Info().Address),
+			sl.Err(err),
+		)
+	}
+}
+
+// write sends message to the connection before the session is started, the write fails if it is not done in time.
+func (h *Handler) write(conn *websocket.Conn, data []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(h.heartbeat.WriteWait)); err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// disconnect removes the session from the user sessions and closes it.
+func (h *Handler) disconnect(userID int64, session *clients.Session) {
+	if h.conns.Remove(userID, session) {
+		h.log.Info(
+			"client disconnected",
+			slog.Int64("user_id", userID),
+			slog.String("address", session.Info().Address),
+			slog.Int("sessions", h.conns.Count(userID)),
+		)
+	}
+	session.Close()
+}
+
+// Shutdown refuses new connections and asks clients to close connections.
+// Messages being handled are finished (saved and answered), then close frame is sent.
+// Connections which are not closed before the context is done are closed immediately and the context error is returned.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closing {
+		h.closing = true
+		close(h.shutdown)
+	}
+	h.mu.Unlock()
+
+	for _, s := range h.conns.All() {
+		s.StopReading()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		h.active.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		for _, s := range h.conns.All() {
+			s.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// acquire registers new connection, false is returned if shutdown was started.
+func (h *Handler) acquire() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closing {
+		return false
+	}
+	h.active.Add(1)
+	return true
+}
+
+func (h *Handler) shuttingDown() bool {
+	select {
+	case <-h.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSession sends close frame after the queued messages and waits until it is written.
+func (h *Handler) closeSession(session *clients.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.heartbeat.WriteWait)
+	defer cancel()
+
+	if err := session.SendClose(ctx, websocket.CloseGoingAway, "server is shutting down"); err != nil {
+		return
+	}
+	select {
+	case <-session.Stopped():
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/clients"
+	"github.com/dkrasnykh/gophkeeper/pkg/jwt"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// fakeService saves every message with the next revision and sends sync messages on connect.
+// Requests (history, snapshot_at) are answered with response messages.
+// If saving is set, Save signals it and waits for release.
+type fakeService struct {
+	revision atomic.Int64
+	saving   chan struct{}
+	release  chan struct{}
+	sync     []models.Message
+	response []models.Message
+}
+
+func (s *fakeService) Sync(ctx context.Context, userID int64, revision int64, send func(models.Message) error) error {
+	for _, msg := range s.sync {
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeService) Save(ctx context.Context, userID int64, msg models.Message) (int64, error) {
+	if s.saving != nil {
+		s.saving <- struct{}{}
+		<-s.release
+	}
+	return s.revision.Add(1), nil
+}
+
+func (s *fakeService) Validate(msg models.Message) (models.Message, error) {
+	return models.Message{Type: models.Update, Value: msg.Value}, nil
+}
+
+func (s *fakeService) History(ctx context.Context, userID int64, msg models.Message, send func(models.Message) error) error {
+	return s.respond(msg.ID, send)
+}
+
+func (s *fakeService) SnapshotAt(ctx context.Context, userID int64, msg models.Message, send func(models.Message) error) error {
+	return s.respond(msg.ID, send)
+}
+
+func (s *fakeService) respond(id string, send func(models.Message) error) error {
+	for _, msg := range s.response {
+		msg.ID = id
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newToken(t *testing.T, userID int64) string {
+	user := models.User{ID: userID, Email: "name@example.com"}
+	app := models.App{ID: 1, Name: "gophkeeper", Secret: "test-secret"}
+	token, err := jwt.NewToken(user, app, time.Hour)
+	require.NoError(t, err)
+	return token
+}
+
+func newTestServer(t *testing.T, s IService, queueSize int) (*httptest.Server, *Handler) {
+	return newHeartbeatServer(t, s, Heartbeat{PingPeriod: time.Minute, PongWait: time.Minute, WriteWait: time.Second, QueueSize: queueSize,
+		MaxMessageSize: 1 << 16})
+}
+
+func newHeartbeatServer(t *testing.T, s IService, heartbeat Heartbeat) (*httptest.Server, *Handler) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	conns := clients.NewUserWSConnMap()
+	h := NewHandler(log, s, conns, heartbeat)
+
+	srv := httptest.NewServer(http.HandlerFunc(h.Handle))
+	t.Cleanup(srv.Close)
+	return srv, h
+}
+
+func dial(t *testing.T, srv *httptest.Server, token string) *websocket.Conn {
+	conn, resp, err := tryDial(srv, token)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func tryDial(srv *httptest.Server, token string) (*websocket.Conn, *http.Response, error) {
+	headers := http.Header{}
+	headers.Set("token", token)
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), headers)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) models.Message {
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var msg models.Message
+	require.NoError(t, json.Unmarshal(data, &msg))
+	return msg
+}
+
+func waitSessions(t *testing.T, conns *clients.UserWSConnMap, userID int64, count int) {
+	require.Eventually(t, func() bool {
+		return conns.Count(userID) == count
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// TestManyDevices checks that concurrent saves from many devices of the same user
+// are delivered to every device (run with -race).
+func TestManyDevices(t *testing.T) {
+	const (
+		devices   = 20
+		perDevice = 25
+	)
+	userID := int64(1)
+	token := newToken(t, userID)
+	srv, h := newTestServer(t, &fakeService{}, devices*perDevice*2)
+	conns := h.conns
+
+	clientConns := make([]*websocket.Conn, 0, devices)
+	for i := 0; i < devices; i++ {
+		clientConns = append(clientConns, dial(t, srv, token))
+	}
+	waitSessions(t, conns, userID, devices)
+
+	wg := &sync.WaitGroup{}
+	for d, conn := range clientConns {
+		wg.Add(2)
+		go func(d int, conn *websocket.Conn) {
+			defer wg.Done()
+			for i := 0; i < perDevice; i++ {
+				msg := models.Message{
+					ID:    fmt.Sprintf("%d-%d", d, i),
+					Token: token,
+					Type:  models.New,
+					Value: []byte(fmt.Sprintf(`{"type":"text","key":"key-%d-%d"}`, d, i)),
+				}
+				data, _ := json.Marshal(msg)
+				if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					t.Errorf("device %d: write: %v", d, err)
+					return
+				}
+			}
+		}(d, conn)
+
+		go func(d int, conn *websocket.Conn) {
+			defer wg.Done()
+			_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+			updates, acks := 0, 0
+			for updates < devices*perDevice || acks < perDevice {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					t.Errorf("device %d: read after %d updates and %d acks: %v", d, updates, acks, err)
+					return
+				}
+				var msg models.Message
+				if err = json.Unmarshal(data, &msg); err != nil {
+					t.Errorf("device %d: unexpected message: %v", d, err)
+					return
+				}
+				switch msg.Type {
+				case models.Update:
+					updates++
+				case models.Ack:
+					acks++
+				}
+			}
+		}(d, conn)
+	}
+	wg.Wait()
+
+	require.Equal(t, devices, conns.Count(userID))
+}
+
+func TestDisconnectRemovesSession(t *testing.T) {
+	userID := int64(1)
+	token := newToken(t, userID)
+	srv, h := newTestServer(t, &fakeService{}, 10)
+	conns := h.conns
+
+	first := dial(t, srv, token)
+	_ = dial(t, srv, token)
+	waitSessions(t, conns, userID, 2)
+
+	require.NoError(t, first.Close())
+	waitSessions(t, conns, userID, 1)
+}
+
+func TestSyncSnapshotChunks(t *testing.T) {
+	userID := int64(1)
+	token := newToken(t, userID)
+	// more snapshot chunks than the session queue holds
+	s := &fakeService{sync: []models.Message{{Type: models.SnapshotBegin}}}
+	for i := 0; i < 20; i++ {
+		s.sync = append(s.sync, models.Message{Type: models.SnapshotChunk, Value: []byte(fmt.Sprintf(`[{"revision":%d}]`, i+1))})
+	}
+	s.sync = append(s.sync, models.Message{Type: models.SnapshotEnd, Revision: 20})
+	srv, _ := newTestServer(t, s, 2)
+
+	conn := dial(t, srv, token)
+	for _, expected := range s.sync {
+		msg := readMessage(t, conn)
+		require.Equal(t, expected.Type, msg.Type)
+		require.Equal(t, expected.Value, msg.Value)
+		require.Equal(t, expected.Revision, msg.Revision)
+	}
+}
+
+func TestSaveWhileSnapshotStreams(t *testing.T) {
+	userID := int64(1)
+	token := newToken(t, userID)
+	// the snapshot is larger than the connection buffers, it is streamed while the client reads it
+	s := &fakeService{sync: []models.Message{{Type: models.SnapshotBegin}}}
+	chunk := []byte(`["` + strings.Repeat("a", 1<<16) + `"]`)
+	for i := 0; i < 200; i++ {
+		s.sync = append(s.sync, models.Message{Type: models.SnapshotChunk, Value: chunk})
+	}
+	s.sync = append(s.sync, models.Message{Type: models.SnapshotEnd, Revision: 200})
+	// the writer waits for the client reading the snapshot later
+	srv, h := newHeartbeatServer(t, s, Heartbeat{PingPeriod: time.Minute, PongWait: time.Minute, WriteWait: time.Minute, QueueSize: 2,
+		MaxMessageSize: 1 << 16})
+
+	syncing := dial(t, srv, token)
+	waitSessions(t, h.conns, userID, 1)
+
+	// the second device saves while the first one has not read the snapshot
+	saving := dial(t, srv, token)
+	for range s.sync {
+		readMessage(t, saving)
+	}
+	msg, _ := json.Marshal(models.Message{ID: "request1", Token: token, Type: models.New, Value: []byte(`{"type":"text","key":"key1"}`)})
+	require.NoError(t, saving.WriteMessage(websocket.TextMessage, msg))
+	require.Equal(t, models.Ack, readMessage(t, saving).Type)
+	require.Equal(t, models.Update, readMessage(t, saving).Type)
+	require.Equal(t, 2, h.conns.Count(userID))
+
+	// the update is delivered after the snapshot, the syncing device is not disconnected
+	for _, expected := range s.sync {
+		require.Equal(t, expected.Type, readMessage(t, syncing).Type)
+	}
+	update := readMessage(t, syncing)
+	require.Equal(t, models.Update, update.Type)
+	require.Equal(t, int64(1), update.Revision)
+}
+
+func TestResponseChunks(t *testing.T) {
+	userID := int64(1)
+	token := newToken(t, userID)
+	// more response chunks than the session queue holds
+	s := &fakeService{response: []models.Message{{Type: models.SnapshotBegin}}}
+	for i := 0; i < 20; i++ {
+		s.response = append(s.response, models.Message{Type: models.SnapshotChunk, Value: []byte(fmt.Sprintf(`[{"revision":%d}]`, i+1))})
+	}
+	s.response = append(s.response, models.Message{Type: models.SnapshotEnd})
+	srv, _ := newTestServer(t, s, 2)
+
+	conn := dial(t, srv, token)
+	request, _ := json.Marshal(models.Message{ID: "request1", Type: models.History, Token: token, Value: []byte(`{"type":"t1","key":"k1"}`)})
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, request))
+	for _, expected := range s.response {
+		msg := readMessage(t, conn)
+		require.Equal(t, "request1", msg.ID)
+		require.Equal(t, expected.Type, msg.Type)
+		require.Equal(t, expected.Value, msg.Value)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	userID := int64(1)
+	token := newToken(t, userID)
+	srv, h := newTestServer(t, &fakeService{}, 10)
+
+	conn := dial(t, srv, token)
+	waitSessions(t, h.conns, userID, 1)
+
+	msg := models.Message{ID: "request1", Token: token, Type: models.New, Value: make([]byte, 1<<16)}
+	data, _ := json.Marshal(msg)
+	// the server may close the connection before the message is written
+	_ = conn.WriteMessage(websocket.TextMessage, data)
+
+	_, _, err := conn.ReadMessage()
+	require.Error(t, err)
+	waitSessions(t, h.conns, userID, 0)
+}
+
+func TestShutdown(t *testing.T) {
+	userID := int64(1)
+	token := newToken(t, userID)
+	s := &fakeService{saving: make(chan struct{}), release: make(chan struct{})}
+	srv, h := newTestServer(t, s, 10)
+
+	conn := dial(t, srv, token)
+	waitSessions(t, h.conns, userID, 1)
+
+	msg := models.Message{ID: "request1", Token: token, Type: models.New, Value: []byte(`{"type":"text","key":"key1"}`)}
+	data, _ := json.Marshal(msg)
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, data))
+	<-s.saving
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- h.Shutdown(ctx)
+	}()
+
+	// new connections are refused while the message is being saved
+	require.Eventually(t, func() bool {
+		_, resp, err := tryDial(srv, token)
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		return err != nil && resp != nil && resp.StatusCode == http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(s.release)
+
+	// the message being handled is saved and answered before close frame
+	ack := readMessage(t, conn)
+	require.Equal(t, models.Ack, ack.Type)
+	require.Equal(t, "request1", ack.ID)
+	require.Equal(t, models.Update, readMessage(t, conn).Type)
+
+	_, _, err := conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+
+	require.NoError(t, <-stopped)
+	require.Equal(t, 0, h.conns.Count(userID))
+}
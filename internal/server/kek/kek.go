@@ -0,0 +1,94 @@
+// Package kek provides key-encryption keys of the keeper server. Keys never leave the provider:
+// data keys of users are wrapped (encrypted) and unwrapped by it.
+// File provider reads the keyring from a local file, Client asks the KMS process (Server) which holds the keyring.
+package kek
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/ilyakaznacheev/cleanenv"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+)
+
+// KeyInfo describes the keyring: Current key encrypts, any key of IDs decrypts,
+// Legacy key decrypts messages written without key ID.
+type KeyInfo struct {
+	Current string   `json:"current"`
+	Legacy  string   `json:"legacy,omitempty"`
+	IDs     []string `json:"ids"`
+}
+
+// Provider encrypts and decrypts with the keys it holds.
+type Provider interface {
+	Keys(ctx context.Context) (KeyInfo, error)
+	Encrypt(ctx context.Context, text []byte, ad []byte) ([]byte, string, error)
+	Decrypt(ctx context.Context, msg []byte, ad []byte) ([]byte, error)
+}
+
+// ErrPublishedKey is returned if the current key was published, new data keys must not be wrapped by it.
+var ErrPublishedKey = errors.New("key was published in the repository")
+
+// published are SHA-256 (hex) of keys once committed to the repository (development keys), they are compromised.
+// Such key may stay in the keyring to decrypt data keys wrapped by it until "server reencrypt" rewraps them,
+// but it is never the current key.
+var published = map[string]bool{
+	"d1d11e207ef3a0975790fee0b5525cfd3611ac66cafd334a91c23af7132a5222": true,
+}
+
+// FileKeys is the keyring file layout.
+type FileKeys struct {
+	Current string            `yaml:"current" env:"KEK_CURRENT"`
+	Legacy  string            `yaml:"legacy" env:"KEK_LEGACY"`
+	Keys    map[string]string `yaml:"keys" env:"KEK_KEYS"`
+}
+
+// File is the provider with the keyring read from yaml file.
+type File struct {
+	keys *encrypt.Keyring
+}
+
+// NewFile reads the keyring file, see FileKeys. ErrPublishedKey is returned if the current key was published.
+func NewFile(path string) (*File, error) {
+	const op = "kek.NewFile"
+
+	var keys FileKeys
+	if err := cleanenv.ReadConfig(path, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sum := sha256.Sum256([]byte(keys.Keys[keys.Current]))
+	if published[hex.EncodeToString(sum[:])] {
+		return nil, fmt.Errorf("%s: current key %q: %w, add a new random key and make it current", op, keys.Current, ErrPublishedKey)
+	}
+	keyring, err := encrypt.NewKeyring(keys.Keys, keys.Current, keys.Legacy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return NewKeyring(keyring), nil
+}
+
+// NewKeyring returns the provider with the keyring.
+func NewKeyring(keys *encrypt.Keyring) *File {
+	return &File{keys: keys}
+}
+
+func (f *File) Keys(_ context.Context) (KeyInfo, error) {
+	return KeyInfo{Current: f.keys.Current(), Legacy: f.keys.Legacy(), IDs: f.keys.IDs()}, nil
+}
+
+// Encrypt encrypts the text with the current key, ID of the key is returned with the message.
+func (f *File) Encrypt(_ context.Context, text []byte, ad []byte) ([]byte, string, error) {
+	msg, err := f.keys.Encrypt(text, ad)
+	if err != nil {
+		return nil, "", err
+	}
+	return msg, f.keys.Current(), nil
+}
+
+func (f *File) Decrypt(_ context.Context, msg []byte, ad []byte) ([]byte, error) {
+	return f.keys.Decrypt(msg, ad)
+}
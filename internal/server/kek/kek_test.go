@@ -0,0 +1,103 @@
+package kek
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+)
+
+func newFile(t *testing.T) *File {
+	path := filepath.Join(t.TempDir(), "kek.yaml")
+	keys := "current: \"2\"\nlegacy: \"1\"\nkeys:\n  \"1\": \"first secret\"\n  \"2\": \"second secret\"\n"
+	require.NoError(t, os.WriteFile(path, []byte(keys), 0o600))
+
+	provider, err := NewFile(path)
+	require.NoError(t, err)
+	return provider
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	provider := newFile(t)
+
+	info, err := provider.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, KeyInfo{Current: "2", Legacy: "1", IDs: []string{"1", "2"}}, info)
+
+	msg, keyID, err := provider.Encrypt(ctx, []byte("data key"), []byte("user 1"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", keyID)
+	text, err := provider.Decrypt(ctx, msg, []byte("user 1"))
+	require.NoError(t, err)
+	assert.Equal(t, "data key", string(text))
+
+	// message written before key IDs is decrypted with the legacy key
+	legacy, err := encrypt.Encrypt([]byte("legacy"), "first secret", nil)
+	require.NoError(t, err)
+	text, err = provider.Decrypt(ctx, legacy, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", string(text))
+}
+
+func TestNewFileFailCases(t *testing.T) {
+	_, err := NewFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "kek.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("current: \"2\"\nkeys:\n  \"1\": \"first secret\"\n"), 0o600))
+	_, err = NewFile(path)
+	assert.ErrorIs(t, err, encrypt.ErrKeyring)
+
+	// published development key only decrypts until data keys are rewrapped by the new key
+	published := "keys:\n  \"1\": \"s5as4d5a#$%#%s6ad545##$%#4353KSFjH\"\n  \"2\": \"second secret\"\n"
+	require.NoError(t, os.WriteFile(path, []byte("current: \"1\"\n"+published), 0o600))
+	_, err = NewFile(path)
+	assert.ErrorIs(t, err, ErrPublishedKey)
+	require.NoError(t, os.WriteFile(path, []byte("current: \"2\"\nlegacy: \"1\"\n"+published), 0o600))
+	_, err = NewFile(path)
+	assert.NoError(t, err)
+}
+
+func TestKMS(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	srv := httptest.NewServer(NewServer(log, newFile(t), "token").Handler())
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "token", time.Second)
+
+	info, err := client.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", info.Current)
+
+	msg, keyID, err := client.Encrypt(ctx, []byte("data key"), []byte("user 1"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", keyID)
+	text, err := client.Decrypt(ctx, msg, []byte("user 1"))
+	require.NoError(t, err)
+	assert.Equal(t, "data key", string(text))
+
+	_, err = client.Decrypt(ctx, msg, []byte("user 2"))
+	assert.ErrorIs(t, err, encrypt.ErrDecrypt)
+	_, err = client.Decrypt(ctx, nil, nil)
+	assert.ErrorIs(t, err, encrypt.ErrMalformed)
+
+	retired, err := encrypt.NewKeyring(map[string]string{"3": "third secret"}, "3", "")
+	require.NoError(t, err)
+	msg, err = retired.Encrypt([]byte("data key"), nil)
+	require.NoError(t, err)
+	_, err = client.Decrypt(ctx, msg, nil)
+	assert.ErrorIs(t, err, encrypt.ErrUnknownKey)
+
+	_, err = NewClient(srv.URL, "wrong token", time.Second).Keys(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
@@ -0,0 +1,225 @@
+package kek
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+const maxRequestSize = 1 << 20
+
+var ErrUnauthorized = errors.New("kms request is not authorized")
+
+type encryptRequest struct {
+	Text []byte `json:"text"`
+	AD   []byte `json:"ad,omitempty"`
+}
+
+type encryptResponse struct {
+	Message []byte `json:"message"`
+	KeyID   string `json:"key_id"`
+}
+
+type decryptRequest struct {
+	Message []byte `json:"message"`
+	AD      []byte `json:"ad,omitempty"`
+}
+
+type decryptResponse struct {
+	Text []byte `json:"text"`
+}
+
+// Server is the local KMS stand-in: it serves the provider keys to keeper servers over HTTP
+// (JSON requests: GET /keys, POST /encrypt, POST /decrypt). Requests must carry the bearer token.
+// Decryption errors are returned as status codes, Client converts them back into encrypt errors.
+type Server struct {
+	log      *slog.Logger
+	provider Provider
+	token    string
+}
+
+func NewServer(log *slog.Logger, provider Provider, token string) *Server {
+	return &Server{
+		log:      log,
+		provider: provider,
+		token:    token,
+	}
+}
+
+// Handler returns the handler of the KMS requests.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", s.authorized(s.keys))
+	mux.HandleFunc("/encrypt", s.authorized(s.encrypt))
+	mux.HandleFunc("/decrypt", s.authorized(s.decrypt))
+	return mux
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := []byte("Bearer " + s.token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), token) != 1 {
+			http.Error(w, ErrUnauthorized.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) keys(w http.ResponseWriter, r *http.Request) {
+	info, err := s.provider.Keys(r.Context())
+	if err != nil {
+		s.fail(w, "kek.Server.keys", err)
+		return
+	}
+	s.reply(w, info)
+}
+
+func (s *Server) encrypt(w http.ResponseWriter, r *http.Request) {
+	var req encryptRequest
+	if !s.read(w, r, &req) {
+		return
+	}
+	msg, keyID, err := s.provider.Encrypt(r.Context(), req.Text, req.AD)
+	if err != nil {
+		s.fail(w, "kek.Server.encrypt", err)
+		return
+	}
+	s.reply(w, encryptResponse{Message: msg, KeyID: keyID})
+}
+
+func (s *Server) decrypt(w http.ResponseWriter, r *http.Request) {
+	var req decryptRequest
+	if !s.read(w, r, &req) {
+		return
+	}
+	text, err := s.provider.Decrypt(r.Context(), req.Message, req.AD)
+	if err != nil {
+		s.fail(w, "kek.Server.decrypt", err)
+		return
+	}
+	s.reply(w, decryptResponse{Text: text})
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request, req any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(req); err != nil {
+		http.Error(w, encrypt.ErrMalformed.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (s *Server) reply(w http.ResponseWriter, res any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) fail(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, encrypt.ErrUnknownKey):
+		http.Error(w, encrypt.ErrUnknownKey.Error(), http.StatusNotFound)
+	case errors.Is(err, encrypt.ErrMalformed):
+		http.Error(w, encrypt.ErrMalformed.Error(), http.StatusBadRequest)
+	case errors.Is(err, encrypt.ErrDecrypt):
+		http.Error(w, encrypt.ErrDecrypt.Error(), http.StatusUnprocessableEntity)
+	default:
+		s.log.Error("kms request error", slog.String("op", op), sl.Err(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// Client is the provider which asks the KMS process.
+type Client struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// NewClient returns the client of the KMS at the address (http://host:port).
+func NewClient(address string, token string, timeout time.Duration) *Client {
+	return &Client{
+		address: address,
+		token:   token,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *Client) Keys(ctx context.Context) (KeyInfo, error) {
+	var res KeyInfo
+	err := c.call(ctx, http.MethodGet, "/keys", nil, &res)
+	return res, err
+}
+
+func (c *Client) Encrypt(ctx context.Context, text []byte, ad []byte) ([]byte, string, error) {
+	var res encryptResponse
+	if err := c.call(ctx, http.MethodPost, "/encrypt", encryptRequest{Text: text, AD: ad}, &res); err != nil {
+		return nil, "", err
+	}
+	return res.Message, res.KeyID, nil
+}
+
+func (c *Client) Decrypt(ctx context.Context, msg []byte, ad []byte) ([]byte, error) {
+	var res decryptResponse
+	if err := c.call(ctx, http.MethodPost, "/decrypt", decryptRequest{Message: msg, AD: ad}, &res); err != nil {
+		return nil, err
+	}
+	return res.Text, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, path string, req any, res any) error {
+	const op = "kek.Client.call"
+
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.address+path, body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer httpRes.Body.Close()
+
+	switch httpRes.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%s: %w", op, ErrUnauthorized)
+	case http.StatusNotFound:
+		return fmt.Errorf("%s: %w", op, encrypt.ErrUnknownKey)
+	case http.StatusBadRequest:
+		return fmt.Errorf("%s: %w", op, encrypt.ErrMalformed)
+	case http.StatusUnprocessableEntity:
+		return fmt.Errorf("%s: %w", op, encrypt.ErrDecrypt)
+	default:
+		return fmt.Errorf("%s: kms response status %s", op, httpRes.Status)
+	}
+
+	if err = json.NewDecoder(io.LimitReader(httpRes.Body, maxRequestSize)).Decode(res); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/blob"
+	"github.com/dkrasnykh/gophkeeper/internal/server/config"
+	"github.com/dkrasnykh/gophkeeper/internal/server/kek"
+	"github.com/dkrasnykh/gophkeeper/internal/server/service"
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+// newKeyProvider returns the provider of key-encryption keys configured for the server.
+func newKeyProvider(cfg *config.Config) (kek.Provider, error) {
+	switch cfg.Keys.Provider {
+	case "file":
+		return kek.NewFile(cfg.Keys.File)
+	case "kms":
+		return kek.NewClient(cfg.Keys.KMSAddress, cfg.Keys.KMSToken, cfg.QueryTimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", cfg.Keys.Provider)
+	}
+}
+
+// newKeeper connects to the database and creates the keeper service with the configured key provider and blob store.
+// Database connections pool is closed by the caller.
+func newKeeper(log *slog.Logger, cfg *config.Config) (*pgxpool.Pool, *service.Service, kek.Provider, error) {
+	keys, err := newKeyProvider(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	db, err := storage.New(cfg.DatabaseURL, cfg.QueryTimeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	blobs, err := blob.New(cfg.Blobs.Backend, cfg.Blobs.Path)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	storageKeeper := storage.NewKeeperPostgres(db, cfg.QueryTimeout)
+	keeper := service.New(log, storageKeeper, blobs, keys, cfg.Keys.CacheTTL, cfg.Keys.Index, cfg.Keys.Legacy, cfg.MaxChanges,
+		cfg.SnapshotChunkSize, cfg.RequireBound)
+	return db, keeper, keys, nil
+}
+
+// Reencrypt wraps data keys of users with the current key-encryption key and encrypts items saved before data keys
+// with the data keys, see service.Rewrap and service.Reencrypt. It runs beside the working server,
+// the server does not need to be stopped.
+func Reencrypt(ctx context.Context, log *slog.Logger, cfg *config.Config, batch int) error {
+	const op = "server.Reencrypt"
+	log = log.With(
+		slog.String("op", op),
+	)
+
+	db, keeper, _, err := newKeeper(log, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer db.Close()
+
+	rewrapped, failedKeys, err := keeper.Rewrap(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	done, failed, err := keeper.Reencrypt(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if failedKeys > 0 || failed > 0 {
+		log.Error("some keys or items are not re-encrypted",
+			slog.Int64("rewrapped keys", rewrapped),
+			slog.Int64("failed keys", failedKeys),
+			slog.Int64("items", done),
+			slog.Int64("failed items", failed),
+		)
+		return fmt.Errorf("%s: %d keys and %d items are not re-encrypted", op, failedKeys, failed)
+	}
+	log.Info("all keys and items are re-encrypted", slog.Int64("rewrapped keys", rewrapped), slog.Int64("items", done))
+	return nil
+}
+
+// Reindex replaces identifiers of rows saved before blind indexes with blind indexes, see service.Reindex.
+// The server does not start while such rows are left, the interrupted run is continued by the next one.
+func Reindex(ctx context.Context, log *slog.Logger, cfg *config.Config, batch int) error {
+	const op = "server.Reindex"
+	log = log.With(
+		slog.String("op", op),
+	)
+
+	db, keeper, _, err := newKeeper(log, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer db.Close()
+
+	done, failed, err := keeper.Reindex(ctx, batch)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if failed > 0 {
+		log.Error("some items are not reindexed", slog.Int64("items", done), slog.Int64("failed items", failed))
+		return fmt.Errorf("%s: %d items are not reindexed", op, failed)
+	}
+	log.Info("all items are reindexed", slog.Int64("items", done))
+	return nil
+}
+
+// Keys writes the number of references (wrapped data keys and items saved before data keys) by key-encryption key ID:
+// keys without references can be retired (removed from the keyring), keys with references which are missing
+// in the keyring must be returned into it.
+func Keys(ctx context.Context, log *slog.Logger, cfg *config.Config, w io.Writer) error {
+	const op = "server.Keys"
+
+	db, keeper, keys, err := newKeeper(log, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer db.Close()
+
+	info, err := keys.Keys(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	usage, err := keeper.KeyUsage(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ids := slices.Clone(info.IDs)
+	for id := range usage {
+		if !slices.Contains(info.IDs, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		var status string
+		inRing := slices.Contains(info.IDs, id)
+		switch {
+		case id == info.Current:
+			status = "current"
+		case !inRing:
+			status = "missing in the keyring, items are not decrypted"
+		case usage[id] == 0:
+			status = "can be retired"
+		default:
+			status = "in use, run reencrypt"
+		}
+		if id == info.Legacy && inRing {
+			status += ", legacy"
+		}
+		if _, err = fmt.Fprintf(w, "key %q: %d references, %s\n", id, usage[id], status); err != nil {
+			log.Error("failed write key usage", slog.String("op", op), sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Shred deletes the data key and the items of the user, see service.Shred.
+// Running servers keep the unwrapped data key in cache for the configured time.
+func Shred(ctx context.Context, log *slog.Logger, cfg *config.Config, userID int64) error {
+	const op = "server.Shred"
+
+	db, keeper, _, err := newKeeper(log, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer db.Close()
+
+	if err = keeper.Shred(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// CollectGarbage deletes file chunks and blobs nothing references any more, see service.CollectGarbage.
+// Chunks and blobs saved during the configured grace period are kept, their files may be still uploaded.
+func CollectGarbage(ctx context.Context, log *slog.Logger, cfg *config.Config, batch int) error {
+	const op = "server.CollectGarbage"
+
+	db, keeper, _, err := newKeeper(log, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer db.Close()
+
+	if _, _, err = keeper.CollectGarbage(ctx, time.Now().Add(-cfg.Blobs.Grace), batch); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
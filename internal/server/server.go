@@ -1,37 +1,121 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/dkrasnykh/gophkeeper/internal/server/clients"
 	"github.com/dkrasnykh/gophkeeper/internal/server/config"
 	"github.com/dkrasnykh/gophkeeper/internal/server/handler"
-	"github.com/dkrasnykh/gophkeeper/internal/server/service"
-	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
 )
 
+// App with websocket server and database connections pool.
+// Provides start/stop methods.
 type App struct {
-	db *pgxpool.Pool
+	log             *slog.Logger
+	db              *pgxpool.Pool
+	srv             *http.Server
+	handler         *handler.Handler
+	certFile        string
+	keyFile         string
+	shutdownTimeout time.Duration
 }
 
-func Run(log *slog.Logger, cfg *config.Config) {
-	// TODO gracefull shutdown
-	db, err := storage.New(cfg.DatabaseURL, cfg.QueryTimeout)
+// New connects to the database and creates the application.
+// The application is not created if stored items are encrypted with keys missing in the keyring or rows saved before
+// blind indexes are left: rows of an item are found by the index, "server reindex" reindexes them.
+func New(log *slog.Logger, cfg *config.Config) (*App, error) {
+	db, serviceKeeper, _, err := newKeeper(log, cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.QueryTimeout)
+	defer cancel()
+	if err = serviceKeeper.CheckKeys(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err = serviceKeeper.CheckIndexed(ctx); err != nil {
+		db.Close()
+		return nil, err
 	}
-	storageKeeper := storage.NewKeeperPostgres(db, cfg.QueryTimeout)
-	serviceKeeper := service.New(log, storageKeeper, cfg.Key)
 	conns := clients.NewUserWSConnMap()
-	h := handler.NewHandler(log, serviceKeeper, conns)
+	heartbeat := handler.Heartbeat{
+		PingPeriod:     cfg.WS.PingPeriod,
+		PongWait:       cfg.WS.PongWait,
+		WriteWait:      cfg.WS.WriteWait,
+		QueueSize:      cfg.WS.QueueSize,
+		MaxMessageSize: cfg.WS.MaxMessageSize,
+	}
+	h := handler.NewHandler(log, serviceKeeper, conns, heartbeat)
 
-	http.HandleFunc("/ws", h.Handle)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", h.Handle)
+	mux.HandleFunc("/sessions", h.Sessions)
+	mux.Handle("/files/", handler.NewFiles(log, serviceKeeper, cfg.MaxChunkSize))
 
-	err = http.ListenAndServeTLS(cfg.WS.Address, cfg.CertFile, cfg.KeyFile, nil)
-	if err != nil {
-		panic(err)
+	return &App{
+		log:             log,
+		db:              db,
+		srv:             &http.Server{Addr: cfg.WS.Address, Handler: mux},
+		handler:         h,
+		certFile:        cfg.CertFile,
+		keyFile:         cfg.KeyFile,
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}, nil
+}
+
+func (app *App) MustRun() {
+	if err := app.Run(); err != nil {
+		app.log.Error(
+			"error running websocket server",
+			sl.Err(err),
+		)
+		return
+	}
+}
+
+func (app *App) Run() error {
+	const op = "server.Run"
+	log := app.log.With(
+		slog.String("op", op),
+		slog.String("addr", app.srv.Addr),
+	)
+
+	log.Info("websocket server is running")
+	err := app.srv.ListenAndServeTLS(app.certFile, app.keyFile)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Stop stops accepting connections, closes websocket connections after the messages being handled are saved
+// and closes database connections pool. Connections still open after shutdown timeout are closed immediately.
+func (app *App) Stop() {
+	const op = "server.Stop"
+	log := app.log.With(
+		slog.String("op", op),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout)
+	defer cancel()
+
+	log.Info("stopping websocket server", slog.Duration("timeout", app.shutdownTimeout))
+
+	// hijacked (websocket) connections are not tracked by http.Server, handler closes them
+	if err := app.srv.Shutdown(ctx); err != nil {
+		log.Error("failed stop http server", sl.Err(err))
+	}
+	if err := app.handler.Shutdown(ctx); err != nil {
+		log.Error("websocket connections are not closed in time", sl.Err(err))
 	}
+	app.db.Close()
 }
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -11,149 +13,260 @@ import (
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
 )
 
+// Validate checks the message contains the envelope with item identifiers.
+// Item data is encrypted by the client, so it is checked only to be present (history request has no data).
+// Message value is never logged: even encrypted, the server has no reason to write it anywhere but the store.
 func (s *Service) Validate(msg models.Message) (models.Message, error) {
 	const op = "servicekeeper.Validate"
 	log := s.log.With(
 		slog.String("op", op),
 	)
 
-	var kind struct{ Type string }
-	err := json.Unmarshal(msg.Value, &kind)
+	var env models.Envelope
+	err := json.Unmarshal(msg.Value, &env)
 	if err != nil {
 		log.Error(
-			"failed extract value from message",
-			slog.String(`msg should contains "Type" field`, string(msg.Value)),
+			"failed extract envelope from message",
+			slog.Int("value length", len(msg.Value)),
 			sl.Err(err),
 		)
 		return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
 	}
-	switch kind.Type {
-	case models.CredItem.String():
-		var cred models.Credentials
-		err := json.Unmarshal(msg.Value, &cred)
-		if err != nil {
-			log.Error(
-				`failed unmarshal message value into "Credentials" model`,
-				slog.String(`msg`, string(msg.Value)),
-				sl.Err(err),
-			)
-			return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
-		}
-	case models.TextItem.String():
-		var text models.Text
-		err = json.Unmarshal(msg.Value, &text)
-		if err != nil {
-			log.Error(
-				`failed unmarshal message value into "Text" model`,
-				slog.String(`msg`, string(msg.Value)),
-				sl.Err(err),
-			)
-			return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
-		}
-	case models.BinItem.String():
-		var bin models.Binary
-		err = json.Unmarshal(msg.Value, &bin)
-		if err != nil {
-			log.Error(
-				`failed unmarshal message value into "Binary" model`,
-				slog.String(`msg`, string(msg.Value)),
-				sl.Err(err),
-			)
-			return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
-		}
-	case models.CardItem.String():
-		var card models.Card
-		err = json.Unmarshal(msg.Value, &card)
-		if err != nil {
+	if env.Type == "" || env.Key == "" {
+		log.Error(
+			"envelope has no item identifiers",
+		)
+		return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
+	}
+	if msg.Type != models.History && len(env.Data) == 0 {
+		log.Error(
+			"envelope has no item data",
+		)
+		return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
+	}
+	for _, file := range env.Files {
+		if !validFileID(file) {
 			log.Error(
-				`failed unmarshal message value into "Card" model`,
-				slog.String(`msg`, string(msg.Value)),
-				sl.Err(err),
+				"envelope references invalid file",
 			)
 			return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
 		}
-	default:
-		log.Error(
-			`failed unmarshal message into existing models`,
-			slog.String(`unknown message type`, kind.Type),
-		)
-		return models.Message{}, fmt.Errorf("%s: %w", op, ErrInvalidMessage)
+	}
+
+	if msg.Type == models.Delete {
+		return models.Message{Type: models.Delete, Value: msg.Value}, nil
 	}
 	return models.Message{Type: models.Update, Value: msg.Value}, nil
 }
 
-func (s *Service) convertItemListToMessage(items []storage.Item) models.Message {
-	const op = "servicekeeper.ConvertItemListToMessage"
-	log := s.log.With(
-		slog.String("op", op),
-	)
+// snapshotChunk collects encoded values (update messages or versions) into the value of snapshot_chunk message (JSON list).
+type snapshotChunk struct {
+	size  int
+	value []byte
+	count int
+}
+
+func newSnapshotChunk(size int) *snapshotChunk {
+	return &snapshotChunk{size: size}
+}
 
-	values := make([][]byte, 0, len(items))
-	for _, item := range items {
-		decoded := encrypt.DecodeMsg(string(item.Data), s.key)
-		values = append(values, []byte(decoded))
+// fits reports whether the message is added without exceeding the chunk size, the empty chunk takes any message.
+func (c *snapshotChunk) fits(msg []byte) bool {
+	// list brackets and separator
+	return c.count == 0 || len(c.value)+len(msg)+2 <= c.size
+}
+
+func (c *snapshotChunk) add(msg []byte) {
+	if c.count == 0 {
+		c.value = append(c.value, '[')
+	} else {
+		c.value = append(c.value, ',')
 	}
-	msg, _ := json.Marshal(values)
-	log.Info(
-		"items converted",
-		slog.Int("number of added items into message", len(items)),
-	)
+	c.value = append(c.value, msg...)
+	c.count++
+}
 
-	return models.Message{Type: models.Snapshot, Value: msg}
+func (c *snapshotChunk) empty() bool {
+	return c.count == 0
 }
 
-func (s *Service) convertMessageToItem(userID int64, msg models.Message) storage.Item {
-	const op = "servicekeeper.ConvertItemListToMessage"
-	log := s.log.With(
-		slog.String("op", op),
-		slog.Int64("user_id", userID),
-	)
+// message returns snapshot_chunk message with collected values and the request ID, and starts the next chunk.
+func (c *snapshotChunk) message(id string) models.Message {
+	value := append(c.value, ']')
+	c.value, c.count = nil, 0
+	return models.Message{ID: id, Type: models.SnapshotChunk, Value: value}
+}
 
-	var item storage.Item
-	item.Data = []byte(encrypt.EncodeMsg(msg.Value, s.key))
-	item.UserID = userID
+// convertItemToVersion decrypts the item into the version of the history.
+func (s *Service) convertItemToVersion(ctx context.Context, item storage.Item, dataKey []byte) (models.Version, error) {
+	value, err := s.convertItemToEnvelope(ctx, item, dataKey)
+	if err != nil {
+		return models.Version{}, err
+	}
+	return models.Version{
+		Revision: item.Revision,
+		Created:  item.SavedAt,
+		Value:    value,
+		Deleted:  item.Deleted,
+		Conflict: item.Conflict,
+	}, nil
+}
 
-	var kind struct{ Type string }
-	_ = json.Unmarshal(msg.Value, &kind)
+func (s *Service) convertItemToMessage(ctx context.Context, item storage.Item, dataKey []byte) (models.Message, error) {
+	value, err := s.convertItemToEnvelope(ctx, item, dataKey)
+	if err != nil {
+		return models.Message{}, err
+	}
 
-	switch kind.Type {
-	case models.CredItem.String():
-		var cred models.Credentials
-		_ = json.Unmarshal(msg.Value, &cred)
+	msg := models.Message{
+		Type:     models.Update,
+		Value:    value,
+		Revision: item.Revision,
+	}
+	if item.Deleted {
+		msg.Type = models.Delete
+	}
+	if item.Conflict {
+		msg.Type = models.Conflict
+		msg.BaseRevision = item.BaseRevision
+		msg.Deleted = item.Deleted
+	}
+	return msg, nil
+}
 
-		item.Kind = encrypt.EncodeMsg([]byte(models.CredItem.String()), s.key)
-		item.Key = encrypt.EncodeMsg([]byte(cred.Login), s.key)
-		item.CreatedAt = cred.Created
+// convertItemToEnvelope decrypts the stored envelope, the item data is still encrypted by the client.
+// Data is decrypted with the data key of the user, rows saved before data keys are decrypted by the key provider.
+func (s *Service) convertItemToEnvelope(ctx context.Context, item storage.Item, dataKey []byte) ([]byte, error) {
+	const op = "servicekeeper.ConvertItemToEnvelope"
 
-	case models.TextItem.String():
-		var text models.Text
-		_ = json.Unmarshal(msg.Value, &text)
+	kind, key, err := s.itemIdentity(item, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
-		item.Kind = encrypt.EncodeMsg([]byte(models.TextItem.String()), s.key)
-		item.Key = encrypt.EncodeMsg([]byte(text.Key), s.key)
-		item.CreatedAt = text.Created
+	ad := associatedData(item.UserID, kind, key)
+	var data []byte
+	switch {
+	case item.UserKey && dataKey == nil:
+		return nil, fmt.Errorf("%s: revision %d: %w", op, item.Revision, ErrNoDataKey)
+	case item.UserKey:
+		data, err = encrypt.Decrypt(item.Data, string(dataKey), ad)
+	case item.Bound:
+		data, err = s.keys.Decrypt(ctx, item.Data, ad)
+	case s.requireBound:
+		return nil, fmt.Errorf("%s: revision %d: %w", op, item.Revision, ErrUnbound)
+	default:
+		data, err = s.keys.Decrypt(ctx, item.Data, nil)
+	}
+	if err != nil {
+		if item.Bound && errors.Is(err, encrypt.ErrDecrypt) {
+			s.log.Error(
+				"item data does not belong to the row, the row was moved or changed in the store",
+				slog.String("op", op),
+				slog.Int64("user_id", item.UserID),
+				slog.Int64("revision", item.Revision),
+			)
+		}
+		return nil, fmt.Errorf("%s: decrypt data of revision %d: %w", op, item.Revision, err)
+	}
 
-	case models.BinItem.String():
-		var bin models.Binary
-		_ = json.Unmarshal(msg.Value, &bin)
+	value, _ := json.Marshal(models.Envelope{Type: kind, Key: key, Data: data})
+	return value, nil
+}
 
-		item.Kind = encrypt.EncodeMsg([]byte(models.BinItem.String()), s.key)
-		item.Key = encrypt.EncodeMsg([]byte(bin.Key), s.key)
-		item.CreatedAt = bin.Created
+// convertMessageToItem converts the envelope into the store row, the item data is encrypted with the data key of the user.
+// Type and key are stored as blind indexes: rows of the same item are found by them. The identifiers are encrypted
+// with the data key and bound to the blind indexes.
+// Data is bound to the user, type and key, so it is not decrypted if the row is moved to another user or item.
+// Client time of creation is encrypted with the item, so CreatedAt is not set.
+// Files referenced by the envelope are returned with the row, the storage keeps them with the revision.
+func (s *Service) convertMessageToItem(userID int64, msg models.Message, dataKey []byte) (storage.Item, []string, error) {
+	const op = "servicekeeper.ConvertMessageToItem"
 
-	case models.CardItem.String():
-		var card models.Card
-		_ = json.Unmarshal(msg.Value, &card)
+	var env models.Envelope
+	_ = json.Unmarshal(msg.Value, &env)
 
-		item.Kind = encrypt.EncodeMsg([]byte(models.CardItem.String()), s.key)
-		item.Key = encrypt.EncodeMsg([]byte(card.Number), s.key)
-		item.CreatedAt = card.Created
+	data, err := encrypt.Encrypt(env.Data, string(dataKey), associatedData(userID, env.Type, env.Key))
+	if err != nil {
+		return storage.Item{}, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info(
-		"message converted",
-		slog.String("msg value", string(msg.Value)),
-	)
+	kind, key := s.blindIdentity(env)
+	ident, err := encryptIdentity(userID, kind, key, env, dataKey)
+	if err != nil {
+		return storage.Item{}, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return storage.Item{
+		UserID:       userID,
+		Kind:         kind,
+		Key:          key,
+		Data:         data,
+		Deleted:      msg.Type == models.Delete,
+		BaseRevision: msg.BaseRevision,
+		Bound:        true,
+		UserKey:      true,
+		Identity:     ident,
+		Indexed:      true,
+	}, env.Files, nil
+}
+
+// identity is the plain text of the row identity.
+type identity struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+}
+
+// blindIdentity returns blind indexes of the item identifiers of the envelope as they are stored in type and key columns.
+func (s *Service) blindIdentity(env models.Envelope) (string, string) {
+	return encrypt.BlindIndex(s.indexKey, "type", env.Type), encrypt.BlindIndex(s.indexKey, "key", env.Key)
+}
+
+// encryptIdentity encrypts the item identifiers of the envelope with the data key, they are bound to the row
+// by the user and the blind indexes.
+func encryptIdentity(userID int64, kind string, key string, env models.Envelope, dataKey []byte) ([]byte, error) {
+	text, _ := json.Marshal(identity{Type: env.Type, Key: env.Key})
+	return encrypt.Encrypt(text, string(dataKey), identityAD(userID, kind, key))
+}
+
+// itemIdentity returns the item identifiers of the row: indexed rows keep them encrypted with the data key,
+// rows saved before blind indexes keep them encrypted deterministically with the legacy key in type and key columns.
+func (s *Service) itemIdentity(item storage.Item, dataKey []byte) (string, string, error) {
+	if !item.Indexed {
+		if s.legacyKey == "" {
+			return "", "", fmt.Errorf("identity of revision %d: %w", item.Revision, ErrNoLegacyKey)
+		}
+		kind, err := encrypt.DecodeMsg(item.Kind, s.legacyKey)
+		if err != nil {
+			return "", "", fmt.Errorf("decrypt type of revision %d: %w", item.Revision, err)
+		}
+		key, err := encrypt.DecodeMsg(item.Key, s.legacyKey)
+		if err != nil {
+			return "", "", fmt.Errorf("decrypt key of revision %d: %w", item.Revision, err)
+		}
+		return kind, key, nil
+	}
+
+	if dataKey == nil {
+		return "", "", fmt.Errorf("identity of revision %d: %w", item.Revision, ErrNoDataKey)
+	}
+	text, err := encrypt.Decrypt(item.Identity, string(dataKey), identityAD(item.UserID, item.Kind, item.Key))
+	if err != nil {
+		return "", "", fmt.Errorf("decrypt identity of revision %d: %w", item.Revision, err)
+	}
+	var ident identity
+	if err = json.Unmarshal(text, &ident); err != nil {
+		return "", "", fmt.Errorf("decode identity of revision %d: %w", item.Revision, err)
+	}
+	return ident.Type, ident.Key, nil
+}
+
+// identityAD identifies the row the identity belongs to: the user and blind indexes of type and key.
+func identityAD(userID int64, kind string, key string) []byte {
+	return append([]byte("identity|"), associatedData(userID, kind, key)...)
+}
 
-	return item
+// associatedData identifies the row the data belongs to: the user and the item (client identifiers of type and key).
+func associatedData(userID int64, kind string, key string) []byte {
+	// length prefix keeps the parts apart
+	return []byte(fmt.Sprintf("user:%d|type:%d:%s|key:%d:%s", userID, len(kind), kind, len(key), key))
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"testing"
@@ -16,7 +17,7 @@ import (
 func TestValidateOK(t *testing.T) {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	s := Service{log: log}
-	data := []byte(`{"type":"text","tag":"tag1","key":"key1","value":"value 1","comment":"comment","created":1}`)
+	data := []byte(`{"type":"t1","key":"k1","data":"AQID"}`)
 	msg := models.Message{Type: models.New, Value: data}
 
 	validated, err := s.Validate(msg)
@@ -26,6 +27,19 @@ func TestValidateOK(t *testing.T) {
 	assert.Equal(t, string(data), string(validated.Value))
 }
 
+func TestValidateDelete(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Service{log: log}
+	data := []byte(`{"type":"t2","key":"k2","data":"BAUG"}`)
+	msg := models.Message{Type: models.Delete, Value: data}
+
+	validated, err := s.Validate(msg)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.Delete, validated.Type)
+	assert.Equal(t, string(data), string(validated.Value))
+}
+
 func TestValidateFailCases(t *testing.T) {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	s := Service{log: log}
@@ -36,14 +50,26 @@ func TestValidateFailCases(t *testing.T) {
 		expectedErr error
 	}{
 		{
-			name:        "invalid message type",
-			data:        []byte(`{"type":"undefined","tag":"tag1","key":"key1","value":"value 1","comment":"comment","created":1}`),
+			name:        "not envelope",
+			data:        []byte(`[1,2,3]`),
 			ecpectedMsg: models.Message{},
 			expectedErr: ErrInvalidMessage,
 		},
 		{
-			name:        "invalid message value",
-			data:        []byte(`{"type":"text","tag":"tag1","key":5,"value":"value 1","comment":"comment","created":1}`),
+			name:        "no item key",
+			data:        []byte(`{"type":"t1","data":"AQID"}`),
+			ecpectedMsg: models.Message{},
+			expectedErr: ErrInvalidMessage,
+		},
+		{
+			name:        "no item data",
+			data:        []byte(`{"type":"t1","key":"k1"}`),
+			ecpectedMsg: models.Message{},
+			expectedErr: ErrInvalidMessage,
+		},
+		{
+			name:        "invalid file",
+			data:        []byte(`{"type":"t1","key":"k1","data":"AQID","files":["../f1"]}`),
 			ecpectedMsg: models.Message{},
 			expectedErr: ErrInvalidMessage,
 		},
@@ -51,7 +77,7 @@ func TestValidateFailCases(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			validated, err := s.Validate(models.Message{Value: tt.data})
+			validated, err := s.Validate(models.Message{Type: models.New, Value: tt.data})
 
 			require.Error(t, err)
 			assert.ErrorIs(t, err, tt.expectedErr)
@@ -63,12 +89,147 @@ func TestValidateFailCases(t *testing.T) {
 func TestConvertMessageToItemOK(t *testing.T) {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	key := "s5as4d5a#$%#%s6ad545##$%#4353KSFjH"
-	s := Service{log: log, key: key}
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), indexKey: key}
 
-	data := []byte(`{"type":"text","tag":"tag1","key":"key1","value":"value 1","comment":"comment","created":1}`)
+	data := []byte(`{"type":"t1","key":"k1","data":"AQID"}`)
 	msg := models.Message{Value: data}
-	expected := storage.Item{UserID: 1, Kind: encrypt.EncodeMsg([]byte("text"), key), Key: encrypt.EncodeMsg([]byte("key1"), key), Data: []byte(encrypt.EncodeMsg(msg.Value, key)), CreatedAt: 1}
-	converted := s.convertMessageToItem(1, msg)
+	converted, _, err := s.convertMessageToItem(1, msg, testDataKey(1))
+	require.NoError(t, err)
+
+	decrypted, err := encrypt.Decrypt(converted.Data, string(testDataKey(1)), associatedData(1, "t1", "k1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, decrypted)
+
+	ident, err := encrypt.Decrypt(converted.Identity, string(testDataKey(1)), identityAD(1, converted.Kind, converted.Key))
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"t1","key":"k1"}`, string(ident))
+
+	// identifiers are encrypted with random nonces, rows of the same item are grouped by blind indexes
+	again, _, err := s.convertMessageToItem(1, msg, testDataKey(1))
+	require.NoError(t, err)
+	assert.NotEqual(t, converted.Identity, again.Identity)
+	assert.Equal(t, converted.Kind, again.Kind)
+	assert.Equal(t, converted.Key, again.Key)
 
+	converted.Data, converted.Identity = nil, nil
+	expected := storage.Item{UserID: 1, Kind: encrypt.BlindIndex(key, "type", "t1"), Key: encrypt.BlindIndex(key, "key", "k1"),
+		Bound: true, UserKey: true, Indexed: true}
 	assert.Equal(t, expected, converted)
 }
+
+func TestConvertDeleteMessageToTombstone(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	key := "s5as4d5a#$%#%s6ad545##$%#4353KSFjH"
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), indexKey: key}
+
+	data := []byte(`{"type":"t2","key":"k2","data":"BAUG"}`)
+	converted, _, err := s.convertMessageToItem(1, models.Message{Type: models.Delete, Value: data}, testDataKey(1))
+	require.NoError(t, err)
+
+	assert.True(t, converted.Deleted)
+	assert.Equal(t, encrypt.BlindIndex(key, "key", "k2"), converted.Key)
+}
+
+func TestConvertMessageToItemFiles(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	key := "s5as4d5a#$%#%s6ad545##$%#4353KSFjH"
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), indexKey: key}
+
+	data := []byte(`{"type":"t1","key":"k1","data":"AQID","files":["f1"]}`)
+	_, files, err := s.convertMessageToItem(1, models.Message{Type: models.New, Value: data}, testDataKey(1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f1"}, files)
+}
+
+func TestConvertItemToMessageKeepsEnvelope(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key"}
+
+	data := `{"type":"t1","key":"k1","data":"AQID"}`
+	item, _, err := s.convertMessageToItem(1, models.Message{Type: models.New, Value: []byte(data)}, testDataKey(1))
+	require.NoError(t, err)
+	item.Revision = 3
+
+	msg, err := s.convertItemToMessage(context.Background(), item, testDataKey(item.UserID))
+	require.NoError(t, err)
+
+	assert.Equal(t, models.Update, msg.Type)
+	assert.Equal(t, int64(3), msg.Revision)
+	assert.Equal(t, data, string(msg.Value))
+}
+
+func TestConvertItemWrongKey(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key"}
+
+	item, _, err := s.convertMessageToItem(1, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)}, testDataKey(1))
+	require.NoError(t, err)
+
+	_, err = s.convertItemToMessage(context.Background(), item, testDataKey(2))
+	assert.ErrorIs(t, err, encrypt.ErrDecrypt)
+
+	// data key of the user is shredded
+	_, err = s.convertItemToMessage(context.Background(), item, nil)
+	assert.ErrorIs(t, err, ErrNoDataKey)
+}
+
+func TestConvertMovedItem(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key"}
+
+	item, _, err := s.convertMessageToItem(1, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)}, testDataKey(1))
+	require.NoError(t, err)
+	other, _, err := s.convertMessageToItem(1, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k2","data":"BAUG"}`)}, testDataKey(1))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		item storage.Item
+	}{
+		{name: "another user", item: func() storage.Item { moved := item; moved.UserID = 2; return moved }()},
+		{name: "another key", item: func() storage.Item { swapped := item; swapped.Key = other.Key; return swapped }()},
+		{name: "identity of another item", item: func() storage.Item {
+			swapped := item
+			swapped.Key, swapped.Identity = other.Key, other.Identity
+			return swapped
+		}()},
+		{name: "marked saved before data keys", item: func() storage.Item {
+			legacy := item
+			legacy.UserKey, legacy.Bound = false, false
+			return legacy
+		}()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.convertItemToMessage(context.Background(), test.item, testDataKey(test.item.UserID))
+			assert.ErrorIs(t, err, encrypt.ErrDecrypt)
+		})
+	}
+}
+
+func TestConvertUnboundItem(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "index", legacyKey: "key"}
+
+	data, err := encrypt.Encrypt([]byte{1, 2, 3}, s.legacyKey, nil)
+	require.NoError(t, err)
+	item := storage.Item{UserID: 1, Kind: encrypt.EncodeMsg([]byte("t1"), s.legacyKey), Key: encrypt.EncodeMsg([]byte("k1"), s.legacyKey), Data: data}
+
+	msg, err := s.convertItemToMessage(context.Background(), item, testDataKey(item.UserID))
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"t1","key":"k1","data":"AQID"}`, string(msg.Value))
+
+	s.requireBound = true
+	_, err = s.convertItemToMessage(context.Background(), item, testDataKey(item.UserID))
+	assert.ErrorIs(t, err, ErrUnbound)
+}
+
+func TestConvertItemWithoutLegacyKey(t *testing.T) {
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "index"}
+
+	// identifiers of the row saved before blind indexes are not decrypted with the index key
+	item := storage.Item{UserID: 1, Kind: encrypt.EncodeMsg([]byte("t1"), "key"), Key: encrypt.EncodeMsg([]byte("k1"), "key"), Revision: 1}
+	_, _, err := s.itemIdentity(item, testDataKey(item.UserID))
+	assert.ErrorIs(t, err, ErrNoLegacyKey)
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/kek"
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+const dataKeySize = 32
+
+// KeyProvider holds key-encryption keys, the keys never leave it. Data keys of users are wrapped by the current key,
+// items saved before data keys were encrypted by it too.
+type KeyProvider interface {
+	Keys(ctx context.Context) (kek.KeyInfo, error)
+	Encrypt(ctx context.Context, text []byte, ad []byte) ([]byte, string, error)
+	Decrypt(ctx context.Context, msg []byte, ad []byte) ([]byte, error)
+}
+
+// dataKeys caches unwrapped data keys of users for ttl, so the key provider is not asked on every message.
+// Shredded key is still used by the other server processes until it expires in their caches.
+type dataKeys struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	keys map[int64]cachedKey
+}
+
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+func newDataKeys(ttl time.Duration) *dataKeys {
+	return &dataKeys{
+		ttl:  ttl,
+		keys: make(map[int64]cachedKey),
+	}
+}
+
+func (c *dataKeys) get(userID int64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.keys[userID]
+	if !ok || time.Now().After(cached.expires) {
+		delete(c.keys, userID)
+		return nil, false
+	}
+	return cached.key, true
+}
+
+func (c *dataKeys) put(userID int64, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys[userID] = cachedKey{key: key, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *dataKeys) remove(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.keys, userID)
+}
+
+// userKeyAD binds the wrapped data key to its user.
+func userKeyAD(userID int64) []byte {
+	return []byte(fmt.Sprintf("user key:%d", userID))
+}
+
+// dataKey returns the unwrapped data key of the user. If the user has no key, a new key is created when create is set,
+// otherwise nil key is returned.
+func (s *Service) dataKey(ctx context.Context, userID int64, create bool) ([]byte, error) {
+	const op = "servicekeeper.dataKey"
+
+	if key, ok := s.dataKeys.get(userID); ok {
+		return key, nil
+	}
+
+	wrapped, err := s.storage.UserKey(ctx, userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		if !create {
+			return nil, nil
+		}
+		wrapped, err = s.newDataKey(ctx, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err := s.keys.Decrypt(ctx, wrapped.Wrapped, userKeyAD(userID))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unwrap data key of user %d: %w", op, userID, err)
+	}
+	s.dataKeys.put(userID, key)
+	return key, nil
+}
+
+// newDataKey creates the random data key of the user and saves it wrapped by the current key-encryption key.
+// Key created concurrently by another save is kept, the saved key is returned.
+func (s *Service) newDataKey(ctx context.Context, userID int64) (storage.UserKey, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return storage.UserKey{}, err
+	}
+	wrapped, keyID, err := s.keys.Encrypt(ctx, key, userKeyAD(userID))
+	if err != nil {
+		return storage.UserKey{}, err
+	}
+	return s.storage.SaveUserKey(ctx, storage.UserKey{UserID: userID, Wrapped: wrapped, KeyID: keyID})
+}
+
+// Shred deletes the data key and the items of the user (crypto-shredding): copies of the items (backups)
+// can not be decrypted after that. Items saved before data keys are encrypted with the server key,
+// they are shredded only if Reencrypt was run before.
+func (s *Service) Shred(ctx context.Context, userID int64) error {
+	const op = "servicekeeper.Shred"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	if err := s.storage.DeleteUser(ctx, userID); err != nil {
+		log.Error("delete user data key error", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	s.dataKeys.remove(userID)
+	log.Info("user data is shredded")
+	return nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	mock_storage "github.com/dkrasnykh/gophkeeper/internal/server/storage/mocks"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+func TestDataKeyCreated(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newDataKeys(time.Hour), indexKey: "key", storage: repo}
+
+	var wrapped storage.UserKey
+	repo.EXPECT().UserKey(gomock.Any(), int64(1)).Return(storage.UserKey{}, fmt.Errorf("storage: %w", storage.ErrNotFound))
+	repo.EXPECT().SaveUserKey(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, key storage.UserKey) (storage.UserKey, error) {
+		wrapped = key
+		return key, nil
+	})
+
+	key, err := s.dataKey(context.Background(), 1, true)
+	require.NoError(t, err)
+	assert.Len(t, key, dataKeySize)
+	assert.Equal(t, "1", wrapped.KeyID)
+	assert.NotContains(t, string(wrapped.Wrapped), string(key))
+
+	// unwrapped key is cached
+	cached, err := s.dataKey(context.Background(), 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, key, cached)
+
+	// key is not created for reading
+	repo.EXPECT().UserKey(gomock.Any(), int64(2)).Return(storage.UserKey{}, fmt.Errorf("storage: %w", storage.ErrNotFound))
+	key, err = s.dataKey(context.Background(), 2, false)
+	require.NoError(t, err)
+	assert.Nil(t, key)
+}
+
+func TestDataKeyOfAnotherUser(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newDataKeys(time.Hour), storage: repo}
+
+	// wrapped data key copied to another user is not unwrapped
+	msg, keyID, err := s.keys.Encrypt(context.Background(), testDataKey(1), userKeyAD(1))
+	require.NoError(t, err)
+	repo.EXPECT().UserKey(gomock.Any(), int64(2)).Return(storage.UserKey{UserID: 2, Wrapped: msg, KeyID: keyID}, nil)
+	_, err = s.dataKey(context.Background(), 2, false)
+	assert.Error(t, err)
+}
+
+func TestShred(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+
+	item, _, err := s.convertMessageToItem(1, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)}, testDataKey(1))
+	require.NoError(t, err)
+
+	repo.EXPECT().DeleteUser(gomock.Any(), int64(1)).Return(nil)
+	require.NoError(t, s.Shred(context.Background(), 1))
+
+	// backup copy of the item is not decrypted: data key is not cached and not stored anymore
+	repo.EXPECT().Revision(gomock.Any(), int64(1)).Return(item.Revision, nil)
+	repo.EXPECT().UserKey(gomock.Any(), int64(1)).Return(storage.UserKey{}, fmt.Errorf("storage: %w", storage.ErrNotFound))
+	repo.EXPECT().Snapshot(gomock.Any(), int64(1), "", "", snapshotPage).Return([]storage.Item{item}, nil)
+	err = s.Sync(context.Background(), 1, 0, func(models.Message) error { return nil })
+	assert.ErrorIs(t, err, ErrMakeSnapshot)
+
+	repo.EXPECT().DeleteUser(gomock.Any(), int64(2)).Return(errors.New("delete error"))
+	assert.ErrorIs(t, s.Shred(context.Background(), 2), ErrInternal)
+}
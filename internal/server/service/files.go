@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+var (
+	ErrInvalidChunk  = errors.New("invalid file chunk")
+	ErrChunkHash     = errors.New("file chunk does not match its hash")
+	ErrChunkNotFound = errors.New("file chunk not found")
+)
+
+// maxFileID is the maximum length of the file ID chosen by the client.
+const maxFileID = 64
+
+// SaveChunk stores the chunk n of the user file. The chunk is encrypted by the client, hash is SHA-256 (hex)
+// of it computed by the client: ErrChunkHash is returned if the chunk was damaged on the way.
+// The chunk is kept in the blob store by the user and the hash, the same chunk of another file or version
+// is stored once. The blob is encrypted with the data key of the user like items, so it is shredded with them.
+func (s *Service) SaveChunk(ctx context.Context, userID int64, fileID string, n int, data []byte, hash string) error {
+	const op = "servicekeeper.SaveChunk"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("file_id", fileID),
+		slog.Int("chunk", n),
+	)
+
+	if !validFileID(fileID) || n < 0 || len(data) == 0 {
+		return fmt.Errorf("%s: %w", op, ErrInvalidChunk)
+	}
+	if chunkHash(data) != hash {
+		log.Info("file chunk does not match its hash")
+		return fmt.Errorf("%s: %w", op, ErrChunkHash)
+	}
+
+	dataKey, err := s.dataKey(ctx, userID, true)
+	if err != nil {
+		log.Error(
+			"query user data key error",
+			sl.Err(err),
+		)
+		return ErrInternal
+	}
+	encrypted, err := encrypt.Encrypt(data, string(dataKey), blobAD(userID, hash))
+	if err != nil {
+		log.Error(
+			"encrypt file chunk error",
+			sl.Err(err),
+		)
+		return ErrInternal
+	}
+	// blob is saved first, a chunk row always has its blob
+	if err = s.blobs.Put(ctx, blobKey(userID, hash), encrypted); err != nil {
+		log.Error(
+			"saving file chunk blob error",
+			sl.Err(err),
+		)
+		return ErrInternal
+	}
+	err = s.storage.SaveChunk(ctx, storage.Chunk{UserID: userID, FileID: fileID, N: n, Hash: hash})
+	if err != nil {
+		log.Error(
+			"saving file chunk error",
+			sl.Err(err),
+		)
+		return ErrInternal
+	}
+
+	return nil
+}
+
+// Chunk returns the chunk n of the user file as it was sent by the client and its hash.
+func (s *Service) Chunk(ctx context.Context, userID int64, fileID string, n int) ([]byte, string, error) {
+	const op = "servicekeeper.Chunk"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("file_id", fileID),
+		slog.Int("chunk", n),
+	)
+
+	if !validFileID(fileID) || n < 0 {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidChunk)
+	}
+
+	chunk, err := s.storage.Chunk(ctx, userID, fileID, n)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrChunkNotFound)
+	}
+	if err != nil {
+		log.Error(
+			"query file chunk error",
+			sl.Err(err),
+		)
+		return nil, "", ErrInternal
+	}
+	dataKey, err := s.dataKey(ctx, userID, false)
+	if err != nil {
+		log.Error(
+			"query user data key error",
+			sl.Err(err),
+		)
+		return nil, "", ErrInternal
+	}
+	if dataKey == nil {
+		log.Error("user has no data key for the file chunk")
+		return nil, "", ErrInternal
+	}
+	var data []byte
+	if chunk.Data != nil {
+		// chunk saved before the blob store
+		data, err = encrypt.Decrypt(chunk.Data, string(dataKey), chunkAD(userID, fileID, n))
+	} else {
+		data, err = s.chunkBlob(ctx, userID, chunk.Hash, dataKey)
+	}
+	if err != nil {
+		log.Error(
+			"decrypt file chunk error",
+			sl.Err(err),
+		)
+		return nil, "", ErrInternal
+	}
+
+	return data, chunk.Hash, nil
+}
+
+// Chunks returns numbers of the chunks of the user file saved by the server, upload is resumed from the missing ones.
+func (s *Service) Chunks(ctx context.Context, userID int64, fileID string) ([]int, error) {
+	const op = "servicekeeper.Chunks"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.String("file_id", fileID),
+	)
+
+	if !validFileID(fileID) {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidChunk)
+	}
+
+	chunks, err := s.storage.Chunks(ctx, userID, fileID)
+	if err != nil {
+		log.Error(
+			"query file chunks error",
+			sl.Err(err),
+		)
+		return nil, ErrInternal
+	}
+
+	return chunks, nil
+}
+
+func (s *Service) chunkBlob(ctx context.Context, userID int64, hash string, dataKey []byte) ([]byte, error) {
+	encrypted, err := s.blobs.Get(ctx, blobKey(userID, hash))
+	if err != nil {
+		return nil, err
+	}
+	return encrypt.Decrypt(encrypted, string(dataKey), blobAD(userID, hash))
+}
+
+// validFileID accepts IDs made of letters, digits, '-' and '_', they are used in URLs.
+func validFileID(id string) bool {
+	if id == "" || len(id) > maxFileID {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func chunkHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// blobKey is the key of the chunk blob: chunks of the user are grouped, so they are easy to find by hand.
+func blobKey(userID int64, hash string) string {
+	return fmt.Sprintf("%d/%s", userID, hash)
+}
+
+// blobAD binds the encrypted blob to the user and the hash of the chunk.
+func blobAD(userID int64, hash string) []byte {
+	return []byte(fmt.Sprintf("blob|user:%d|hash:%s", userID, hash))
+}
+
+// chunkAD binds the encrypted chunk saved before the blob store to the user, the file and the position in it.
+func chunkAD(userID int64, fileID string, n int) []byte {
+	return []byte(fmt.Sprintf("chunk|user:%d|file:%d:%s|n:%d", userID, len(fileID), fileID, n))
+}
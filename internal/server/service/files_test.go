@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/blob"
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	mock_storage "github.com/dkrasnykh/gophkeeper/internal/server/storage/mocks"
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+)
+
+func TestChunkSaved(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	blobs, err := blob.NewFS(t.TempDir())
+	require.NoError(t, err)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), storage: repo, blobs: blobs}
+
+	data := []byte("encrypted chunk")
+	var saved storage.Chunk
+	repo.EXPECT().SaveChunk(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, chunk storage.Chunk) error {
+		saved = chunk
+		return nil
+	})
+	require.NoError(t, s.SaveChunk(context.Background(), 1, "file-1", 3, data, chunkHash(data)))
+	assert.Equal(t, chunkHash(data), saved.Hash)
+	assert.Nil(t, saved.Data)
+
+	stored, err := blobs.Get(context.Background(), blobKey(1, chunkHash(data)))
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), string(data))
+
+	repo.EXPECT().Chunk(gomock.Any(), int64(1), "file-1", 3).Return(saved, nil)
+	chunk, hash, err := s.Chunk(context.Background(), 1, "file-1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, data, chunk)
+	assert.Equal(t, chunkHash(data), hash)
+
+	// blob is bound to the user
+	require.NoError(t, blobs.Put(context.Background(), blobKey(2, chunkHash(data)), stored))
+	repo.EXPECT().Chunk(gomock.Any(), int64(2), "file-1", 3).Return(storage.Chunk{UserID: 2, FileID: "file-1", N: 3, Hash: saved.Hash}, nil)
+	_, _, err = s.Chunk(context.Background(), 2, "file-1", 3)
+	assert.ErrorIs(t, err, ErrInternal)
+}
+
+func TestLegacyChunk(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), storage: repo}
+
+	data := []byte("encrypted chunk")
+	encrypted, err := encrypt.Encrypt(data, string(testDataKey(1)), chunkAD(1, "file-1", 3))
+	require.NoError(t, err)
+	legacy := storage.Chunk{UserID: 1, FileID: "file-1", N: 3, Data: encrypted, Hash: chunkHash(data)}
+
+	repo.EXPECT().Chunk(gomock.Any(), int64(1), "file-1", 3).Return(legacy, nil)
+	chunk, _, err := s.Chunk(context.Background(), 1, "file-1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, data, chunk)
+
+	// chunk is bound to its position in the file
+	repo.EXPECT().Chunk(gomock.Any(), int64(1), "file-1", 4).Return(legacy, nil)
+	_, _, err = s.Chunk(context.Background(), 1, "file-1", 4)
+	assert.ErrorIs(t, err, ErrInternal)
+}
+
+func TestSaveChunkFailCases(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), storage: repo}
+
+	data := []byte("encrypted chunk")
+	tests := []struct {
+		name   string
+		fileID string
+		n      int
+		data   []byte
+		hash   string
+		err    error
+	}{
+		{name: "damaged chunk", fileID: "file1", n: 0, data: data, hash: chunkHash([]byte("another chunk")), err: ErrChunkHash},
+		{name: "empty chunk", fileID: "file1", n: 0, data: nil, hash: chunkHash(nil), err: ErrInvalidChunk},
+		{name: "negative number", fileID: "file1", n: -1, data: data, hash: chunkHash(data), err: ErrInvalidChunk},
+		{name: "empty file id", fileID: "", n: 0, data: data, hash: chunkHash(data), err: ErrInvalidChunk},
+		{name: "file id with path", fileID: "../file1", n: 0, data: data, hash: chunkHash(data), err: ErrInvalidChunk},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.SaveChunk(context.Background(), 1, test.fileID, test.n, test.data, test.hash)
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestChunkNotFound(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), storage: repo}
+
+	repo.EXPECT().Chunk(gomock.Any(), int64(1), "file1", 0).Return(storage.Chunk{}, fmt.Errorf("storage: %w", storage.ErrNotFound))
+	_, _, err := s.Chunk(context.Background(), 1, "file1", 0)
+	assert.ErrorIs(t, err, ErrChunkNotFound)
+
+	repo.EXPECT().Chunks(gomock.Any(), int64(1), "file1").Return([]int{0, 2}, nil)
+	chunks, err := s.Chunks(context.Background(), 1, "file1")
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 2}, chunks)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+)
+
+// CollectGarbage deletes chunks of files no item version references and then blobs no chunk references.
+// Only chunks and blobs saved before the time are deleted: a file is referenced after all its chunks are uploaded,
+// so before must leave the clients time to finish the upload. Chunks and blobs are handled in batches
+// while the server keeps serving, it is safe to run it again. The numbers of deleted chunks and blobs are returned.
+func (s *Service) CollectGarbage(ctx context.Context, before time.Time, batch int) (chunks int64, blobs int64, err error) {
+	const op = "servicekeeper.CollectGarbage"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	for {
+		n, err := s.storage.CollectChunks(ctx, before, batch)
+		if err != nil {
+			log.Error("collect file chunks error", sl.Err(err))
+			return chunks, blobs, fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+		chunks += n
+		if n < int64(batch) {
+			break
+		}
+		log.Info("file chunks collected", slog.Int64("done", chunks))
+	}
+
+	refs := make([]storage.BlobRef, 0, batch)
+	collect := func() error {
+		n, err := s.deleteUnreferenced(ctx, refs)
+		blobs += n
+		refs = refs[:0]
+		return err
+	}
+	err = s.blobs.Walk(ctx, func(key string, saved time.Time) error {
+		if !saved.Before(before) {
+			return nil
+		}
+		ref, ok := parseBlobKey(key)
+		if !ok {
+			log.Error("blob is not a file chunk, it is kept", slog.String("key", key))
+			return nil
+		}
+		refs = append(refs, ref)
+		if len(refs) < batch {
+			return nil
+		}
+		return collect()
+	})
+	if err == nil {
+		err = collect()
+	}
+	if err != nil {
+		log.Error("collect blobs error", sl.Err(err))
+		return chunks, blobs, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	log.Info("garbage collected", slog.Int64("chunks", chunks), slog.Int64("blobs", blobs))
+	return chunks, blobs, nil
+}
+
+// deleteUnreferenced deletes the blobs of refs which are not referenced by any chunk.
+func (s *Service) deleteUnreferenced(ctx context.Context, refs []storage.BlobRef) (int64, error) {
+	if len(refs) == 0 {
+		return 0, nil
+	}
+	referenced, err := s.storage.ReferencedBlobs(ctx, refs)
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[storage.BlobRef]bool, len(referenced))
+	for _, ref := range referenced {
+		keep[ref] = true
+	}
+
+	var deleted int64
+	for _, ref := range refs {
+		if keep[ref] {
+			continue
+		}
+		if err = s.blobs.Delete(ctx, blobKey(ref.UserID, ref.Hash)); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// parseBlobKey returns the chunk blob of the key made by blobKey.
+func parseBlobKey(key string) (storage.BlobRef, bool) {
+	user, hash, ok := strings.Cut(key, "/")
+	if !ok || hash == "" || strings.Contains(hash, "/") {
+		return storage.BlobRef{}, false
+	}
+	userID, err := strconv.ParseInt(user, 10, 64)
+	if err != nil {
+		return storage.BlobRef{}, false
+	}
+	return storage.BlobRef{UserID: userID, Hash: hash}, true
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/blob"
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	mock_storage "github.com/dkrasnykh/gophkeeper/internal/server/storage/mocks"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	dir := t.TempDir()
+	blobs, err := blob.NewFS(dir)
+	require.NoError(t, err)
+	s := Service{log: log, storage: repo, blobs: blobs}
+	ctx := context.Background()
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, key := range []string{"1/referenced", "1/unreferenced", "2/unreferenced", "1/recent", "foreign"} {
+		require.NoError(t, blobs.Put(ctx, key, []byte(key)))
+	}
+	for _, path := range []string{"1/re/referenced", "1/un/unreferenced", "2/un/unreferenced", "fo/foreign"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, filepath.FromSlash(path)), old, old))
+	}
+
+	before := time.Now().Add(-24 * time.Hour)
+	gomock.InOrder(
+		repo.EXPECT().CollectChunks(gomock.Any(), before, 2).Return(int64(2), nil),
+		repo.EXPECT().CollectChunks(gomock.Any(), before, 2).Return(int64(1), nil),
+	)
+	repo.EXPECT().ReferencedBlobs(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, refs []storage.BlobRef) ([]storage.BlobRef, error) {
+			assert.LessOrEqual(t, len(refs), 2)
+			var res []storage.BlobRef
+			for _, ref := range refs {
+				if ref.Hash == "referenced" {
+					res = append(res, ref)
+				}
+			}
+			return res, nil
+		}).Times(2)
+
+	chunks, deleted, err := s.CollectGarbage(ctx, before, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), chunks)
+	assert.Equal(t, int64(2), deleted)
+
+	for _, key := range []string{"1/referenced", "1/recent", "foreign"} {
+		_, err = blobs.Get(ctx, key)
+		assert.NoError(t, err, key)
+	}
+	for _, key := range []string{"1/unreferenced", "2/unreferenced"} {
+		_, err = blobs.Get(ctx, key)
+		assert.ErrorIs(t, err, blob.ErrNotFound, key)
+	}
+}
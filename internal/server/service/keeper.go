@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"github.com/dkrasnykh/gophkeeper/internal/server/blob"
 	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
 	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
@@ -14,65 +17,452 @@ import (
 var (
 	ErrInvalidMessage = errors.New("invalid message")
 	ErrMakeSnapshot   = errors.New("get snapshot error")
+	ErrHistory        = errors.New("get history error")
 	ErrInternal       = errors.New("internal error")
+	ErrConflict       = errors.New("item was changed after base revision")
+	ErrDuplicate      = errors.New("message was already saved")
+	ErrUnbound        = errors.New("item data is not bound to the item")
+	ErrRetiredKey     = errors.New("items are encrypted with key missing in the keyring")
+	ErrNoDataKey      = errors.New("user has no data key")
+	ErrNoLegacyKey    = errors.New("legacy key is not set")
+	ErrUnindexed      = errors.New("items saved before blind indexes are not reindexed")
 )
 
 //go:generate mockgen -source=keeper.go -destination=../storage/mocks/mock.go
 type Storager interface {
-	Snapshot(ctx context.Context, userID int64) ([]storage.Item, error)
-	Save(ctx context.Context, item storage.Item) error
+	Snapshot(ctx context.Context, userID int64, kind string, key string, limit int) ([]storage.Item, error)
+	Changes(ctx context.Context, userID int64, revision int64) ([]storage.Item, error)
+	Revision(ctx context.Context, userID int64) (int64, error)
+	Conflicts(ctx context.Context, userID int64) ([]storage.Item, error)
+	History(ctx context.Context, userID int64, kind string, key string, revision int64, limit int) ([]storage.Item, error)
+	SnapshotAt(ctx context.Context, userID int64, at int64, kind string, key string, limit int) ([]storage.Item, error)
+	Save(ctx context.Context, item storage.Item, requestID string, files ...string) (int64, error)
+	Stale(ctx context.Context, userID int64, revision int64, limit int) ([]storage.Item, error)
+	Rewrite(ctx context.Context, item storage.Item) error
+	Unindexed(ctx context.Context, userID int64, revision int64, limit int) ([]storage.Item, error)
+	Reindex(ctx context.Context, item storage.Item) error
+	KeyUsage(ctx context.Context) (map[string]int64, error)
+	UserKey(ctx context.Context, userID int64) (storage.UserKey, error)
+	SaveUserKey(ctx context.Context, key storage.UserKey) (storage.UserKey, error)
+	StaleUserKeys(ctx context.Context, keyID string, userID int64, limit int) ([]storage.UserKey, error)
+	RewrapUserKey(ctx context.Context, key storage.UserKey) error
+	DeleteUser(ctx context.Context, userID int64) error
+	PurgeHistory(ctx context.Context, userID int64, kind string, key string, revision int64) error
+	SaveChunk(ctx context.Context, chunk storage.Chunk) error
+	Chunk(ctx context.Context, userID int64, fileID string, n int) (storage.Chunk, error)
+	Chunks(ctx context.Context, userID int64, fileID string) ([]int, error)
+	CollectChunks(ctx context.Context, before time.Time, limit int) (int64, error)
+	ReferencedBlobs(ctx context.Context, refs []storage.BlobRef) ([]storage.BlobRef, error)
 }
 
+// Service stores items encrypted with the data key of the user, the data key is wrapped by the key-encryption key
+// of the key provider. Item data is bound to the user, type and key of the item (associated data).
+// Rows saved before data keys are encrypted with the provider keys, rows saved before binding are decrypted
+// without associated data until requireBound is set.
+// Rows of the same item are found by blind indexes (keyed hashes) of the item type and key computed with the index key,
+// it is not rotated. The identifiers themselves are encrypted with the data key like the data.
+// Identifiers of rows saved before blind indexes are decrypted with the legacy key (the former server key).
 type Service struct {
-	log     *slog.Logger
-	storage Storager
-	key     string
+	log          *slog.Logger
+	storage      Storager
+	blobs        blob.Store
+	keys         KeyProvider
+	dataKeys     *dataKeys
+	indexKey     string
+	legacyKey    string
+	maxChanges   int64
+	chunkSize    int
+	requireBound bool
 }
 
-func New(log *slog.Logger, s Storager, key string) *Service {
+// New creates the service, unwrapped data keys are cached for keyTTL. Snapshot is sent in chunks up to chunkSize bytes.
+// File chunks are kept in blobs.
+func New(log *slog.Logger, s Storager, blobs blob.Store, keys KeyProvider, keyTTL time.Duration, indexKey string, legacyKey string,
+	maxChanges int64, chunkSize int, requireBound bool) *Service {
 	return &Service{
-		log:     log,
-		storage: s,
-		key:     key,
+		log:          log,
+		storage:      s,
+		blobs:        blobs,
+		keys:         keys,
+		dataKeys:     newDataKeys(keyTTL),
+		indexKey:     indexKey,
+		legacyKey:    legacyKey,
+		maxChanges:   maxChanges,
+		chunkSize:    chunkSize,
+		requireBound: requireBound,
 	}
 }
 
-func (s *Service) Snapshot(ctx context.Context, userID int64) (models.Message, error) {
-	const op = "servicekeeper.Snapshot"
+// snapshotPage is the number of items read from the storage at once while the snapshot is sent.
+const snapshotPage = 100
+
+// Sync sends messages which bring the client from the revision to the latest state.
+// Changes after the revision are sent as update and delete messages.
+// Conflict versions are sent as conflict messages.
+// Full snapshot is sent when client has no revision, when the revision is unknown to the server
+// or when the client is more than maxChanges revisions behind.
+// Messages are sent with send as soon as they are made, so the snapshot is never held in memory as a whole.
+// Error of send stops the sync and is returned.
+func (s *Service) Sync(ctx context.Context, userID int64, revision int64, send func(models.Message) error) error {
+	const op = "servicekeeper.Sync"
 	log := s.log.With(
 		slog.String("op", op),
 		slog.Int64("user_id", userID),
+		slog.Int64("revision", revision),
 	)
 
-	res, err := s.storage.Snapshot(ctx, userID)
+	latest, err := s.storage.Revision(ctx, userID)
+	if err != nil {
+		log.Error(
+			"query latest revision error",
+			sl.Err(err),
+		)
+		return fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
+	}
+	dataKey, err := s.dataKey(ctx, userID, false)
 	if err != nil {
 		log.Error(
-			"query snapshot error",
+			"query user data key error",
 			sl.Err(err),
 		)
-		return models.Message{}, fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
+		return fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
 	}
 
-	return s.convertItemListToMessage(res), nil
+	if revision <= 0 || revision > latest || latest-revision > s.maxChanges {
+		if err = s.snapshot(ctx, userID, latest, dataKey, send); err != nil {
+			return err
+		}
+
+		conflicts, err := s.storage.Conflicts(ctx, userID)
+		if err != nil {
+			log.Error(
+				"query conflicts error",
+				sl.Err(err),
+			)
+			return fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
+		}
+		return s.sendItems(ctx, op, conflicts, dataKey, send)
+	}
+
+	items, err := s.storage.Changes(ctx, userID, revision)
+	if err != nil {
+		log.Error(
+			"query changes error",
+			sl.Err(err),
+		)
+		return fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
+	}
+	return s.sendItems(ctx, op, items, dataKey, send)
 }
 
-func (s *Service) Save(ctx context.Context, userID int64, msg models.Message) error {
+// sendItems sends the items one by one as update, delete or conflict messages.
+func (s *Service) sendItems(ctx context.Context, op string, items []storage.Item, dataKey []byte, send func(models.Message) error) error {
+	for _, item := range items {
+		msg, err := s.convertItemToMessage(ctx, item, dataKey)
+		if err != nil {
+			s.log.Error(
+				"decrypt item error",
+				slog.String("op", op),
+				slog.Int64("user_id", item.UserID),
+				sl.Err(err),
+			)
+			return fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
+		}
+		if err = send(msg); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// snapshot sends actual items of the user: snapshot_begin, snapshot_chunk messages and snapshot_end
+// with the latest revision. Items are read from the storage by pages and grouped into chunks up to chunkSize bytes,
+// the item larger than chunkSize is sent in its own chunk. If the snapshot is interrupted the client gets no end
+// and asks for the full snapshot again.
+func (s *Service) snapshot(ctx context.Context, userID int64, latest int64, dataKey []byte, send func(models.Message) error) error {
+	const op = "servicekeeper.Snapshot"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	next := s.snapshotPages(ctx, log, dataKey, func(kind string, key string) ([]storage.Item, error) {
+		return s.storage.Snapshot(ctx, userID, kind, key, snapshotPage)
+	})
+	items, chunks, err := s.sendChunks(models.Message{Type: models.SnapshotEnd, Revision: latest}, next, send)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info(
+		"snapshot sent",
+		slog.Int("items", items),
+		slog.Int("chunks", chunks),
+	)
+	return nil
+}
+
+// snapshotPages returns the reader of snapshot pages for sendChunks: items are read with query after the item
+// (kind, key) of the previous page and encoded as update messages.
+func (s *Service) snapshotPages(ctx context.Context, log *slog.Logger, dataKey []byte, query func(kind string, key string) ([]storage.Item, error)) func() ([][]byte, bool, error) {
+	var kind, key string
+	return func() ([][]byte, bool, error) {
+		page, err := query(kind, key)
+		if err != nil {
+			log.Error(
+				"query snapshot error",
+				sl.Err(err),
+			)
+			return nil, false, ErrMakeSnapshot
+		}
+
+		values := make([][]byte, 0, len(page))
+		for _, item := range page {
+			msg, err := s.convertItemToMessage(ctx, item, dataKey)
+			if err != nil {
+				log.Error(
+					"decrypt snapshot error",
+					sl.Err(err),
+				)
+				return nil, false, ErrMakeSnapshot
+			}
+			value, _ := json.Marshal(msg)
+			values = append(values, value)
+		}
+
+		if len(page) < snapshotPage {
+			return values, false, nil
+		}
+		kind, key = page[len(page)-1].Kind, page[len(page)-1].Key
+		return values, true, nil
+	}
+}
+
+// sendChunks sends snapshot_begin, snapshot_chunk messages and the end message, begin and chunks get the ID of the end.
+// Values are read by pages with next until it reports no more pages and grouped into chunks up to chunkSize bytes
+// (JSON list), the value larger than chunkSize is sent in its own chunk. It returns the number of sent values and chunks.
+func (s *Service) sendChunks(end models.Message, next func() ([][]byte, bool, error), send func(models.Message) error) (int, int, error) {
+	if err := send(models.Message{ID: end.ID, Type: models.SnapshotBegin}); err != nil {
+		return 0, 0, err
+	}
+
+	chunk := newSnapshotChunk(s.chunkSize)
+	var items, chunks int
+	for more := true; more; {
+		var (
+			values [][]byte
+			err    error
+		)
+		values, more, err = next()
+		if err != nil {
+			return items, chunks, err
+		}
+
+		for _, value := range values {
+			if !chunk.fits(value) {
+				if err = send(chunk.message(end.ID)); err != nil {
+					return items, chunks, err
+				}
+				chunks++
+			}
+			chunk.add(value)
+			items++
+		}
+	}
+	if !chunk.empty() {
+		if err := send(chunk.message(end.ID)); err != nil {
+			return items, chunks, err
+		}
+		chunks++
+	}
+
+	return items, chunks, send(end)
+}
+
+// Save stores the message and returns the revision assigned to it.
+// ErrConflict is returned if the message base revision is stale, the message is kept as a conflict version.
+// ErrDuplicate is returned with the revision saved before if the message with the same ID was already saved.
+// Deletion of the item saved before end-to-end encryption purges its history, see purgeLegacy.
+func (s *Service) Save(ctx context.Context, userID int64, msg models.Message) (int64, error) {
 	const op = "servicekeeper.Save"
 	log := s.log.With(
 		slog.String("op", op),
 		slog.Int64("user_id", userID),
 	)
 
-	item := s.convertMessageToItem(userID, msg)
-	if err := s.storage.Save(ctx, item); err != nil {
+	dataKey, err := s.dataKey(ctx, userID, true)
+	if err != nil {
+		log.Error(
+			"query user data key error",
+			sl.Err(err),
+		)
+		return 0, ErrInternal
+	}
+	item, files, err := s.convertMessageToItem(userID, msg, dataKey)
+	if err != nil {
+		log.Error(
+			"encrypt item error",
+			sl.Err(err),
+		)
+		return 0, ErrInternal
+	}
+	revision, err := s.storage.Save(ctx, item, msg.ID, files...)
+	if errors.Is(err, storage.ErrConflict) {
+		log.Info(
+			"item was changed after base revision, saved as conflict",
+			slog.Int64("base revision", item.BaseRevision),
+			slog.Int64("revision", revision),
+		)
+		return revision, fmt.Errorf("%s: %w", op, ErrConflict)
+	}
+	if errors.Is(err, storage.ErrDuplicate) {
+		log.Info(
+			"message was already saved",
+			slog.String("request id", msg.ID),
+			slog.Int64("revision", revision),
+		)
+		// the deletion may be replayed because purge failed after it was saved
+		if err = s.purgeLegacy(ctx, msg, item, revision); err != nil {
+			log.Error(
+				"purge legacy history error",
+				slog.Int64("revision", revision),
+				sl.Err(err),
+			)
+			return 0, ErrInternal
+		}
+		return revision, fmt.Errorf("%s: %w", op, ErrDuplicate)
+	}
+	if err != nil {
 		log.Error(
 			"saving new item error",
 			slog.String("item type", item.Kind),
 			slog.String("item key", item.Key),
 			sl.Err(err),
 		)
-		return ErrInternal
+		return 0, ErrInternal
+	}
+	if err = s.purgeLegacy(ctx, msg, item, revision); err != nil {
+		log.Error(
+			"purge legacy history error",
+			slog.Int64("revision", revision),
+			sl.Err(err),
+		)
+		return 0, ErrInternal
 	}
 
+	return revision, nil
+}
+
+// purgeLegacy deletes the history of the item saved before end-to-end encryption when the client deletes it
+// after re-encryption: its versions are in clear for the client key, they must not be kept after the item is encrypted.
+// The client deletes the legacy version with the item type and key in clear, encrypted items have keyed hashes of them.
+func (s *Service) purgeLegacy(ctx context.Context, msg models.Message, item storage.Item, revision int64) error {
+	if msg.Type != models.Delete {
+		return nil
+	}
+	var env models.Envelope
+	_ = json.Unmarshal(msg.Value, &env)
+	if _, ok := models.Lookup(models.ItemType(env.Type)); !ok {
+		return nil
+	}
+	return s.storage.PurgeHistory(ctx, item.UserID, item.Kind, item.Key, revision)
+}
+
+// History sends all versions of the item from the request message: snapshot_begin, snapshot_chunk messages
+// with lists of versions and snapshot_end, all of them have the same ID as the request.
+// Versions are read from the storage by pages and grouped into chunks like the snapshot.
+func (s *Service) History(ctx context.Context, userID int64, msg models.Message, send func(models.Message) error) error {
+	const op = "servicekeeper.History"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	if _, err := s.Validate(msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var env models.Envelope
+	_ = json.Unmarshal(msg.Value, &env)
+	kind, key := s.blindIdentity(env)
+	dataKey, err := s.dataKey(ctx, userID, false)
+	if err != nil {
+		log.Error(
+			"query user data key error",
+			sl.Err(err),
+		)
+		return fmt.Errorf("%s: %w", op, ErrHistory)
+	}
+
+	var revision int64
+	next := func() ([][]byte, bool, error) {
+		page, err := s.storage.History(ctx, userID, kind, key, revision, snapshotPage)
+		if err != nil {
+			log.Error(
+				"query history error",
+				sl.Err(err),
+			)
+			return nil, false, ErrHistory
+		}
+
+		values := make([][]byte, 0, len(page))
+		for _, item := range page {
+			version, err := s.convertItemToVersion(ctx, item, dataKey)
+			if err != nil {
+				log.Error(
+					"decrypt history error",
+					sl.Err(err),
+				)
+				return nil, false, ErrHistory
+			}
+			value, _ := json.Marshal(version)
+			values = append(values, value)
+		}
+
+		if len(page) < snapshotPage {
+			return values, false, nil
+		}
+		revision = page[len(page)-1].Revision
+		return values, true, nil
+	}
+	if _, _, err = s.sendChunks(models.Message{ID: msg.ID, Type: models.SnapshotEnd}, next, send); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SnapshotAt sends the vault as it was at the moment from the request message: snapshot_begin, snapshot_chunk
+// messages with lists of update messages and snapshot_end, all of them have the same ID as the request.
+// Items are read from the storage by pages and grouped into chunks like the snapshot.
+func (s *Service) SnapshotAt(ctx context.Context, userID int64, msg models.Message, send func(models.Message) error) error {
+	const op = "servicekeeper.SnapshotAt"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+	)
+
+	var at models.PointInTime
+	if err := json.Unmarshal(msg.Value, &at); err != nil || at.At <= 0 {
+		log.Error(
+			"failed extract point in time from message",
+			slog.String("msg", string(msg.Value)),
+		)
+		return fmt.Errorf("%s: %w", op, ErrInvalidMessage)
+	}
+
+	dataKey, err := s.dataKey(ctx, userID, false)
+	if err != nil {
+		log.Error(
+			"query user data key error",
+			sl.Err(err),
+		)
+		return fmt.Errorf("%s: %w", op, ErrMakeSnapshot)
+	}
+
+	next := s.snapshotPages(ctx, log, dataKey, func(kind string, key string) ([]storage.Item, error) {
+		return s.storage.SnapshotAt(ctx, userID, at.At, kind, key, snapshotPage)
+	})
+	if _, _, err = s.sendChunks(models.Message{ID: msg.ID, Type: models.SnapshotEnd}, next, send); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 	return nil
 }
@@ -1,20 +1,105 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/dkrasnykh/gophkeeper/internal/server/kek"
 	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
 	mock_storage "github.com/dkrasnykh/gophkeeper/internal/server/storage/mocks"
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
 	"github.com/dkrasnykh/gophkeeper/pkg/models"
 )
 
+// newKeyring returns the key provider with the only key, it decrypts items saved before key IDs too.
+func newKeyring(t *testing.T, secret string) *kek.File {
+	keys, err := encrypt.NewKeyring(map[string]string{"1": secret}, "1", "1")
+	require.NoError(t, err)
+	return kek.NewKeyring(keys)
+}
+
+// testDataKey is the data key of the test user.
+func testDataKey(userID int64) []byte {
+	key := make([]byte, dataKeySize)
+	copy(key, fmt.Sprintf("data key of user %d", userID))
+	return key
+}
+
+// newTestDataKeys returns the cache with data keys of users 1 and 2, so the storage is not asked for them.
+func newTestDataKeys() *dataKeys {
+	keys := newDataKeys(time.Hour)
+	keys.put(1, testDataKey(1))
+	keys.put(2, testDataKey(2))
+	return keys
+}
+
+func newItem(t *testing.T, s Service, userID int64, msg models.Message) storage.Item {
+	item, _, err := s.convertMessageToItem(userID, msg, testDataKey(userID))
+	require.NoError(t, err)
+	return item
+}
+
+// itemMatcher matches the item with the same fields and the same decrypted data and identity:
+// they are encrypted with random nonce, so data of equal items differs.
+type itemMatcher struct {
+	s    Service
+	item storage.Item
+}
+
+func sameItem(s Service, item storage.Item) gomock.Matcher {
+	return itemMatcher{s: s, item: item}
+}
+
+func (m itemMatcher) Matches(x interface{}) bool {
+	item, ok := x.(storage.Item)
+	if !ok {
+		return false
+	}
+	got, err := m.s.convertItemToEnvelope(context.Background(), item, testDataKey(item.UserID))
+	if err != nil {
+		return false
+	}
+	want, err := m.s.convertItemToEnvelope(context.Background(), m.item, testDataKey(m.item.UserID))
+	if err != nil {
+		return false
+	}
+	item.Data, item.Identity = nil, nil
+	expected := m.item
+	expected.Data, expected.Identity = nil, nil
+	return reflect.DeepEqual(expected, item) && string(got) == string(want)
+}
+
+func (m itemMatcher) String() string {
+	return fmt.Sprintf("is equal to %v with decrypted data and identity", m.item)
+}
+
+// collect returns send function of Sync which appends sent messages to msgs.
+func collect(msgs *[]models.Message) func(models.Message) error {
+	return func(msg models.Message) error {
+		*msgs = append(*msgs, msg)
+		return nil
+	}
+}
+
+func messageTypes(msgs []models.Message) []models.MessageType {
+	types := make([]models.MessageType, 0, len(msgs))
+	for _, msg := range msgs {
+		types = append(types, msg.Type)
+	}
+	return types
+}
+
 func TestSnapshotOK(t *testing.T) {
 	type mockBehavior func(r *mock_storage.MockStorager, userID int64)
 
@@ -27,18 +112,84 @@ func TestSnapshotOK(t *testing.T) {
 	behavior = func(r *mock_storage.MockStorager, userID int64) {
 		item1 := storage.Item{UserID: 1, Kind: "80c3314f39f125002c7c3274a7df6c0a747a7bb0", Key: "9fc3300add723e7db0dd2482907fa14c7e5be6de", Data: []byte("8f843d426a06cba17a7b7d0713ec9dbbcad7461f278302ecef9cb9bebd1365c3072d150d41d5653af14972db6bbde20d74e88d2025d30b3be9c053308c4c877e8b50d2399cc22916b28ece6a06ffd07b4864bd128708dfc74517aa74fef3ae1182cf80e25e924d8d0f1fc508d88d645cfa05b61d"), CreatedAt: 1717748173}
 		item2 := storage.Item{UserID: 1, Kind: "97d42c5f258fc90849ea6210cf2d44fa4d5b9270", Key: "98c92e527452ad98dd7bd056253875e29de43b3eb37a", Data: []byte("8f843d426a06cba17a6c6a1a03ec9dbbcad7461f278302ecef9cb9bebd146fdd4c79155c06c03b7fb40535982beaf74e3db98c2e3bc24c30e99c1020905685698115d22f9cc22916b28ece6a15e7de3a447bb5169d198ac75304fe37aca5ee4cd7da89ae9c6f78aed30a2ac58b110a5488418bf74a7feda6ac39fbea0bb6"), CreatedAt: 1717748206}
-		r.EXPECT().Snapshot(context.Background(), int64(1)).Return([]storage.Item{item1, item2}, nil)
+		r.EXPECT().Snapshot(context.Background(), int64(1), "", "", snapshotPage).Return([]storage.Item{item1, item2}, nil)
 	}
 
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
 	repo := mock_storage.NewMockStorager(c)
-	s := Service{log: log, key: key, storage: repo}
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), legacyKey: key, storage: repo, chunkSize: 1 << 16}
 	behavior(repo, int64(1))
 
-	msg, err := s.Snapshot(context.Background(), int64(1))
+	var msgs []models.Message
+	err := s.snapshot(context.Background(), int64(1), 2, nil, collect(&msgs))
 	require.NoError(t, err)
-	require.Equal(t, models.Snapshot, msg.Type)
+	require.Equal(t, 3, len(msgs))
+	require.Equal(t, models.SnapshotBegin, msgs[0].Type)
+	require.Equal(t, models.SnapshotChunk, msgs[1].Type)
+	require.Equal(t, models.SnapshotEnd, msgs[2].Type)
+	require.Equal(t, int64(2), msgs[2].Revision)
+
+	var values []models.Message
+	require.NoError(t, json.Unmarshal(msgs[1].Value, &values))
+	require.Equal(t, 2, len(values))
+}
+
+func TestSnapshotChunks(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo, chunkSize: 1024}
+	userID := int64(1)
+
+	// two full pages and the last one, every item takes about a third of the chunk, the large one exceeds it
+	items := make([]storage.Item, 0, 2*snapshotPage+1)
+	for i := 0; i < cap(items); i++ {
+		data := bytes.Repeat([]byte{byte(i)}, 200)
+		if i == snapshotPage {
+			data = bytes.Repeat([]byte{1}, 2048)
+		}
+		value, _ := json.Marshal(models.Envelope{Type: "t1", Key: fmt.Sprintf("k%03d", i), Data: data})
+		item := newItem(t, s, userID, models.Message{Type: models.New, Value: value})
+		item.Revision = int64(i + 1)
+		items = append(items, item)
+	}
+	last := func(page []storage.Item) (string, string) { return page[len(page)-1].Kind, page[len(page)-1].Key }
+	first, second, third := items[:snapshotPage], items[snapshotPage:2*snapshotPage], items[2*snapshotPage:]
+	kind1, key1 := last(first)
+	kind2, key2 := last(second)
+	gomock.InOrder(
+		repo.EXPECT().Snapshot(gomock.Any(), userID, "", "", snapshotPage).Return(first, nil),
+		repo.EXPECT().Snapshot(gomock.Any(), userID, kind1, key1, snapshotPage).Return(second, nil),
+		repo.EXPECT().Snapshot(gomock.Any(), userID, kind2, key2, snapshotPage).Return(third, nil),
+	)
+
+	var msgs []models.Message
+	require.NoError(t, s.snapshot(context.Background(), userID, int64(len(items)), testDataKey(userID), collect(&msgs)))
+	require.Equal(t, models.SnapshotBegin, msgs[0].Type)
+	require.Equal(t, models.SnapshotEnd, msgs[len(msgs)-1].Type)
+	require.Equal(t, int64(len(items)), msgs[len(msgs)-1].Revision)
+
+	var revisions []int64
+	for _, msg := range msgs[1 : len(msgs)-1] {
+		require.Equal(t, models.SnapshotChunk, msg.Type)
+		var values []models.Message
+		require.NoError(t, json.Unmarshal(msg.Value, &values))
+		if len(msg.Value) > s.chunkSize {
+			// only the item larger than the chunk is sent alone
+			require.Equal(t, 1, len(values))
+			require.Equal(t, int64(snapshotPage+1), values[0].Revision)
+		}
+		for _, value := range values {
+			revisions = append(revisions, value.Revision)
+		}
+	}
+	require.Equal(t, len(items), len(revisions))
+	for i, revision := range revisions {
+		require.Equal(t, int64(i+1), revision)
+	}
 }
 
 func TestSave(t *testing.T) {
@@ -48,20 +199,21 @@ func TestSave(t *testing.T) {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	key := "s5as4d5a#$%#%s6ad545##$%#4353KSFjH"
 	repo := mock_storage.NewMockStorager(c)
-	s := Service{log: log, key: key, storage: repo}
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), indexKey: key, storage: repo}
 	userID := int64(1)
 
 	behavior := func(r *mock_storage.MockStorager, userID int64, msg models.Message) {
-		item := s.convertMessageToItem(userID, msg)
-		r.EXPECT().Save(context.Background(), item).Return(nil)
+		item := newItem(t, s, userID, msg)
+		r.EXPECT().Save(context.Background(), sameItem(s, item), msg.ID).Return(int64(1), nil)
 	}
 
-	msg := models.Message{Type: models.New, Value: []byte(`{"type":"text","tag":"tag1","key":"key1","value":"value 1","comment":"comment","created":1}`)}
+	msg := models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)}
 
 	behavior(repo, userID, msg)
 
-	err := s.Save(context.Background(), userID, msg)
+	revision, err := s.Save(context.Background(), userID, msg)
 	require.NoError(t, err)
+	require.Equal(t, int64(1), revision)
 }
 
 func TestSaveError(t *testing.T) {
@@ -71,18 +223,290 @@ func TestSaveError(t *testing.T) {
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	key := "key"
 	repo := mock_storage.NewMockStorager(c)
-	s := Service{log: log, key: key, storage: repo}
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), indexKey: key, storage: repo}
 	userID := int64(1)
 
 	behavior := func(r *mock_storage.MockStorager, userID int64, msg models.Message) {
-		item := s.convertMessageToItem(userID, msg)
-		r.EXPECT().Save(context.Background(), item).Return(errors.New("saving db error"))
+		item := newItem(t, s, userID, msg)
+		r.EXPECT().Save(context.Background(), sameItem(s, item), msg.ID).Return(int64(0), errors.New("saving db error"))
 	}
 
-	msg := models.Message{Type: models.New, Value: []byte(`{"type":"text","tag":"tag1","key":"key1","value":"value 1","comment":"comment","created":1}`)}
+	msg := models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)}
 
 	behavior(repo, userID, msg)
 
-	err := s.Save(context.Background(), userID, msg)
+	_, err := s.Save(context.Background(), userID, msg)
 	require.ErrorIs(t, err, ErrInternal)
 }
+
+func TestSyncChanges(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	key := "s5as4d5a#$%#%s6ad545##$%#4353KSFjH"
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, key), dataKeys: newTestDataKeys(), indexKey: key, storage: repo, maxChanges: 10}
+	userID := int64(1)
+
+	update := newItem(t, s, userID, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)})
+	update.Revision = 4
+	tombstone := newItem(t, s, userID, models.Message{Type: models.Delete, Value: []byte(`{"type":"t1","key":"k2","data":"BAUG"}`)})
+	tombstone.Revision = 5
+
+	repo.EXPECT().Revision(context.Background(), userID).Return(int64(5), nil)
+	repo.EXPECT().Changes(context.Background(), userID, int64(3)).Return([]storage.Item{update, tombstone}, nil)
+
+	var msgs []models.Message
+	err := s.Sync(context.Background(), userID, 3, collect(&msgs))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, models.Update, msgs[0].Type)
+	require.Equal(t, int64(4), msgs[0].Revision)
+	require.Equal(t, `{"type":"t1","key":"k1","data":"AQID"}`, string(msgs[0].Value))
+	require.Equal(t, models.Delete, msgs[1].Type)
+	require.Equal(t, int64(5), msgs[1].Revision)
+}
+
+func TestSyncFallbackToSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		revision int64
+	}{
+		{name: "no revision", revision: 0},
+		{name: "revision unknown to server", revision: 50},
+		{name: "revision too old", revision: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := gomock.NewController(t)
+			defer c.Finish()
+
+			log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			repo := mock_storage.NewMockStorager(c)
+			s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo, maxChanges: 10}
+			userID := int64(1)
+
+			repo.EXPECT().Revision(context.Background(), userID).Return(int64(20), nil)
+			repo.EXPECT().Snapshot(context.Background(), userID, "", "", snapshotPage).Return([]storage.Item{}, nil)
+			conflict := newItem(t, s, userID, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"BwgJ"}`), BaseRevision: 17})
+			conflict.Revision = 19
+			conflict.Conflict = true
+			repo.EXPECT().Conflicts(context.Background(), userID).Return([]storage.Item{conflict}, nil)
+
+			var msgs []models.Message
+			err := s.Sync(context.Background(), userID, tt.revision, collect(&msgs))
+			require.NoError(t, err)
+			require.Equal(t, 3, len(msgs))
+			require.Equal(t, models.SnapshotBegin, msgs[0].Type)
+			require.Equal(t, models.SnapshotEnd, msgs[1].Type)
+			require.Equal(t, int64(20), msgs[1].Revision)
+			require.Equal(t, models.Conflict, msgs[2].Type)
+			require.Equal(t, int64(19), msgs[2].Revision)
+			require.Equal(t, int64(17), msgs[2].BaseRevision)
+		})
+	}
+}
+
+func TestSaveConflict(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+	userID := int64(1)
+
+	msg := models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"BwgJ"}`), BaseRevision: 3}
+	item := newItem(t, s, userID, msg)
+	require.Equal(t, int64(3), item.BaseRevision)
+	repo.EXPECT().Save(context.Background(), sameItem(s, item), msg.ID).Return(int64(5), fmt.Errorf("storage: %w", storage.ErrConflict))
+
+	revision, err := s.Save(context.Background(), userID, msg)
+	require.ErrorIs(t, err, ErrConflict)
+	require.Equal(t, int64(5), revision)
+}
+
+func TestSaveDuplicate(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+	userID := int64(1)
+
+	msg := models.Message{ID: "request1", Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"BwgJ"}`)}
+	item := newItem(t, s, userID, msg)
+	repo.EXPECT().Save(context.Background(), sameItem(s, item), "request1").Return(int64(4), fmt.Errorf("storage: %w", storage.ErrDuplicate))
+
+	revision, err := s.Save(context.Background(), userID, msg)
+	require.ErrorIs(t, err, ErrDuplicate)
+	require.Equal(t, int64(4), revision)
+}
+
+func TestSaveLegacyDelete(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+	userID := int64(1)
+
+	legacy := models.Message{ID: "request1", Type: models.Delete, Value: []byte(`{"type":"text","key":"k1","data":"BwgJ"}`), BaseRevision: 2}
+	item := newItem(t, s, userID, legacy)
+	gomock.InOrder(
+		repo.EXPECT().Save(context.Background(), sameItem(s, item), "request1").Return(int64(6), nil),
+		repo.EXPECT().PurgeHistory(context.Background(), userID, item.Kind, item.Key, int64(6)).Return(nil),
+	)
+	revision, err := s.Save(context.Background(), userID, legacy)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), revision)
+
+	// replayed deletion purges again: purge may have failed after the deletion was saved
+	gomock.InOrder(
+		repo.EXPECT().Save(context.Background(), sameItem(s, item), "request1").Return(int64(6), fmt.Errorf("storage: %w", storage.ErrDuplicate)),
+		repo.EXPECT().PurgeHistory(context.Background(), userID, item.Kind, item.Key, int64(6)).Return(errors.New("purge db error")),
+	)
+	_, err = s.Save(context.Background(), userID, legacy)
+	require.ErrorIs(t, err, ErrInternal)
+
+	// deletion of the encrypted item keeps its history
+	encrypted := models.Message{ID: "request2", Type: models.Delete, Value: []byte(`{"type":"t1","key":"k1","data":"BwgJ"}`)}
+	repo.EXPECT().Save(context.Background(), sameItem(s, newItem(t, s, userID, encrypted)), "request2").Return(int64(7), nil)
+	_, err = s.Save(context.Background(), userID, encrypted)
+	require.NoError(t, err)
+}
+
+func TestHistory(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo, chunkSize: 1 << 16}
+	userID := int64(1)
+
+	version1 := newItem(t, s, userID, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)})
+	version1.Revision, version1.SavedAt = 1, 100
+	version2 := newItem(t, s, userID, models.Message{Type: models.Delete, Value: []byte(`{"type":"t1","key":"k1","data":"CgsM"}`)})
+	version2.Revision, version2.SavedAt = 4, 200
+
+	request := models.Message{ID: "request-1", Type: models.History, Value: []byte(`{"type":"t1","key":"k1"}`)}
+	item := newItem(t, s, userID, request)
+	repo.EXPECT().History(context.Background(), userID, item.Kind, item.Key, int64(0), snapshotPage).Return([]storage.Item{version1, version2}, nil)
+
+	var msgs []models.Message
+	require.NoError(t, s.History(context.Background(), userID, request, collect(&msgs)))
+	require.Equal(t, []models.MessageType{models.SnapshotBegin, models.SnapshotChunk, models.SnapshotEnd}, messageTypes(msgs))
+	for _, msg := range msgs {
+		require.Equal(t, "request-1", msg.ID)
+	}
+
+	var versions []models.Version
+	require.NoError(t, json.Unmarshal(msgs[1].Value, &versions))
+	require.Equal(t, []models.Version{
+		{Revision: 1, Created: 100, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)},
+		{Revision: 4, Created: 200, Value: []byte(`{"type":"t1","key":"k1","data":"CgsM"}`), Deleted: true},
+	}, versions)
+}
+
+func TestHistoryPages(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo, chunkSize: 1024}
+	userID := int64(1)
+
+	// the full page and the last one, versions do not fit into one chunk
+	versions := make([]storage.Item, 0, snapshotPage+1)
+	for i := 0; i < cap(versions); i++ {
+		version := newItem(t, s, userID, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)})
+		version.Revision = int64(2*i + 1)
+		versions = append(versions, version)
+	}
+	request := models.Message{ID: "request-1", Type: models.History, Value: []byte(`{"type":"t1","key":"k1"}`)}
+	item := newItem(t, s, userID, request)
+	gomock.InOrder(
+		repo.EXPECT().History(gomock.Any(), userID, item.Kind, item.Key, int64(0), snapshotPage).Return(versions[:snapshotPage], nil),
+		repo.EXPECT().History(gomock.Any(), userID, item.Kind, item.Key, versions[snapshotPage-1].Revision, snapshotPage).Return(versions[snapshotPage:], nil),
+	)
+
+	var msgs []models.Message
+	require.NoError(t, s.History(context.Background(), userID, request, collect(&msgs)))
+	require.Equal(t, models.SnapshotBegin, msgs[0].Type)
+	require.Equal(t, models.SnapshotEnd, msgs[len(msgs)-1].Type)
+
+	var revisions []int64
+	for _, msg := range msgs[1 : len(msgs)-1] {
+		require.Equal(t, models.SnapshotChunk, msg.Type)
+		require.Equal(t, "request-1", msg.ID)
+		require.LessOrEqual(t, len(msg.Value), s.chunkSize)
+		var chunk []models.Version
+		require.NoError(t, json.Unmarshal(msg.Value, &chunk))
+		for _, version := range chunk {
+			revisions = append(revisions, version.Revision)
+		}
+	}
+	require.Equal(t, len(versions), len(revisions))
+	require.Equal(t, int64(2*snapshotPage+1), revisions[len(revisions)-1])
+}
+
+func TestHistoryInvalidMessage(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+
+	var msgs []models.Message
+	err := s.History(context.Background(), 1, models.Message{Type: models.History, Value: []byte(`{"type":"t1"}`)}, collect(&msgs))
+	require.ErrorIs(t, err, ErrInvalidMessage)
+	require.Empty(t, msgs)
+}
+
+func TestSnapshotAt(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo, chunkSize: 1 << 16}
+	userID := int64(1)
+
+	item := newItem(t, s, userID, models.Message{Type: models.New, Value: []byte(`{"type":"t1","key":"k1","data":"AQID"}`)})
+	item.Revision = 2
+	repo.EXPECT().SnapshotAt(context.Background(), userID, int64(1717748173), "", "", snapshotPage).Return([]storage.Item{item}, nil)
+
+	request := models.Message{ID: "request-1", Type: models.SnapshotAt, Value: []byte(`{"at":1717748173}`)}
+	var msgs []models.Message
+	require.NoError(t, s.SnapshotAt(context.Background(), userID, request, collect(&msgs)))
+	require.Equal(t, []models.MessageType{models.SnapshotBegin, models.SnapshotChunk, models.SnapshotEnd}, messageTypes(msgs))
+	for _, msg := range msgs {
+		require.Equal(t, "request-1", msg.ID)
+	}
+
+	var values []models.Message
+	require.NoError(t, json.Unmarshal(msgs[1].Value, &values))
+	require.Equal(t, 1, len(values))
+	require.Equal(t, `{"type":"t1","key":"k1","data":"AQID"}`, string(values[0].Value))
+}
+
+func TestSnapshotAtInvalidMessage(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+
+	var msgs []models.Message
+	err := s.SnapshotAt(context.Background(), 1, models.Message{Type: models.SnapshotAt, Value: []byte(`{"at":"yesterday"}`)}, collect(&msgs))
+	require.ErrorIs(t, err, ErrInvalidMessage)
+	require.Empty(t, msgs)
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+	"github.com/dkrasnykh/gophkeeper/pkg/logger/sl"
+	"github.com/dkrasnykh/gophkeeper/pkg/models"
+)
+
+// Rewrap wraps data keys of users again with the current key-encryption key. Data keys are not changed,
+// so rotating the key-encryption key rewrites one row per user, not the items.
+// Keys are read in batches while the server keeps serving, the number of rewrapped keys and the number of keys
+// which were not rewrapped (they are not unwrapped) are returned. It is safe to run it again.
+func (s *Service) Rewrap(ctx context.Context, batch int) (done int64, failed int64, err error) {
+	const op = "servicekeeper.Rewrap"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	info, err := s.keys.Keys(ctx)
+	if err != nil {
+		log.Error("query key-encryption keys error", sl.Err(err))
+		return 0, 0, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	log = log.With(slog.String("key_id", info.Current))
+
+	var userID int64
+	for {
+		keys, err := s.storage.StaleUserKeys(ctx, info.Current, userID, batch)
+		if err != nil {
+			log.Error("query stale data keys error", sl.Err(err))
+			return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+		if len(keys) == 0 {
+			break
+		}
+
+		for _, key := range keys {
+			userID = key.UserID
+
+			dataKey, err := s.keys.Decrypt(ctx, key.Wrapped, userKeyAD(key.UserID))
+			if err != nil {
+				log.Error("unwrap data key error", slog.Int64("user_id", key.UserID), sl.Err(err))
+				failed++
+				continue
+			}
+			key.Wrapped, key.KeyID, err = s.keys.Encrypt(ctx, dataKey, userKeyAD(key.UserID))
+			if err != nil {
+				log.Error("wrap data key error", sl.Err(err))
+				return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+			}
+			if err = s.storage.RewrapUserKey(ctx, key); err != nil {
+				log.Error("save rewrapped data key error", sl.Err(err))
+				return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+			}
+			done++
+		}
+		log.Info("data keys rewrapped", slog.Int64("done", done), slog.Int64("failed", failed))
+	}
+
+	return done, failed, nil
+}
+
+// Reencrypt encrypts data of the rows saved before data keys again with the data key of the user,
+// the data is bound to its row too. Rows are read in batches while the server keeps serving,
+// the number of re-encrypted rows and the number of rows which were not re-encrypted (their data is not decrypted)
+// are returned. Up to date rows are not changed, so it is safe to run it again.
+// After all rows are re-encrypted the old keys can be retired and the service can be started with requireBound.
+func (s *Service) Reencrypt(ctx context.Context, batch int) (done int64, failed int64, err error) {
+	const op = "servicekeeper.Reencrypt"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	var userID, revision int64
+	for {
+		items, err := s.storage.Stale(ctx, userID, revision, batch)
+		if err != nil {
+			log.Error("query stale items error", sl.Err(err))
+			return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			userID, revision = item.UserID, item.Revision
+
+			reencrypted, err := s.reencryptItem(ctx, item)
+			if err != nil {
+				// row is skipped, it is reported on every read until it is fixed or deleted
+				log.Error("re-encrypt item error",
+					slog.Int64("user_id", item.UserID),
+					slog.Int64("revision", item.Revision),
+					sl.Err(err),
+				)
+				failed++
+				continue
+			}
+			if err = s.storage.Rewrite(ctx, reencrypted); err != nil {
+				log.Error("save re-encrypted item error", sl.Err(err))
+				return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+			}
+			done++
+		}
+		log.Info("items re-encrypted", slog.Int64("done", done), slog.Int64("failed", failed))
+	}
+
+	return done, failed, nil
+}
+
+// reencryptItem encrypts data of the row with the data key of the user and the row associated data.
+func (s *Service) reencryptItem(ctx context.Context, item storage.Item) (storage.Item, error) {
+	dataKey, err := s.dataKey(ctx, item.UserID, true)
+	if err != nil {
+		return storage.Item{}, err
+	}
+	kind, key, err := s.itemIdentity(item, dataKey)
+	if err != nil {
+		return storage.Item{}, err
+	}
+
+	ad := associatedData(item.UserID, kind, key)
+	var data []byte
+	if item.Bound {
+		data, err = s.keys.Decrypt(ctx, item.Data, ad)
+	} else {
+		data, err = s.keys.Decrypt(ctx, item.Data, nil)
+	}
+	if err != nil {
+		return storage.Item{}, err
+	}
+
+	item.Data, err = encrypt.Encrypt(data, string(dataKey), ad)
+	if err != nil {
+		return storage.Item{}, err
+	}
+	item.Bound = true
+	item.UserKey = true
+	item.KeyID = ""
+	return item, nil
+}
+
+// Reindex replaces item identifiers of the rows saved before blind indexes (type and key encrypted deterministically)
+// with blind indexes and encrypts the identifiers with the data key of the user.
+// Rows of an item are found by their identifiers, so all rows are reindexed before the service starts serving
+// (see CheckIndexed): the number of reindexed rows and the number of rows which were not reindexed (their identifiers
+// are not decrypted) are returned. Indexed rows are not changed, so the interrupted run is continued by the next one.
+func (s *Service) Reindex(ctx context.Context, batch int) (done int64, failed int64, err error) {
+	const op = "servicekeeper.Reindex"
+	log := s.log.With(
+		slog.String("op", op),
+	)
+
+	var userID, revision int64
+	for {
+		items, err := s.storage.Unindexed(ctx, userID, revision, batch)
+		if err != nil {
+			log.Error("query unindexed items error", sl.Err(err))
+			return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			userID, revision = item.UserID, item.Revision
+
+			indexed, err := s.reindexItem(ctx, item)
+			if err != nil {
+				log.Error("reindex item error",
+					slog.Int64("user_id", item.UserID),
+					slog.Int64("revision", item.Revision),
+					sl.Err(err),
+				)
+				failed++
+				continue
+			}
+			if err = s.storage.Reindex(ctx, indexed); err != nil {
+				log.Error("save reindexed item error", sl.Err(err))
+				return done, failed, fmt.Errorf("%s: %w", op, ErrInternal)
+			}
+			done++
+		}
+		log.Info("items reindexed", slog.Int64("done", done), slog.Int64("failed", failed))
+	}
+
+	return done, failed, nil
+}
+
+// reindexItem replaces deterministically encrypted identifiers of the row with blind indexes and the encrypted identity.
+// Data of the row is bound to the identifiers, not to the columns, so it is not changed.
+func (s *Service) reindexItem(ctx context.Context, item storage.Item) (storage.Item, error) {
+	kind, key, err := s.itemIdentity(item, nil)
+	if err != nil {
+		return storage.Item{}, err
+	}
+	dataKey, err := s.dataKey(ctx, item.UserID, true)
+	if err != nil {
+		return storage.Item{}, err
+	}
+
+	env := models.Envelope{Type: kind, Key: key}
+	item.Kind, item.Key = s.blindIdentity(env)
+	item.Identity, err = encryptIdentity(item.UserID, item.Kind, item.Key, env, dataKey)
+	if err != nil {
+		return storage.Item{}, err
+	}
+	item.Indexed = true
+	return item, nil
+}
+
+// KeyUsage returns the number of references to key-encryption keys by key ID: wrapped data keys and rows
+// saved before data keys. Rows saved before key IDs are counted for the legacy key.
+func (s *Service) KeyUsage(ctx context.Context) (map[string]int64, error) {
+	const op = "servicekeeper.KeyUsage"
+
+	info, err := s.keys.Keys(ctx)
+	if err != nil {
+		s.log.Error("query key-encryption keys error", slog.String("op", op), sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	usage, err := s.storage.KeyUsage(ctx)
+	if err != nil {
+		s.log.Error("query key usage error", slog.String("op", op), sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+
+	res := make(map[string]int64, len(usage))
+	for id, count := range usage {
+		if id == "" {
+			id = info.Legacy
+		}
+		res[id] += count
+	}
+	return res, nil
+}
+
+// CheckKeys checks every key still referenced is held by the key provider: the key in use must not be retired.
+func (s *Service) CheckKeys(ctx context.Context) error {
+	const op = "servicekeeper.CheckKeys"
+
+	info, err := s.keys.Keys(ctx)
+	if err != nil {
+		s.log.Error("query key-encryption keys error", slog.String("op", op), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	usage, err := s.KeyUsage(ctx)
+	if err != nil {
+		return err
+	}
+	for id, count := range usage {
+		if !slices.Contains(info.IDs, id) {
+			s.log.Error("items are encrypted with retired key",
+				slog.String("op", op),
+				slog.String("key_id", id),
+				slog.Int64("references", count),
+			)
+			return fmt.Errorf("%s: key %q: %w", op, id, ErrRetiredKey)
+		}
+	}
+	return nil
+}
+
+// CheckIndexed checks no rows saved before blind indexes are left: rows of an item are found by the blind indexes,
+// unindexed rows would be served as other items.
+func (s *Service) CheckIndexed(ctx context.Context) error {
+	const op = "servicekeeper.CheckIndexed"
+
+	items, err := s.storage.Unindexed(ctx, 0, 0, 1)
+	if err != nil {
+		s.log.Error("query unindexed items error", slog.String("op", op), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInternal)
+	}
+	if len(items) > 0 {
+		s.log.Error("items saved before blind indexes are left, run reindex", slog.String("op", op))
+		return fmt.Errorf("%s: %w", op, ErrUnindexed)
+	}
+	return nil
+}
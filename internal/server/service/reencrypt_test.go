@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dkrasnykh/gophkeeper/internal/server/kek"
+	"github.com/dkrasnykh/gophkeeper/internal/server/storage"
+	mock_storage "github.com/dkrasnykh/gophkeeper/internal/server/storage/mocks"
+	"github.com/dkrasnykh/gophkeeper/pkg/encrypt"
+)
+
+func newRotatedKeyring(t *testing.T) (*encrypt.Keyring, *kek.File) {
+	keys, err := encrypt.NewKeyring(map[string]string{"1": "first secret", "2": "second secret"}, "2", "1")
+	require.NoError(t, err)
+	return keys, kek.NewKeyring(keys)
+}
+
+func TestReencrypt(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	keys, provider := newRotatedKeyring(t)
+	s := Service{log: log, keys: provider, dataKeys: newTestDataKeys(), indexKey: "index", legacyKey: "first secret", storage: repo,
+		requireBound: true}
+
+	// item saved with the server key before data keys and item saved before binding and key IDs
+	kind, key := encrypt.EncodeMsg([]byte("t1"), s.legacyKey), encrypt.EncodeMsg([]byte("k1"), s.legacyKey)
+	data, err := keys.Encrypt([]byte{1, 2, 3}, associatedData(1, "t1", "k1"))
+	require.NoError(t, err)
+	item1 := storage.Item{UserID: 1, Kind: kind, Key: key, Data: data, Revision: 1, Bound: true, KeyID: "2"}
+	data, err = encrypt.Encrypt([]byte{4, 5, 6}, "first secret", nil)
+	require.NoError(t, err)
+	item2 := storage.Item{UserID: 2, Kind: kind, Key: key, Data: data, Revision: 1}
+	broken := storage.Item{UserID: 2, Kind: kind, Key: key, Data: []byte("broken"), Revision: 2}
+
+	var saved []storage.Item
+	gomock.InOrder(
+		repo.EXPECT().Stale(gomock.Any(), int64(0), int64(0), 2).Return([]storage.Item{item1, item2}, nil),
+		repo.EXPECT().Rewrite(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, item storage.Item) error {
+			saved = append(saved, item)
+			return nil
+		}).Times(2),
+		repo.EXPECT().Stale(gomock.Any(), int64(2), int64(1), 2).Return([]storage.Item{broken}, nil),
+		repo.EXPECT().Stale(gomock.Any(), int64(2), int64(2), 2).Return(nil, nil),
+	)
+
+	done, failed, err := s.Reencrypt(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), done)
+	assert.Equal(t, int64(1), failed)
+
+	require.Len(t, saved, 2)
+	for _, item := range saved {
+		assert.True(t, item.Bound)
+		assert.True(t, item.UserKey)
+		assert.Empty(t, item.KeyID)
+	}
+	msg, err := s.convertItemToMessage(context.Background(), saved[1], testDataKey(2))
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"t1","key":"k1","data":"BAUG"}`, string(msg.Value))
+
+	// re-encrypted data is still bound to its row
+	saved[0].UserID = 2
+	_, err = s.convertItemToMessage(context.Background(), saved[0], testDataKey(1))
+	assert.ErrorIs(t, err, encrypt.ErrDecrypt)
+}
+
+func TestReindex(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "index", legacyKey: "key", storage: repo}
+
+	// item saved before blind indexes
+	data, err := encrypt.Encrypt([]byte{1, 2, 3}, string(testDataKey(1)), associatedData(1, "t1", "k1"))
+	require.NoError(t, err)
+	item := storage.Item{UserID: 1, Kind: encrypt.EncodeMsg([]byte("t1"), s.legacyKey), Key: encrypt.EncodeMsg([]byte("k1"), s.legacyKey),
+		Data: data, Revision: 1, Bound: true, UserKey: true}
+	broken := storage.Item{UserID: 1, Kind: "broken", Key: item.Key, Data: data, Revision: 2}
+
+	var saved storage.Item
+	gomock.InOrder(
+		repo.EXPECT().Unindexed(gomock.Any(), int64(0), int64(0), 10).Return([]storage.Item{item, broken}, nil),
+		repo.EXPECT().Reindex(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, item storage.Item) error {
+			saved = item
+			return nil
+		}),
+		repo.EXPECT().Unindexed(gomock.Any(), int64(1), int64(2), 10).Return(nil, nil),
+	)
+
+	done, failed, err := s.Reindex(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), done)
+	assert.Equal(t, int64(1), failed)
+
+	assert.True(t, saved.Indexed)
+	assert.Equal(t, encrypt.BlindIndex("index", "type", "t1"), saved.Kind)
+	assert.Equal(t, encrypt.BlindIndex("index", "key", "k1"), saved.Key)
+	assert.Equal(t, data, saved.Data)
+
+	msg, err := s.convertItemToMessage(context.Background(), saved, testDataKey(1))
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"t1","key":"k1","data":"AQID"}`, string(msg.Value))
+}
+
+func TestReencryptStorageError(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "key", storage: repo}
+
+	repo.EXPECT().Stale(gomock.Any(), int64(0), int64(0), 10).Return(nil, errors.New("query error"))
+
+	_, _, err := s.Reencrypt(context.Background(), 10)
+	assert.ErrorIs(t, err, ErrInternal)
+}
+
+func TestRewrap(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	keys, provider := newRotatedKeyring(t)
+	s := Service{log: log, keys: provider, dataKeys: newDataKeys(0), storage: repo}
+
+	old, err := encrypt.NewKeyring(map[string]string{"1": "first secret"}, "1", "")
+	require.NoError(t, err)
+	wrapped, err := old.Encrypt(testDataKey(1), userKeyAD(1))
+	require.NoError(t, err)
+	// data key moved to another user is not unwrapped
+	moved, err := old.Encrypt(testDataKey(1), userKeyAD(1))
+	require.NoError(t, err)
+
+	var rewrapped []storage.UserKey
+	gomock.InOrder(
+		repo.EXPECT().StaleUserKeys(gomock.Any(), "2", int64(0), 10).Return([]storage.UserKey{
+			{UserID: 1, Wrapped: wrapped, KeyID: "1"},
+			{UserID: 3, Wrapped: moved, KeyID: "1"},
+		}, nil),
+		repo.EXPECT().RewrapUserKey(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, key storage.UserKey) error {
+			rewrapped = append(rewrapped, key)
+			return nil
+		}),
+		repo.EXPECT().StaleUserKeys(gomock.Any(), "2", int64(3), 10).Return(nil, nil),
+	)
+
+	done, failed, err := s.Rewrap(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), done)
+	assert.Equal(t, int64(1), failed)
+
+	require.Len(t, rewrapped, 1)
+	assert.Equal(t, "2", rewrapped[0].KeyID)
+	id, err := keys.KeyID(rewrapped[0].Wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "2", id)
+	dataKey, err := keys.Decrypt(rewrapped[0].Wrapped, userKeyAD(1))
+	require.NoError(t, err)
+	assert.Equal(t, testDataKey(1), dataKey)
+}
+
+func TestCheckKeys(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	keys, err := encrypt.NewKeyring(map[string]string{"2": "second secret", "3": "third secret"}, "3", "2")
+	require.NoError(t, err)
+	s := Service{log: log, keys: kek.NewKeyring(keys), storage: repo}
+
+	// rows saved before key IDs are counted for the legacy key
+	repo.EXPECT().KeyUsage(gomock.Any()).Return(map[string]int64{"": 1, "2": 2, "3": 5}, nil)
+	usage, err := s.KeyUsage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"2": 3, "3": 5}, usage)
+
+	repo.EXPECT().KeyUsage(gomock.Any()).Return(map[string]int64{"2": 2, "3": 5}, nil)
+	assert.NoError(t, s.CheckKeys(context.Background()))
+
+	// key 1 is retired while rows are still encrypted with it
+	repo.EXPECT().KeyUsage(gomock.Any()).Return(map[string]int64{"1": 1, "3": 5}, nil)
+	assert.ErrorIs(t, s.CheckKeys(context.Background()), ErrRetiredKey)
+}
+
+func TestCheckIndexed(t *testing.T) {
+	c := gomock.NewController(t)
+	defer c.Finish()
+
+	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	repo := mock_storage.NewMockStorager(c)
+	s := Service{log: log, keys: newKeyring(t, "key"), dataKeys: newTestDataKeys(), indexKey: "index", storage: repo}
+
+	repo.EXPECT().Unindexed(gomock.Any(), int64(0), int64(0), 1).Return(nil, nil)
+	assert.NoError(t, s.CheckIndexed(context.Background()))
+
+	repo.EXPECT().Unindexed(gomock.Any(), int64(0), int64(0), 1).Return([]storage.Item{{UserID: 1, Revision: 1}}, nil)
+	assert.ErrorIs(t, s.CheckIndexed(context.Background()), ErrUnindexed)
+
+	repo.EXPECT().Unindexed(gomock.Any(), int64(0), int64(0), 1).Return(nil, errors.New("query error"))
+	assert.ErrorIs(t, s.CheckIndexed(context.Background()), ErrInternal)
+}
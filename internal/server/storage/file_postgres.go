@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveChunk saves the file chunk, chunk sent again (upload resumed after the response was lost) replaces the saved one.
+func (s *KeeperPostgres) SaveChunk(ctx context.Context, chunk Chunk) error {
+	const op = "storage.postgres.SaveChunk"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.db.Exec(newCtx,
+		`INSERT INTO file_chunk (user_id, file_id, n, data, hash) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, file_id, n) DO UPDATE SET data=excluded.data, hash=excluded.hash, created_at=now()`,
+		chunk.UserID, chunk.FileID, chunk.N, chunk.Data, chunk.Hash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Chunk returns the file chunk of the user, ErrNotFound is returned if it was not uploaded.
+func (s *KeeperPostgres) Chunk(ctx context.Context, userID int64, fileID string, n int) (Chunk, error) {
+	const op = "storage.postgres.Chunk"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	chunk := Chunk{UserID: userID, FileID: fileID, N: n}
+	err := s.db.QueryRow(newCtx, "SELECT data, hash FROM file_chunk WHERE user_id=$1 AND file_id=$2 AND n=$3",
+		userID, fileID, n).Scan(&chunk.Data, &chunk.Hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Chunk{}, fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	if err != nil {
+		return Chunk{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return chunk, nil
+}
+
+// Chunks returns numbers of the uploaded chunks of the file in ascending order, upload is resumed from the missing ones.
+func (s *KeeperPostgres) Chunks(ctx context.Context, userID int64, fileID string) ([]int, error) {
+	const op = "storage.postgres.Chunks"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx, "SELECT n FROM file_chunk WHERE user_id=$1 AND file_id=$2 ORDER BY n", userID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// CollectChunks deletes at most limit chunks saved before the time whose file is not referenced by any row version.
+// Chunks of a file being uploaded are not referenced until the item is saved, before gives the upload time to finish.
+// It returns the number of deleted chunks, chunks are deleted in batches until none is left.
+func (s *KeeperPostgres) CollectChunks(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "storage.postgres.CollectChunks"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tag, err := s.db.Exec(newCtx,
+		`DELETE FROM file_chunk WHERE ctid IN (
+			SELECT c.ctid FROM file_chunk c
+			WHERE c.collectable AND c.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM store_file f WHERE f.user_id=c.user_id AND f.file_id=c.file_id)
+			LIMIT $2)`,
+		before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ReferencedBlobs returns the blobs of refs referenced by a saved chunk.
+func (s *KeeperPostgres) ReferencedBlobs(ctx context.Context, refs []BlobRef) ([]BlobRef, error) {
+	const op = "storage.postgres.ReferencedBlobs"
+
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	users := make([]int64, 0, len(refs))
+	hashes := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		users = append(users, ref.UserID)
+		hashes = append(hashes, ref.Hash)
+	}
+
+	rows, err := s.db.Query(newCtx,
+		`SELECT r.user_id, r.hash FROM unnest($1::BIGINT[], $2::VARCHAR[]) AS r(user_id, hash)
+		WHERE EXISTS (SELECT 1 FROM file_chunk c WHERE c.user_id=r.user_id AND c.hash=r.hash)`,
+		users, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowToStructByPos[BlobRef])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -22,17 +23,24 @@ func NewKeeperPostgres(db *pgxpool.Pool, timeout time.Duration) *KeeperPostgres
 	}
 }
 
-// Snapshot collect all actual user data with unique keys.
-func (s *KeeperPostgres) Snapshot(ctx context.Context, userID int64) ([]Item, error) {
+// Snapshot collect actual user data with unique keys ordered by type and key, up to limit items
+// after the item (kind, key). Empty kind and key start from the first item, the page ends when fewer items are returned.
+// The actual version of a key is the one with the latest revision, conflict versions are skipped.
+// Keys whose latest version is a tombstone are skipped.
+// Actual versions are found by store_current, so the cost depends on the number of items, not on the history.
+func (s *KeeperPostgres) Snapshot(ctx context.Context, userID int64, kind string, key string, limit int) ([]Item, error) {
 	const op = "storage.postgres.Snapshot"
 
 	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	rows, err := s.db.Query(newCtx,
-		`select (t1.user_id, t1.type, t1.key, s.data, t1.created_at_client) from
-		(select user_id, type, key, max(created_at_client) as created_at_client from store where user_id=$1 group by user_id, type, key) as t1
-		left join store as s ON t1.type = s.type AND t1.key = s.key AND t1.created_at_client=s.created_at_client`, userID)
+		`select (s.user_id, s.type, s.key, s.data, s.created_at_client, s.deleted, s.revision, s.base_revision, s.conflict, extract(epoch from s.created_at)::bigint, s.bound, s.key_id, s.user_key, s.ident, s.indexed) from store_current as c
+		join store as s on s.user_id=c.user_id and s.revision=c.revision
+		where c.user_id=$1 and (c.type, c.key) > ($2, $3) and not c.deleted order by c.type, c.key limit $4`, userID, kind, key, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
 	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
 	if err != nil {
@@ -41,18 +49,478 @@ func (s *KeeperPostgres) Snapshot(ctx context.Context, userID int64) ([]Item, er
 	return res, nil
 }
 
-// Save method insert into database user encrypted message.
-func (s *KeeperPostgres) Save(ctx context.Context, item Item) error {
-	const op = "storage.postgres.Save"
+// SnapshotAt collect user data as it was at the moment (server time), up to limit items after the item (kind, key).
+// Versions saved after the moment are ignored, otherwise it is the same as Snapshot.
+// The moment is unix seconds, compared with SavedAt: versions saved during that second are included.
+// Past versions are found in the history.
+func (s *KeeperPostgres) SnapshotAt(ctx context.Context, userID int64, at int64, kind string, key string, limit int) ([]Item, error) {
+	const op = "storage.postgres.SnapshotAt"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		`select (user_id, type, key, data, created_at_client, deleted, revision, base_revision, conflict, extract(epoch from created_at)::bigint, bound, key_id, user_key, ident, indexed) from
+		(select distinct on (type, key) * from store where user_id=$1 and not conflict and created_at < to_timestamp($2::bigint + 1) and (type, key) > ($3, $4)
+		order by type, key, revision desc) as latest
+		where not deleted order by type, key limit $5`, userID, at, kind, key, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// Conflicts collect conflict versions which were not resolved by a later write to the same key.
+func (s *KeeperPostgres) Conflicts(ctx context.Context, userID int64) ([]Item, error) {
+	const op = "storage.postgres.Conflicts"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		`select (c.user_id, c.type, c.key, c.data, c.created_at_client, c.deleted, c.revision, c.base_revision, c.conflict, extract(epoch from c.created_at)::bigint, c.bound, c.key_id, c.user_key, c.ident, c.indexed) from store as c
+		left join store_current as h on h.user_id=c.user_id and h.type=c.type and h.key=c.key
+		where c.user_id=$1 and c.conflict and c.revision > coalesce(h.revision, 0)
+		order by c.revision`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// Changes collect all user rows (tombstones included) saved after the revision, ordered by revision.
+func (s *KeeperPostgres) Changes(ctx context.Context, userID int64, revision int64) ([]Item, error) {
+	const op = "storage.postgres.Changes"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		`select (user_id, type, key, data, created_at_client, deleted, revision, base_revision, conflict, extract(epoch from created_at)::bigint, bound, key_id, user_key, ident, indexed) from store
+		where user_id=$1 and revision>$2 order by revision`, userID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// History collect versions of the user item (tombstones and conflicts included) saved after the revision,
+// up to limit versions ordered by revision.
+func (s *KeeperPostgres) History(ctx context.Context, userID int64, kind string, key string, revision int64, limit int) ([]Item, error) {
+	const op = "storage.postgres.History"
 
 	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	_, err := s.db.Exec(newCtx, "INSERT INTO store (user_id, type, key, data, created_at_client) values ($1, $2, $3, $4, $5);",
-		item.UserID, item.Kind, item.Key, item.Data, item.CreatedAt)
+	rows, err := s.db.Query(newCtx,
+		`select (user_id, type, key, data, created_at_client, deleted, revision, base_revision, conflict, extract(epoch from created_at)::bigint, bound, key_id, user_key, ident, indexed) from store
+		where user_id=$1 and type=$2 and key=$3 and revision>$4 order by revision limit $5`, userID, kind, key, revision, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
+	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// Stale collect rows whose data is not encrypted with the data key of the user,
+// ordered by user and revision, starting after the row (userID, revision).
+func (s *KeeperPostgres) Stale(ctx context.Context, userID int64, revision int64, limit int) ([]Item, error) {
+	const op = "storage.postgres.Stale"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		`select (user_id, type, key, data, created_at_client, deleted, revision, base_revision, conflict, extract(epoch from created_at)::bigint, bound, key_id, user_key, ident, indexed) from store
+		where not user_key and (user_id, revision) > ($1, $2) order by user_id, revision limit $3`, userID, revision, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// Rewrite replaces data of the row encrypted again, the row is found by user and revision.
+// Other columns of the row are changed only by Reindex: the store is append-only for them.
+func (s *KeeperPostgres) Rewrite(ctx context.Context, item Item) error {
+	const op = "storage.postgres.Rewrite"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.db.Exec(newCtx,
+		"UPDATE store SET data=$1, bound=$2, key_id=$3, user_key=$4 WHERE user_id=$5 AND revision=$6",
+		item.Data, item.Bound, item.KeyID, item.UserKey, item.UserID, item.Revision)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	return nil
 }
+
+// Unindexed collect rows saved before blind indexes, ordered by user and revision, starting after the row (userID, revision).
+func (s *KeeperPostgres) Unindexed(ctx context.Context, userID int64, revision int64, limit int) ([]Item, error) {
+	const op = "storage.postgres.Unindexed"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		`select (user_id, type, key, data, created_at_client, deleted, revision, base_revision, conflict, extract(epoch from created_at)::bigint, bound, key_id, user_key, ident, indexed) from store
+		where not indexed and (user_id, revision) > ($1, $2) order by user_id, revision limit $3`, userID, revision, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowTo[Item])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// Reindex replaces item identifiers of the row with blind indexes and the encrypted identifiers,
+// the row is found by user and revision.
+func (s *KeeperPostgres) Reindex(ctx context.Context, item Item) error {
+	const op = "storage.postgres.Reindex"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.Begin(newCtx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(newCtx)
+
+	_, err = tx.Exec(newCtx,
+		"UPDATE store SET type=$1, key=$2, ident=$3, indexed=$4 WHERE user_id=$5 AND revision=$6",
+		item.Kind, item.Key, item.Identity, item.Indexed, item.UserID, item.Revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// the latest version of the item is found by the identifiers too
+	_, err = tx.Exec(newCtx,
+		"UPDATE store_current SET type=$1, key=$2 WHERE user_id=$3 AND revision=$4",
+		item.Kind, item.Key, item.UserID, item.Revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(newCtx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// KeyUsage counts references to key-encryption keys by key ID: wrapped data keys and rows encrypted
+// with the server key before data keys. Rows saved before key IDs are counted with empty key ID.
+func (s *KeeperPostgres) KeyUsage(ctx context.Context) (map[string]int64, error) {
+	const op = "storage.postgres.KeyUsage"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		`SELECT key_id, sum(n)::bigint FROM
+		(SELECT key_id, count(*) AS n FROM store WHERE NOT user_key GROUP BY key_id
+		UNION ALL SELECT kek_id, count(*) FROM user_key GROUP BY kek_id) AS usage
+		GROUP BY key_id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	res := make(map[string]int64)
+	for rows.Next() {
+		var (
+			keyID string
+			count int64
+		)
+		if err = rows.Scan(&keyID, &count); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res[keyID] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// UserKey returns the wrapped data key of the user, ErrNotFound is returned if the user has no key.
+func (s *KeeperPostgres) UserKey(ctx context.Context, userID int64) (UserKey, error) {
+	const op = "storage.postgres.UserKey"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	key := UserKey{UserID: userID}
+	err := s.db.QueryRow(newCtx, "SELECT wrapped, kek_id FROM user_key WHERE user_id=$1", userID).Scan(&key.Wrapped, &key.KeyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UserKey{}, fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	if err != nil {
+		return UserKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return key, nil
+}
+
+// SaveUserKey saves the wrapped data key of the user if the user has no key yet, the saved key is returned:
+// if keys were created concurrently the first saved key is kept.
+func (s *KeeperPostgres) SaveUserKey(ctx context.Context, key UserKey) (UserKey, error) {
+	const op = "storage.postgres.SaveUserKey"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.db.Exec(newCtx,
+		"INSERT INTO user_key (user_id, wrapped, kek_id) VALUES ($1, $2, $3) ON CONFLICT (user_id) DO NOTHING",
+		key.UserID, key.Wrapped, key.KeyID)
+	if err != nil {
+		return UserKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	saved := UserKey{UserID: key.UserID}
+	err = s.db.QueryRow(newCtx, "SELECT wrapped, kek_id FROM user_key WHERE user_id=$1", key.UserID).Scan(&saved.Wrapped, &saved.KeyID)
+	if err != nil {
+		return UserKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return saved, nil
+}
+
+// StaleUserKeys collect data keys wrapped by another key than keyID, ordered by user, starting after the user.
+func (s *KeeperPostgres) StaleUserKeys(ctx context.Context, keyID string, userID int64, limit int) ([]UserKey, error) {
+	const op = "storage.postgres.StaleUserKeys"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	rows, err := s.db.Query(newCtx,
+		"SELECT user_id, wrapped, kek_id FROM user_key WHERE kek_id<>$1 AND user_id>$2 ORDER BY user_id LIMIT $3",
+		keyID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := pgx.CollectRows(rows, pgx.RowToStructByPos[UserKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return res, nil
+}
+
+// RewrapUserKey replaces the wrapped data key of the user, the data key itself is the same.
+func (s *KeeperPostgres) RewrapUserKey(ctx context.Context, key UserKey) error {
+	const op = "storage.postgres.RewrapUserKey"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	_, err := s.db.Exec(newCtx, "UPDATE user_key SET wrapped=$1, kek_id=$2 WHERE user_id=$3", key.Wrapped, key.KeyID, key.UserID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteUser deletes the data key, the rows and the file chunks of the user, blobs of the chunks are collected later.
+// Copies of the rows (backups) encrypted with the data key can not be decrypted after that. User revision is kept, so revisions known to clients are never reused.
+func (s *KeeperPostgres) DeleteUser(ctx context.Context, userID int64) error {
+	const op = "storage.postgres.DeleteUser"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.Begin(newCtx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(newCtx)
+
+	for _, query := range []string{
+		"DELETE FROM user_key WHERE user_id=$1",
+		"DELETE FROM store_current WHERE user_id=$1",
+		"DELETE FROM store WHERE user_id=$1",
+		"DELETE FROM request WHERE user_id=$1",
+		"DELETE FROM store_file WHERE user_id=$1",
+		"DELETE FROM file_chunk WHERE user_id=$1",
+	} {
+		if _, err = tx.Exec(newCtx, query, userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(newCtx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// PurgeHistory deletes the versions of the item saved before the revision, conflict versions included, and forgets
+// the files referenced by them, their chunks are collected when no other version references them.
+// The version with the revision (the tombstone) is kept, so clients behind it still receive the deletion.
+func (s *KeeperPostgres) PurgeHistory(ctx context.Context, userID int64, kind string, key string, revision int64) error {
+	const op = "storage.postgres.PurgeHistory"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.Begin(newCtx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(newCtx)
+
+	_, err = tx.Exec(newCtx,
+		`DELETE FROM store_file WHERE user_id=$1 AND revision IN
+		(SELECT revision FROM store WHERE user_id=$1 AND type=$2 AND key=$3 AND revision < $4)`,
+		userID, kind, key, revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(newCtx,
+		"DELETE FROM store WHERE user_id=$1 AND type=$2 AND key=$3 AND revision < $4", userID, kind, key, revision)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(newCtx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Revision returns the latest revision assigned to the user rows, 0 if user has no rows.
+func (s *KeeperPostgres) Revision(ctx context.Context, userID int64) (int64, error) {
+	const op = "storage.postgres.Revision"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var revision int64
+	err := s.db.QueryRow(newCtx, "SELECT coalesce(max(revision), 0) FROM user_revision WHERE user_id=$1", userID).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return revision, nil
+}
+
+// Save method insert into database user encrypted message.
+// Deleting an item is also an insert: a tombstone row with deleted flag.
+// Every saved row gets the next user revision, the revision is returned.
+// If the key was changed after the item base revision, the item is saved as a conflict version
+// and ErrConflict is returned with the revision of the conflict version.
+// Request ID is remembered with the revision, if the request was already saved (client replayed it)
+// nothing is inserted and ErrDuplicate is returned with the revision saved before.
+// The row is appended to the history, store_current is pointed to it unless it is a conflict version.
+// Files referenced by the item are remembered with the revision, their chunks are not collected.
+func (s *KeeperPostgres) Save(ctx context.Context, item Item, requestID string, files ...string) (int64, error) {
+	const op = "storage.postgres.Save"
+
+	newCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.Begin(newCtx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(newCtx)
+
+	// updating user_revision row locks it, so saves of the same user are serialized
+	var revision int64
+	err = tx.QueryRow(newCtx,
+		`INSERT INTO user_revision (user_id, revision) VALUES ($1, 1)
+		ON CONFLICT (user_id) DO UPDATE SET revision = user_revision.revision + 1
+		RETURNING revision`, item.UserID).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if requestID != "" {
+		var saved int64
+		err = tx.QueryRow(newCtx,
+			"SELECT revision FROM request WHERE user_id=$1 AND request_id=$2", item.UserID, requestID).Scan(&saved)
+		if err == nil {
+			return saved, fmt.Errorf("%s: %w", op, ErrDuplicate)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var head int64
+	err = tx.QueryRow(newCtx,
+		"SELECT coalesce((SELECT revision FROM store_current WHERE user_id=$1 AND type=$2 AND key=$3), 0)",
+		item.UserID, item.Kind, item.Key).Scan(&head)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	item.Conflict = head != item.BaseRevision
+
+	_, err = tx.Exec(newCtx,
+		`INSERT INTO store (user_id, type, key, data, created_at_client, deleted, revision, base_revision, conflict, bound, key_id, user_key, ident, indexed)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14);`,
+		item.UserID, item.Kind, item.Key, item.Data, item.CreatedAt, item.Deleted, revision, item.BaseRevision, item.Conflict, item.Bound, item.KeyID, item.UserKey,
+		item.Identity, item.Indexed)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !item.Conflict {
+		_, err = tx.Exec(newCtx,
+			`INSERT INTO store_current (user_id, type, key, revision, deleted) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id, type, key) DO UPDATE SET revision = excluded.revision, deleted = excluded.deleted`,
+			item.UserID, item.Kind, item.Key, revision, item.Deleted)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	for _, file := range files {
+		_, err = tx.Exec(newCtx,
+			"INSERT INTO store_file (user_id, file_id, revision) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+			item.UserID, file, revision)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if requestID != "" {
+		_, err = tx.Exec(newCtx,
+			"INSERT INTO request (user_id, request_id, revision) values ($1, $2, $3);", item.UserID, requestID, revision)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = tx.Commit(newCtx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if item.Conflict {
+		return revision, fmt.Errorf("%s: %w", op, ErrConflict)
+	}
+	return revision, nil
+}
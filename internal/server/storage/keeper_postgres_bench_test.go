@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const benchItems = 100
+
+// benchEdits is the number of versions of every item: snapshot cost must not grow with it.
+var benchEdits = []int{1, 10, 100}
+
+// seedUser saves items versions of the user items edits times, the latest versions are live.
+// Rows are inserted by the database itself, saving them one by one takes minutes for large histories.
+func seedUser(ctx context.Context, s *KeeperPostgres, userID int64, items int, edits int) error {
+	queries := []string{
+		`INSERT INTO store (user_id, type, key, data, created_at_client, revision, bound, user_key, ident, indexed)
+		SELECT $1, 'type', 'key' || k, decode(repeat('ab', 256), 'hex'), 0, (e - 1) * $2 + k, true, true, decode(repeat('cd', 64), 'hex'), true
+		FROM generate_series(1, $2) AS k, generate_series(1, $3) AS e`,
+		`INSERT INTO store_current (user_id, type, key, revision)
+		SELECT $1, 'type', 'key' || k, ($3 - 1) * $2 + k FROM generate_series(1, $2) AS k`,
+		`INSERT INTO user_revision (user_id, revision) VALUES ($1, $2 * $3)`,
+	}
+	for _, query := range queries {
+		if _, err := s.db.Exec(ctx, query, userID, items, edits); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.Exec(ctx, "ANALYZE")
+	return err
+}
+
+// newBenchStorage starts the database and seeds a user with benchItems items for every number of benchEdits,
+// user ID is the number of edits.
+func newBenchStorage(b *testing.B) *KeeperPostgres {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	databaseURL, terminate, err := testDatabase(ctx)
+	if err != nil {
+		noDatabase(b, err)
+	}
+	b.Cleanup(terminate)
+
+	db, err := New(databaseURL, time.Second*10)
+	require.NoError(b, err)
+	b.Cleanup(db.Close)
+	s := NewKeeperPostgres(db, time.Second*10)
+
+	for _, edits := range benchEdits {
+		require.NoError(b, seedUser(ctx, s, int64(edits), benchItems, edits))
+	}
+	return s
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	s := newBenchStorage(b)
+
+	for _, edits := range benchEdits {
+		b.Run(fmt.Sprintf("items=%d/edits=%d", benchItems, edits), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				items, err := s.Snapshot(context.Background(), int64(edits), "", "", benchItems)
+				if err != nil || len(items) != benchItems {
+					b.Fatalf("snapshot: %d items, %v", len(items), err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSave(b *testing.B) {
+	s := newBenchStorage(b)
+
+	for _, edits := range benchEdits {
+		b.Run(fmt.Sprintf("items=%d/edits=%d", benchItems, edits), func(b *testing.B) {
+			item := Item{UserID: int64(edits), Kind: "type", Key: "key1", Data: []byte("data"), Bound: true, UserKey: true, Indexed: true}
+			item.BaseRevision = int64((edits-1)*benchItems + 1)
+			for i := 0; i < b.N; i++ {
+				revision, err := s.Save(context.Background(), item, "")
+				if err != nil {
+					b.Fatalf("save: %v", err)
+				}
+				item.BaseRevision = revision
+			}
+		})
+	}
+}
+
+func BenchmarkConflicts(b *testing.B) {
+	s := newBenchStorage(b)
+
+	for _, edits := range benchEdits {
+		b.Run(fmt.Sprintf("items=%d/edits=%d", benchItems, edits), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Conflicts(context.Background(), int64(edits)); err != nil {
+					b.Fatalf("conflicts: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,15 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/testcontainers/testcontainers-go"
@@ -17,15 +22,36 @@ import (
 )
 
 var (
-	text1 = models.Text{Type: models.TextItem, Tag: "tag1", Key: "key1", Value: "value 1", Comment: "comment", Created: 1}
-	text2 = models.Text{Type: models.TextItem, Tag: "tag1", Key: "key1", Value: "value 2", Comment: "comment 2", Created: 2}
-	cred1 = models.Credentials{Type: models.CredItem, Tag: "tag1", Login: "login1", Password: "pass1", Comment: "credentials comment", Created: 1}
-	cred2 = models.Credentials{Type: models.CredItem, Tag: "tag1", Login: "login1", Password: "pass2", Comment: "credentials comment 2", Created: 2}
+	text1 = models.Text{Type: models.TextItem, Tags: []string{"tag1"}, Key: "key1", Value: "value 1", Comment: "comment", Created: 1}
+	text2 = models.Text{Type: models.TextItem, Tags: []string{"tag1"}, Key: "key1", Value: "value 2", Comment: "comment 2", Created: 2}
+	cred1 = models.Credentials{Type: models.CredItem, Tags: []string{"tag1"}, Login: "login1", Password: "pass1", Comment: "credentials comment", Created: 1}
+	cred2 = models.Credentials{Type: models.CredItem, Tags: []string{"tag1"}, Login: "login1", Password: "pass2", Comment: "credentials comment 2", Created: 2}
 )
 
 type Storager interface {
-	Snapshot(ctx context.Context, userID int64) ([]Item, error)
-	Save(ctx context.Context, item Item) error
+	Snapshot(ctx context.Context, userID int64, kind string, key string, limit int) ([]Item, error)
+	Changes(ctx context.Context, userID int64, revision int64) ([]Item, error)
+	Revision(ctx context.Context, userID int64) (int64, error)
+	Conflicts(ctx context.Context, userID int64) ([]Item, error)
+	History(ctx context.Context, userID int64, kind string, key string, revision int64, limit int) ([]Item, error)
+	SnapshotAt(ctx context.Context, userID int64, at int64, kind string, key string, limit int) ([]Item, error)
+	Save(ctx context.Context, item Item, requestID string, files ...string) (int64, error)
+	Stale(ctx context.Context, userID int64, revision int64, limit int) ([]Item, error)
+	Rewrite(ctx context.Context, item Item) error
+	Unindexed(ctx context.Context, userID int64, revision int64, limit int) ([]Item, error)
+	Reindex(ctx context.Context, item Item) error
+	KeyUsage(ctx context.Context) (map[string]int64, error)
+	UserKey(ctx context.Context, userID int64) (UserKey, error)
+	SaveUserKey(ctx context.Context, key UserKey) (UserKey, error)
+	StaleUserKeys(ctx context.Context, keyID string, userID int64, limit int) ([]UserKey, error)
+	RewrapUserKey(ctx context.Context, key UserKey) error
+	DeleteUser(ctx context.Context, userID int64) error
+	PurgeHistory(ctx context.Context, userID int64, kind string, key string, revision int64) error
+	SaveChunk(ctx context.Context, chunk Chunk) error
+	Chunk(ctx context.Context, userID int64, fileID string, n int) (Chunk, error)
+	Chunks(ctx context.Context, userID int64, fileID string) ([]int, error)
+	CollectChunks(ctx context.Context, before time.Time, limit int) (int64, error)
+	ReferencedBlobs(ctx context.Context, refs []BlobRef) ([]BlobRef, error)
 }
 
 type testStorager interface {
@@ -37,13 +63,80 @@ type PostgresTestSuite struct {
 	suite.Suite
 	testStorager
 
-	tc *tcpostgres.PostgresContainer
+	databaseURL string
+	terminate   func()
 }
 
 func (ts *PostgresTestSuite) SetupSuite() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	databaseURL, terminate, err := testDatabase(ctx)
+	if err != nil {
+		noDatabase(ts.T(), err)
+	}
+	ts.databaseURL, ts.terminate = databaseURL, terminate
+
+	db, err := New(databaseURL, time.Second*10)
+	storage := NewKeeperPostgres(db, time.Second*10)
+	require.NoError(ts.T(), err)
+
+	ts.testStorager = storage
+
+	ts.T().Logf("stared postgres at %s", databaseURL)
+}
+
+// testDatabaseEnv is the URL of the database for storage tests (CI service database),
+// the postgres container is started if it is not set.
+const testDatabaseEnv = "TEST_DATABASE_URL"
+
+// errNotTestDatabase is returned for the database whose name does not say it is a test database:
+// tests delete all rows of the tables.
+var errNotTestDatabase = errors.New("database name must contain \"test\"")
+
+// testDatabase returns the URL of the database for storage tests and the function releasing it.
+// The error is returned if the database is not set and the container cannot be started (no docker).
+func testDatabase(ctx context.Context) (string, func(), error) {
+	if databaseURL := os.Getenv(testDatabaseEnv); databaseURL != "" {
+		config, err := pgx.ParseConfig(databaseURL)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", testDatabaseEnv, err)
+		}
+		if !strings.Contains(strings.ToLower(config.Database), "test") {
+			return "", nil, fmt.Errorf("%s: database %q: %w", testDatabaseEnv, config.Database, errNotTestDatabase)
+		}
+		return databaseURL, func() {}, nil
+	}
+
+	pgc, databaseURL, err := runPostgres(ctx)
+	terminate := func() {
+		if pgc == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_ = pgc.Terminate(ctx)
+	}
+	if err != nil {
+		terminate()
+		return "", nil, err
+	}
+	return databaseURL, terminate, nil
+}
+
+// noDatabase stops the test which has no database: it is skipped on a developer machine without docker,
+// but fails in CI (CI variable is set), so storage queries are never left untested there.
+// The test always fails if the configured database is not a test database.
+func noDatabase(tb testing.TB, err error) {
+	tb.Helper()
+	if os.Getenv("CI") == "" && !errors.Is(err, errNotTestDatabase) {
+		tb.Skipf("postgres is not available, set %s or run docker: %v", testDatabaseEnv, err)
+	}
+	tb.Fatalf("storage tests need the test database: %v", err)
+}
+
+// runPostgres starts the database container and returns its URL, the container is terminated by the caller.
+func runPostgres(ctx context.Context) (*tcpostgres.PostgresContainer, string, error) {
 	pgc, err := tcpostgres.RunContainer(ctx,
 		testcontainers.WithImage("docker.io/postgres:latest"),
 		tcpostgres.WithDatabase("testdb"),
@@ -56,40 +149,51 @@ func (ts *PostgresTestSuite) SetupSuite() {
 				WithStartupTimeout(10*time.Second),
 		),
 	)
-
-	require.NoError(ts.T(), err)
+	if err != nil {
+		return nil, "", err
+	}
 
 	host, err := pgc.Host(ctx)
-	require.NoError(ts.T(), err)
-
+	if err != nil {
+		return pgc, "", err
+	}
 	port, err := pgc.MappedPort(ctx, "5432")
-	require.NoError(ts.T(), err)
-
-	ts.tc = pgc
-	databaseURL := fmt.Sprintf("postgres://postgres:postgres@%s:%s/testdb?sslmode=disable", host, port.Port())
-
-	db, err := New(databaseURL, time.Second*10)
-	storage := NewKeeperPostgres(db, time.Second*10)
-	require.NoError(ts.T(), err)
-
-	ts.testStorager = storage
-
-	ts.T().Logf("stared postgres at %s:%d", host, port.Int())
+	if err != nil {
+		return pgc, "", err
+	}
+	return pgc, fmt.Sprintf("postgres://postgres:postgres@%s:%s/testdb?sslmode=disable", host, port.Port()), nil
 }
 
 func (s *KeeperPostgres) clean(ctx context.Context) error {
 	newCtx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	_, err := s.db.Exec(newCtx, "DELETE FROM store")
+	if _, err := s.db.Exec(newCtx, "DELETE FROM store_current"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(newCtx, "DELETE FROM store"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(newCtx, "DELETE FROM request"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(newCtx, "DELETE FROM user_key"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(newCtx, "DELETE FROM file_chunk"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(newCtx, "DELETE FROM store_file"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(newCtx, "DELETE FROM user_revision")
 	return err
 }
 
 func (ts *PostgresTestSuite) TearDownSuite() {
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-
-	require.NoError(ts.T(), ts.tc.Terminate(ctx))
+	if ts.terminate != nil {
+		ts.terminate()
+	}
 }
 
 func TestPostgres(t *testing.T) {
@@ -109,46 +213,99 @@ func (ts *PostgresTestSuite) TestSave() {
 	data, _ := json.Marshal(text1)
 	itemToSave := Item{UserID: userID, Kind: "text", Key: "key1", Data: data, CreatedAt: 1}
 
-	ts.NoError(ts.Save(context.Background(), itemToSave))
+	revision, err := ts.Save(context.Background(), itemToSave, "")
+	ts.NoError(err)
+	ts.Equal(int64(1), revision)
+	itemToSave.Revision = revision
 
-	savedItems, err := ts.Snapshot(context.Background(), userID)
+	savedItems, err := ts.Snapshot(context.Background(), userID, "", "", 100)
 	ts.NoError(err)
 	ts.Equal(len(savedItems), 1)
+	ts.NotZero(savedItems[0].SavedAt)
+	itemToSave.SavedAt = savedItems[0].SavedAt
 	ts.Equal(itemToSave, savedItems[0])
 }
 
+func (ts *PostgresTestSuite) TestSaveDuplicate() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	itemToSave := Item{UserID: userID, Kind: "text", Key: "key1", Data: data, CreatedAt: 1}
+
+	revision, err := ts.Save(context.Background(), itemToSave, "request1")
+	ts.NoError(err)
+
+	// replayed request is not saved again
+	duplicate, err := ts.Save(context.Background(), itemToSave, "request1")
+	ts.ErrorIs(err, ErrDuplicate)
+	ts.Equal(revision, duplicate)
+
+	latest, err := ts.Revision(context.Background(), userID)
+	ts.NoError(err)
+	ts.Equal(revision, latest)
+
+	changes, err := ts.Changes(context.Background(), userID, 0)
+	ts.NoError(err)
+	ts.Equal(1, len(changes))
+}
+
 func (ts *PostgresTestSuite) TestSnapshotWithAnotherUserID() {
 	userID1, userID2 := int64(1), int64(2)
 	data, _ := json.Marshal(text1)
-	ts.NoError(ts.Save(context.Background(), Item{UserID: userID1, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}))
+	_, err := ts.Save(context.Background(), Item{UserID: userID1, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}, "")
+	ts.NoError(err)
 	data, _ = json.Marshal(cred1)
-	ts.NoError(ts.Save(context.Background(), Item{UserID: userID1, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}))
+	_, err = ts.Save(context.Background(), Item{UserID: userID1, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}, "")
+	ts.NoError(err)
 
-	savedItems, err := ts.Snapshot(context.Background(), userID2)
+	savedItems, err := ts.Snapshot(context.Background(), userID2, "", "", 100)
 	ts.NoError(err)
 	ts.Equal(len(savedItems), 0)
 }
 
 func (ts *PostgresTestSuite) TestSnapshot() {
 	userID := int64(1)
-	data, _ := json.Marshal(text2)
-	itemText2 := Item{UserID: userID, Kind: string(text2.Type), Key: text2.Key, Data: data, CreatedAt: text2.Created}
-	ts.NoError(ts.Save(context.Background(), itemText2))
-	data, _ = json.Marshal(text1)
-	ts.NoError(ts.Save(context.Background(), Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}))
+	data, _ := json.Marshal(text1)
+	revision, err := ts.Save(context.Background(), Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(text2)
+	itemText2 := Item{UserID: userID, Kind: string(text2.Type), Key: text2.Key, Data: data, CreatedAt: text2.Created, BaseRevision: revision}
+	_, err = ts.Save(context.Background(), itemText2, "")
+	ts.NoError(err)
 	data, _ = json.Marshal(cred1)
-	ts.NoError(ts.Save(context.Background(), Item{UserID: userID, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}))
+	revision, err = ts.Save(context.Background(), Item{UserID: userID, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}, "")
+	ts.NoError(err)
 	data, _ = json.Marshal(cred2)
-	itemCred2 := Item{UserID: userID, Kind: cred2.Type.String(), Key: cred2.Login, Data: data, CreatedAt: cred2.Created}
-	ts.NoError(ts.Save(context.Background(), itemCred2))
+	itemCred2 := Item{UserID: userID, Kind: cred2.Type.String(), Key: cred2.Login, Data: data, CreatedAt: cred2.Created, BaseRevision: revision}
+	_, err = ts.Save(context.Background(), itemCred2, "")
+	ts.NoError(err)
 
-	savedItems, err := ts.Snapshot(context.Background(), userID)
+	savedItems, err := ts.Snapshot(context.Background(), userID, "", "", 100)
 	ts.NoError(err)
 	ts.Equal(len(savedItems), 2)
 	ts.True(contains(itemText2, savedItems))
 	ts.True(contains(itemCred2, savedItems))
 }
 
+func (ts *PostgresTestSuite) TestSnapshotPages() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	for _, key := range []string{"key3", "key1", "key2"} {
+		_, err := ts.Save(context.Background(), Item{UserID: userID, Kind: text1.Type.String(), Key: key, Data: data}, "")
+		ts.NoError(err)
+	}
+
+	page, err := ts.Snapshot(context.Background(), userID, "", "", 2)
+	ts.NoError(err)
+	ts.Equal(2, len(page))
+	ts.Equal("key1", page[0].Key)
+	ts.Equal("key2", page[1].Key)
+
+	page, err = ts.Snapshot(context.Background(), userID, page[1].Kind, page[1].Key, 2)
+	ts.NoError(err)
+	ts.Equal(1, len(page))
+	ts.Equal("key3", page[0].Key)
+}
+
 func contains(target Item, items []Item) bool {
 	for _, item := range items {
 		if target.Kind == item.Kind && target.UserID == target.UserID &&
@@ -159,3 +316,425 @@ func contains(target Item, items []Item) bool {
 	}
 	return false
 }
+
+func (ts *PostgresTestSuite) TestSnapshotSkipsDeleted() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	revision, err := ts.Save(context.Background(), Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(text2)
+	_, err = ts.Save(context.Background(), Item{UserID: userID, Kind: text2.Type.String(), Key: text2.Key, Data: data, CreatedAt: text2.Created, Deleted: true, BaseRevision: revision}, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(cred1)
+	itemCred1 := Item{UserID: userID, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}
+	_, err = ts.Save(context.Background(), itemCred1, "")
+	ts.NoError(err)
+
+	savedItems, err := ts.Snapshot(context.Background(), userID, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(len(savedItems), 1)
+	ts.True(contains(itemCred1, savedItems))
+}
+
+func (ts *PostgresTestSuite) TestChanges() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	itemText1 := Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}
+	revision, err := ts.Save(context.Background(), itemText1, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(text2)
+	itemText2 := Item{UserID: userID, Kind: text2.Type.String(), Key: text2.Key, Data: data, CreatedAt: text2.Created, Deleted: true, BaseRevision: revision}
+	_, err = ts.Save(context.Background(), itemText2, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(cred1)
+	itemCred1 := Item{UserID: userID, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}
+	_, err = ts.Save(context.Background(), itemCred1, "")
+	ts.NoError(err)
+
+	revision, err = ts.Revision(context.Background(), userID)
+	ts.NoError(err)
+	ts.Equal(int64(3), revision)
+
+	changes, err := ts.Changes(context.Background(), userID, 1)
+	ts.NoError(err)
+	ts.Equal(2, len(changes))
+	ts.Equal(int64(2), changes[0].Revision)
+	ts.True(changes[0].Deleted)
+	ts.Equal(int64(3), changes[1].Revision)
+	ts.True(contains(itemCred1, changes))
+}
+
+func (ts *PostgresTestSuite) TestSaveConflict() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	base, err := ts.Save(context.Background(), Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(text2)
+	itemText2 := Item{UserID: userID, Kind: text2.Type.String(), Key: text2.Key, Data: data, CreatedAt: text2.Created, BaseRevision: base}
+	_, err = ts.Save(context.Background(), itemText2, "")
+	ts.NoError(err)
+
+	// another device edited the same version
+	data, _ = json.Marshal(models.Text{Type: models.TextItem, Key: text1.Key, Value: "value 3", Created: 2})
+	stale := Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: 2, BaseRevision: base}
+	revision, err := ts.Save(context.Background(), stale, "")
+	ts.ErrorIs(err, ErrConflict)
+	ts.Equal(int64(3), revision)
+
+	savedItems, err := ts.Snapshot(context.Background(), userID, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(1, len(savedItems))
+	ts.True(contains(itemText2, savedItems))
+
+	conflicts, err := ts.Conflicts(context.Background(), userID)
+	ts.NoError(err)
+	ts.Equal(1, len(conflicts))
+	ts.True(conflicts[0].Conflict)
+	ts.True(contains(stale, conflicts))
+
+	// resolving write hides the conflict version
+	_, err = ts.Save(context.Background(), Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: 3, BaseRevision: 2}, "")
+	ts.NoError(err)
+	conflicts, err = ts.Conflicts(context.Background(), userID)
+	ts.NoError(err)
+	ts.Equal(0, len(conflicts))
+}
+
+func (ts *PostgresTestSuite) TestHistory() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	itemText1 := Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}
+	revision, err := ts.Save(context.Background(), itemText1, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(cred1)
+	_, err = ts.Save(context.Background(), Item{UserID: userID, Kind: cred1.Type.String(), Key: cred1.Login, Data: data, CreatedAt: cred1.Created}, "")
+	ts.NoError(err)
+	data, _ = json.Marshal(text2)
+	itemText2 := Item{UserID: userID, Kind: text2.Type.String(), Key: text2.Key, Data: data, CreatedAt: text2.Created, BaseRevision: revision}
+	_, err = ts.Save(context.Background(), itemText2, "")
+	ts.NoError(err)
+
+	versions, err := ts.History(context.Background(), userID, text1.Type.String(), text1.Key, 0, 100)
+	ts.NoError(err)
+	ts.Equal(2, len(versions))
+	ts.Equal(int64(1), versions[0].Revision)
+	ts.True(contains(itemText1, versions[:1]))
+	ts.Equal(int64(3), versions[1].Revision)
+	ts.True(contains(itemText2, versions[1:]))
+
+	// versions are read by pages after the last version of the previous page
+	versions, err = ts.History(context.Background(), userID, text1.Type.String(), text1.Key, 0, 1)
+	ts.NoError(err)
+	ts.Equal(1, len(versions))
+	ts.Equal(int64(1), versions[0].Revision)
+	versions, err = ts.History(context.Background(), userID, text1.Type.String(), text1.Key, 1, 1)
+	ts.NoError(err)
+	ts.Equal(1, len(versions))
+	ts.Equal(int64(3), versions[0].Revision)
+}
+
+func (ts *PostgresTestSuite) TestSnapshotAt() {
+	userID := int64(1)
+	data, _ := json.Marshal(text1)
+	itemText1 := Item{UserID: userID, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}
+	revision, err := ts.Save(context.Background(), itemText1, "")
+	ts.NoError(err)
+
+	versions, err := ts.History(context.Background(), userID, text1.Type.String(), text1.Key, 0, 100)
+	ts.NoError(err)
+	at := versions[0].SavedAt
+
+	// wait for the next second, changes after the moment should be ignored
+	time.Sleep(time.Until(time.Unix(at+1, 0)))
+	data, _ = json.Marshal(text2)
+	_, err = ts.Save(context.Background(), Item{UserID: userID, Kind: text2.Type.String(), Key: text2.Key, Data: data, CreatedAt: text2.Created, Deleted: true, BaseRevision: revision}, "")
+	ts.NoError(err)
+
+	savedItems, err := ts.SnapshotAt(context.Background(), userID, at, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(1, len(savedItems))
+	ts.True(contains(itemText1, savedItems))
+
+	// the next page starts after the last item
+	savedItems, err = ts.SnapshotAt(context.Background(), userID, at, itemText1.Kind, itemText1.Key, 100)
+	ts.NoError(err)
+	ts.Equal(0, len(savedItems))
+
+	savedItems, err = ts.SnapshotAt(context.Background(), userID, at-1, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(0, len(savedItems))
+
+	savedItems, err = ts.Snapshot(context.Background(), userID, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(0, len(savedItems))
+}
+
+func (ts *PostgresTestSuite) TestSavedAtTimeZone() {
+	// the server session time zone does not shift the saved time
+	config, err := pgxpool.ParseConfig(ts.databaseURL)
+	ts.Require().NoError(err)
+	config.ConnConfig.RuntimeParams["timezone"] = "Asia/Tokyo"
+	db, err := pgxpool.NewWithConfig(context.Background(), config)
+	ts.Require().NoError(err)
+	defer db.Close()
+	storage := NewKeeperPostgres(db, time.Second*10)
+
+	before := time.Now().Unix()
+	data, _ := json.Marshal(text1)
+	itemText1 := Item{UserID: 1, Kind: text1.Type.String(), Key: text1.Key, Data: data, CreatedAt: text1.Created}
+	_, err = storage.Save(context.Background(), itemText1, "")
+	ts.NoError(err)
+
+	versions, err := storage.History(context.Background(), 1, text1.Type.String(), text1.Key, 0, 100)
+	ts.NoError(err)
+	ts.Equal(1, len(versions))
+	ts.InDelta(before, versions[0].SavedAt, 2)
+
+	savedItems, err := storage.SnapshotAt(context.Background(), 1, time.Now().Unix(), "", "", 100)
+	ts.NoError(err)
+	ts.Equal(1, len(savedItems))
+	savedItems, err = storage.SnapshotAt(context.Background(), 1, before-60, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(0, len(savedItems))
+}
+
+func (ts *PostgresTestSuite) TestPurgeHistory() {
+	ctx := context.Background()
+	data, _ := json.Marshal(text1)
+	revision, err := ts.Save(ctx, Item{UserID: 1, Kind: text1.Type.String(), Key: text1.Key, Data: data}, "", "file1")
+	ts.NoError(err)
+	_, err = ts.Save(ctx, Item{UserID: 1, Kind: cred1.Type.String(), Key: cred1.Login, Data: data}, "")
+	ts.NoError(err)
+	deleted, err := ts.Save(ctx, Item{UserID: 1, Kind: text1.Type.String(), Key: text1.Key, Data: data, Deleted: true, BaseRevision: revision}, "")
+	ts.NoError(err)
+
+	ts.NoError(ts.PurgeHistory(ctx, 1, text1.Type.String(), text1.Key, deleted))
+
+	// the tombstone is kept, so clients behind it receive the deletion, other items keep their history
+	versions, err := ts.History(ctx, 1, text1.Type.String(), text1.Key, 0, 100)
+	ts.NoError(err)
+	ts.Equal(1, len(versions))
+	ts.Equal(deleted, versions[0].Revision)
+	ts.True(versions[0].Deleted)
+	items, err := ts.SnapshotAt(ctx, 1, revision, "", "", 100)
+	ts.NoError(err)
+	ts.Empty(items)
+	versions, err = ts.History(ctx, 1, cred1.Type.String(), cred1.Login, 0, 100)
+	ts.NoError(err)
+	ts.Equal(1, len(versions))
+
+	// chunks of the file referenced only by the purged version are collected
+	ts.NoError(ts.SaveChunk(ctx, Chunk{UserID: 1, FileID: "file1", N: 0, Hash: "hash1"}))
+	collected, err := ts.CollectChunks(ctx, time.Now().Add(time.Hour), 100)
+	ts.NoError(err)
+	ts.Equal(int64(1), collected)
+}
+
+func (ts *PostgresTestSuite) TestReindex() {
+	data, _ := json.Marshal(text1)
+	_, err := ts.Save(context.Background(), Item{UserID: 1, Kind: "type1", Key: "key1", Data: data}, "")
+	ts.NoError(err)
+	_, err = ts.Save(context.Background(), Item{UserID: 1, Kind: "type1", Key: "key1", Data: data}, "")
+	ts.NoError(err)
+	_, err = ts.Save(context.Background(), Item{UserID: 1, Kind: "blind type", Key: "blind key2", Data: data, Identity: []byte("ident"), Indexed: true}, "")
+	ts.NoError(err)
+
+	unindexed, err := ts.Unindexed(context.Background(), 0, 0, 10)
+	ts.NoError(err)
+	ts.Equal(2, len(unindexed))
+
+	// rows are read in batches after the last row of the previous batch
+	unindexed, err = ts.Unindexed(context.Background(), 1, 1, 10)
+	ts.NoError(err)
+	ts.Equal(1, len(unindexed))
+	ts.Equal(int64(2), unindexed[0].Revision)
+
+	for _, item := range []Item{{UserID: 1, Revision: 1}, {UserID: 1, Revision: 2}} {
+		item.Kind, item.Key, item.Identity, item.Indexed = "blind type", "blind key1", []byte("ident"), true
+		ts.NoError(ts.Reindex(context.Background(), item))
+	}
+
+	unindexed, err = ts.Unindexed(context.Background(), 0, 0, 10)
+	ts.NoError(err)
+	ts.Equal(0, len(unindexed))
+
+	history, err := ts.History(context.Background(), 1, "blind type", "blind key1", 0, 100)
+	ts.NoError(err)
+	ts.Equal(2, len(history))
+	ts.Equal([]byte("ident"), history[0].Identity)
+	ts.True(history[0].Indexed)
+	ts.Equal(data, history[0].Data)
+
+	// the latest version is found by the new identifiers
+	items, err := ts.Snapshot(context.Background(), 1, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(2, len(items))
+	_, err = ts.Save(context.Background(), Item{UserID: 1, Kind: "blind type", Key: "blind key1", Data: data, BaseRevision: 2, Indexed: true}, "")
+	ts.NoError(err)
+}
+
+func (ts *PostgresTestSuite) TestRewriteStale() {
+	data, _ := json.Marshal(text1)
+	_, err := ts.Save(context.Background(), Item{UserID: 1, Kind: text1.Type.String(), Key: text1.Key, Data: data}, "")
+	ts.NoError(err)
+	_, err = ts.Save(context.Background(), Item{UserID: 2, Kind: text1.Type.String(), Key: text1.Key, Data: data, Bound: true, KeyID: "1"}, "")
+	ts.NoError(err)
+	_, err = ts.Save(context.Background(), Item{UserID: 2, Kind: text1.Type.String(), Key: "key2", Data: data, Bound: true, UserKey: true}, "")
+	ts.NoError(err)
+	_, err = ts.SaveUserKey(context.Background(), UserKey{UserID: 2, Wrapped: []byte("wrapped"), KeyID: "2"})
+	ts.NoError(err)
+
+	usage, err := ts.KeyUsage(context.Background())
+	ts.NoError(err)
+	ts.Equal(map[string]int64{"": 1, "1": 1, "2": 1}, usage)
+
+	stale, err := ts.Stale(context.Background(), 0, 0, 10)
+	ts.NoError(err)
+	ts.Equal(2, len(stale))
+	ts.Equal(int64(1), stale[0].UserID)
+	ts.Equal(int64(2), stale[1].UserID)
+	ts.Equal("1", stale[1].KeyID)
+
+	// rows are read in batches after the last row of the previous batch
+	stale, err = ts.Stale(context.Background(), 1, 1, 10)
+	ts.NoError(err)
+	ts.Equal(1, len(stale))
+	ts.Equal(int64(2), stale[0].UserID)
+
+	rewritten := stale[0]
+	rewritten.Data = []byte("rewritten data")
+	rewritten.KeyID = ""
+	rewritten.UserKey = true
+	ts.NoError(ts.Rewrite(context.Background(), rewritten))
+
+	stale, err = ts.Stale(context.Background(), 0, 0, 10)
+	ts.NoError(err)
+	ts.Equal(1, len(stale))
+	ts.Equal(int64(1), stale[0].UserID)
+
+	usage, err = ts.KeyUsage(context.Background())
+	ts.NoError(err)
+	ts.Equal(map[string]int64{"": 1, "2": 1}, usage)
+
+	items, err := ts.Snapshot(context.Background(), 2, "", "", 100)
+	ts.NoError(err)
+	ts.Equal(2, len(items))
+	ts.True(contains(Item{UserID: 2, Kind: text1.Type.String(), Key: text1.Key, Data: []byte("rewritten data")}, items))
+}
+
+func (ts *PostgresTestSuite) TestUserKey() {
+	_, err := ts.UserKey(context.Background(), 1)
+	ts.ErrorIs(err, ErrNotFound)
+
+	saved, err := ts.SaveUserKey(context.Background(), UserKey{UserID: 1, Wrapped: []byte("first"), KeyID: "1"})
+	ts.NoError(err)
+	ts.Equal(UserKey{UserID: 1, Wrapped: []byte("first"), KeyID: "1"}, saved)
+
+	// concurrently created key does not replace the saved one
+	saved, err = ts.SaveUserKey(context.Background(), UserKey{UserID: 1, Wrapped: []byte("second"), KeyID: "1"})
+	ts.NoError(err)
+	ts.Equal([]byte("first"), saved.Wrapped)
+
+	_, err = ts.SaveUserKey(context.Background(), UserKey{UserID: 2, Wrapped: []byte("other"), KeyID: "2"})
+	ts.NoError(err)
+
+	stale, err := ts.StaleUserKeys(context.Background(), "2", 0, 10)
+	ts.NoError(err)
+	ts.Equal([]UserKey{{UserID: 1, Wrapped: []byte("first"), KeyID: "1"}}, stale)
+
+	ts.NoError(ts.RewrapUserKey(context.Background(), UserKey{UserID: 1, Wrapped: []byte("rewrapped"), KeyID: "2"}))
+	key, err := ts.UserKey(context.Background(), 1)
+	ts.NoError(err)
+	ts.Equal(UserKey{UserID: 1, Wrapped: []byte("rewrapped"), KeyID: "2"}, key)
+
+	stale, err = ts.StaleUserKeys(context.Background(), "2", 0, 10)
+	ts.NoError(err)
+	ts.Empty(stale)
+}
+
+func (ts *PostgresTestSuite) TestDeleteUser() {
+	data, _ := json.Marshal(text1)
+	_, err := ts.Save(context.Background(), Item{UserID: 1, Kind: text1.Type.String(), Key: text1.Key, Data: data, UserKey: true}, "request1")
+	ts.NoError(err)
+	_, err = ts.Save(context.Background(), Item{UserID: 2, Kind: text1.Type.String(), Key: text1.Key, Data: data, UserKey: true}, "")
+	ts.NoError(err)
+	_, err = ts.SaveUserKey(context.Background(), UserKey{UserID: 1, Wrapped: []byte("wrapped"), KeyID: "1"})
+	ts.NoError(err)
+	ts.NoError(ts.SaveChunk(context.Background(), Chunk{UserID: 1, FileID: "file1", N: 0, Data: []byte("chunk"), Hash: "hash"}))
+
+	ts.NoError(ts.DeleteUser(context.Background(), 1))
+
+	_, err = ts.Chunk(context.Background(), 1, "file1", 0)
+	ts.ErrorIs(err, ErrNotFound)
+
+	_, err = ts.UserKey(context.Background(), 1)
+	ts.ErrorIs(err, ErrNotFound)
+	items, err := ts.Changes(context.Background(), 1, 0)
+	ts.NoError(err)
+	ts.Empty(items)
+	items, err = ts.Changes(context.Background(), 2, 0)
+	ts.NoError(err)
+	ts.Equal(1, len(items))
+
+	// revisions are not reused
+	revision, err := ts.Save(context.Background(), Item{UserID: 1, Kind: text1.Type.String(), Key: text1.Key, Data: data, UserKey: true}, "request1")
+	ts.NoError(err)
+	ts.Equal(int64(2), revision)
+}
+
+func (ts *PostgresTestSuite) TestChunks() {
+	chunk0 := Chunk{UserID: 1, FileID: "file1", N: 0, Data: []byte("chunk 0"), Hash: "hash0"}
+	chunk2 := Chunk{UserID: 1, FileID: "file1", N: 2, Data: []byte("chunk 2"), Hash: "hash2"}
+	ts.NoError(ts.SaveChunk(context.Background(), chunk2))
+	ts.NoError(ts.SaveChunk(context.Background(), chunk0))
+	ts.NoError(ts.SaveChunk(context.Background(), Chunk{UserID: 2, FileID: "file1", N: 1, Data: []byte("chunk 1"), Hash: "hash1"}))
+
+	chunks, err := ts.Chunks(context.Background(), 1, "file1")
+	ts.NoError(err)
+	ts.Equal([]int{0, 2}, chunks)
+
+	// chunk sent again replaces the saved one
+	chunk0.Data, chunk0.Hash = []byte("chunk 0 again"), "hash0 again"
+	ts.NoError(ts.SaveChunk(context.Background(), chunk0))
+	saved, err := ts.Chunk(context.Background(), 1, "file1", 0)
+	ts.NoError(err)
+	ts.Equal(chunk0, saved)
+
+	_, err = ts.Chunk(context.Background(), 1, "file1", 1)
+	ts.ErrorIs(err, ErrNotFound)
+	chunks, err = ts.Chunks(context.Background(), 1, "file2")
+	ts.NoError(err)
+	ts.Empty(chunks)
+}
+
+func (ts *PostgresTestSuite) TestCollectChunks() {
+	ctx := context.Background()
+	ts.NoError(ts.SaveChunk(ctx, Chunk{UserID: 1, FileID: "file1", N: 0, Hash: "hash1"}))
+	ts.NoError(ts.SaveChunk(ctx, Chunk{UserID: 1, FileID: "file2", N: 0, Hash: "hash2"}))
+	ts.NoError(ts.SaveChunk(ctx, Chunk{UserID: 1, FileID: "file3", N: 0, Hash: "hash3"}))
+	_, err := ts.Save(ctx, Item{UserID: 1, Kind: "binary", Key: "key1", Data: []byte("data")}, "", "file1")
+	ts.NoError(err)
+
+	// chunks saved after the time are kept, the file may be still uploaded
+	collected, err := ts.CollectChunks(ctx, time.Now().Add(-time.Hour), 10)
+	ts.NoError(err)
+	ts.Zero(collected)
+
+	collected, err = ts.CollectChunks(ctx, time.Now().Add(time.Hour), 1)
+	ts.NoError(err)
+	ts.Equal(int64(1), collected)
+	collected, err = ts.CollectChunks(ctx, time.Now().Add(time.Hour), 1)
+	ts.NoError(err)
+	ts.Equal(int64(1), collected)
+	collected, err = ts.CollectChunks(ctx, time.Now().Add(time.Hour), 1)
+	ts.NoError(err)
+	ts.Zero(collected)
+
+	chunks, err := ts.Chunks(ctx, 1, "file1")
+	ts.NoError(err)
+	ts.Equal([]int{0}, chunks)
+
+	refs, err := ts.ReferencedBlobs(ctx, []BlobRef{{UserID: 1, Hash: "hash1"}, {UserID: 1, Hash: "hash2"}, {UserID: 2, Hash: "hash1"}})
+	ts.NoError(err)
+	ts.Equal([]BlobRef{{UserID: 1, Hash: "hash1"}}, refs)
+}
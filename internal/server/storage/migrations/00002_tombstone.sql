@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE store ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE store DROP COLUMN deleted;
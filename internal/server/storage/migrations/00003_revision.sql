@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE store ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS user_revision
+(
+    user_id            BIGINT PRIMARY KEY,
+    revision           BIGINT NOT NULL DEFAULT 0
+);
+
+UPDATE store SET revision = numbered.revision
+FROM (SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY id) AS revision FROM store) AS numbered
+WHERE store.id = numbered.id;
+
+INSERT INTO user_revision (user_id, revision)
+SELECT user_id, max(revision) FROM store GROUP BY user_id;
+
+-- +goose Down
+DROP TABLE user_revision;
+ALTER TABLE store DROP COLUMN revision;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE store ADD COLUMN base_revision BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE store ADD COLUMN conflict BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE store DROP COLUMN conflict;
+ALTER TABLE store DROP COLUMN base_revision;
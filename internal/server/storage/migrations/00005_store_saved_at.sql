@@ -0,0 +1,7 @@
+-- +goose Up
+-- saved time of the version is the absolute moment, timestamp without time zone was the local time of the server
+-- session and its epoch was shifted by the time zone offset. Rows saved before are read in the session time zone.
+ALTER TABLE store ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+
+-- +goose Down
+ALTER TABLE store ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE current_setting('TimeZone');
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS request
+(
+    user_id            BIGINT NOT NULL,
+    request_id         VARCHAR NOT NULL,
+    revision           BIGINT NOT NULL,
+    created_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, request_id)
+);
+
+-- +goose Down
+DROP TABLE request;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE store ADD COLUMN bound BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS store_unbound_idx ON store (user_id, revision) WHERE NOT bound;
+
+-- +goose Down
+DROP INDEX IF EXISTS store_unbound_idx;
+ALTER TABLE store DROP COLUMN bound;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- rows saved before key IDs have empty key ID, they are encrypted with the legacy key
+ALTER TABLE store ADD COLUMN key_id VARCHAR NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS store_unbound_idx;
+CREATE INDEX IF NOT EXISTS store_key_id_idx ON store (key_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS store_key_id_idx;
+CREATE INDEX IF NOT EXISTS store_unbound_idx ON store (user_id, revision) WHERE NOT bound;
+ALTER TABLE store DROP COLUMN key_id;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- data keys of users wrapped by key-encryption keys, deleting the row makes the user data unrecoverable
+CREATE TABLE IF NOT EXISTS user_key
+(
+    user_id            BIGINT PRIMARY KEY,
+    wrapped            BYTEA NOT NULL,
+    kek_id             VARCHAR NOT NULL,
+    created_at         TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS user_key_kek_id_idx ON user_key (kek_id);
+
+ALTER TABLE store ADD COLUMN user_key BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE store DROP COLUMN user_key;
+DROP TABLE user_key;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- indexed rows keep blind indexes in type and key columns, the identifiers are encrypted in ident
+ALTER TABLE store ADD COLUMN ident BYTEA;
+ALTER TABLE store ADD COLUMN indexed BOOLEAN NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS store_unindexed_idx ON store (user_id, revision) WHERE NOT indexed;
+
+-- +goose Down
+DROP INDEX IF EXISTS store_unindexed_idx;
+ALTER TABLE store DROP COLUMN indexed;
+ALTER TABLE store DROP COLUMN ident;
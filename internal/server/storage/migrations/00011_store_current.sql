@@ -0,0 +1,28 @@
+-- +goose Up
+-- store keeps the history of items, store_current points to the latest version of every item (tombstones included),
+-- so snapshots and saves do not scan the history
+CREATE UNIQUE INDEX IF NOT EXISTS store_user_revision_idx ON store (user_id, revision);
+CREATE INDEX IF NOT EXISTS store_item_idx ON store (user_id, type, key, revision);
+CREATE INDEX IF NOT EXISTS store_conflict_idx ON store (user_id, revision) WHERE conflict;
+
+CREATE TABLE IF NOT EXISTS store_current
+(
+    user_id            BIGINT NOT NULL,
+    type               VARCHAR NOT NULL,
+    key                VARCHAR NOT NULL,
+    revision           BIGINT NOT NULL,
+    deleted            BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (user_id, type, key)
+);
+CREATE INDEX IF NOT EXISTS store_current_revision_idx ON store_current (user_id, revision);
+
+INSERT INTO store_current (user_id, type, key, revision, deleted)
+SELECT DISTINCT ON (user_id, type, key) user_id, type, key, revision, deleted FROM store
+WHERE NOT conflict AND type IS NOT NULL AND key IS NOT NULL
+ORDER BY user_id, type, key, revision DESC;
+
+-- +goose Down
+DROP TABLE store_current;
+DROP INDEX IF EXISTS store_conflict_idx;
+DROP INDEX IF EXISTS store_item_idx;
+DROP INDEX IF EXISTS store_user_revision_idx;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- chunks of files uploaded by users, data is encrypted by the client and by the server
+CREATE TABLE IF NOT EXISTS file_chunk (
+    user_id BIGINT NOT NULL,
+    file_id VARCHAR(64) NOT NULL,
+    n INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, file_id, n)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS file_chunk;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- chunk data is kept in the blob store by its hash, rows saved before keep it in data
+ALTER TABLE file_chunk ALTER COLUMN data DROP NOT NULL;
+-- files referenced by chunks saved before store_file are not known, such chunks are never collected
+ALTER TABLE file_chunk ADD COLUMN collectable BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE file_chunk ALTER COLUMN collectable SET DEFAULT true;
+CREATE INDEX IF NOT EXISTS file_chunk_hash_idx ON file_chunk (user_id, hash);
+
+-- files referenced by store rows (every version), chunks of files without references are collected
+CREATE TABLE IF NOT EXISTS store_file (
+    user_id BIGINT NOT NULL,
+    file_id VARCHAR(64) NOT NULL,
+    revision BIGINT NOT NULL,
+    PRIMARY KEY (user_id, file_id, revision)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS store_file;
+DROP INDEX IF EXISTS file_chunk_hash_idx;
+ALTER TABLE file_chunk DROP COLUMN collectable;
+DELETE FROM file_chunk WHERE data IS NULL;
+ALTER TABLE file_chunk ALTER COLUMN data SET NOT NULL;
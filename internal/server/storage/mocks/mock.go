@@ -2,11 +2,12 @@
 // Source: keeper.go
 
 // Package mock_service is a generated GoMock package.
-package mock_storage
+package mock_service
 
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	storage "github.com/dkrasnykh/gophkeeper/internal/server/storage"
 	gomock "github.com/golang/mock/gomock"
@@ -35,31 +36,346 @@ func (m *MockStorager) EXPECT() *MockStoragerMockRecorder {
 	return m.recorder
 }
 
-// Save mocks base method.
-func (m *MockStorager) Save(ctx context.Context, item storage.Item) error {
+// Changes mocks base method.
+func (m *MockStorager) Changes(ctx context.Context, userID, revision int64) ([]storage.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Changes", ctx, userID, revision)
+	ret0, _ := ret[0].([]storage.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Changes indicates an expected call of Changes.
+func (mr *MockStoragerMockRecorder) Changes(ctx, userID, revision interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Changes", reflect.TypeOf((*MockStorager)(nil).Changes), ctx, userID, revision)
+}
+
+// Chunk mocks base method.
+func (m *MockStorager) Chunk(ctx context.Context, userID int64, fileID string, n int) (storage.Chunk, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chunk", ctx, userID, fileID, n)
+	ret0, _ := ret[0].(storage.Chunk)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Chunk indicates an expected call of Chunk.
+func (mr *MockStoragerMockRecorder) Chunk(ctx, userID, fileID, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chunk", reflect.TypeOf((*MockStorager)(nil).Chunk), ctx, userID, fileID, n)
+}
+
+// Chunks mocks base method.
+func (m *MockStorager) Chunks(ctx context.Context, userID int64, fileID string) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chunks", ctx, userID, fileID)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Chunks indicates an expected call of Chunks.
+func (mr *MockStoragerMockRecorder) Chunks(ctx, userID, fileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chunks", reflect.TypeOf((*MockStorager)(nil).Chunks), ctx, userID, fileID)
+}
+
+// CollectChunks mocks base method.
+func (m *MockStorager) CollectChunks(ctx context.Context, before time.Time, limit int) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CollectChunks", ctx, before, limit)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CollectChunks indicates an expected call of CollectChunks.
+func (mr *MockStoragerMockRecorder) CollectChunks(ctx, before, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectChunks", reflect.TypeOf((*MockStorager)(nil).CollectChunks), ctx, before, limit)
+}
+
+// Conflicts mocks base method.
+func (m *MockStorager) Conflicts(ctx context.Context, userID int64) ([]storage.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Conflicts", ctx, userID)
+	ret0, _ := ret[0].([]storage.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Conflicts indicates an expected call of Conflicts.
+func (mr *MockStoragerMockRecorder) Conflicts(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Conflicts", reflect.TypeOf((*MockStorager)(nil).Conflicts), ctx, userID)
+}
+
+// DeleteUser mocks base method.
+func (m *MockStorager) DeleteUser(ctx context.Context, userID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockStoragerMockRecorder) DeleteUser(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockStorager)(nil).DeleteUser), ctx, userID)
+}
+
+// History mocks base method.
+func (m *MockStorager) History(ctx context.Context, userID int64, kind, key string, revision int64, limit int) ([]storage.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", ctx, userID, kind, key, revision, limit)
+	ret0, _ := ret[0].([]storage.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockStoragerMockRecorder) History(ctx, userID, kind, key, revision, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockStorager)(nil).History), ctx, userID, kind, key, revision, limit)
+}
+
+// KeyUsage mocks base method.
+func (m *MockStorager) KeyUsage(ctx context.Context) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KeyUsage", ctx)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// KeyUsage indicates an expected call of KeyUsage.
+func (mr *MockStoragerMockRecorder) KeyUsage(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KeyUsage", reflect.TypeOf((*MockStorager)(nil).KeyUsage), ctx)
+}
+
+// PurgeHistory mocks base method.
+func (m *MockStorager) PurgeHistory(ctx context.Context, userID int64, kind, key string, revision int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeHistory", ctx, userID, kind, key, revision)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeHistory indicates an expected call of PurgeHistory.
+func (mr *MockStoragerMockRecorder) PurgeHistory(ctx, userID, kind, key, revision interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeHistory", reflect.TypeOf((*MockStorager)(nil).PurgeHistory), ctx, userID, kind, key, revision)
+}
+
+// ReferencedBlobs mocks base method.
+func (m *MockStorager) ReferencedBlobs(ctx context.Context, refs []storage.BlobRef) ([]storage.BlobRef, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReferencedBlobs", ctx, refs)
+	ret0, _ := ret[0].([]storage.BlobRef)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReferencedBlobs indicates an expected call of ReferencedBlobs.
+func (mr *MockStoragerMockRecorder) ReferencedBlobs(ctx, refs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReferencedBlobs", reflect.TypeOf((*MockStorager)(nil).ReferencedBlobs), ctx, refs)
+}
+
+// Reindex mocks base method.
+func (m *MockStorager) Reindex(ctx context.Context, item storage.Item) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reindex", ctx, item)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reindex indicates an expected call of Reindex.
+func (mr *MockStoragerMockRecorder) Reindex(ctx, item interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reindex", reflect.TypeOf((*MockStorager)(nil).Reindex), ctx, item)
+}
+
+// Revision mocks base method.
+func (m *MockStorager) Revision(ctx context.Context, userID int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revision", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Revision indicates an expected call of Revision.
+func (mr *MockStoragerMockRecorder) Revision(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revision", reflect.TypeOf((*MockStorager)(nil).Revision), ctx, userID)
+}
+
+// RewrapUserKey mocks base method.
+func (m *MockStorager) RewrapUserKey(ctx context.Context, key storage.UserKey) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Save", ctx, item)
+	ret := m.ctrl.Call(m, "RewrapUserKey", ctx, key)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// RewrapUserKey indicates an expected call of RewrapUserKey.
+func (mr *MockStoragerMockRecorder) RewrapUserKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RewrapUserKey", reflect.TypeOf((*MockStorager)(nil).RewrapUserKey), ctx, key)
+}
+
+// Rewrite mocks base method.
+func (m *MockStorager) Rewrite(ctx context.Context, item storage.Item) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rewrite", ctx, item)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rewrite indicates an expected call of Rewrite.
+func (mr *MockStoragerMockRecorder) Rewrite(ctx, item interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rewrite", reflect.TypeOf((*MockStorager)(nil).Rewrite), ctx, item)
+}
+
+// Save mocks base method.
+func (m *MockStorager) Save(ctx context.Context, item storage.Item, requestID string, files ...string) (int64, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, item, requestID}
+	for _, a := range files {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Save", varargs...)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // Save indicates an expected call of Save.
-func (mr *MockStoragerMockRecorder) Save(ctx, item interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) Save(ctx, item, requestID interface{}, files ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, item, requestID}, files...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockStorager)(nil).Save), varargs...)
+}
+
+// SaveChunk mocks base method.
+func (m *MockStorager) SaveChunk(ctx context.Context, chunk storage.Chunk) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveChunk", ctx, chunk)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveChunk indicates an expected call of SaveChunk.
+func (mr *MockStoragerMockRecorder) SaveChunk(ctx, chunk interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveChunk", reflect.TypeOf((*MockStorager)(nil).SaveChunk), ctx, chunk)
+}
+
+// SaveUserKey mocks base method.
+func (m *MockStorager) SaveUserKey(ctx context.Context, key storage.UserKey) (storage.UserKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveUserKey", ctx, key)
+	ret0, _ := ret[0].(storage.UserKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveUserKey indicates an expected call of SaveUserKey.
+func (mr *MockStoragerMockRecorder) SaveUserKey(ctx, key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockStorager)(nil).Save), ctx, item)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUserKey", reflect.TypeOf((*MockStorager)(nil).SaveUserKey), ctx, key)
 }
 
 // Snapshot mocks base method.
-func (m *MockStorager) Snapshot(ctx context.Context, userID int64) ([]storage.Item, error) {
+func (m *MockStorager) Snapshot(ctx context.Context, userID int64, kind, key string, limit int) ([]storage.Item, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Snapshot", ctx, userID)
+	ret := m.ctrl.Call(m, "Snapshot", ctx, userID, kind, key, limit)
 	ret0, _ := ret[0].([]storage.Item)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Snapshot indicates an expected call of Snapshot.
-func (mr *MockStoragerMockRecorder) Snapshot(ctx, userID interface{}) *gomock.Call {
+func (mr *MockStoragerMockRecorder) Snapshot(ctx, userID, kind, key, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockStorager)(nil).Snapshot), ctx, userID, kind, key, limit)
+}
+
+// SnapshotAt mocks base method.
+func (m *MockStorager) SnapshotAt(ctx context.Context, userID, at int64, kind, key string, limit int) ([]storage.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SnapshotAt", ctx, userID, at, kind, key, limit)
+	ret0, _ := ret[0].([]storage.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SnapshotAt indicates an expected call of SnapshotAt.
+func (mr *MockStoragerMockRecorder) SnapshotAt(ctx, userID, at, kind, key, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SnapshotAt", reflect.TypeOf((*MockStorager)(nil).SnapshotAt), ctx, userID, at, kind, key, limit)
+}
+
+// Stale mocks base method.
+func (m *MockStorager) Stale(ctx context.Context, userID, revision int64, limit int) ([]storage.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stale", ctx, userID, revision, limit)
+	ret0, _ := ret[0].([]storage.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stale indicates an expected call of Stale.
+func (mr *MockStoragerMockRecorder) Stale(ctx, userID, revision, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stale", reflect.TypeOf((*MockStorager)(nil).Stale), ctx, userID, revision, limit)
+}
+
+// StaleUserKeys mocks base method.
+func (m *MockStorager) StaleUserKeys(ctx context.Context, keyID string, userID int64, limit int) ([]storage.UserKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StaleUserKeys", ctx, keyID, userID, limit)
+	ret0, _ := ret[0].([]storage.UserKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StaleUserKeys indicates an expected call of StaleUserKeys.
+func (mr *MockStoragerMockRecorder) StaleUserKeys(ctx, keyID, userID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StaleUserKeys", reflect.TypeOf((*MockStorager)(nil).StaleUserKeys), ctx, keyID, userID, limit)
+}
+
+// Unindexed mocks base method.
+func (m *MockStorager) Unindexed(ctx context.Context, userID, revision int64, limit int) ([]storage.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unindexed", ctx, userID, revision, limit)
+	ret0, _ := ret[0].([]storage.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unindexed indicates an expected call of Unindexed.
+func (mr *MockStoragerMockRecorder) Unindexed(ctx, userID, revision, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unindexed", reflect.TypeOf((*MockStorager)(nil).Unindexed), ctx, userID, revision, limit)
+}
+
+// UserKey mocks base method.
+func (m *MockStorager) UserKey(ctx context.Context, userID int64) (storage.UserKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserKey", ctx, userID)
+	ret0, _ := ret[0].(storage.UserKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserKey indicates an expected call of UserKey.
+func (mr *MockStoragerMockRecorder) UserKey(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockStorager)(nil).Snapshot), ctx, userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserKey", reflect.TypeOf((*MockStorager)(nil).UserKey), ctx, userID)
 }
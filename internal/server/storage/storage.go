@@ -10,7 +10,10 @@ import (
 )
 
 var (
-	ErrInternal = errors.New("internal error")
+	ErrInternal  = errors.New("internal error")
+	ErrConflict  = errors.New("item was changed after base revision")
+	ErrDuplicate = errors.New("request was already saved")
+	ErrNotFound  = errors.New("not found")
 )
 
 func New(databaseURL string, timeout time.Duration) (*pgxpool.Pool, error) {
@@ -22,7 +25,7 @@ func New(databaseURL string, timeout time.Duration) (*pgxpool.Pool, error) {
 		return nil, fmt.Errorf("init database error: %w", ErrInternal)
 	}
 
-	if err = migrate(pool, 1); err != nil {
+	if err = migrate(pool, 13); err != nil {
 		return nil, fmt.Errorf("migrate database error: %w", ErrInternal)
 	}
 
@@ -1,9 +1,56 @@
 package storage
 
+// Item is a single row of the append-only store table.
+// Deleted item is a tombstone: it hides all earlier versions of the same key.
+// Revision is a per-user monotonic number assigned by the server on save.
+// BaseRevision is the revision of the version the client edited.
+// Conflict item was written against a stale base revision, it is kept aside and does not replace the current version.
+// Kind and Key are opaque identifiers of the item computed by the client, Data is the item encrypted by the client.
+// Indexed row keeps blind indexes of Kind and Key in the columns and the identifiers encrypted in Identity,
+// rows saved before blind indexes keep them encrypted deterministically.
+// CreatedAt is the client time of creation, it is encrypted with the item and left 0 for end-to-end encrypted items.
+// SavedAt is the server time of saving (unix seconds), it is set by the database.
+// Bound item data is encrypted with the user, kind and key as associated data: it is not decrypted in another row.
+// UserKey item data is encrypted with the data key of the user, otherwise it is encrypted with the server key KeyID
+// (empty for rows saved before key IDs).
 type Item struct {
-	UserID    int64
-	Kind      string
-	Key       string
-	Data      []byte
-	CreatedAt int64
+	UserID       int64
+	Kind         string
+	Key          string
+	Data         []byte
+	CreatedAt    int64
+	Deleted      bool
+	Revision     int64
+	BaseRevision int64
+	Conflict     bool
+	SavedAt      int64
+	Bound        bool
+	KeyID        string
+	UserKey      bool
+	Identity     []byte
+	Indexed      bool
+}
+
+// UserKey is the data key of the user wrapped by the key-encryption key KeyID.
+type UserKey struct {
+	UserID  int64
+	Wrapped []byte
+	KeyID   string
+}
+
+// Chunk is the part number N of the file uploaded by the user. Hash is SHA-256 (hex) of the chunk sent by the client,
+// the chunk is kept in the blob store by the hash. Chunks saved before the blob store keep Data encrypted by the client
+// with the file key and by the server with the data key of the user.
+type Chunk struct {
+	UserID int64
+	FileID string
+	N      int
+	Data   []byte
+	Hash   string
+}
+
+// BlobRef is the blob of the chunk with the Hash uploaded by the user.
+type BlobRef struct {
+	UserID int64
+	Hash   string
 }
@@ -1,53 +1,167 @@
 // encrypt module provides methods for encrypt and decrypt the text using the AES (Advanced Encryption Standard) algorithm.
+//
+// Encrypt produces versioned message, version 1 layout:
+//
+//	version (1 byte) | salt (16 bytes) | nonce (12 bytes) | AES-256-GCM ciphertext with tag
+//
+// The message key is derived from the secret and the random salt with HKDF-SHA256, the nonce is random,
+// so equal texts give different messages. Associated data is authenticated but not stored in the message:
+// the message is decrypted only with the same associated data. The secret should be random (not a user password).
+//
+// Version 2 message is written by Keyring, it names the key it is encrypted with:
+//
+//	version (1 byte) | key ID length (1 byte) | key ID | salt (16 bytes) | nonce (12 bytes) | AES-256-GCM ciphertext with tag
+//
+// Messages written before versioning (hex encoded AES-GCM with the nonce fixed by the secret) are still decrypted.
+// Values which must be equal for equal texts use BlindIndex, not encryption.
 package encrypt
 
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
 )
 
-func EncodeMsg(msgBytes []byte, secret string) string {
-	key := sha256.Sum256([]byte(secret))
+const (
+	Version1 byte = 1
+	Version2 byte = 2
 
-	aesblock, err := aes.NewCipher(key[:])
-	if err != nil {
-		panic(err)
+	saltSize  = 16
+	nonceSize = 12
+)
+
+var (
+	ErrEncrypt   = errors.New("encryption error")
+	ErrDecrypt   = errors.New("decryption error")
+	ErrMalformed = errors.New("malformed message")
+)
+
+// Encrypt encrypts the text with the key derived from the secret, ad is optional associated data.
+func Encrypt(text []byte, secret string, ad []byte) ([]byte, error) {
+	return seal([]byte{Version1}, text, secret, ad)
+}
+
+// Decrypt decrypts the message written by Encrypt with the same secret and associated data.
+// Message without version is decrypted as written by EncodeMsg, associated data must be empty for it.
+func Decrypt(msg []byte, secret string, ad []byte) ([]byte, error) {
+	if len(msg) == 0 {
+		return nil, ErrMalformed
 	}
-	aesgcm, err := cipher.NewGCM(aesblock)
-	if err != nil {
-		panic(err)
+
+	switch msg[0] {
+	case Version1:
+		return open(msg, 1, secret, ad)
+
+	default:
+		// legacy message is hex encoded, its first byte is never Version1
+		if len(ad) != 0 {
+			return nil, fmt.Errorf("%w: legacy message has no associated data", ErrDecrypt)
+		}
+		text, err := DecodeMsg(string(msg), secret)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(text), nil
 	}
+}
+
+// EncodeMsg encrypts the text with the nonce fixed by the secret and encodes it into hex.
+// Equal texts give equal messages and the same nonce is reused for every text: it is insecure
+// and it is kept only to write test data of the format stored before BlindIndex.
+func EncodeMsg(msgBytes []byte, secret string) string {
+	key := sha256.Sum256([]byte(secret))
 
+	// key is always 32 bytes, AES-256 and GCM with the standard nonce size cannot fail
+	aesgcm, _ := newGCM(key[:])
 	nonce := key[len(key)-aesgcm.NonceSize():]
 
 	dst := aesgcm.Seal(nil, nonce, msgBytes, nil) // зашифровываем
 	return hex.EncodeToString(dst)
 }
 
-func DecodeMsg(msg string, secret string) string {
+// DecodeMsg decrypts the message written by EncodeMsg.
+func DecodeMsg(msg string, secret string) (string, error) {
 	key := sha256.Sum256([]byte(secret))
 
-	aesblock, err := aes.NewCipher(key[:])
-	if err != nil {
-		panic(err)
-	}
-	aesgcm, err := cipher.NewGCM(aesblock)
+	aesgcm, err := newGCM(key[:])
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("%w: %w", ErrDecrypt, err)
 	}
 
 	decodedMsg, err := hex.DecodeString(msg)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("%w: %w", ErrMalformed, err)
 	}
 
 	nonce := key[len(key)-aesgcm.NonceSize():]
 	decrypted, err := aesgcm.Open(nil, nonce, decodedMsg, nil)
 	if err != nil {
-		panic(err)
+		return "", ErrDecrypt
+	}
+
+	return string(decrypted), nil
+}
+
+// seal appends random salt and nonce to the message header and encrypts the text after it.
+func seal(header []byte, text []byte, secret string, ad []byte) ([]byte, error) {
+	n := len(header)
+	header = append(header, make([]byte, saltSize+nonceSize)...)
+	if _, err := rand.Read(header[n:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncrypt, err)
+	}
+	salt, nonce := header[n:n+saltSize], header[n+saltSize:]
+
+	aesgcm, err := newGCM(deriveKey(secret, salt))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncrypt, err)
 	}
 
-	return string(decrypted)
+	// header is authenticated too: changed version, key or salt fails decryption
+	return aesgcm.Seal(header, nonce, text, additionalData(header, ad)), nil
+}
+
+// open decrypts the message written by seal, n is the length of the header before salt and nonce.
+func open(msg []byte, n int, secret string, ad []byte) ([]byte, error) {
+	if len(msg) < n+saltSize+nonceSize {
+		return nil, ErrMalformed
+	}
+	header := msg[:n+saltSize+nonceSize]
+	salt, nonce := header[n:n+saltSize], header[n+saltSize:]
+
+	aesgcm, err := newGCM(deriveKey(secret, salt))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	text, err := aesgcm.Open(nil, nonce, msg[len(header):], additionalData(header, ad))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return text, nil
+}
+
+func deriveKey(secret string, salt []byte) []byte {
+	key := make([]byte, keySize)
+	_, _ = io.ReadFull(hkdf.New(sha256.New, []byte(secret), salt, []byte("gophkeeper encrypt v1")), key)
+	return key
+}
+
+func additionalData(header []byte, ad []byte) []byte {
+	res := make([]byte, 0, len(header)+len(ad))
+	res = append(res, header...)
+	return append(res, ad...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(aesblock)
 }
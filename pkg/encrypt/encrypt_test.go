@@ -11,7 +11,139 @@ func TestEncodeMsg(t *testing.T) {
 	key := "testpassword"
 	encodeHash := EncodeMsg([]byte(sourceMsg), key)
 	require.NotEmpty(t, sourceMsg)
-	resultMsg := DecodeMsg(encodeHash, key)
-	require.NotEmpty(t, resultMsg)
+	resultMsg, err := DecodeMsg(encodeHash, key)
+	require.NoError(t, err)
 	require.Equal(t, sourceMsg, resultMsg)
+
+	_, err = DecodeMsg(encodeHash, "otherpassword")
+	require.ErrorIs(t, err, ErrDecrypt)
+	_, err = DecodeMsg("not hex", key)
+	require.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestEncrypt(t *testing.T) {
+	key := "testpassword"
+	ad := []byte("user 1")
+
+	msg, err := Encrypt([]byte("some text"), key, ad)
+	require.NoError(t, err)
+	require.Equal(t, Version1, msg[0])
+
+	again, err := Encrypt([]byte("some text"), key, ad)
+	require.NoError(t, err)
+	require.NotEqual(t, msg, again)
+
+	text, err := Decrypt(msg, key, ad)
+	require.NoError(t, err)
+	require.Equal(t, "some text", string(text))
+}
+
+func TestDecryptFailCases(t *testing.T) {
+	key := "testpassword"
+	msg, err := Encrypt([]byte("some text"), key, []byte("user 1"))
+	require.NoError(t, err)
+
+	changed := append([]byte{}, msg...)
+	changed[len(changed)-1] ^= 1
+
+	tests := []struct {
+		name        string
+		msg         []byte
+		key         string
+		ad          []byte
+		expectedErr error
+	}{
+		{name: "other key", msg: msg, key: "otherpassword", ad: []byte("user 1"), expectedErr: ErrDecrypt},
+		{name: "other associated data", msg: msg, key: key, ad: []byte("user 2"), expectedErr: ErrDecrypt},
+		{name: "no associated data", msg: msg, key: key, expectedErr: ErrDecrypt},
+		{name: "changed message", msg: changed, key: key, ad: []byte("user 1"), expectedErr: ErrDecrypt},
+		{name: "short message", msg: msg[:10], key: key, ad: []byte("user 1"), expectedErr: ErrMalformed},
+		{name: "empty message", msg: nil, key: key, expectedErr: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.msg, tt.key, tt.ad)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	key := "testpassword"
+	legacy := []byte(EncodeMsg([]byte("some text"), key))
+
+	text, err := Decrypt(legacy, key, nil)
+	require.NoError(t, err)
+	require.Equal(t, "some text", string(text))
+
+	_, err = Decrypt(legacy, key, []byte("user 1"))
+	require.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestVaultKey(t *testing.T) {
+	key := DeriveVaultKey("master password", "Name@example.com")
+
+	sealed, err := key.Seal([]byte("some text"))
+	require.NoError(t, err)
+	require.NotContains(t, string(sealed), "some text")
+
+	again, err := key.Seal([]byte("some text"))
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, again)
+
+	// the same password and email give the same key on another client
+	data, err := DeriveVaultKey("master password", "name@example.com").Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "some text", string(data))
+
+	require.Equal(t, key.BlindID("text", "key1"), DeriveVaultKey("master password", "name@example.com").BlindID("text", "key1"))
+	require.NotEqual(t, key.BlindID("text", "key1"), key.BlindID("text", "key2"))
+	require.NotEqual(t, key.BlindID("ab", "c"), key.BlindID("a", "bc"))
+
+	require.Equal(t, key.FileKey("hash1"), DeriveVaultKey("master password", "name@example.com").FileKey("hash1"))
+	require.NotEqual(t, key.FileKey("hash1"), key.FileKey("hash2"))
+	require.NotEqual(t, key.FileKey("hash1"), DeriveVaultKey("wrong password", "name@example.com").FileKey("hash1"))
+}
+
+func TestVaultKeyAssociated(t *testing.T) {
+	key := DeriveVaultKey("master password", "name@example.com")
+	sealed, err := key.Seal([]byte("some text"), "type1", "item1")
+	require.NoError(t, err)
+
+	data, err := key.Open(sealed, "type1", "item1")
+	require.NoError(t, err)
+	require.Equal(t, "some text", string(data))
+
+	// the ciphertext moved to another item or opened without identifiers is rejected
+	_, err = key.Open(sealed, "type1", "item2")
+	require.ErrorIs(t, err, ErrDecrypt)
+	_, err = key.Open(sealed, "type1item1")
+	require.ErrorIs(t, err, ErrDecrypt)
+	_, err = key.Open(sealed)
+	require.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestVaultKeyWrongPassword(t *testing.T) {
+	sealed, err := DeriveVaultKey("master password", "name@example.com").Seal([]byte("some text"))
+	require.NoError(t, err)
+
+	_, err = DeriveVaultKey("wrong password", "name@example.com").Open(sealed)
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = DeriveVaultKey("master password", "other@example.com").Open(sealed)
+	require.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = DeriveVaultKey("master password", "name@example.com").Open([]byte("short"))
+	require.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestBlindIndex(t *testing.T) {
+	index := BlindIndex("secret", "type", "t1")
+	require.Equal(t, index, BlindIndex("secret", "type", "t1"))
+	require.Len(t, index, 64)
+
+	require.NotEqual(t, index, BlindIndex("other secret", "type", "t1"))
+	require.NotEqual(t, index, BlindIndex("secret", "key", "t1"))
+	require.NotEqual(t, BlindIndex("secret", "ab", "c"), BlindIndex("secret", "a", "bc"))
 }
@@ -0,0 +1,125 @@
+package encrypt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const maxKeyIDSize = 255
+
+var (
+	ErrUnknownKey = errors.New("key is not in the keyring")
+	ErrKeyring    = errors.New("invalid keyring")
+)
+
+// Keyring holds the secrets by key ID. Messages are encrypted with the current key and name it,
+// so any key still in the ring decrypts them. Messages written before key IDs (version 1 and legacy)
+// are decrypted with the legacy key.
+// The key is retired (removed from the ring) after all messages encrypted with it are encrypted again.
+type Keyring struct {
+	keys    map[string]string
+	current string
+	legacy  string
+}
+
+// NewKeyring checks the keys and returns the keyring. The current key must be in the ring,
+// the legacy key is optional (empty ID) but if set it must be in the ring too.
+func NewKeyring(keys map[string]string, current string, legacy string) (*Keyring, error) {
+	for id, secret := range keys {
+		if id == "" || len(id) > maxKeyIDSize {
+			return nil, fmt.Errorf("%w: key ID %q must be 1 to %d bytes", ErrKeyring, id, maxKeyIDSize)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("%w: key %q has no secret", ErrKeyring, id)
+		}
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %q: %w", ErrKeyring, current, ErrUnknownKey)
+	}
+	if _, ok := keys[legacy]; legacy != "" && !ok {
+		return nil, fmt.Errorf("%w: legacy key %q: %w", ErrKeyring, legacy, ErrUnknownKey)
+	}
+
+	ring := make(map[string]string, len(keys))
+	for id, secret := range keys {
+		ring[id] = secret
+	}
+	return &Keyring{keys: ring, current: current, legacy: legacy}, nil
+}
+
+// Current returns ID of the key new messages are encrypted with.
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Legacy returns ID of the key messages without key ID are decrypted with, empty if it is not set.
+func (k *Keyring) Legacy() string {
+	return k.legacy
+}
+
+// IDs returns sorted IDs of the keys in the ring.
+func (k *Keyring) IDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Has reports if the key is in the ring.
+func (k *Keyring) Has(id string) bool {
+	_, ok := k.keys[id]
+	return ok
+}
+
+// Encrypt encrypts the text with the current key, ad is optional associated data.
+func (k *Keyring) Encrypt(text []byte, ad []byte) ([]byte, error) {
+	header := make([]byte, 0, 2+len(k.current)+saltSize+nonceSize)
+	header = append(header, Version2, byte(len(k.current)))
+	header = append(header, k.current...)
+	return seal(header, text, k.keys[k.current], ad)
+}
+
+// Decrypt decrypts the message with the key it names or, for the message without key ID, with the legacy key.
+func (k *Keyring) Decrypt(msg []byte, ad []byte) ([]byte, error) {
+	id, n, err := k.keyID(msg)
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	if n == 0 {
+		return Decrypt(msg, secret, ad)
+	}
+	return open(msg, n, secret, ad)
+}
+
+// KeyID returns ID of the key the message is encrypted with.
+func (k *Keyring) KeyID(msg []byte) (string, error) {
+	id, _, err := k.keyID(msg)
+	return id, err
+}
+
+// keyID parses the message header, n is the header length before salt and nonce (0 for the message without key ID).
+func (k *Keyring) keyID(msg []byte) (id string, n int, err error) {
+	if len(msg) == 0 {
+		return "", 0, ErrMalformed
+	}
+	if msg[0] != Version2 {
+		if k.legacy == "" {
+			return "", 0, fmt.Errorf("%w: message has no key ID and legacy key is not set", ErrUnknownKey)
+		}
+		return k.legacy, 0, nil
+	}
+
+	if len(msg) < 2 || msg[1] == 0 || len(msg) < 2+int(msg[1]) {
+		return "", 0, ErrMalformed
+	}
+	n = 2 + int(msg[1])
+	return string(msg[2:n]), n, nil
+}
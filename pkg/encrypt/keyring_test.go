@@ -0,0 +1,113 @@
+package encrypt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := NewKeyring(map[string]string{"1": "first secret"}, "1", "1")
+	require.NoError(t, err)
+	msg, err := old.Encrypt([]byte("some text"), []byte("user 1"))
+	require.NoError(t, err)
+	require.Equal(t, Version2, msg[0])
+
+	ring, err := NewKeyring(map[string]string{"1": "first secret", "2": "second secret"}, "2", "1")
+	require.NoError(t, err)
+
+	// message encrypted with the old key is decrypted while the key is in the ring
+	id, err := ring.KeyID(msg)
+	require.NoError(t, err)
+	require.Equal(t, "1", id)
+	text, err := ring.Decrypt(msg, []byte("user 1"))
+	require.NoError(t, err)
+	require.Equal(t, "some text", string(text))
+
+	msg, err = ring.Encrypt(text, []byte("user 1"))
+	require.NoError(t, err)
+	id, err = ring.KeyID(msg)
+	require.NoError(t, err)
+	require.Equal(t, "2", id)
+
+	// old key is retired
+	retired, err := NewKeyring(map[string]string{"2": "second secret"}, "2", "")
+	require.NoError(t, err)
+	text, err = retired.Decrypt(msg, []byte("user 1"))
+	require.NoError(t, err)
+	require.Equal(t, "some text", string(text))
+	_, err = old.Decrypt(msg, []byte("user 1"))
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyringLegacy(t *testing.T) {
+	ring, err := NewKeyring(map[string]string{"1": "first secret", "2": "second secret"}, "2", "1")
+	require.NoError(t, err)
+
+	v1, err := Encrypt([]byte("version 1"), "first secret", []byte("user 1"))
+	require.NoError(t, err)
+	text, err := ring.Decrypt(v1, []byte("user 1"))
+	require.NoError(t, err)
+	require.Equal(t, "version 1", string(text))
+
+	legacy := []byte(EncodeMsg([]byte("legacy"), "first secret"))
+	id, err := ring.KeyID(legacy)
+	require.NoError(t, err)
+	require.Equal(t, "1", id)
+	text, err = ring.Decrypt(legacy, nil)
+	require.NoError(t, err)
+	require.Equal(t, "legacy", string(text))
+
+	noLegacy, err := NewKeyring(map[string]string{"2": "second secret"}, "2", "")
+	require.NoError(t, err)
+	_, err = noLegacy.Decrypt(v1, []byte("user 1"))
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeyringFailCases(t *testing.T) {
+	ring, err := NewKeyring(map[string]string{"1": "first secret", "2": "second secret"}, "2", "")
+	require.NoError(t, err)
+	msg, err := ring.Encrypt([]byte("some text"), nil)
+	require.NoError(t, err)
+
+	// key ID is authenticated: the message is not decrypted with another key of the ring
+	changed := append([]byte{}, msg...)
+	changed[2] = '1'
+
+	tests := []struct {
+		name        string
+		msg         []byte
+		expectedErr error
+	}{
+		{name: "changed key ID", msg: changed, expectedErr: ErrDecrypt},
+		{name: "empty message", msg: nil, expectedErr: ErrMalformed},
+		{name: "short key ID", msg: msg[:2], expectedErr: ErrMalformed},
+		{name: "short message", msg: msg[:10], expectedErr: ErrMalformed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ring.Decrypt(test.msg, nil)
+			require.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestNewKeyringFailCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		current string
+		legacy  string
+	}{
+		{name: "no current key", keys: map[string]string{"1": "secret"}, current: "2"},
+		{name: "no legacy key", keys: map[string]string{"1": "secret"}, current: "1", legacy: "0"},
+		{name: "empty secret", keys: map[string]string{"1": ""}, current: "1"},
+		{name: "empty key ID", keys: map[string]string{"": "secret"}, current: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewKeyring(test.keys, test.current, test.legacy)
+			require.ErrorIs(t, err, ErrKeyring)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package encrypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Argon2id parameters of master password derivation (RFC 9106 second recommended option).
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024
+	kdfThreads = 4
+	keySize    = 32
+)
+
+// VaultKey is the key of the user vault, it is derived from the master password on the client and never leaves it.
+// Items are encrypted with AES-256-GCM before they are sent, identifiers of the items are keyed hashes (HMAC-SHA256):
+// the server can find versions of the same item but cannot read or guess it.
+type VaultKey struct {
+	data  []byte
+	index []byte
+	files []byte
+}
+
+// DeriveVaultKey derives the vault key from the master password with Argon2id.
+// The salt is derived from the user email, so every client of the user derives the same key
+// without asking the server, and the same password of different users gives different keys.
+// Separate subkeys for encryption, identifiers and file keys are expanded with HKDF.
+func DeriveVaultKey(password string, email string) *VaultKey {
+	salt := sha256.Sum256([]byte("gophkeeper vault:" + strings.ToLower(strings.TrimSpace(email))))
+	master := argon2.IDKey([]byte(password), salt[:], kdfTime, kdfMemory, kdfThreads, keySize)
+
+	return &VaultKey{
+		data:  subkey(master, "item data"),
+		index: subkey(master, "item identifiers"),
+		files: subkey(master, "file keys"),
+	}
+}
+
+func subkey(master []byte, purpose string) []byte {
+	key := make([]byte, keySize)
+	_, _ = io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(purpose)), key)
+	return key
+}
+
+// Seal encrypts the data bound to the associated parts (identifiers of the item), random nonce is prepended to the ciphertext.
+// The ciphertext is opened only with the same parts, so it cannot be moved to another item.
+func (k *VaultKey) Seal(data []byte, associated ...string) ([]byte, error) {
+	aesgcm, err := newGCM(k.data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncrypt, err)
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncrypt, err)
+	}
+	return aesgcm.Seal(nonce, nonce, data, associatedData(associated)), nil
+}
+
+// Open decrypts the data sealed by the same key with the same associated parts,
+// ErrDecrypt is returned if the data was sealed by another key or for other parts or changed.
+func (k *VaultKey) Open(sealed []byte, associated ...string) ([]byte, error) {
+	aesgcm, err := newGCM(k.data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+
+	if len(sealed) < aesgcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aesgcm.NonceSize()], sealed[aesgcm.NonceSize():]
+	data, err := aesgcm.Open(nil, nonce, ciphertext, associatedData(associated))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
+
+// associatedData encodes the parts like blindID does, no parts is no associated data.
+func associatedData(parts []string) []byte {
+	if len(parts) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		_, _ = fmt.Fprintf(&b, "%d:%s", len(part), part)
+	}
+	return []byte(b.String())
+}
+
+// BlindID returns the keyed hash of the parts, equal parts give equal identifiers.
+func (k *VaultKey) BlindID(parts ...string) string {
+	return blindID(k.index, parts)
+}
+
+// FileKey returns the key encrypting chunks of the file with the content hash. The key depends on the content only,
+// so the same file added again (on any client of the user) is encrypted with the same key and its uploaded chunks are reused.
+func (k *VaultKey) FileKey(hash string) []byte {
+	mac := hmac.New(sha256.New, k.files)
+	mac.Write([]byte(hash))
+	return mac.Sum(nil)
+}
+
+// BlindIndex returns the keyed hash (HMAC-SHA256) of the parts with the key derived from the secret:
+// equal parts give equal values, so rows are grouped and found by them, but the parts are not revealed.
+func BlindIndex(secret string, parts ...string) string {
+	return blindID(subkey([]byte(secret), "blind index"), parts)
+}
+
+func blindID(key []byte, parts []string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, part := range parts {
+		// length prefix keeps ("ab", "c") and ("a", "bc") apart
+		_, _ = fmt.Fprintf(mac, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -12,10 +12,28 @@ func (t MessageType) String() string {
 }
 
 const (
-	Update   MessageType = "update"
-	New      MessageType = "new"
-	Snapshot MessageType = "snapshot"
-	Error    MessageType = "error"
+	Update     MessageType = "update"
+	New        MessageType = "new"
+	Snapshot   MessageType = "snapshot"
+	Error      MessageType = "error"
+	Delete     MessageType = "delete"
+	Conflict   MessageType = "conflict"
+	History    MessageType = "history"
+	SnapshotAt MessageType = "snapshot_at"
+	Ack        MessageType = "ack"
+
+	SnapshotBegin MessageType = "snapshot_begin"
+	SnapshotChunk MessageType = "snapshot_chunk"
+	SnapshotEnd   MessageType = "snapshot_end"
+)
+
+// ErrorCode is the kind of error message, client decides by the code whether to retry the request.
+type ErrorCode string
+
+const (
+	CodeInvalidToken   ErrorCode = "invalid_token"
+	CodeInvalidMessage ErrorCode = "invalid_message"
+	CodeInternal       ErrorCode = "internal"
 )
 
 const (
@@ -23,49 +41,205 @@ const (
 	TextItem ItemType = "text"
 	BinItem  ItemType = "bin"
 	CardItem ItemType = "card"
+
+	FolderItem ItemType = "folder"
 )
 
+// Items are identified by ID generated by the client when the item is created, so items with the same login,
+// key or number are kept apart. Items saved before IDs have no ID in JSON, the natural key (login, key or number)
+// is their ID. Every item carries custom fields added by the user besides the fields of its type.
+// Items are labeled with several Tags and put into Folder (folder ID, empty for the top level).
+// Items saved before tags have the single "tag" in JSON, it is read as the only tag (Normalize).
+
 type Credentials struct {
-	Type     ItemType `json:"type"` //cred
-	Tag      string   `json:"tag"`
-	Login    string   `json:"login"`
-	Password string   `json:"password"`
-	Comment  string   `json:"comment"`
-	Created  int64    `json:"created"`
+	ID       string        `json:"id,omitempty"`
+	Type     ItemType      `json:"type"` //cred
+	Tags     []string      `json:"tags,omitempty"`
+	Folder   string        `json:"folder,omitempty"`
+	Login    string        `json:"login"`
+	Password string        `json:"password"`
+	Comment  string        `json:"comment"`
+	Fields   []CustomField `json:"fields,omitempty"`
+	Created  int64         `json:"created"`
 }
 
 type Text struct {
-	Type    ItemType `json:"type"` //text
-	Tag     string   `json:"tag"`
-	Key     string   `json:"key"`
-	Value   string   `json:"value"`
-	Comment string   `json:"comment"`
-	Created int64    `json:"created"`
+	ID      string        `json:"id,omitempty"`
+	Type    ItemType      `json:"type"` //text
+	Tags    []string      `json:"tags,omitempty"`
+	Folder  string        `json:"folder,omitempty"`
+	Key     string        `json:"key"`
+	Value   string        `json:"value"`
+	Comment string        `json:"comment"`
+	Fields  []CustomField `json:"fields,omitempty"`
+	Created int64         `json:"created"`
 }
 
+// Binary is the file kept by the user. Content of files added before chunked upload is in Value,
+// content of the other files is uploaded in encrypted chunks referenced by File.
 type Binary struct {
-	Type    ItemType `json:"type"` //bin
-	Tag     string   `json:"tag"`
-	Key     string   `json:"key"`
-	Value   []byte   `json:"value"`
-	Comment string   `json:"comment"`
-	Created int64    `json:"created"`
+	ID      string        `json:"id,omitempty"`
+	Type    ItemType      `json:"type"` //bin
+	Tags    []string      `json:"tags,omitempty"`
+	Folder  string        `json:"folder,omitempty"`
+	Key     string        `json:"key"`
+	Value   []byte        `json:"value"`
+	File    *FileRef      `json:"file,omitempty"`
+	Comment string        `json:"comment"`
+	Fields  []CustomField `json:"fields,omitempty"`
+	Created int64         `json:"created"`
+}
+
+// FileRef references the file content uploaded to the server in chunks of ChunkSize bytes (the last one may be shorter).
+// Every chunk is encrypted with Key, the key is known only to the clients: it travels inside the encrypted item.
+// Hash is SHA-256 (hex) of the whole content, it is checked after download.
+type FileRef struct {
+	ID        string `json:"id"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`
+	Hash      string `json:"hash"`
+	Key       []byte `json:"key"`
 }
 
 type Card struct {
-	Type    ItemType `json:"type"` //card
-	Tag     string   `json:"tag"`
-	Number  string   `json:"number"`
-	Exp     string   `json:"exp"`
-	CVV     int32    `json:"cvv"`
-	Comment string   `json:"comment"`
+	ID      string        `json:"id,omitempty"`
+	Type    ItemType      `json:"type"` //card
+	Tags    []string      `json:"tags,omitempty"`
+	Folder  string        `json:"folder,omitempty"`
+	Number  string        `json:"number"`
+	Exp     string        `json:"exp"`
+	CVV     int32         `json:"cvv"`
+	Comment string        `json:"comment"`
+	Fields  []CustomField `json:"fields,omitempty"`
+	Created int64         `json:"created"`
+}
+
+// Folder groups items, folders are nested: Folder is the ID of the parent folder, empty for the top level.
+// Folders are synced like items.
+type Folder struct {
+	ID      string   `json:"id,omitempty"`
+	Type    ItemType `json:"type"` //folder
+	Name    string   `json:"name"`
+	Folder  string   `json:"folder,omitempty"`
 	Created int64    `json:"created"`
 }
 
-// message from server - snapshot, update, error
-// message from client - new
+// CustomFieldType is the type of the custom field, it decides how the value is checked and shown.
+type CustomFieldType string
+
+const (
+	TextCustomField   CustomFieldType = "text"
+	HiddenCustomField CustomFieldType = "hidden"
+	URLCustomField    CustomFieldType = "url"
+	DateCustomField   CustomFieldType = "date"
+	OTPCustomField    CustomFieldType = "otp"
+)
+
+// CustomField is the named field added by the user to the item: site, person, bank, one-time activation codes.
+// Date is YYYY-MM-DD, OTP secret is base32 encoded (RFC 4648). Hidden and OTP secret values are masked when items are listed.
+type CustomField struct {
+	Name  string          `json:"name"`
+	Type  CustomFieldType `json:"type"`
+	Value string          `json:"value"`
+}
+
+// Secret reports whether the value of the field is masked when the item is listed.
+func (f CustomField) Secret() bool {
+	return f.Type == HiddenCustomField || f.Type == OTPCustomField
+}
+
+// ConflictVersion is a version of the item rejected by the server because it was based on a stale revision.
+// Deleted conflict is a rejected deletion.
+type ConflictVersion struct {
+	Revision int64
+	Type     ItemType
+	Key      string
+	Value    []byte
+	Deleted  bool
+}
+
+// Version is a past version of the item kept by the server.
+// Created is the server time of saving (unix seconds).
+type Version struct {
+	Revision int64  `json:"revision"`
+	Created  int64  `json:"created"`
+	Value    []byte `json:"value"`
+	Deleted  bool   `json:"deleted,omitempty"`
+	Conflict bool   `json:"conflict,omitempty"`
+}
+
+// PendingChange is the local change not acknowledged by the server yet.
+// Code and Error are set if the server rejected the change.
+// Legacy change deletes the item version saved before end-to-end encryption (type and key are not hashed).
+type PendingChange struct {
+	ID           string
+	Type         ItemType
+	Key          string
+	Value        []byte
+	Deleted      bool
+	BaseRevision int64
+	Legacy       bool
+	Code         ErrorCode
+	Error        string
+}
+
+// Upload is the file being uploaded in chunks. Binary item referencing the file is sent to the server
+// after all chunks are saved. Upload is resumed from Path after the client restart, it is failed with Error
+// if the file size or ModTime (unix nanoseconds) changed meanwhile. Binary saved before files is uploaded
+// from Content, it has no Path.
+type Upload struct {
+	Binary  Binary
+	Path    string
+	ModTime int64
+	Content []byte
+	Error   string
+}
+
+// Envelope is the item encrypted by the client, the server stores and relays it without decrypting.
+// Type and Key are opaque identifiers of the item type and the item ID (keyed hashes computed by the client),
+// the server uses them only to find versions of the same item. Data is the encrypted item.
+// Files are IDs of the uploaded files the item references, the server keeps their chunks while any version
+// references them. History request contains Type and Key only.
+type Envelope struct {
+	Type  string   `json:"type"`
+	Key   string   `json:"key"`
+	Data  []byte   `json:"data,omitempty"`
+	Files []string `json:"files,omitempty"`
+}
+
+// PointInTime is the value of snapshot_at request, At is unix seconds.
+type PointInTime struct {
+	At int64 `json:"at"`
+}
+
+// message from server - snapshot_begin, snapshot_chunk, snapshot_end, update, delete, conflict, history, snapshot_at, ack, error
+// message from client - new, delete, history, snapshot_at
+// ID is set by the client for every message, the response (ack, error, history, snapshot_at) has the same ID.
+// Ack confirms the change (new, delete) was saved, Revision of the ack is the revision of the saved item.
+// Error contains Code and the reason in Value.
+// Revision is assigned by the server: for update, delete and conflict it is the revision of the saved item,
+// for snapshot end it is the latest user revision included into the snapshot.
+// Full snapshot is sent in parts: snapshot_begin, snapshot_chunk messages with bounded lists of update messages
+// and snapshot_end. The client replaces local state on begin, applies every chunk as it arrives and remembers
+// the revision only on end. Single snapshot message (the whole list in one message) is sent by older servers.
+// BaseRevision is the revision of the item version the client edited, 0 for a new item.
+// Conflict message is sent when the item was changed after its base revision,
+// it contains the rejected version (Deleted is set if the rejected version is a tombstone), the current version is kept.
+// History request contains the item identifiers (Envelope without Data), the response contains the item versions.
+// SnapshotAt request contains PointInTime, the response contains the vault as it was at that moment (update messages).
+// Responses are sent in parts like the full snapshot, every part has the ID of the request: snapshot_begin,
+// snapshot_chunk messages with bounded lists of versions (update messages) and snapshot_end. The client does not apply them.
+// Single history (snapshot_at) message with the whole list is sent by older servers.
+// Items are end-to-end encrypted: Value of new, delete, update and conflict messages, of snapshot items and of history versions
+// is Envelope, the server never sees the item in plaintext.
 type Message struct {
-	Token string      `json:"token"`
-	Type  MessageType `json:"type"`
-	Value []byte      `json:"value"`
+	ID           string      `json:"id,omitempty"`
+	Token        string      `json:"token"`
+	Type         MessageType `json:"type"`
+	Value        []byte      `json:"value"`
+	Revision     int64       `json:"revision,omitempty"`
+	BaseRevision int64       `json:"base_revision,omitempty"`
+	Deleted      bool        `json:"deleted,omitempty"`
+	Code         ErrorCode   `json:"code,omitempty"`
 }
@@ -0,0 +1,494 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ShiraazMoollatjie/goluhn"
+)
+
+// FieldKind is the kind of the item field value, it decides how the typed value is encoded into JSON.
+type FieldKind string
+
+const (
+	TextField   FieldKind = "text"
+	NumberField FieldKind = "number"
+	// ListField is typed as comma separated values, it is encoded as the list of strings.
+	ListField FieldKind = "list"
+)
+
+// Field describes the item field. Name is the JSON name of the field, Label is shown to the user.
+// Required field must not be empty, Check returns the reason the value is invalid ("" if it is valid).
+// Sensitive field is the secret, it is typed without echo. ReadOnly field is filled by the client, not typed by the user.
+type Field struct {
+	Name      string
+	Label     string
+	Kind      FieldKind
+	Required  bool
+	Sensitive bool
+	ReadOnly  bool
+	Check     func(value string) string
+}
+
+// Schema describes the item type: its fields in the order they are shown and typed in.
+// Identity is the name of the field identifying items saved before IDs (natural key).
+// Check validates the item as a whole after the fields are valid, it returns the reasons the item is invalid.
+type Schema struct {
+	Type     ItemType
+	Title    string
+	Identity string
+	Fields   []Field
+	Check    func(item map[string]any) []string
+}
+
+// secretMask is shown instead of secret values.
+const secretMask = "******"
+
+var (
+	tagsField    = Field{Name: "tags", Label: "Tags (comma separated)", Kind: ListField}
+	commentField = Field{Name: "comment", Label: "Comment", Kind: TextField}
+)
+
+// schemas are all item types known to the client, the order is the order item types are shown in.
+var schemas = []Schema{
+	{
+		Type:     CredItem,
+		Title:    "credentials",
+		Identity: "login",
+		Fields: []Field{
+			tagsField,
+			{Name: "login", Label: "Login", Kind: TextField, Required: true},
+			{Name: "password", Label: "Password", Kind: TextField, Required: true, Sensitive: true},
+			commentField,
+		},
+	},
+	{
+		Type:     TextItem,
+		Title:    "text",
+		Identity: "key",
+		Fields: []Field{
+			tagsField,
+			{Name: "key", Label: "Key", Kind: TextField, Required: true},
+			{Name: "value", Label: "Value", Kind: TextField, Required: true},
+			commentField,
+		},
+	},
+	{
+		Type:     BinItem,
+		Title:    "binary",
+		Identity: "key",
+		Fields: []Field{
+			tagsField,
+			{Name: "key", Label: "File name", Kind: TextField, Required: true, ReadOnly: true},
+			commentField,
+		},
+		Check: func(item map[string]any) []string {
+			if fieldString(item["value"]) == "" && item["file"] == nil {
+				return []string{"file cannot be empty"}
+			}
+			return nil
+		},
+	},
+	{
+		Type:     CardItem,
+		Title:    "card",
+		Identity: "number",
+		Fields: []Field{
+			tagsField,
+			{Name: "number", Label: "Number", Kind: TextField, Required: true, Check: func(value string) string {
+				if err := goluhn.Validate(value); err != nil {
+					return "card number should pass digit check (Luhn algorithm)"
+				}
+				return ""
+			}},
+			{Name: "exp", Label: "Exp", Kind: TextField},
+			{Name: "cvv", Label: "CVV", Kind: NumberField, Sensitive: true},
+			commentField,
+		},
+	},
+	{
+		Type:     FolderItem,
+		Title:    "folder",
+		Identity: "name",
+		Fields: []Field{
+			{Name: "name", Label: "Name", Kind: TextField, Required: true, Check: func(value string) string {
+				if strings.Contains(value, FolderSeparator) {
+					return fmt.Sprintf("folder name should not contain %q", FolderSeparator)
+				}
+				return ""
+			}},
+		},
+	},
+}
+
+// FolderSeparator separates folder names in the folder path: Work/Banks.
+const FolderSeparator = "/"
+
+// FolderPaths returns paths of the folders (Work/Banks) by the folder ID.
+// The folder whose parent is missing is at the top level.
+func FolderPaths(folders []Folder) map[string]string {
+	byID := make(map[string]Folder, len(folders))
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+
+	paths := make(map[string]string, len(folders))
+	for _, folder := range folders {
+		names := []string{folder.Name}
+		// parents are walked at most once each, so the cycle made by concurrent moves ends
+		seen := map[string]bool{folder.ID: true}
+		for parent, ok := byID[folder.Folder]; ok && !seen[parent.ID]; parent, ok = byID[parent.Folder] {
+			seen[parent.ID] = true
+			names = append([]string{parent.Name}, names...)
+		}
+		paths[folder.ID] = strings.Join(names, FolderSeparator)
+	}
+	return paths
+}
+
+// Schemas returns schemas of all item types.
+func Schemas() []Schema {
+	return schemas
+}
+
+// Lookup returns the schema of the item type, false if the type is unknown.
+func Lookup(kind ItemType) (Schema, bool) {
+	for _, schema := range schemas {
+		if schema.Type == kind {
+			return schema, true
+		}
+	}
+	return Schema{}, false
+}
+
+// Inputs returns the fields typed in by the user.
+func (s Schema) Inputs() []Field {
+	fields := make([]Field, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		if !field.ReadOnly {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// NaturalKey returns the value of the identity field of the item encoded into JSON.
+func (s Schema) NaturalKey(value []byte) string {
+	return fieldString(decodeItem(value)[s.Identity])
+}
+
+// Values returns values of the item fields as they are shown to the user, by field name.
+func (s Schema) Values(value []byte) map[string]string {
+	item := decodeItem(value)
+	values := make(map[string]string, len(s.Fields))
+	for _, field := range s.Fields {
+		values[field.Name] = fieldString(item[field.Name])
+	}
+	return values
+}
+
+// Validate returns the reasons the item encoded into JSON is invalid, the item is valid if there are none.
+func (s Schema) Validate(value []byte) []string {
+	item := decodeItem(value)
+	msg := []string{}
+	for _, field := range s.Fields {
+		v := fieldString(item[field.Name])
+		if v == "" {
+			if field.Required {
+				msg = append(msg, fmt.Sprintf("%s should not be empty", strings.ToLower(field.Label)))
+			}
+			continue
+		}
+		if field.Check != nil {
+			if reason := field.Check(v); reason != "" {
+				msg = append(msg, reason)
+			}
+		}
+	}
+	msg = append(msg, validateCustomFields(ItemFields(value))...)
+	if len(msg) == 0 && s.Check != nil {
+		msg = append(msg, s.Check(item)...)
+	}
+	return msg
+}
+
+// validateCustomFields returns the reasons the custom fields are invalid.
+func validateCustomFields(fields []CustomField) []string {
+	msg := []string{}
+	names := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if field.Name == "" {
+			msg = append(msg, "custom field name should not be empty")
+			continue
+		}
+		if names[field.Name] {
+			msg = append(msg, fmt.Sprintf("custom field %s is repeated", field.Name))
+		}
+		names[field.Name] = true
+		if reason := checkCustomField(field); reason != "" {
+			msg = append(msg, fmt.Sprintf("custom field %s %s", field.Name, reason))
+		}
+	}
+	return msg
+}
+
+// checkCustomField returns the reason the value does not match the field type ("" if it matches).
+func checkCustomField(field CustomField) string {
+	switch field.Type {
+	case TextCustomField, HiddenCustomField:
+		return ""
+	case URLCustomField:
+		u, err := url.Parse(field.Value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "should be URL with scheme and host"
+		}
+	case DateCustomField:
+		if _, err := time.Parse(time.DateOnly, field.Value); err != nil {
+			return "should be date YYYY-MM-DD"
+		}
+	case OTPCustomField:
+		if _, err := decodeOTPSecret(field.Value); err != nil || field.Value == "" {
+			return "should be base32 encoded secret"
+		}
+	default:
+		return fmt.Sprintf("has unknown type %q", field.Type)
+	}
+	return ""
+}
+
+// decodeOTPSecret decodes the base32 secret of one-time codes, spaces and missing padding are allowed.
+func decodeOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+}
+
+// ItemFields returns custom fields of the item encoded into JSON.
+func ItemFields(value []byte) []CustomField {
+	var item struct {
+		Fields []CustomField `json:"fields"`
+	}
+	_ = json.Unmarshal(value, &item)
+	return item.Fields
+}
+
+// Edit sets the typed field values and custom fields of the item encoded into JSON, the other attributes
+// of the item are kept. Nil value is the new item of the type. Fields without values are left as they are.
+func (s Schema) Edit(value []byte, values map[string]string, fields []CustomField) ([]byte, error) {
+	item := decodeItem(value)
+	item["type"] = s.Type
+	for _, field := range s.Fields {
+		v, ok := values[field.Name]
+		if !ok {
+			continue
+		}
+		if field.Kind == ListField {
+			if list := splitList(v); len(list) > 0 {
+				item[field.Name] = list
+			} else {
+				delete(item, field.Name)
+			}
+			continue
+		}
+		if field.Kind != NumberField {
+			item[field.Name] = v
+			continue
+		}
+		if v == "" {
+			delete(item, field.Name)
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s should be a number", strings.ToLower(field.Label))
+		}
+		item[field.Name] = n
+	}
+	if len(fields) > 0 {
+		item["fields"] = fields
+	} else {
+		delete(item, "fields")
+	}
+	return json.Marshal(item)
+}
+
+// Format formats fields of the item encoded into JSON into one line, values of secret custom fields are masked.
+func (s Schema) Format(value []byte) string {
+	item := decodeItem(value)
+	parts := make([]string, 0, len(s.Fields))
+	for _, field := range s.Fields {
+		parts = append(parts, fmt.Sprintf("%s=%s", field.Name, fieldString(item[field.Name])))
+	}
+	for _, field := range ItemFields(value) {
+		v := field.Value
+		if field.Secret() {
+			v = secretMask
+		}
+		parts = append(parts, fmt.Sprintf("%s(%s)=%s", field.Name, field.Type, v))
+	}
+	return strings.Join(parts, "; ") + "."
+}
+
+// Match reports whether the item encoded into JSON contains the query (case-insensitive) in a field value
+// or in a custom field name. Values of sensitive fields and secret custom fields are not searched.
+func (s Schema) Match(value []byte, query string) bool {
+	query = strings.ToLower(query)
+	contains := func(v string) bool {
+		return strings.Contains(strings.ToLower(v), query)
+	}
+
+	item := decodeItem(value)
+	for _, field := range s.Fields {
+		if !field.Sensitive && contains(fieldString(item[field.Name])) {
+			return true
+		}
+	}
+	for _, field := range ItemFields(value) {
+		if contains(field.Name) || !field.Secret() && contains(field.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeItem decodes the item encoded into JSON keeping numbers as they are written, the item is normalized.
+func decodeItem(value []byte) map[string]any {
+	item := map[string]any{}
+	d := json.NewDecoder(bytes.NewReader(value))
+	d.UseNumber()
+	_ = d.Decode(&item)
+	normalize(item)
+	return item
+}
+
+// Normalize converts the item encoded into JSON by older clients into the current form:
+// the single tag becomes the only tag. The item in the current form is returned as it is.
+func Normalize(value []byte) []byte {
+	if _, ok := decodeRaw(value)["tag"]; !ok {
+		return value
+	}
+	normalized, err := json.Marshal(decodeItem(value))
+	if err != nil {
+		return value
+	}
+	return normalized
+}
+
+func decodeRaw(value []byte) map[string]json.RawMessage {
+	item := map[string]json.RawMessage{}
+	_ = json.Unmarshal(value, &item)
+	return item
+}
+
+func normalize(item map[string]any) {
+	tag, ok := item["tag"]
+	if !ok {
+		return
+	}
+	delete(item, "tag")
+	if tag, _ := tag.(string); tag != "" {
+		item["tags"] = addTag(listStrings(item["tags"]), tag)
+	}
+}
+
+// ItemTags returns tags of the item encoded into JSON.
+func ItemTags(value []byte) []string {
+	return listStrings(decodeItem(value)["tags"])
+}
+
+// ItemFolder returns ID of the folder of the item encoded into JSON, empty for the top level.
+func ItemFolder(value []byte) string {
+	return fieldString(decodeItem(value)["folder"])
+}
+
+// SetFolder puts the item encoded into JSON into the folder, empty folder is the top level.
+func SetFolder(value []byte, folder string) ([]byte, error) {
+	item := decodeItem(value)
+	if folder == "" {
+		delete(item, "folder")
+	} else {
+		item["folder"] = folder
+	}
+	return json.Marshal(item)
+}
+
+// RenameTag replaces the tag of the item encoded into JSON by the new one, the tag is removed if the new one is empty.
+// False is returned if the item has no such tag.
+func RenameTag(value []byte, tag string, renamed string) ([]byte, bool) {
+	item := decodeItem(value)
+	tags := listStrings(item["tags"])
+	i := slices.Index(tags, tag)
+	if i < 0 {
+		return value, false
+	}
+	tags = slices.Delete(tags, i, i+1)
+	if renamed != "" {
+		tags = addTag(tags, renamed)
+	}
+	if len(tags) > 0 {
+		item["tags"] = tags
+	} else {
+		delete(item, "tags")
+	}
+	renamedValue, err := json.Marshal(item)
+	if err != nil {
+		return value, false
+	}
+	return renamedValue, true
+}
+
+// addTag appends the tag to tags unless it is there already.
+func addTag(tags []string, tag string) []string {
+	if slices.Contains(tags, tag) {
+		return tags
+	}
+	return append(tags, tag)
+}
+
+// splitList returns comma separated values without spaces around them, empty and repeated values are dropped.
+func splitList(v string) []string {
+	var list []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = addTag(list, part)
+		}
+	}
+	return list
+}
+
+// listStrings returns the list decoded from JSON as strings.
+func listStrings(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			list = append(list, fieldString(e))
+		}
+		return list
+	}
+	return nil
+}
+
+// fieldString returns the field value decoded from JSON as a string, "" for the missing field.
+// List is returned as comma separated values.
+func fieldString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case []string, []any:
+		return strings.Join(listStrings(v), ", ")
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemas(t *testing.T) {
+	// every item type is declared once and identified by one of its fields
+	seen := map[ItemType]bool{}
+	for _, schema := range Schemas() {
+		require.False(t, seen[schema.Type], schema.Type)
+		seen[schema.Type] = true
+
+		declared := false
+		for _, field := range schema.Fields {
+			declared = declared || field.Name == schema.Identity
+		}
+		require.True(t, declared, schema.Type)
+	}
+	for _, kind := range []ItemType{CredItem, TextItem, BinItem, CardItem} {
+		require.True(t, seen[kind], kind)
+	}
+}
+
+func TestSchemaNewItem(t *testing.T) {
+	schema, ok := Lookup(CardItem)
+	require.True(t, ok)
+
+	value, err := schema.Edit(nil, map[string]string{"tags": "bank, visa, bank", "number": "4561261212345467", "exp": "12/30", "cvv": "123"}, nil)
+	require.NoError(t, err)
+	var card Card
+	require.NoError(t, json.Unmarshal(value, &card))
+	require.Equal(t, Card{Type: CardItem, Tags: []string{"bank", "visa"}, Number: "4561261212345467", Exp: "12/30", CVV: 123}, card)
+
+	require.Empty(t, schema.Validate(value))
+	require.Equal(t, "4561261212345467", schema.NaturalKey(value))
+	require.Equal(t, "123", schema.Values(value)["cvv"])
+	require.Equal(t, "tags=bank, visa; number=4561261212345467; exp=12/30; cvv=123; comment=.", schema.Format(value))
+
+	_, err = schema.Edit(nil, map[string]string{"number": "4561261212345467", "cvv": "abc"}, nil)
+	require.EqualError(t, err, "cvv should be a number")
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		item any
+		want []string
+	}{
+		{
+			name: "empty credentials",
+			item: Credentials{Type: CredItem},
+			want: []string{"login should not be empty", "password should not be empty"},
+		},
+		{
+			name: "card number digit check",
+			item: Card{Type: CardItem, Number: "1234"},
+			want: []string{"card number should pass digit check (Luhn algorithm)"},
+		},
+		{
+			name: "binary without content",
+			item: Binary{Type: BinItem, Key: "file.txt"},
+			want: []string{"file cannot be empty"},
+		},
+		{
+			name: "invalid custom fields",
+			item: Text{Type: TextItem, Key: "key", Value: "value", Fields: []CustomField{
+				{Name: "site", Type: URLCustomField, Value: "example.com"},
+				{Name: "birthday", Type: DateCustomField, Value: "01.02.2000"},
+				{Name: "activation", Type: OTPCustomField, Value: "not base32!"},
+				{Name: "site", Type: TextCustomField, Value: "example"},
+				{Type: HiddenCustomField, Value: "secret"},
+			}},
+			want: []string{
+				"custom field site should be URL with scheme and host",
+				"custom field birthday should be date YYYY-MM-DD",
+				"custom field activation should be base32 encoded secret",
+				"custom field site is repeated",
+				"custom field name should not be empty",
+			},
+		},
+		{
+			name: "valid custom fields",
+			item: Text{Type: TextItem, Key: "key", Value: "value", Fields: []CustomField{
+				{Name: "site", Type: URLCustomField, Value: "https://example.com/login"},
+				{Name: "birthday", Type: DateCustomField, Value: "2000-02-01"},
+				{Name: "activation", Type: OTPCustomField, Value: "JBSW Y3DP EHPK 3PXP"},
+				{Name: "pin", Type: HiddenCustomField, Value: "1234"},
+			}},
+			want: []string{},
+		},
+		{
+			name: "binary with file",
+			item: Binary{Type: BinItem, Key: "file.txt", File: &FileRef{ID: "file"}},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := json.Marshal(tt.item)
+			require.NoError(t, err)
+			schema, ok := Lookup(ItemType(decodeItem(value)["type"].(string)))
+			require.True(t, ok)
+			require.Equal(t, tt.want, schema.Validate(value))
+		})
+	}
+}
+
+func TestSchemaEdit(t *testing.T) {
+	schema, ok := Lookup(BinItem)
+	require.True(t, ok)
+	value, err := json.Marshal(Binary{ID: "binary-1", Type: BinItem, Tags: []string{"docs"}, Key: "file.txt",
+		File: &FileRef{ID: "file", Size: 10}, Created: 100})
+	require.NoError(t, err)
+
+	// fields not edited, file and creation time are kept
+	fields := []CustomField{{Name: "person", Type: TextCustomField, Value: "Ann"}, {Name: "pin", Type: HiddenCustomField, Value: "1234"}}
+	value, err = schema.Edit(value, map[string]string{"tags": "work", "comment": "scan"}, fields)
+	require.NoError(t, err)
+	var bin Binary
+	require.NoError(t, json.Unmarshal(value, &bin))
+	require.Equal(t, Binary{ID: "binary-1", Type: BinItem, Tags: []string{"work"}, Key: "file.txt", File: &FileRef{ID: "file", Size: 10},
+		Comment: "scan", Fields: fields, Created: 100}, bin)
+
+	require.Equal(t, "tags=work; key=file.txt; comment=scan; person(text)=Ann; pin(hidden)=******.", schema.Format(value))
+	require.True(t, schema.Match(value, "WORK"))
+	require.True(t, schema.Match(value, "ann"))
+	require.True(t, schema.Match(value, "pin"))
+	require.False(t, schema.Match(value, "1234"))
+
+	// custom fields are removed
+	value, err = schema.Edit(value, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, ItemFields(value))
+}
+
+func TestNormalize(t *testing.T) {
+	// single tag of the item saved before tags is the only tag
+	value := Normalize([]byte(`{"id":"text-1","type":"text","tag":"work","key":"key","value":"value","created":1700000000}`))
+	var text Text
+	require.NoError(t, json.Unmarshal(value, &text))
+	require.Equal(t, Text{ID: "text-1", Type: TextItem, Tags: []string{"work"}, Key: "key", Value: "value", Created: 1700000000}, text)
+	require.Equal(t, []string{"work"}, ItemTags([]byte(`{"type":"text","tag":"work"}`)))
+	require.Empty(t, ItemTags(Normalize([]byte(`{"type":"text","tag":""}`))))
+
+	current := []byte(`{"type":"text","tags":["work"]}`)
+	require.Equal(t, current, Normalize(current))
+}
+
+func TestRenameTag(t *testing.T) {
+	value := []byte(`{"type":"cred","tags":["work","bank"],"login":"login"}`)
+
+	_, ok := RenameTag(value, "home", "family")
+	require.False(t, ok)
+
+	renamed, ok := RenameTag(value, "work", "job")
+	require.True(t, ok)
+	require.Equal(t, []string{"bank", "job"}, ItemTags(renamed))
+
+	// renamed into the tag the item has already
+	renamed, ok = RenameTag(value, "work", "bank")
+	require.True(t, ok)
+	require.Equal(t, []string{"bank"}, ItemTags(renamed))
+
+	renamed, ok = RenameTag(renamed, "bank", "")
+	require.True(t, ok)
+	require.Empty(t, ItemTags(renamed))
+}
+
+func TestSetFolder(t *testing.T) {
+	value, err := SetFolder([]byte(`{"type":"cred","login":"login"}`), "folder-1")
+	require.NoError(t, err)
+	require.Equal(t, "folder-1", ItemFolder(value))
+
+	value, err = SetFolder(value, "")
+	require.NoError(t, err)
+	require.Empty(t, ItemFolder(value))
+
+	schema, ok := Lookup(FolderItem)
+	require.True(t, ok)
+	require.Equal(t, []string{`folder name should not contain "/"`}, schema.Validate([]byte(`{"type":"folder","name":"Work/Banks"}`)))
+}
+
+func TestFolderPaths(t *testing.T) {
+	paths := FolderPaths([]Folder{
+		{ID: "banks", Name: "Banks", Folder: "work"},
+		{ID: "work", Name: "Work"},
+		{ID: "lost", Name: "Lost", Folder: "deleted"},
+		// folders moved into each other on different devices
+		{ID: "a", Name: "A", Folder: "b"},
+		{ID: "b", Name: "B", Folder: "a"},
+	})
+	require.Equal(t, map[string]string{"banks": "Work/Banks", "work": "Work", "lost": "Lost", "a": "B/A", "b": "A/B"}, paths)
+}